@@ -1,6 +1,8 @@
 package common
 
 import (
+	"errors"
+	"fmt"
 	vk "github.com/goki/vulkan"
 	"log"
 )
@@ -8,15 +10,21 @@ import (
 // This Code section contains allocation helper functions. It aims to simplify the allocation of buffers and
 // images on the selected device.
 
+// Buffer is a buffer Handle together with the memory bound to it. Buffers created by an Allocator share DeviceMem with
+// other resources and start at Offset within it, buffers from CreateBuffer own their memory and Offset is 0.
 type Buffer struct {
 	Handle    vk.Buffer
 	DeviceMem vk.DeviceMemory
+	Offset    vk.DeviceSize
 	Size      vk.DeviceSize
 	Usage     vk.BufferUsageFlags
 	props     vk.MemoryPropertyFlags
+	alloc     *Allocation
 }
 
-func CreateBuffer(dc *Device, size vk.DeviceSize, usage vk.BufferUsageFlags, props vk.MemoryPropertyFlags) *Buffer {
+// CreateBuffer creates a buffer Handle and binds freshly allocated device memory to it. The buffer is tracked under the
+// label until DestroyBuffer. On failure everything created up to that point is released again.
+func CreateBuffer(dc *Device, label string, size vk.DeviceSize, usage vk.BufferUsageFlags, props vk.MemoryPropertyFlags) (*Buffer, error) {
 	// Buffer Handle of fitting Size
 	bufferInfo := vk.BufferCreateInfo{
 		SType:                 vk.StructureTypeBufferCreateInfo,
@@ -31,28 +39,43 @@ func CreateBuffer(dc *Device, size vk.DeviceSize, usage vk.BufferUsageFlags, pro
 
 	buf, err := VkCreateBuffer(dc.D, &bufferInfo, nil)
 	if err != nil {
-		log.Panicf("Failed to create vertex buffer")
+		return nil, fmt.Errorf("failed to create buffer of %d bytes: %w", size, err)
 	}
 
 	bufRequirements := ReadBufferMemoryRequirements(dc.D, buf)
+	memTypeIdx, err := findMemoryType(dc, bufRequirements.MemoryTypeBits, props)
+	if err != nil {
+		vk.DestroyBuffer(dc.D, buf, nil)
+		return nil, err
+	}
 
 	// Allocate device memory
 	allocInfo := vk.MemoryAllocateInfo{
 		SType:           vk.StructureTypeMemoryAllocateInfo,
 		PNext:           nil,
 		AllocationSize:  bufRequirements.Size,
-		MemoryTypeIndex: findMemoryType(dc, bufRequirements.MemoryTypeBits, props),
+		MemoryTypeIndex: memTypeIdx,
 	}
 	deviceMem, err := VkAllocateMemory(dc.D, &allocInfo, nil)
 	if err != nil {
-		log.Panicf("Failed to allocate vertex buffer memory")
+		vk.DestroyBuffer(dc.D, buf, nil)
+		return nil, fmt.Errorf("failed to allocate %d bytes of buffer memory: %w", bufRequirements.Size, err)
 	}
 
 	// Associate allocated memory with buffer Handle
 	err = VkBindBufferMemory(dc.D, buf, deviceMem, 0)
 	if err != nil {
-		log.Panicf("Failed to bind device memory to buffer Handle")
+		vk.DestroyBuffer(dc.D, buf, nil)
+		vk.FreeMemory(dc.D, deviceMem, nil)
+		return nil, fmt.Errorf("failed to bind device memory to buffer Handle: %w", err)
 	}
+	dc.Resources.track(ObjectHandle(buf), TrackedResource{
+		Kind:       "buffer",
+		Label:      label,
+		Size:       bufRequirements.Size,
+		MemTypeIdx: memTypeIdx,
+		HeapIdx:    dc.PdMemoryProps.MemoryTypes[memTypeIdx].HeapIndex,
+	})
 
 	return &Buffer{
 		Handle:    buf,
@@ -60,36 +83,50 @@ func CreateBuffer(dc *Device, size vk.DeviceSize, usage vk.BufferUsageFlags, pro
 		Size:      size,
 		Usage:     usage,
 		props:     props,
-	}
+	}, nil
 }
 
 // CopyToDeviceBuffer is a convenience method to simplify the process of mapping device memory to CPU memory,
 // copy bytes over to the GPU and unmapping the memory again. This requires the buffer to:
 // - have the stated Usage: vk.BufferUsageTransferSrcBit
 // - be: vk.MemoryPropertyHostVisibleBit and vk.MemoryPropertyHostCoherentBit
-func CopyToDeviceBuffer(dc *Device, deviceBuf *Buffer, payload []byte) {
+func CopyToDeviceBuffer(dc *Device, deviceBuf *Buffer, payload []byte) error {
 	// Check the memory is accessible by the CPU
 	hasTransferUsage := deviceBuf.Usage&vk.BufferUsageFlags(vk.BufferUsageTransferSrcBit) != 0
 	isHostVisCoh := deviceBuf.props&vk.MemoryPropertyFlags(vk.MemoryPropertyHostVisibleBit|vk.MemoryPropertyHostCoherentBit) != 0
 	if !(hasTransferUsage && isHostVisCoh) {
-		log.Panicf("Cant copy to device buffer as buffer is not suitable")
+		return errors.New("cant copy to device buffer as buffer is not suitable")
 	}
 	// check for Size mismatches - this function only allows to copy a "full buffer" worth of payload starting at offset = 0
 	if deviceBuf.Size != vk.DeviceSize(uint64(len(payload))) {
-		log.Panicf("Cant copy to device buffer. Buffer and payload not of equal Size.")
+		return fmt.Errorf("cant copy to device buffer, buffer (%d bytes) and payload (%d bytes) not of equal Size", deviceBuf.Size, len(payload))
+	}
+	// Sub-allocated buffers live in a block that stays mapped, mapping it again would be invalid
+	if deviceBuf.alloc != nil {
+		bCopied := vk.Memcopy(deviceBuf.alloc.Mapped(), payload)
+		log.Printf("copied %d bytes from cpu to device", bCopied)
+		return nil
 	}
 	// Map -> copy -> Unmap
 	pData, err := VkMapMemory(dc.D, deviceBuf.DeviceMem, 0, deviceBuf.Size, 0)
 	if err != nil {
-		log.Panicf("Failed to map device memory")
+		return fmt.Errorf("failed to map device memory: %w", err)
 	}
 	bCopied := vk.Memcopy(pData, payload)
 	log.Printf("copied %d bytes from cpu to device", bCopied)
 	vk.UnmapMemory(dc.D, deviceBuf.DeviceMem)
+	return nil
 }
 
+// DestroyBuffer destroys the buffer Handle and releases its memory, returning it to the Allocator if it came from one
 func DestroyBuffer(dc *Device, buffer *Buffer) {
+	dc.Resources.untrack(ObjectHandle(buffer.Handle))
 	vk.DestroyBuffer(dc.D, buffer.Handle, nil)
+	if buffer.alloc != nil {
+		buffer.alloc.Free()
+		buffer.alloc = nil
+		return
+	}
 	vk.FreeMemory(dc.D, buffer.DeviceMem, nil)
 }
 
@@ -98,7 +135,9 @@ type TextureImage struct {
 	deviceMem vk.DeviceMemory
 }
 
-func CreateImage(dc *Device, w uint32, h uint32, format vk.Format, tiling vk.ImageTiling, usage vk.ImageUsageFlags, props vk.MemoryPropertyFlags) (vk.Image, vk.DeviceMemory) {
+// CreateImage creates a 2D image and binds freshly allocated device memory to it. The image is tracked under the label
+// until DestroyImage. On failure everything created up to that point is released again.
+func CreateImage(dc *Device, label string, w uint32, h uint32, format vk.Format, tiling vk.ImageTiling, usage vk.ImageUsageFlags, props vk.MemoryPropertyFlags) (vk.Image, vk.DeviceMemory, error) {
 	imageInfo := &vk.ImageCreateInfo{
 		SType:     vk.StructureTypeImageCreateInfo,
 		PNext:     nil,
@@ -122,34 +161,58 @@ func CreateImage(dc *Device, w uint32, h uint32, format vk.Format, tiling vk.Ima
 	}
 	img, err := VkCreateImage(dc.D, imageInfo, nil)
 	if err != nil {
-		log.Panicf("failed to create image!")
+		return nil, nil, fmt.Errorf("failed to create %dx%d image: %w", w, h, err)
 	}
 
 	memRequirements := ReadImageMemoryRequirements(dc.D, img)
+	memTypeIdx, err := findMemoryType(dc, memRequirements.MemoryTypeBits, props)
+	if err != nil {
+		vk.DestroyImage(dc.D, img, nil)
+		return nil, nil, err
+	}
 	allocInfo := &vk.MemoryAllocateInfo{
 		SType:           vk.StructureTypeMemoryAllocateInfo,
 		PNext:           nil,
 		AllocationSize:  memRequirements.Size,
-		MemoryTypeIndex: findMemoryType(dc, memRequirements.MemoryTypeBits, props),
+		MemoryTypeIndex: memTypeIdx,
 	}
 	imgMemory, err := VkAllocateMemory(dc.D, allocInfo, nil)
 	if err != nil {
-		log.Panicf("Failed to allocate image device memory")
+		vk.DestroyImage(dc.D, img, nil)
+		return nil, nil, fmt.Errorf("failed to allocate %d bytes of image memory: %w", memRequirements.Size, err)
+	}
+	err = vk.Error(vk.BindImageMemory(dc.D, img, imgMemory, 0))
+	if err != nil {
+		vk.DestroyImage(dc.D, img, nil)
+		vk.FreeMemory(dc.D, imgMemory, nil)
+		return nil, nil, fmt.Errorf("failed to bind device memory to image: %w", err)
 	}
-	vk.BindImageMemory(dc.D, img, imgMemory, 0)
-	return img, imgMemory
+	dc.Resources.track(ObjectHandle(img), TrackedResource{
+		Kind:       "image",
+		Label:      label,
+		Size:       memRequirements.Size,
+		MemTypeIdx: memTypeIdx,
+		HeapIdx:    dc.PdMemoryProps.MemoryTypes[memTypeIdx].HeapIndex,
+	})
+	return img, imgMemory, nil
+}
+
+// DestroyImage destroys an image created by CreateImage and frees its memory. Null handles are ignored.
+func DestroyImage(dc *Device, img vk.Image, mem vk.DeviceMemory) {
+	dc.Resources.untrack(ObjectHandle(img))
+	vk.DestroyImage(dc.D, img, nil)
+	vk.FreeMemory(dc.D, mem, nil)
 }
 
-func findMemoryType(dc *Device, typeFilter uint32, propFlags vk.MemoryPropertyFlags) uint32 {
+func findMemoryType(dc *Device, typeFilter uint32, propFlags vk.MemoryPropertyFlags) (uint32, error) {
 	//log.Printf("Got memory properties: %v", toStringPhysicalDeviceMemProps(c.pdMemoryProps))
 	for i := uint32(0); i < dc.PdMemoryProps.MemoryTypeCount; i++ {
 		ofType := (typeFilter & (1 << i)) > 0
 		hasProperties := dc.PdMemoryProps.MemoryTypes[i].PropertyFlags&propFlags == propFlags
 		if ofType && hasProperties {
 			log.Printf("Found memory type for buffer -> %d on heap %d", i, dc.PdMemoryProps.MemoryTypes[i].HeapIndex)
-			return i
+			return i, nil
 		}
 	}
-	log.Panicf("Failed to find suitable memory type")
-	return 0
+	return 0, fmt.Errorf("failed to find suitable memory type for filter %b with properties %b", typeFilter, propFlags)
 }
@@ -0,0 +1,68 @@
+package common
+
+import (
+	"fmt"
+
+	vk "github.com/goki/vulkan"
+)
+
+// BufferPool is a single large device local buffer handed out in ranges of equally sized elements, e.g.: the shared
+// vertex and index buffers many static meshes are packed into, so they can be drawn without rebinding buffers. Ranges
+// are tracked in element units with the same first fit free list as a memoryBlock.
+type BufferPool struct {
+	Buffer *Buffer
+	stride vk.DeviceSize
+	ranges *memoryBlock
+}
+
+// NewBufferPool creates the pool's buffer with room for capacity elements of stride bytes each. The buffer is a copy
+// destination besides the given usage, it is filled by copying into the ranges.
+func NewBufferPool(a *Allocator, label string, stride vk.DeviceSize, capacity vk.DeviceSize, usage vk.BufferUsageFlags) (*BufferPool, error) {
+	buf, err := a.CreateBuffer(
+		label,
+		stride*capacity,
+		vk.BufferUsageFlags(vk.BufferUsageTransferDstBit)|usage,
+		vk.MemoryPropertyFlags(vk.MemoryPropertyDeviceLocalBit),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create buffer pool '%s': %w", label, err)
+	}
+	p := newBufferPool(stride, capacity)
+	p.Buffer = buf
+	return p, nil
+}
+
+func newBufferPool(stride vk.DeviceSize, capacity vk.DeviceSize) *BufferPool {
+	return &BufferPool{stride: stride, ranges: newMemoryBlock(capacity)}
+}
+
+// Alloc reserves count elements and returns the index of the first one. Its byte offset in Buffer is Offset(first).
+func (p *BufferPool) Alloc(count int) (int, error) {
+	first, ok := p.ranges.alloc(vk.DeviceSize(count), 1)
+	if !ok {
+		_, largest := p.ranges.freeSize()
+		return 0, fmt.Errorf("no room for %d elements in buffer pool, largest free range holds %d", count, largest)
+	}
+	return int(first), nil
+}
+
+// Free returns a range handed out by Alloc. Frames in flight must not use it anymore.
+func (p *BufferPool) Free(first int, count int) {
+	p.ranges.release(vk.DeviceSize(first), vk.DeviceSize(count))
+}
+
+// Offset returns the byte offset of an element within Buffer
+func (p *BufferPool) Offset(idx int) vk.DeviceSize {
+	return vk.DeviceSize(idx) * p.stride
+}
+
+// Available returns the number of free elements in total and the largest number that can be allocated at once
+func (p *BufferPool) Available() (total int, largest int) {
+	t, l := p.ranges.freeSize()
+	return int(t), int(l)
+}
+
+// Destroy releases the pool's buffer, no frame in flight may use it anymore
+func (p *BufferPool) Destroy(dc *Device) {
+	DestroyBuffer(dc, p.Buffer)
+}
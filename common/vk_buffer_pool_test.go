@@ -0,0 +1,22 @@
+package common
+
+import "testing"
+
+func TestBufferPoolReusesFreedRanges(t *testing.T) {
+	p := newBufferPool(32, 100)
+	a, _ := p.Alloc(40)
+	b, _ := p.Alloc(40)
+	if a != 0 || b != 40 || p.Offset(b) != 40*32 {
+		t.Fatalf("expected ranges at 0 and 40, got %d and %d", a, b)
+	}
+	if _, err := p.Alloc(30); err == nil {
+		t.Fatalf("expected allocation beyond the capacity to fail")
+	}
+	p.Free(a, 40)
+	if c, err := p.Alloc(30); err != nil || c != 0 {
+		t.Fatalf("expected freed range to be reused at 0, got %d (%v)", c, err)
+	}
+	if total, largest := p.Available(); total != 30 || largest != 20 {
+		t.Fatalf("expected 30 free elements, at most 20 at once, got %d and %d", total, largest)
+	}
+}
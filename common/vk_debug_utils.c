@@ -0,0 +1,49 @@
+#include "vk_debug_utils.h"
+#include "_cgo_export.h"
+
+int loadDebugUtilsFuncs(void* getInstanceProcAddr, VkInstance instance, DebugUtilsFuncs* funcs) {
+    PFN_getInstanceProcAddr getProcAddr = (PFN_getInstanceProcAddr)getInstanceProcAddr;
+    funcs->createMessenger = (PFN_createDebugUtilsMessenger)getProcAddr(instance, "vkCreateDebugUtilsMessengerEXT");
+    funcs->destroyMessenger = (PFN_destroyDebugUtilsMessenger)getProcAddr(instance, "vkDestroyDebugUtilsMessengerEXT");
+    funcs->setObjectName = (PFN_setDebugUtilsObjectName)getProcAddr(instance, "vkSetDebugUtilsObjectNameEXT");
+    return funcs->createMessenger != NULL && funcs->destroyMessenger != NULL && funcs->setObjectName != NULL;
+}
+
+// debugUtilsCallback is called by the layers, possibly from threads unknown to Go. The message is handed over as plain
+// strings, since the callback data is only valid for the duration of the call.
+static VkBool32 DEBUG_UTILS_CALL debugUtilsCallback(uint32_t severity, VkDebugUtilsMessageTypeFlagsEXT types,
+                                                    const DebugUtilsCallbackData* data, void* userData) {
+    goDebugUtilsMessage((uint32_t)severity, (uint32_t)types, (char*)data->pMessageIdName, data->messageIdNumber,
+                        (char*)data->pMessage, (uintptr_t)userData);
+    // The application must not abort the call that triggered the message, see the spec of the callback
+    return VK_FALSE;
+}
+
+VkResult createDebugUtilsMessenger(DebugUtilsFuncs* funcs, VkInstance instance,
+                                   VkDebugUtilsMessageSeverityFlagsEXT severities,
+                                   VkDebugUtilsMessageTypeFlagsEXT types, uintptr_t userData,
+                                   VkDebugUtilsMessengerEXT* messenger) {
+    DebugUtilsMessengerCreateInfo createInfo = {
+        .sType = VK_STRUCTURE_TYPE_DEBUG_UTILS_MESSENGER_CREATE_INFO_EXT,
+        .messageSeverity = severities,
+        .messageType = types,
+        .pfnUserCallback = debugUtilsCallback,
+        .pUserData = (void*)userData,
+    };
+    return funcs->createMessenger(instance, &createInfo, NULL, messenger);
+}
+
+void destroyDebugUtilsMessenger(DebugUtilsFuncs* funcs, VkInstance instance, VkDebugUtilsMessengerEXT messenger) {
+    funcs->destroyMessenger(instance, messenger, NULL);
+}
+
+VkResult setDebugUtilsObjectName(DebugUtilsFuncs* funcs, VkDevice device, VkObjectType type, uint64_t handle,
+                                 const char* name) {
+    DebugUtilsObjectNameInfo nameInfo = {
+        .sType = VK_STRUCTURE_TYPE_DEBUG_UTILS_OBJECT_NAME_INFO_EXT,
+        .objectType = type,
+        .objectHandle = handle,
+        .pObjectName = name,
+    };
+    return funcs->setObjectName(device, &nameInfo);
+}
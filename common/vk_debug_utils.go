@@ -0,0 +1,216 @@
+package common
+
+/*
+#include "vk_debug_utils.h"
+#include <stdlib.h>
+*/
+import "C"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime/cgo"
+	"strings"
+	"sync"
+	"unsafe"
+
+	vk "github.com/goki/vulkan"
+)
+
+// DEBUG_MESSAGE_SEVERITIES and DEBUG_MESSAGE_TYPES select what the messenger receives. Everything is requested, the
+// logger decides what is actually printed (verbose messages map to slog.LevelDebug and are hidden by default).
+const DEBUG_MESSAGE_SEVERITIES = vk.DebugUtilsMessageSeverityVerboseBit | vk.DebugUtilsMessageSeverityInfoBit |
+	vk.DebugUtilsMessageSeverityWarningBit | vk.DebugUtilsMessageSeverityErrorBit
+const DEBUG_MESSAGE_TYPES = vk.DebugUtilsMessageTypeGeneralBit | vk.DebugUtilsMessageTypeValidationBit |
+	vk.DebugUtilsMessageTypePerformanceBit
+
+// DebugMessage is a single message reported through VK_EXT_debug_utils, usually by the validation layers
+type DebugMessage struct {
+	Severity vk.DebugUtilsMessageSeverityFlagBits
+	Types    vk.DebugUtilsMessageTypeFlags
+	// Name and number of the check that triggered the message (VUID), may be empty for general messages
+	ID     string
+	Number int32
+	Text   string
+}
+
+// DebugMessenger routes the messages of the validation layers into a structured logger instead of having the layers
+// print them on their own. In strict mode, error messages are collected as well, so they can be turned into failures
+// (see: Err). The messenger also names Vulkan objects, names show up in messages and debugging tools like RenderDoc.
+//
+// All methods may be called on a nil messenger, which is what the window has if validation is disabled. Naming and
+// error collection are no-ops then.
+type DebugMessenger struct {
+	inst      vk.Instance
+	funcs     C.DebugUtilsFuncs
+	messenger C.VkDebugUtilsMessengerEXT
+	self      cgo.Handle
+
+	Logger *slog.Logger
+
+	mu     sync.Mutex
+	strict bool
+	errs   []error
+}
+
+// NewDebugMessenger registers a messenger on the instance, which needs to be created with the VK_EXT_debug_utils
+// extension enabled. The extension's functions are loaded through getInstanceProcAddr, since the go bindings don't
+// provide them. Messages are logged to slog.Default until a different Logger is set.
+func NewDebugMessenger(inst vk.Instance, getInstanceProcAddr unsafe.Pointer) (*DebugMessenger, error) {
+	d := &DebugMessenger{
+		inst:   inst,
+		Logger: slog.Default(),
+	}
+	if C.loadDebugUtilsFuncs(getInstanceProcAddr, d.cInstance(), &d.funcs) == 0 {
+		return nil, fmt.Errorf("failed to load the functions of %s", vk.ExtDebugUtilsExtensionName)
+	}
+	// The layers only get an integer handle to find their way back to the messenger, Go memory must not be kept in C
+	d.self = cgo.NewHandle(d)
+	res := vk.Result(C.createDebugUtilsMessenger(
+		&d.funcs,
+		d.cInstance(),
+		C.VkDebugUtilsMessageSeverityFlagsEXT(DEBUG_MESSAGE_SEVERITIES),
+		C.VkDebugUtilsMessageTypeFlagsEXT(DEBUG_MESSAGE_TYPES),
+		C.uintptr_t(d.self),
+		&d.messenger,
+	))
+	if err := vk.Error(res); err != nil {
+		d.self.Delete()
+		return nil, fmt.Errorf("failed to create debug messenger: %w", err)
+	}
+	return d, nil
+}
+
+// Destroy unregisters the messenger, it has to be called before the instance is destroyed
+func (d *DebugMessenger) Destroy() {
+	if d == nil {
+		return
+	}
+	C.destroyDebugUtilsMessenger(&d.funcs, d.cInstance(), d.messenger)
+	d.self.Delete()
+}
+
+// SetStrict enables collecting error messages, which is meant for tests and CI runs where any validation error
+// should fail the run. Errors reported before enabling strict mode are not collected.
+func (d *DebugMessenger) SetStrict(strict bool) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.strict = strict
+}
+
+// Err returns all error messages collected in strict mode since the last call and resets the collection. It returns
+// nil if there were none, or if strict mode is disabled.
+func (d *DebugMessenger) Err() error {
+	if d == nil {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	err := errors.Join(d.errs...)
+	d.errs = nil
+	return err
+}
+
+// SetObjectName attaches a name to the object of the given type and raw handle, see: ObjectHandle. Naming is a
+// debugging aid only, so a failure is logged rather than returned.
+func (d *DebugMessenger) SetObjectName(device vk.Device, objType vk.ObjectType, handle uint64, name string) {
+	if d == nil || handle == 0 {
+		return
+	}
+	cName := C.CString(name)
+	defer C.free(unsafe.Pointer(cName))
+	cDevice := *(*C.VkDevice)(unsafe.Pointer(&device))
+	res := vk.Result(C.setDebugUtilsObjectName(&d.funcs, cDevice, C.VkObjectType(objType), C.uint64_t(handle), cName))
+	if err := vk.Error(res); err != nil {
+		d.Logger.Warn("Failed to name Vulkan object", "name", name, "type", objType, "err", err)
+	}
+}
+
+// NameObject is SetObjectName for any handle type of the go bindings, e.g.:
+//
+//	NameObject(d, device.D, vk.ObjectTypeBuffer, buf.Handle, "cube vertices")
+func NameObject[T any](d *DebugMessenger, device vk.Device, objType vk.ObjectType, handle T, name string) {
+	d.SetObjectName(device, objType, ObjectHandle(handle), name)
+}
+
+// ObjectHandle converts a handle of the go bindings into the raw 64-bit value used by the debug utils. Dispatchable
+// handles are pointers, which may only be 32 bit wide, non-dispatchable handles are always 64 bit.
+func ObjectHandle[T any](handle T) uint64 {
+	if unsafe.Sizeof(handle) == 4 {
+		return uint64(*(*uint32)(unsafe.Pointer(&handle)))
+	}
+	return *(*uint64)(unsafe.Pointer(&handle))
+}
+
+func (d *DebugMessenger) cInstance() C.VkInstance {
+	return *(*C.VkInstance)(unsafe.Pointer(&d.inst))
+}
+
+// handle logs a message received from the layers and collects it if it is an error in strict mode. It may be called
+// from any thread the driver or layers use.
+func (d *DebugMessenger) handle(msg DebugMessage) {
+	d.Logger.Log(context.Background(), debugLogLevel(msg.Severity), msg.Text,
+		"type", debugTypeNames(msg.Types),
+		"id", msg.ID,
+		"number", msg.Number,
+	)
+	if msg.Severity&vk.DebugUtilsMessageSeverityErrorBit == 0 {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.strict {
+		d.errs = append(d.errs, fmt.Errorf("%s: %s", msg.ID, msg.Text))
+	}
+}
+
+//export goDebugUtilsMessage
+func goDebugUtilsMessage(severity, types C.uint32_t, id *C.char, number C.int32_t, text *C.char, self C.uintptr_t) {
+	d, ok := cgo.Handle(self).Value().(*DebugMessenger)
+	if !ok {
+		return
+	}
+	d.handle(DebugMessage{
+		Severity: vk.DebugUtilsMessageSeverityFlagBits(severity),
+		Types:    vk.DebugUtilsMessageTypeFlags(types),
+		ID:       C.GoString(id),
+		Number:   int32(number),
+		Text:     C.GoString(text),
+	})
+}
+
+// debugLogLevel maps the severity of a message onto the closest log level
+func debugLogLevel(severity vk.DebugUtilsMessageSeverityFlagBits) slog.Level {
+	switch {
+	case severity&vk.DebugUtilsMessageSeverityErrorBit != 0:
+		return slog.LevelError
+	case severity&vk.DebugUtilsMessageSeverityWarningBit != 0:
+		return slog.LevelWarn
+	case severity&vk.DebugUtilsMessageSeverityInfoBit != 0:
+		return slog.LevelInfo
+	default:
+		return slog.LevelDebug
+	}
+}
+
+// debugTypeNames lists the message types set in the flags, e.g.: "validation|performance"
+func debugTypeNames(types vk.DebugUtilsMessageTypeFlags) string {
+	var names []string
+	if types&vk.DebugUtilsMessageTypeFlags(vk.DebugUtilsMessageTypeGeneralBit) != 0 {
+		names = append(names, "general")
+	}
+	if types&vk.DebugUtilsMessageTypeFlags(vk.DebugUtilsMessageTypeValidationBit) != 0 {
+		names = append(names, "validation")
+	}
+	if types&vk.DebugUtilsMessageTypeFlags(vk.DebugUtilsMessageTypePerformanceBit) != 0 {
+		names = append(names, "performance")
+	}
+	if types&vk.DebugUtilsMessageTypeFlags(vk.DebugUtilsMessageTypeDeviceAddressBindingBit) != 0 {
+		names = append(names, "device-address-binding")
+	}
+	return strings.Join(names, "|")
+}
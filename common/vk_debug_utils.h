@@ -0,0 +1,92 @@
+#ifndef VK_DEBUG_UTILS_H
+#define VK_DEBUG_UTILS_H
+
+// The go bindings ship the VK_EXT_debug_utils structs but none of its functions. These helpers load the extension's
+// functions from the instance and call them, the messenger callback forwards every message to the Go side.
+//
+// The few Vulkan types needed are declared here, matching the layouts of vulkan_core.h, instead of including the
+// Vulkan headers. Like the go bindings, which vendor their headers, this builds without a Vulkan SDK installed.
+
+#include <stddef.h>
+#include <stdint.h>
+
+#if defined(_WIN32)
+#define DEBUG_UTILS_CALL __stdcall
+#else
+#define DEBUG_UTILS_CALL
+#endif
+
+typedef struct VkInstance_T* VkInstance;
+typedef struct VkDevice_T* VkDevice;
+// Non-dispatchable handles are 64 bit wide on every platform
+typedef uint64_t VkDebugUtilsMessengerEXT;
+typedef int32_t VkResult;
+typedef int32_t VkObjectType;
+typedef uint32_t VkBool32;
+typedef uint32_t VkDebugUtilsMessageSeverityFlagsEXT;
+typedef uint32_t VkDebugUtilsMessageTypeFlagsEXT;
+
+#define VK_FALSE 0
+#define VK_STRUCTURE_TYPE_DEBUG_UTILS_OBJECT_NAME_INFO_EXT 1000128000
+#define VK_STRUCTURE_TYPE_DEBUG_UTILS_MESSENGER_CREATE_INFO_EXT 1000128004
+
+// Only the leading members the callback reads, the layers pass the full struct
+typedef struct DebugUtilsCallbackData {
+    int32_t sType;
+    const void* pNext;
+    uint32_t flags;
+    const char* pMessageIdName;
+    int32_t messageIdNumber;
+    const char* pMessage;
+} DebugUtilsCallbackData;
+
+typedef VkBool32(DEBUG_UTILS_CALL* DebugUtilsCallback)(uint32_t severity, VkDebugUtilsMessageTypeFlagsEXT types,
+                                                       const DebugUtilsCallbackData* data, void* userData);
+
+typedef struct DebugUtilsMessengerCreateInfo {
+    int32_t sType;
+    const void* pNext;
+    uint32_t flags;
+    VkDebugUtilsMessageSeverityFlagsEXT messageSeverity;
+    VkDebugUtilsMessageTypeFlagsEXT messageType;
+    DebugUtilsCallback pfnUserCallback;
+    void* pUserData;
+} DebugUtilsMessengerCreateInfo;
+
+typedef struct DebugUtilsObjectNameInfo {
+    int32_t sType;
+    const void* pNext;
+    VkObjectType objectType;
+    uint64_t objectHandle;
+    const char* pObjectName;
+} DebugUtilsObjectNameInfo;
+
+typedef void*(DEBUG_UTILS_CALL* PFN_getInstanceProcAddr)(VkInstance instance, const char* name);
+typedef VkResult(DEBUG_UTILS_CALL* PFN_createDebugUtilsMessenger)(VkInstance instance,
+                                                                  const DebugUtilsMessengerCreateInfo* createInfo,
+                                                                  const void* allocator,
+                                                                  VkDebugUtilsMessengerEXT* messenger);
+typedef void(DEBUG_UTILS_CALL* PFN_destroyDebugUtilsMessenger)(VkInstance instance, VkDebugUtilsMessengerEXT messenger,
+                                                                const void* allocator);
+typedef VkResult(DEBUG_UTILS_CALL* PFN_setDebugUtilsObjectName)(VkDevice device,
+                                                                const DebugUtilsObjectNameInfo* nameInfo);
+
+typedef struct DebugUtilsFuncs {
+    PFN_createDebugUtilsMessenger createMessenger;
+    PFN_destroyDebugUtilsMessenger destroyMessenger;
+    PFN_setDebugUtilsObjectName setObjectName;
+} DebugUtilsFuncs;
+
+int loadDebugUtilsFuncs(void* getInstanceProcAddr, VkInstance instance, DebugUtilsFuncs* funcs);
+
+VkResult createDebugUtilsMessenger(DebugUtilsFuncs* funcs, VkInstance instance,
+                                   VkDebugUtilsMessageSeverityFlagsEXT severities,
+                                   VkDebugUtilsMessageTypeFlagsEXT types, uintptr_t userData,
+                                   VkDebugUtilsMessengerEXT* messenger);
+
+void destroyDebugUtilsMessenger(DebugUtilsFuncs* funcs, VkInstance instance, VkDebugUtilsMessengerEXT messenger);
+
+VkResult setDebugUtilsObjectName(DebugUtilsFuncs* funcs, VkDevice device, VkObjectType type, uint64_t handle,
+                                 const char* name);
+
+#endif
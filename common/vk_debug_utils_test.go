@@ -0,0 +1,45 @@
+package common
+
+import (
+	"log/slog"
+	"testing"
+
+	vk "github.com/goki/vulkan"
+)
+
+func TestDebugLogLevel(t *testing.T) {
+	tests := []struct {
+		severity vk.DebugUtilsMessageSeverityFlagBits
+		expected slog.Level
+	}{
+		{vk.DebugUtilsMessageSeverityVerboseBit, slog.LevelDebug},
+		{vk.DebugUtilsMessageSeverityInfoBit, slog.LevelInfo},
+		{vk.DebugUtilsMessageSeverityWarningBit, slog.LevelWarn},
+		{vk.DebugUtilsMessageSeverityErrorBit, slog.LevelError},
+		// The most severe bit wins if several are set
+		{vk.DebugUtilsMessageSeverityInfoBit | vk.DebugUtilsMessageSeverityErrorBit, slog.LevelError},
+		{0, slog.LevelDebug},
+	}
+	for _, tt := range tests {
+		if level := debugLogLevel(tt.severity); level != tt.expected {
+			t.Errorf("expected severity %#x to map to %v, got %v", tt.severity, tt.expected, level)
+		}
+	}
+}
+
+func TestDebugTypeNames(t *testing.T) {
+	tests := []struct {
+		types    vk.DebugUtilsMessageTypeFlags
+		expected string
+	}{
+		{0, ""},
+		{vk.DebugUtilsMessageTypeFlags(vk.DebugUtilsMessageTypeGeneralBit), "general"},
+		{vk.DebugUtilsMessageTypeFlags(DEBUG_MESSAGE_TYPES), "general|validation|performance"},
+		{vk.DebugUtilsMessageTypeFlags(vk.DebugUtilsMessageTypePerformanceBit | vk.DebugUtilsMessageTypeDeviceAddressBindingBit), "performance|device-address-binding"},
+	}
+	for _, tt := range tests {
+		if names := debugTypeNames(tt.types); names != tt.expected {
+			t.Errorf("expected types %#x to be named '%s', got '%s'", tt.types, tt.expected, names)
+		}
+	}
+}
@@ -1,17 +1,13 @@
 package common
 
 import (
+	"errors"
+	"fmt"
 	"log"
 
 	vk "github.com/goki/vulkan"
 )
 
-const ENABLE_VALIDATION = true
-
-var VALIDATION_LAYERS = []string{
-	"VK_LAYER_KHRONOS_validation",
-}
-
 var DEVICE_EXTENSIONS = []string{
 	"VK_KHR_swapchain",
 }
@@ -24,33 +20,51 @@ type Device struct {
 	PdProps       vk.PhysicalDeviceProperties
 	PdMemoryProps vk.PhysicalDeviceMemoryProperties
 	QFamilies     QueueFamilyIndices
+	// Features enabled on the logical device, optional ones are only set if the physical device supports them
+	Features vk.PhysicalDeviceFeatures
 
 	D         vk.Device
 	GraphicsQ vk.Queue
 	PresentQ  vk.Queue
+	TransferQ vk.Queue
+
+	// Every buffer and image created through common on this device, until it is destroyed
+	Resources *ResourceTracker
 }
 
 // NewDevice constructs a new Device struct as described above. This includes device selection and is therefore,
 // application specific. Requirements for the GPU we want to work with, are currently (23/03/25) a minimal set imposing
 // only a few common constraint like: Having a graphics and present queue, allowing for anisotropic filtering and
-// supporting basic validation layers.
-func NewDevice(w *Window) *Device {
-	dc := &Device{}
-	dc.selectPhysicalDevice(w.Inst, w.Surf)
-	dc.createLogicalDevice()
-	return dc
+// supporting basic validation layers. The validation layers are enabled on the device as well, for implementations that
+// still distinguish between instance and device layers. Pass no layers to disable validation.
+func NewDevice(w *Window, validationLayers []string) (*Device, error) {
+	dc := &Device{Resources: NewResourceTracker()}
+	if err := dc.selectPhysicalDevice(w.Inst, w.Surf); err != nil {
+		return nil, err
+	}
+	if err := dc.createLogicalDevice(validationLayers); err != nil {
+		return nil, err
+	}
+	return dc, nil
 }
 
 // Destroy is a convenience function wrapping the vk.DestroyDevice used to destroy the logical device which is the
-// actual resource we need to destroy on teardown.
+// actual resource we need to destroy on teardown. Buffers and images still alive at this point were never destroyed by
+// their owner, they are listed with their creation stack.
 func (dc *Device) Destroy() {
+	if leaks := dc.Resources.LogLeaks(); leaks > 0 {
+		log.Printf("Destroying device with %d leaked resources", leaks)
+	}
 	vk.DestroyDevice(dc.D, nil)
 }
 
 // ToDo: Reading out the physical device properties (multiple times) is very clunky here. This could/should be
 // refactored once device selection becomes more stringent.
-func (dc *Device) selectPhysicalDevice(in *vk.Instance, su *vk.Surface) {
-	availableDevices := ReadPhysicalDevices(*in)
+func (dc *Device) selectPhysicalDevice(in *vk.Instance, su *vk.Surface) error {
+	availableDevices, err := ReadPhysicalDevices(*in)
+	if err != nil {
+		return err
+	}
 	var pd vk.PhysicalDevice
 	for i := range availableDevices {
 		if isDeviceSuitable(availableDevices[i], su) {
@@ -59,7 +73,7 @@ func (dc *Device) selectPhysicalDevice(in *vk.Instance, su *vk.Surface) {
 		}
 	}
 	if pd == nil {
-		log.Panicf("No suitable physical device (GPU) found")
+		return errors.New("no suitable physical device (GPU) found")
 	}
 	log.Printf("Found suitable device")
 	dc.PD = pd
@@ -67,13 +81,14 @@ func (dc *Device) selectPhysicalDevice(in *vk.Instance, su *vk.Surface) {
 	// Also set related member variables for dc.physicalDevice as they are needed later
 	qf, err := findQueueFamilies(dc.PD, *su)
 	if err != nil {
-		log.Panicf("Failed to read queue families from selected device due to: %s", err)
+		return fmt.Errorf("failed to read queue families from selected device: %w", err)
 	}
 	dc.QFamilies = *qf
 	dc.PdProps = ReadPhysicalDeviceProperties(dc.PD)
 	// this is the easiest spot to deref this at the moment
 	dc.PdProps.Limits.Deref()
 	dc.PdMemoryProps = ReadDeviceMemoryProperties(dc.PD)
+	return nil
 }
 
 func isDeviceSuitable(pd vk.PhysicalDevice, su *vk.Surface) bool {
@@ -106,12 +121,20 @@ func isDeviceSuitable(pd vk.PhysicalDevice, su *vk.Surface) bool {
 	return isSuitable
 }
 
-func (dc *Device) createLogicalDevice() {
-	queueInfos := dc.QFamilies.toQueueCreateInfos()
-	// We explicitly enable anisotropic sampling, more interesting stuff could be added here
+func (dc *Device) createLogicalDevice(validationLayers []string) error {
+	queueInfos, err := dc.QFamilies.toQueueCreateInfos()
+	if err != nil {
+		return err
+	}
+	// We explicitly enable anisotropic sampling. Indirect draws of many meshes at once and their draw IDs passed as first
+	// instance are optional, there are fallbacks for devices without them.
+	pdFeatures := ReadPhysicalDeviceFeatures(dc.PD)
 	deviceFeatures := vk.PhysicalDeviceFeatures{
-		SamplerAnisotropy: vk.True,
+		SamplerAnisotropy:         vk.True,
+		MultiDrawIndirect:         pdFeatures.MultiDrawIndirect,
+		DrawIndirectFirstInstance: pdFeatures.DrawIndirectFirstInstance,
 	}
+	dc.Features = deviceFeatures
 	deviceCreatInfo := &vk.DeviceCreateInfo{
 		SType:                   vk.StructureTypeDeviceCreateInfo,
 		PNext:                   nil,
@@ -124,28 +147,40 @@ func (dc *Device) createLogicalDevice() {
 		PpEnabledExtensionNames: TerminatedStrs(DEVICE_EXTENSIONS),
 		PEnabledFeatures:        []vk.PhysicalDeviceFeatures{deviceFeatures},
 	}
-	if ENABLE_VALIDATION {
-		deviceCreatInfo.EnabledLayerCount = uint32(len(VALIDATION_LAYERS))
-		deviceCreatInfo.PpEnabledLayerNames = TerminatedStrs(VALIDATION_LAYERS)
+	if len(validationLayers) > 0 {
+		deviceCreatInfo.EnabledLayerCount = uint32(len(validationLayers))
+		deviceCreatInfo.PpEnabledLayerNames = TerminatedStrs(validationLayers)
 	}
 
-	var err error
 	dc.D, err = VkCreateDevice(dc.PD, deviceCreatInfo, nil)
 	if err != nil {
-		log.Panicf("Failed create logical device due to: %s", "err")
+		return fmt.Errorf("failed to create logical device: %w", err)
 	}
 	dc.GraphicsQ, err = VkGetDeviceQueue(dc.D, dc.QFamilies.GraphicsFamily, 0)
 	if err != nil {
-		log.Panicf("Failed to get 'graphics' device queue: %s", err)
+		dc.Destroy()
+		return fmt.Errorf("failed to get 'graphics' device queue: %w", err)
 	}
 	dc.PresentQ, err = VkGetDeviceQueue(dc.D, dc.QFamilies.PresentFamily, 0)
 	if err != nil {
-		log.Panicf("Failed to get 'present' device queue: %s", err)
+		dc.Destroy()
+		return fmt.Errorf("failed to get 'present' device queue: %w", err)
+	}
+	dc.TransferQ, err = VkGetDeviceQueue(dc.D, dc.QFamilies.TransferFamily, 0)
+	if err != nil {
+		dc.Destroy()
+		return fmt.Errorf("failed to get 'transfer' device queue: %w", err)
 	}
+	log.Printf("Uploads run on queue family %d (dedicated: %t)", *dc.QFamilies.TransferFamily, dc.QFamilies.HasDedicatedTransfer())
+	return nil
 }
 
 func checkDeviceExtensionSupport(pd vk.PhysicalDevice, requiredDeviceExt []string) bool {
-	supportedExt := ReadDeviceExtensionProperties(pd)
+	supportedExt, err := ReadDeviceExtensionProperties(pd)
+	if err != nil {
+		log.Printf("Failed to read device extensions: %s", err)
+		return false
+	}
 	log.Printf("Required device extensions: %v", requiredDeviceExt)
 	log.Printf("Available device extensions (%d) [...]\n", len(supportedExt))
 	//log.Printf("Available device extensions (%d):\n%v", len(supportedExt), tableStringExtensionProps(supportedExt))
@@ -0,0 +1,306 @@
+package common
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"unsafe"
+
+	vk "github.com/goki/vulkan"
+)
+
+// DEFAULT_MEMORY_BLOCK_SIZE is the size of the device memory blocks the Allocator sub-allocates from. Requests larger
+// than half a block get a dedicated block of their own, so a single big texture does not waste most of a block.
+const DEFAULT_MEMORY_BLOCK_SIZE vk.DeviceSize = 64 * 1024 * 1024
+
+// Allocator hands out device memory in pieces of large blocks instead of calling vkAllocateMemory per resource.
+// Drivers limit the number of allocations (maxMemoryAllocationCount, often only 4096) and each allocation is slow,
+// sub-allocating avoids both. Blocks are grouped into pools by memory type. Linear (buffers) and non-linear (optimal
+// tiling images) resources are kept in separate pools, so bufferImageGranularity never has to be considered.
+//
+// The allocator is safe for concurrent use.
+type Allocator struct {
+	dc        *Device
+	blockSize vk.DeviceSize
+
+	mu     sync.Mutex
+	pools  map[poolKey]*memoryPool
+	blocks int
+}
+
+type poolKey struct {
+	memTypeIdx uint32
+	linear     bool
+}
+
+type memoryPool struct {
+	key    poolKey
+	blocks []*memoryBlock
+}
+
+// Allocation is a piece of a memory block. Resources are bound to Memory at Offset.
+type Allocation struct {
+	Memory     vk.DeviceMemory
+	Offset     vk.DeviceSize
+	Size       vk.DeviceSize
+	MemTypeIdx uint32
+
+	owner *Allocator
+	pool  *memoryPool
+	block *memoryBlock
+}
+
+// AllocatorStats describes the memory currently held by an Allocator
+type AllocatorStats struct {
+	// Device memory allocations made and the bytes they cover
+	Blocks   int
+	Reserved vk.DeviceSize
+	// Live sub-allocations and the bytes they use (including alignment padding between them)
+	Allocations int
+	Used        vk.DeviceSize
+	// Number of free ranges across all blocks, the sum of each block's largest free range and all free bytes
+	FreeRanges  int
+	LargestFree vk.DeviceSize
+	Free        vk.DeviceSize
+}
+
+// Fragmentation returns how scattered the free memory is, 0 if each block has a single free range, close to 1 if the
+// free memory is split into many small ranges. A high value means allocations may need new blocks although enough
+// memory is free in total, which is the point where defragmenting (moving resources together) would pay off.
+func (s AllocatorStats) Fragmentation() float64 {
+	if s.Free == 0 {
+		return 0
+	}
+	return 1 - float64(s.LargestFree)/float64(s.Free)
+}
+
+func (s AllocatorStats) String() string {
+	return fmt.Sprintf(
+		"%d allocations using %d of %d bytes in %d blocks, %d free ranges (fragmentation %.2f)",
+		s.Allocations, s.Used, s.Reserved, s.Blocks, s.FreeRanges, s.Fragmentation(),
+	)
+}
+
+// NewAllocator creates an allocator on the device, blocks are only allocated once memory is requested
+func NewAllocator(dc *Device, blockSize vk.DeviceSize) *Allocator {
+	return &Allocator{
+		dc:        dc,
+		blockSize: blockSize,
+		pools:     make(map[poolKey]*memoryPool),
+	}
+}
+
+// Allocate finds memory matching the requirements and properties. Set linear for buffers and linear tiling images,
+// clear it for optimal tiling images.
+func (a *Allocator) Allocate(req vk.MemoryRequirements, props vk.MemoryPropertyFlags, linear bool) (*Allocation, error) {
+	memTypeIdx, err := findMemoryType(a.dc, req.MemoryTypeBits, props)
+	if err != nil {
+		return nil, err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	key := poolKey{memTypeIdx: memTypeIdx, linear: linear}
+	pool, ok := a.pools[key]
+	if !ok {
+		pool = &memoryPool{key: key}
+		a.pools[key] = pool
+	}
+	if req.Size <= a.blockSize/2 {
+		for _, b := range pool.blocks {
+			if b.dedicated {
+				continue
+			}
+			if offset, ok := b.alloc(req.Size, req.Alignment); ok {
+				return a.newAllocation(pool, b, offset, req.Size), nil
+			}
+		}
+	}
+
+	// No block has room left, or the request is too large to share one
+	size, dedicated := a.blockSize, req.Size > a.blockSize/2
+	if dedicated {
+		size = req.Size
+	}
+	b, err := a.allocateBlock(memTypeIdx, size)
+	if err != nil {
+		return nil, err
+	}
+	b.dedicated = dedicated
+	pool.blocks = append(pool.blocks, b)
+	offset, _ := b.alloc(req.Size, req.Alignment)
+	return a.newAllocation(pool, b, offset, req.Size), nil
+}
+
+func (a *Allocator) newAllocation(pool *memoryPool, b *memoryBlock, offset vk.DeviceSize, size vk.DeviceSize) *Allocation {
+	return &Allocation{
+		Memory:     b.mem,
+		Offset:     offset,
+		Size:       size,
+		MemTypeIdx: pool.key.memTypeIdx,
+		owner:      a,
+		pool:       pool,
+		block:      b,
+	}
+}
+
+// allocateBlock allocates a new block of device memory. Host visible blocks are mapped once and stay mapped for their
+// whole lifetime, since a memory object can only be mapped once at a time and allocations in it share that mapping.
+func (a *Allocator) allocateBlock(memTypeIdx uint32, size vk.DeviceSize) (*memoryBlock, error) {
+	limit := int(a.dc.PdProps.Limits.MaxMemoryAllocationCount)
+	if limit > 0 && a.blocks >= limit {
+		return nil, fmt.Errorf("device memory allocation limit of %d reached", limit)
+	}
+	allocInfo := vk.MemoryAllocateInfo{
+		SType:           vk.StructureTypeMemoryAllocateInfo,
+		PNext:           nil,
+		AllocationSize:  size,
+		MemoryTypeIndex: memTypeIdx,
+	}
+	mem, err := VkAllocateMemory(a.dc.D, &allocInfo, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to allocate memory block of %d bytes: %w", size, err)
+	}
+	b := newMemoryBlock(size)
+	b.mem = mem
+	typeProps := a.dc.PdMemoryProps.MemoryTypes[memTypeIdx].PropertyFlags
+	if typeProps&vk.MemoryPropertyFlags(vk.MemoryPropertyHostVisibleBit) != 0 {
+		b.mapped, err = VkMapMemory(a.dc.D, mem, 0, vk.DeviceSize(vk.WholeSize), 0)
+		if err != nil {
+			vk.FreeMemory(a.dc.D, mem, nil)
+			return nil, fmt.Errorf("failed to map memory block: %w", err)
+		}
+	}
+	a.blocks++
+	log.Printf("Allocated memory block of %d bytes (type %d, %d blocks in total)", size, memTypeIdx, a.blocks)
+	return b, nil
+}
+
+func (a *Allocator) freeBlock(b *memoryBlock) {
+	if b.mapped != nil {
+		vk.UnmapMemory(a.dc.D, b.mem)
+	}
+	vk.FreeMemory(a.dc.D, b.mem, nil)
+	a.blocks--
+}
+
+// Free returns the memory to its block. Blocks left empty are released, except for the last shared block of a pool,
+// which is kept to avoid allocating a new one right away when resources are replaced.
+func (al *Allocation) Free() {
+	a := al.owner
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	b := al.block
+	b.release(al.Offset, al.Size)
+	if b.allocations > 0 {
+		return
+	}
+	shared := 0
+	for _, other := range al.pool.blocks {
+		if !other.dedicated {
+			shared++
+		}
+	}
+	if !b.dedicated && shared == 1 {
+		return
+	}
+	for i, other := range al.pool.blocks {
+		if other == b {
+			al.pool.blocks = append(al.pool.blocks[:i], al.pool.blocks[i+1:]...)
+			break
+		}
+	}
+	a.freeBlock(b)
+}
+
+// Mapped returns the host address of the allocation, nil if the memory is not host visible
+func (al *Allocation) Mapped() unsafe.Pointer {
+	if al.block.mapped == nil {
+		return nil
+	}
+	return unsafe.Add(al.block.mapped, al.Offset)
+}
+
+// Stats collects the current memory usage over all pools
+func (a *Allocator) Stats() AllocatorStats {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var s AllocatorStats
+	for _, pool := range a.pools {
+		for _, b := range pool.blocks {
+			free, largest := b.freeSize()
+			s.Blocks++
+			s.Reserved += b.size
+			s.Allocations += b.allocations
+			s.Used += b.size - free
+			s.FreeRanges += len(b.free)
+			s.LargestFree += largest
+			s.Free += free
+		}
+	}
+	return s
+}
+
+// Destroy releases all blocks. Allocations still alive are reported, their memory is gone afterward.
+func (a *Allocator) Destroy() {
+	if s := a.Stats(); s.Allocations > 0 {
+		log.Printf("Destroying memory allocator with leftover allocations: %v", s)
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for key, pool := range a.pools {
+		for _, b := range pool.blocks {
+			a.freeBlock(b)
+		}
+		delete(a.pools, key)
+	}
+}
+
+// Buffers
+// ----------------------------------------------------------------------------------------------------------
+
+// CreateBuffer creates a buffer Handle and binds it to memory sub-allocated from the allocator. The buffer is tracked
+// under the label and released with DestroyBuffer like any other. On failure everything created up to that point is
+// released again.
+func (a *Allocator) CreateBuffer(label string, size vk.DeviceSize, usage vk.BufferUsageFlags, props vk.MemoryPropertyFlags) (*Buffer, error) {
+	bufferInfo := vk.BufferCreateInfo{
+		SType:                 vk.StructureTypeBufferCreateInfo,
+		PNext:                 nil,
+		Flags:                 0,
+		Size:                  size,
+		Usage:                 usage,
+		SharingMode:           vk.SharingModeExclusive,
+		QueueFamilyIndexCount: 0,
+		PQueueFamilyIndices:   nil,
+	}
+	buf, err := VkCreateBuffer(a.dc.D, &bufferInfo, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create buffer of %d bytes: %w", size, err)
+	}
+	alloc, err := a.Allocate(ReadBufferMemoryRequirements(a.dc.D, buf), props, true)
+	if err != nil {
+		vk.DestroyBuffer(a.dc.D, buf, nil)
+		return nil, err
+	}
+	if err = VkBindBufferMemory(a.dc.D, buf, alloc.Memory, alloc.Offset); err != nil {
+		vk.DestroyBuffer(a.dc.D, buf, nil)
+		alloc.Free()
+		return nil, fmt.Errorf("failed to bind device memory to buffer Handle: %w", err)
+	}
+	a.dc.Resources.track(ObjectHandle(buf), TrackedResource{
+		Kind:       "buffer",
+		Label:      label,
+		Size:       alloc.Size,
+		MemTypeIdx: alloc.MemTypeIdx,
+		HeapIdx:    a.dc.PdMemoryProps.MemoryTypes[alloc.MemTypeIdx].HeapIndex,
+	})
+	return &Buffer{
+		Handle:    buf,
+		DeviceMem: alloc.Memory,
+		Offset:    alloc.Offset,
+		Size:      size,
+		Usage:     usage,
+		props:     props,
+		alloc:     alloc,
+	}, nil
+}
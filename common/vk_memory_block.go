@@ -0,0 +1,99 @@
+package common
+
+import (
+	"sort"
+	"unsafe"
+
+	vk "github.com/goki/vulkan"
+)
+
+// memoryRange is a free range of a memoryBlock, offsets are relative to the start of the block
+type memoryRange struct {
+	offset vk.DeviceSize
+	size   vk.DeviceSize
+}
+
+// memoryBlock is a single vk.DeviceMemory allocation, handed out in pieces by the Allocator. Free space is tracked in a
+// free list sorted by offset. Allocations take the first range that fits (first fit), freed ranges are merged with
+// their free neighbors right away, so the list never contains two adjacent ranges.
+type memoryBlock struct {
+	mem vk.DeviceMemory
+	// Start of the persistent mapping of the whole block, nil unless the memory type is host visible
+	mapped unsafe.Pointer
+	// Set for blocks holding a single large allocation, they are released as soon as that allocation is freed
+	dedicated bool
+
+	size        vk.DeviceSize
+	free        []memoryRange
+	allocations int
+}
+
+func newMemoryBlock(size vk.DeviceSize) *memoryBlock {
+	return &memoryBlock{
+		size: size,
+		free: []memoryRange{{offset: 0, size: size}},
+	}
+}
+
+// alloc reserves size bytes starting at a multiple of alignment, which has to be a power of two (as guaranteed by
+// vk.MemoryRequirements). Padding needed for the alignment stays in the free list.
+func (b *memoryBlock) alloc(size vk.DeviceSize, alignment vk.DeviceSize) (vk.DeviceSize, bool) {
+	for i, r := range b.free {
+		offset := alignUp(r.offset, alignment)
+		padding := offset - r.offset
+		if padding+size > r.size {
+			continue
+		}
+		var remaining []memoryRange
+		if padding > 0 {
+			remaining = append(remaining, memoryRange{offset: r.offset, size: padding})
+		}
+		if rest := r.size - padding - size; rest > 0 {
+			remaining = append(remaining, memoryRange{offset: offset + size, size: rest})
+		}
+		b.free = append(b.free[:i], append(remaining, b.free[i+1:]...)...)
+		b.allocations++
+		return offset, true
+	}
+	return 0, false
+}
+
+// release returns a range handed out by alloc to the free list, merging it with the free ranges around it
+func (b *memoryBlock) release(offset vk.DeviceSize, size vk.DeviceSize) {
+	i := sort.Search(len(b.free), func(i int) bool { return b.free[i].offset > offset })
+	r := memoryRange{offset: offset, size: size}
+	mergePrev := i > 0 && b.free[i-1].offset+b.free[i-1].size == r.offset
+	mergeNext := i < len(b.free) && r.offset+r.size == b.free[i].offset
+	switch {
+	case mergePrev && mergeNext:
+		b.free[i-1].size += r.size + b.free[i].size
+		b.free = append(b.free[:i], b.free[i+1:]...)
+	case mergePrev:
+		b.free[i-1].size += r.size
+	case mergeNext:
+		b.free[i].offset = r.offset
+		b.free[i].size += r.size
+	default:
+		b.free = append(b.free, memoryRange{})
+		copy(b.free[i+1:], b.free[i:])
+		b.free[i] = r
+	}
+	b.allocations--
+}
+
+// freeSize returns the total number of free bytes and the size of the largest free range
+func (b *memoryBlock) freeSize() (total vk.DeviceSize, largest vk.DeviceSize) {
+	for _, r := range b.free {
+		total += r.size
+		largest = max(largest, r.size)
+	}
+	return total, largest
+}
+
+// alignUp rounds v up to the next multiple of alignment, a power of two. An alignment of 0 is treated as 1.
+func alignUp(v vk.DeviceSize, alignment vk.DeviceSize) vk.DeviceSize {
+	if alignment == 0 {
+		return v
+	}
+	return (v + alignment - 1) &^ (alignment - 1)
+}
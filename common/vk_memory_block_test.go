@@ -0,0 +1,52 @@
+package common
+
+import (
+	"testing"
+
+	vk "github.com/goki/vulkan"
+)
+
+func TestMemoryBlockAlignment(t *testing.T) {
+	b := newMemoryBlock(1024)
+	a, _ := b.alloc(10, 4)
+	c, ok := b.alloc(100, 256)
+	if !ok || a != 0 || c != 256 {
+		t.Fatalf("expected allocations at 0 and 256, got %d and %d", a, c)
+	}
+	// The padding between both allocations is still usable
+	d, ok := b.alloc(200, 16)
+	if !ok || d != 16 {
+		t.Fatalf("expected allocation to fill the alignment padding at 16, got %d", d)
+	}
+	if _, ok = b.alloc(1024, 1); ok {
+		t.Fatalf("expected allocation larger than the free space to fail")
+	}
+}
+
+func TestMemoryBlockReleaseMerges(t *testing.T) {
+	b := newMemoryBlock(300)
+	offsets := make([]vk.DeviceSize, 3)
+	for i := range offsets {
+		offsets[i], _ = b.alloc(100, 1)
+	}
+	b.release(offsets[0], 100)
+	b.release(offsets[2], 100)
+	if total, largest := b.freeSize(); len(b.free) != 2 || total != 200 || largest != 100 {
+		t.Fatalf("expected two separate free ranges, got %v", b.free)
+	}
+	// Releasing the middle joins all three ranges into one
+	b.release(offsets[1], 100)
+	if len(b.free) != 1 || b.free[0] != (memoryRange{offset: 0, size: 300}) || b.allocations != 0 {
+		t.Fatalf("expected a single free range covering the block, got %v", b.free)
+	}
+}
+
+func TestAllocatorStatsFragmentation(t *testing.T) {
+	if f := (AllocatorStats{}).Fragmentation(); f != 0 {
+		t.Fatalf("expected no fragmentation without free memory, got %f", f)
+	}
+	s := AllocatorStats{LargestFree: 25, Free: 100}
+	if f := s.Fragmentation(); f != 0.75 {
+		t.Fatalf("expected fragmentation 0.75, got %f", f)
+	}
+}
@@ -3,12 +3,15 @@ package common
 import (
 	"errors"
 	vk "github.com/goki/vulkan"
-	"log"
 )
 
+// QueueFamilyIndices are the queue families the device's queues are taken from. TransferFamily is the family uploads
+// run on, ideally a transfer-only family (dedicated DMA engine). Without one it falls back to the graphics family,
+// which is guaranteed to support transfers as well.
 type QueueFamilyIndices struct {
 	GraphicsFamily *uint32
 	PresentFamily  *uint32
+	TransferFamily *uint32
 }
 
 func findQueueFamilies(pd vk.PhysicalDevice, surf vk.Surface) (*QueueFamilyIndices, error) {
@@ -43,31 +46,66 @@ func findQueueFamilies(pd vk.PhysicalDevice, surf vk.Surface) (*QueueFamilyIndic
 	if indices.PresentFamily == nil {
 		return nil, errors.New("unable to find present capable queue family for given surface")
 	}
+	indices.TransferFamily = new(uint32)
+	*indices.TransferFamily = pickTransferFamily(qFamilies, *indices.GraphicsFamily)
 	return indices, nil
 }
 
+// pickTransferFamily prefers a family that only supports transfers, then one without graphics support (usually an
+// async compute family), and falls back to the graphics family otherwise
+func pickTransferFamily(qFamilies []vk.QueueFamilyProperties, graphicsFamily uint32) uint32 {
+	withoutGraphics := -1
+	for i := range qFamilies {
+		if !isBitSet(qFamilies[i], vk.QueueTransferBit) || isBitSet(qFamilies[i], vk.QueueGraphicsBit) {
+			continue
+		}
+		if !isBitSet(qFamilies[i], vk.QueueComputeBit) {
+			return uint32(i)
+		}
+		if withoutGraphics < 0 {
+			withoutGraphics = i
+		}
+	}
+	if withoutGraphics >= 0 {
+		return uint32(withoutGraphics)
+	}
+	return graphicsFamily
+}
+
+// HasDedicatedTransfer reports whether uploads run on a different queue family than graphics, in which case the
+// ownership of uploaded resources has to be transferred between the families
+func (q *QueueFamilyIndices) HasDedicatedTransfer() bool {
+	return *q.TransferFamily != *q.GraphicsFamily
+}
+
 func isBitSet(qFamily vk.QueueFamilyProperties, bit vk.QueueFlagBits) bool {
 	return vk.QueueFlagBits(qFamily.QueueFlags)&bit > 0
 }
 
 func (q *QueueFamilyIndices) isAllQueuesFound() bool {
-	return q.GraphicsFamily != nil && q.PresentFamily != nil
+	return q.GraphicsFamily != nil && q.PresentFamily != nil && q.TransferFamily != nil
 }
 
-func (q *QueueFamilyIndices) toQueueCreateInfos() []vk.DeviceQueueCreateInfo {
+func (q *QueueFamilyIndices) toQueueCreateInfos() ([]vk.DeviceQueueCreateInfo, error) {
 	var uniqIndices []uint32
 	if q.GraphicsFamily == nil {
-		log.Panicf("Failed to access graphics capable queue family index")
+		return nil, errors.New("failed to access graphics capable queue family index")
 	}
 	if !inList(*q.GraphicsFamily, uniqIndices) {
 		uniqIndices = append(uniqIndices, *q.GraphicsFamily)
 	}
 	if q.PresentFamily == nil {
-		log.Panicf("Failed to access present capable queue family index")
+		return nil, errors.New("failed to access present capable queue family index")
 	}
 	if !inList(*q.PresentFamily, uniqIndices) {
 		uniqIndices = append(uniqIndices, *q.PresentFamily)
 	}
+	if q.TransferFamily == nil {
+		return nil, errors.New("failed to access transfer capable queue family index")
+	}
+	if !inList(*q.TransferFamily, uniqIndices) {
+		uniqIndices = append(uniqIndices, *q.TransferFamily)
+	}
 	infos := make([]vk.DeviceQueueCreateInfo, len(uniqIndices))
 	for i := range uniqIndices {
 		infos[i] = vk.DeviceQueueCreateInfo{
@@ -79,7 +117,7 @@ func (q *QueueFamilyIndices) toQueueCreateInfos() []vk.DeviceQueueCreateInfo {
 			PQueuePriorities: []float32{1.0},
 		}
 	}
-	return infos
+	return infos, nil
 }
 
 func inList(e uint32, l []uint32) bool {
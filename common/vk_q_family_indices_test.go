@@ -0,0 +1,37 @@
+package common
+
+import (
+	"testing"
+
+	vk "github.com/goki/vulkan"
+)
+
+func queueFamilies(flags ...vk.QueueFlagBits) []vk.QueueFamilyProperties {
+	families := make([]vk.QueueFamilyProperties, len(flags))
+	for i, f := range flags {
+		families[i].QueueFlags = vk.QueueFlags(f)
+	}
+	return families
+}
+
+func TestPickTransferFamily(t *testing.T) {
+	all := vk.QueueGraphicsBit | vk.QueueComputeBit | vk.QueueTransferBit
+	compute := vk.QueueComputeBit | vk.QueueTransferBit
+	tests := []struct {
+		name     string
+		families []vk.QueueFamilyProperties
+		want     uint32
+	}{
+		{"graphics only", queueFamilies(all), 0},
+		{"async compute", queueFamilies(all, compute), 1},
+		{"transfer only", queueFamilies(all, compute, vk.QueueTransferBit), 2},
+		{"transfer only first", queueFamilies(vk.QueueTransferBit, all, compute), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pickTransferFamily(tt.families, 0); got != tt.want {
+				t.Fatalf("expected family %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
@@ -1,68 +1,75 @@
 package common
 
 import (
+	"errors"
+	"fmt"
 	vk "github.com/goki/vulkan"
-	"log"
 )
 
 // ReadInstanceExtensionPropertyNames is a convenience method obfuscating the spec defined []vk.ExtensionProperties
 // type in favor of their respective names in order to simplify support checks to a point of string comparisons.
-func ReadInstanceExtensionPropertyNames() []string {
-	supportedExts := readInstanceExtensionProperties()
+func ReadInstanceExtensionPropertyNames() ([]string, error) {
+	supportedExts, err := readInstanceExtensionProperties()
+	if err != nil {
+		return nil, err
+	}
 	supportedExtNames := make([]string, len(supportedExts))
 	for i, ext := range supportedExts {
 		supportedExtNames[i] = vk.ToString(ext.ExtensionName[:])
 	}
-	return supportedExtNames
+	return supportedExtNames, nil
 }
 
 // readInstanceExtensionProperties wraps the raw vulkan call to retrieve all supported instance extensions as their
 // spec defined type and dereferences all necessary pointer values.
-func readInstanceExtensionProperties() []vk.ExtensionProperties {
+func readInstanceExtensionProperties() ([]vk.ExtensionProperties, error) {
 	extensionCount := uint32(0)
 	err := vk.Error(vk.EnumerateInstanceExtensionProperties("", &extensionCount, nil))
 	if err != nil {
-		log.Panicf("Failed read number of InstanceExtensionProperties: %s", err)
+		return nil, fmt.Errorf("failed to read number of InstanceExtensionProperties: %w", err)
 	}
 	extensionProperties := make([]vk.ExtensionProperties, extensionCount)
 	err = vk.Error(vk.EnumerateInstanceExtensionProperties("", &extensionCount, extensionProperties))
 	if err != nil {
-		log.Panicf("Failed read %d InstanceExtensionProperties: %s", extensionCount, err)
+		return nil, fmt.Errorf("failed to read %d InstanceExtensionProperties: %w", extensionCount, err)
 	}
 	for i := range extensionProperties {
 		extensionProperties[i].Deref()
 	}
-	return extensionProperties
+	return extensionProperties, nil
 }
 
 // ReadInstanceLayerPropertyNames is a convenience method obfuscating the spec defined []vk.LayerProperties
 // type in favor of their respective names in order to simplify support checks to a point of string comparisons.
-func ReadInstanceLayerPropertyNames() []string {
-	supportedLayers := readInstanceLayerProperties()
+func ReadInstanceLayerPropertyNames() ([]string, error) {
+	supportedLayers, err := readInstanceLayerProperties()
+	if err != nil {
+		return nil, err
+	}
 	supLayerNames := make([]string, len(supportedLayers))
 	for i, l := range supportedLayers {
 		supLayerNames[i] = vk.ToString(l.LayerName[:])
 	}
-	return supLayerNames
+	return supLayerNames, nil
 }
 
 // readInstanceLayerProperties wraps the raw vulkan call to retrieve all supported instance (validation) layer
 // properties as their spec defined type and dereferences all necessary pointer values.
-func readInstanceLayerProperties() []vk.LayerProperties {
+func readInstanceLayerProperties() ([]vk.LayerProperties, error) {
 	layerCount := uint32(0)
 	err := vk.Error(vk.EnumerateInstanceLayerProperties(&layerCount, nil))
 	if err != nil {
-		log.Panicf("Failed read number of InstanceLayerProperties: %s", err)
+		return nil, fmt.Errorf("failed to read number of InstanceLayerProperties: %w", err)
 	}
 	layers := make([]vk.LayerProperties, layerCount)
 	err = vk.Error(vk.EnumerateInstanceLayerProperties(&layerCount, layers))
 	if err != nil {
-		log.Panicf("Failed read %d InstanceLayerProperties: %s", layerCount, err)
+		return nil, fmt.Errorf("failed to read %d InstanceLayerProperties: %w", layerCount, err)
 	}
 	for i := range layers {
 		layers[i].Deref()
 	}
-	return layers
+	return layers, nil
 }
 
 func ReadSwapChainSupportDetails(pd vk.PhysicalDevice, surface vk.Surface) SwapChainDetails {
@@ -94,21 +101,21 @@ func ReadSwapChainImages(device vk.Device, swapChain vk.Swapchain) []vk.Image {
 	return imgs
 }
 
-func ReadPhysicalDevices(instance vk.Instance) []vk.PhysicalDevice {
+func ReadPhysicalDevices(instance vk.Instance) ([]vk.PhysicalDevice, error) {
 	var gpuCount uint32
 	err := vk.Error(vk.EnumeratePhysicalDevices(instance, &gpuCount, nil))
 	if err != nil {
-		log.Panicf("Failed to read number of PhysicalDevices failed with: %s", err)
+		return nil, fmt.Errorf("failed to read number of PhysicalDevices: %w", err)
 	}
 	if gpuCount == 0 {
-		log.Panic("There are 0 physical devices available")
+		return nil, errors.New("there are 0 physical devices available")
 	}
 	physDevices := make([]vk.PhysicalDevice, gpuCount)
 	err = vk.Error(vk.EnumeratePhysicalDevices(instance, &gpuCount, physDevices))
 	if err != nil {
-		log.Panicf("Failed to read %d PhysicalDevices failed with: %s", gpuCount, err)
+		return nil, fmt.Errorf("failed to read %d PhysicalDevices: %w", gpuCount, err)
 	}
-	return physDevices
+	return physDevices, nil
 }
 
 func ReadDeviceMemoryProperties(pd vk.PhysicalDevice) vk.PhysicalDeviceMemoryProperties {
@@ -150,21 +157,21 @@ func ReadQueueFamilies(pd vk.PhysicalDevice) []vk.QueueFamilyProperties {
 	return qFamilyProps
 }
 
-func ReadDeviceExtensionProperties(pd vk.PhysicalDevice) []vk.ExtensionProperties {
+func ReadDeviceExtensionProperties(pd vk.PhysicalDevice) ([]vk.ExtensionProperties, error) {
 	extensionCount := uint32(0)
 	err := vk.Error(vk.EnumerateDeviceExtensionProperties(pd, "", &extensionCount, nil))
 	if err != nil {
-		log.Panicf("Failed read number of DeviceExtensionProperties: %s", err)
+		return nil, fmt.Errorf("failed to read number of DeviceExtensionProperties: %w", err)
 	}
 	extensionProperties := make([]vk.ExtensionProperties, extensionCount)
 	err = vk.Error(vk.EnumerateDeviceExtensionProperties(pd, "", &extensionCount, extensionProperties))
 	if err != nil {
-		log.Panicf("Failed read %d DeviceExtensionProperties: %s", extensionCount, err)
+		return nil, fmt.Errorf("failed to read %d DeviceExtensionProperties: %w", extensionCount, err)
 	}
 	for i := range extensionProperties {
 		extensionProperties[i].Deref()
 	}
-	return extensionProperties
+	return extensionProperties, nil
 }
 
 func ReadBufferMemoryRequirements(device vk.Device, b vk.Buffer) vk.MemoryRequirements {
@@ -0,0 +1,132 @@
+package common
+
+import (
+	"fmt"
+	"log"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	vk "github.com/goki/vulkan"
+)
+
+// TRACKER_STACK_DEPTH limits how many frames of the creation stack are kept per resource
+const TRACKER_STACK_DEPTH = 16
+
+// TrackedResource describes a buffer or image created through common that has not been destroyed yet
+type TrackedResource struct {
+	// "buffer" or "image"
+	Kind string
+	// Owner label given on creation, e.g.: the model or texture the resource belongs to
+	Label string
+	// Bytes of device memory used by the resource, which may be more than requested due to alignment
+	Size       vk.DeviceSize
+	MemTypeIdx uint32
+	HeapIdx    uint32
+	// Call stack the resource was created from, one "function file:line" entry per line
+	Stack string
+}
+
+// ResourceTracker keeps a record of every buffer and image created through common, so usage can be reported and
+// resources nobody destroyed can be listed on teardown. Resources are keyed by their raw handle. Every Device has one,
+// see: Device.Resources. The tracker is safe for concurrent use.
+type ResourceTracker struct {
+	mu        sync.Mutex
+	resources map[uint64]TrackedResource
+}
+
+func NewResourceTracker() *ResourceTracker {
+	return &ResourceTracker{resources: make(map[uint64]TrackedResource)}
+}
+
+// track records a resource, the creation stack is captured starting at the caller of track
+func (t *ResourceTracker) track(handle uint64, r TrackedResource) {
+	r.Stack = callerStack(2)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.resources[handle] = r
+}
+
+// untrack removes a resource on destruction, unknown and null handles are ignored
+func (t *ResourceTracker) untrack(handle uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.resources, handle)
+}
+
+// Resources returns all live resources ordered by label
+func (t *ResourceTracker) Resources() []TrackedResource {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	rs := make([]TrackedResource, 0, len(t.resources))
+	for _, r := range t.resources {
+		rs = append(rs, r)
+	}
+	sort.Slice(rs, func(i, j int) bool {
+		if rs[i].Label != rs[j].Label {
+			return rs[i].Label < rs[j].Label
+		}
+		return rs[i].Kind < rs[j].Kind
+	})
+	return rs
+}
+
+// Report summarizes the live resources per memory heap of the device, e.g.:
+//
+//	heap 0 (device local, 8192 MiB): 12 buffers, 2 images, 43.17 MiB
+func (t *ResourceTracker) Report(memProps vk.PhysicalDeviceMemoryProperties) string {
+	type heapUsage struct {
+		buffers, images int
+		size            vk.DeviceSize
+	}
+	usage := make([]heapUsage, memProps.MemoryHeapCount)
+	for _, r := range t.Resources() {
+		if int(r.HeapIdx) >= len(usage) {
+			continue
+		}
+		u := &usage[r.HeapIdx]
+		if r.Kind == "image" {
+			u.images++
+		} else {
+			u.buffers++
+		}
+		u.size += r.Size
+	}
+	var sb strings.Builder
+	for i, u := range usage {
+		heap := memProps.MemoryHeaps[i]
+		kind := "host"
+		if heap.Flags&vk.MemoryHeapFlags(vk.MemoryHeapDeviceLocalBit) != 0 {
+			kind = "device local"
+		}
+		fmt.Fprintf(&sb, "heap %d (%s, %d MiB): %d buffers, %d images, %.2f MiB\n",
+			i, kind, heap.Size>>20, u.buffers, u.images, float64(u.size)/(1<<20))
+	}
+	return sb.String()
+}
+
+// LogLeaks lists every resource still alive with the stack it was created from. It returns the number of leaks.
+func (t *ResourceTracker) LogLeaks() int {
+	rs := t.Resources()
+	for _, r := range rs {
+		log.Printf("Leaked %s '%s' (%d Byte, memory type %d) created at:%s", r.Kind, r.Label, r.Size, r.MemTypeIdx, r.Stack)
+	}
+	return len(rs)
+}
+
+// callerStack formats the call stack, skip is the number of frames to leave out with 0 being callerStack itself
+func callerStack(skip int) string {
+	pcs := make([]uintptr, TRACKER_STACK_DEPTH)
+	n := runtime.Callers(skip+1, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	var sb strings.Builder
+	for {
+		f, more := frames.Next()
+		fmt.Fprintf(&sb, "\n\t%s %s:%d", f.Function, f.File, f.Line)
+		if !more {
+			break
+		}
+	}
+	return sb.String()
+}
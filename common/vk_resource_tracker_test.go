@@ -0,0 +1,48 @@
+package common
+
+import (
+	"strings"
+	"testing"
+
+	vk "github.com/goki/vulkan"
+)
+
+func TestResourceTrackerLeaks(t *testing.T) {
+	tr := NewResourceTracker()
+	tr.track(1, TrackedResource{Kind: "buffer", Label: "cube vertices", Size: 1024})
+	tr.track(2, TrackedResource{Kind: "image", Label: "statue", Size: 4096})
+	tr.untrack(1)
+	tr.untrack(3)
+
+	rs := tr.Resources()
+	if len(rs) != 1 || rs[0].Label != "statue" {
+		t.Fatalf("expected only the image to be left, got %v", rs)
+	}
+	if !strings.Contains(rs[0].Stack, "TestResourceTrackerLeaks") {
+		t.Fatalf("expected the creation stack to name the creating function, got:%s", rs[0].Stack)
+	}
+	if n := tr.LogLeaks(); n != 1 {
+		t.Fatalf("expected 1 leak, got %d", n)
+	}
+}
+
+func TestResourceTrackerReport(t *testing.T) {
+	tr := NewResourceTracker()
+	tr.track(1, TrackedResource{Kind: "buffer", Size: 1 << 20, HeapIdx: 0})
+	tr.track(2, TrackedResource{Kind: "image", Size: 3 << 20, HeapIdx: 0})
+	tr.track(3, TrackedResource{Kind: "buffer", Size: 1 << 20, HeapIdx: 1})
+
+	var props vk.PhysicalDeviceMemoryProperties
+	props.MemoryHeapCount = 2
+	props.MemoryHeaps[0] = vk.MemoryHeap{Size: 8 << 30, Flags: vk.MemoryHeapFlags(vk.MemoryHeapDeviceLocalBit)}
+	props.MemoryHeaps[1] = vk.MemoryHeap{Size: 16 << 30}
+	report := tr.Report(props)
+	for _, want := range []string{
+		"heap 0 (device local, 8192 MiB): 1 buffers, 1 images, 4.00 MiB",
+		"heap 1 (host, 16384 MiB): 1 buffers, 0 images, 1.00 MiB",
+	} {
+		if !strings.Contains(report, want) {
+			t.Fatalf("expected report to contain '%s', got:\n%s", want, report)
+		}
+	}
+}
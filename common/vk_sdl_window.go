@@ -1,6 +1,7 @@
 package common
 
 import (
+	"errors"
 	"fmt"
 	"log"
 
@@ -32,14 +33,17 @@ type Window struct {
 	Minimized bool
 	Close     bool
 
-	Inst *vk.Instance
-	Surf *vk.Surface
+	Inst  *vk.Instance
+	Surf  *vk.Surface
+	Debug *DebugMessenger
 }
 
 // NewWindow constructs a new Window struct by default initializing things, stating some meta information and
-// calling the corresponding init functions for the SDL window, Vulkan API instance and so on. On tear down,
-// we need to destroy the: vk.surface, vk.instance and sdl.window.
-func NewWindow(title string, w int32, h int32, validationLayers []string) *Window {
+// calling the corresponding init functions for the SDL window, Vulkan API instance and so on. With validation layers
+// given, a DebugMessenger forwards their messages into the log. On tear down, we need to destroy the: vk.surface,
+// debug messenger, vk.instance and sdl.window. Should any step fail, the parts created so far are destroyed again
+// before returning the error.
+func NewWindow(title string, w int32, h int32, validationLayers []string) (*Window, error) {
 	window := &Window{
 		sdlVersion: fmt.Sprintf("v%d.%d.%d", SDL_MAJOR, SDL_MINOR, SDL_PATCH),
 		vkVersion:  fmt.Sprintf("v%d.%d.%d", VK_SPEC_MAJOR, VK_SPEC_MINOR, VK_SPEC_PATCH),
@@ -48,28 +52,54 @@ func NewWindow(title string, w int32, h int32, validationLayers []string) *Windo
 		Minimized:  false,
 		Close:      false,
 	}
-	window.initSDLWindow(title, w, h)
-	window.initVulkan()
-	window.createVulkanInstance(len(validationLayers) > 0, validationLayers)
-	window.createSdlVkSurface()
+	err := window.initSDLWindow(title, w, h)
+	if err == nil {
+		err = window.initVulkan()
+	}
+	if err == nil {
+		err = window.createVulkanInstance(len(validationLayers) > 0, validationLayers)
+	}
+	if err == nil && len(validationLayers) > 0 {
+		window.Debug, err = NewDebugMessenger(*window.Inst, sdl.VulkanGetVkGetInstanceProcAddr())
+	}
+	if err == nil {
+		err = window.createSdlVkSurface()
+	}
+	if err != nil {
+		window.Destroy()
+		return nil, err
+	}
 	log.Printf("Generated SDL/Vulkan window - SDL: %s Vulkan Spec: %s", window.sdlVersion, window.vkVersion)
-	return window
+	return window, nil
 }
 
-// Destroy is a convenience method to tear down all relevant instances (vk.surface, vk.instance and sdl.window)
-// that have been initialized by itself.
+// Destroy is a convenience method to tear down all relevant instances (vk.surface, debug messenger, vk.instance and
+// sdl.window) that have been initialized by itself. Parts that were never created are skipped, so it is safe to call
+// on a partially initialized window.
 func (w *Window) Destroy() {
-	vk.DestroySurface(*w.Inst, *w.Surf, nil)
-	vk.DestroyInstance(*w.Inst, nil)
-	err := w.Win.Destroy()
-	if err != nil {
-		log.Fatal(err)
+	if w.Surf != nil {
+		vk.DestroySurface(*w.Inst, *w.Surf, nil)
+		w.Surf = nil
+	}
+	if w.Debug != nil {
+		w.Debug.Destroy()
+		w.Debug = nil
+	}
+	if w.Inst != nil {
+		vk.DestroyInstance(*w.Inst, nil)
+		w.Inst = nil
+	}
+	if w.Win != nil {
+		if err := w.Win.Destroy(); err != nil {
+			log.Printf("Failed to destroy SDL window: %v", err)
+		}
+		w.Win = nil
 	}
 }
 
-func (w *Window) initSDLWindow(title string, width int32, height int32) {
+func (w *Window) initSDLWindow(title string, width int32, height int32) error {
 	if err := sdl.Init(sdl.INIT_EVERYTHING); err != nil {
-		log.Panicf("Failed to initialize SDL: %v", err)
+		return fmt.Errorf("failed to initialize SDL: %w", err)
 	}
 	log.Println("Initialized SDL")
 	win, err := sdl.CreateWindow(
@@ -81,28 +111,38 @@ func (w *Window) initSDLWindow(title string, width int32, height int32) {
 		sdl.WINDOW_SHOWN|sdl.WINDOW_RESIZABLE|sdl.WINDOW_VULKAN,
 	)
 	if err != nil {
-		log.Panicf("Failed to create SDL window for use with Vulkan: %v", err)
+		return fmt.Errorf("failed to create SDL window for use with Vulkan: %w", err)
 	}
 	log.Printf("Created SDL window for use with Vulkan. Title: \"%s\", Width: %d, Height: %d", title, width, height)
 	w.Win = win
+	return nil
 }
 
-func (w *Window) initVulkan() {
+func (w *Window) initVulkan() error {
 	// Find and load Vulkan addresses to be able to call driver level functions via provided mechanism
 	vk.SetGetInstanceProcAddr(sdl.VulkanGetVkGetInstanceProcAddr())
 	err := vk.Init()
 	if err != nil {
-		log.Panicf("Failed to initialize Vulkan API: %v", err)
+		return fmt.Errorf("failed to initialize Vulkan API: %w", err)
 	}
+	return nil
 }
 
-func (w *Window) createVulkanInstance(enableValidation bool, validationLayers []string) {
+func (w *Window) createVulkanInstance(enableValidation bool, validationLayers []string) error {
 	requiredExtensions := w.Win.VulkanGetInstanceExtensions()
-	checkInstanceExtensionSupport(requiredExtensions)
+	if enableValidation {
+		// Needed for the debug messenger, the extension is provided by the loader and the validation layers
+		requiredExtensions = append(requiredExtensions, vk.ExtDebugUtilsExtensionName)
+	}
+	if err := checkInstanceExtensionSupport(requiredExtensions); err != nil {
+		return err
+	}
 
 	if enableValidation {
 		log.Printf("Validation enabled, checking layer support")
-		checkValidationLayerSupport(validationLayers)
+		if err := checkValidationLayerSupport(validationLayers); err != nil {
+			return err
+		}
 	}
 	applicationInfo := &vk.ApplicationInfo{
 		SType:              vk.StructureTypeApplicationInfo,
@@ -129,39 +169,47 @@ func (w *Window) createVulkanInstance(enableValidation bool, validationLayers []
 	}
 	ins, err := VkCreateInstance(createInfo, nil)
 	if err != nil {
-		log.Panicf("Failed to create vk instance, due to: %v", err)
+		return fmt.Errorf("failed to create vk instance: %w", err)
 	}
 	w.Inst = &ins
+	return nil
 }
 
-func checkInstanceExtensionSupport(requiredInstanceExt []string) {
-	supportedExtNames := ReadInstanceExtensionPropertyNames()
+func checkInstanceExtensionSupport(requiredInstanceExt []string) error {
+	supportedExtNames, err := ReadInstanceExtensionPropertyNames()
+	if err != nil {
+		return err
+	}
 	log.Printf("Required instance extensions: %v", requiredInstanceExt)
 	log.Printf("Available extensions (%d): %v", len(supportedExtNames), supportedExtNames)
 
 	if !IsSubset(requiredInstanceExt, supportedExtNames) {
-		log.Panicf("At least one required instance extension is not supported")
-	} else {
-		log.Println("Success - All required instance extensions are supported")
+		return errors.New("at least one required instance extension is not supported")
 	}
+	log.Println("Success - All required instance extensions are supported")
+	return nil
 }
 
-func checkValidationLayerSupport(requiredLayers []string) {
-	supportedLayerNames := ReadInstanceLayerPropertyNames()
+func checkValidationLayerSupport(requiredLayers []string) error {
+	supportedLayerNames, err := ReadInstanceLayerPropertyNames()
+	if err != nil {
+		return err
+	}
 	log.Printf("Desired validation layers: %v", requiredLayers)
 	log.Printf("Supported layers (%d): %v", len(supportedLayerNames), supportedLayerNames)
 
 	if !IsSubset(requiredLayers, supportedLayerNames) {
-		log.Panicf("At least one desired layers are supported")
-	} else {
-		log.Println("Success - All desired validation layers are supported")
+		return fmt.Errorf("at least one desired validation layer of %v is not supported", requiredLayers)
 	}
+	log.Println("Success - All desired validation layers are supported")
+	return nil
 }
 
-func (w *Window) createSdlVkSurface() {
+func (w *Window) createSdlVkSurface() error {
 	surf, err := SdlCreateVkSurface(w.Win, *w.Inst)
 	if err != nil {
-		log.Panicf("Failed to create SDL window's Vulkan-surface, due to: %v", err)
+		return fmt.Errorf("failed to create SDL window's Vulkan-surface: %w", err)
 	}
 	w.Surf = &surf
+	return nil
 }
@@ -0,0 +1,120 @@
+package common
+
+import (
+	"fmt"
+	"unsafe"
+
+	vk "github.com/goki/vulkan"
+)
+
+// STAGING_RING_REGION_ALIGNMENT is the alignment of each frame's region within the ring. It covers the largest
+// minUniformBufferOffsetAlignment and optimalBufferCopyOffsetAlignment allowed by the spec.
+const STAGING_RING_REGION_ALIGNMENT vk.DeviceSize = 256
+
+// StagingRing is a persistently mapped, host visible buffer for data that changes every frame: uniforms, vertices of
+// dynamic meshes, texture updates and indirect draws. It is split into one region per frame in flight. Data written for a frame goes
+// into that frame's region, which is only reused once the frame's fence has been waited for, so nothing is allocated
+// per frame and the GPU never reads data the CPU is overwriting.
+//
+// The ring is meant to be driven by the render loop: BeginFrame after waiting for a frame's fence, any number of
+// Alloc or Write calls, EndFrame after submitting the frame. If a frame is never submitted (e.g.: the swap chain was
+// out of date), its region is kept as is and the writes carry over to the next attempt.
+type StagingRing struct {
+	Buffer *Buffer
+	mapped unsafe.Pointer
+
+	regionSize vk.DeviceSize
+	frame      int
+	head       vk.DeviceSize
+	// Set for regions holding writes no submitted frame has consumed yet
+	unsubmitted []bool
+}
+
+// NewStagingRing creates the ring with frameSize bytes per frame, sub-allocated from host coherent memory. The buffer
+// can be used as copy source, uniform buffer, storage buffer and indirect draw buffer.
+func NewStagingRing(a *Allocator, label string, frameSize vk.DeviceSize, frames int) (*StagingRing, error) {
+	regionSize := alignUp(frameSize, STAGING_RING_REGION_ALIGNMENT)
+	usage := vk.BufferUsageTransferSrcBit | vk.BufferUsageUniformBufferBit | vk.BufferUsageStorageBufferBit | vk.BufferUsageIndirectBufferBit
+	buf, err := a.CreateBuffer(
+		label,
+		regionSize*vk.DeviceSize(frames),
+		vk.BufferUsageFlags(usage),
+		vk.MemoryPropertyFlags(vk.MemoryPropertyHostVisibleBit|vk.MemoryPropertyHostCoherentBit),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create staging ring: %w", err)
+	}
+	r := newStagingRing(buf.alloc.Mapped(), regionSize, frames)
+	r.Buffer = buf
+	return r, nil
+}
+
+func newStagingRing(mapped unsafe.Pointer, regionSize vk.DeviceSize, frames int) *StagingRing {
+	return &StagingRing{
+		mapped:      mapped,
+		regionSize:  regionSize,
+		unsubmitted: make([]bool, frames),
+	}
+}
+
+// BeginFrame switches to the region of the frame index, whose fence has to be signalled. The region is emptied, unless
+// it still holds writes of a frame that was never submitted.
+func (r *StagingRing) BeginFrame(frameIdx int) {
+	if r.frame == frameIdx && r.unsubmitted[frameIdx] {
+		return
+	}
+	r.frame = frameIdx
+	r.head = 0
+	r.unsubmitted[frameIdx] = false
+}
+
+// EndFrame marks the writes of the current frame as submitted, its region is emptied by the next BeginFrame for it
+func (r *StagingRing) EndFrame() {
+	r.unsubmitted[r.frame] = false
+}
+
+// Alloc reserves size bytes in the current frame's region. The returned offset is relative to the start of Buffer and
+// a multiple of alignment (a power of two), ptr is the mapped address of the reserved bytes.
+func (r *StagingRing) Alloc(size vk.DeviceSize, alignment vk.DeviceSize) (vk.DeviceSize, unsafe.Pointer, error) {
+	start := r.regionSize * vk.DeviceSize(r.frame)
+	offset := alignUp(start+r.head, alignment)
+	if offset+size > start+r.regionSize {
+		return 0, nil, fmt.Errorf(
+			"staging ring region of %d bytes is full, %d bytes requested with %d in use", r.regionSize, size, r.head,
+		)
+	}
+	r.head = offset + size - start
+	r.unsubmitted[r.frame] = true
+	return offset, unsafe.Add(r.mapped, offset), nil
+}
+
+// Write copies data into the current frame's region and returns its offset within Buffer
+func (r *StagingRing) Write(data []byte, alignment vk.DeviceSize) (vk.DeviceSize, error) {
+	offset, ptr, err := r.Alloc(vk.DeviceSize(len(data)), alignment)
+	if err != nil {
+		return 0, err
+	}
+	copy(unsafe.Slice((*byte)(ptr), len(data)), data)
+	return offset, nil
+}
+
+// Available returns the number of bytes a single Alloc with the alignment can still reserve in the current frame's
+// region
+func (r *StagingRing) Available(alignment vk.DeviceSize) vk.DeviceSize {
+	start := r.regionSize * vk.DeviceSize(r.frame)
+	offset := alignUp(start+r.head, alignment)
+	if offset >= start+r.regionSize {
+		return 0
+	}
+	return start + r.regionSize - offset
+}
+
+// Used returns the number of bytes written to the current frame's region, including alignment padding
+func (r *StagingRing) Used() vk.DeviceSize {
+	return r.head
+}
+
+// Destroy releases the ring's buffer, no frame in flight may use it anymore
+func (r *StagingRing) Destroy(dc *Device) {
+	DestroyBuffer(dc, r.Buffer)
+}
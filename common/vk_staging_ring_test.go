@@ -0,0 +1,61 @@
+package common
+
+import (
+	"testing"
+	"unsafe"
+)
+
+func TestStagingRingRegions(t *testing.T) {
+	mem := make([]byte, 2*256)
+	r := newStagingRing(unsafe.Pointer(&mem[0]), 256, 2)
+	r.BeginFrame(1)
+	if _, err := r.Write([]byte{1, 2, 3}, 1); err != nil {
+		t.Fatal(err)
+	}
+	// Aligned allocations are placed relative to the start of the buffer, inside frame 1's region
+	offset, err := r.Write([]byte{4}, 64)
+	if err != nil || offset != 256+64 || mem[256+64] != 4 {
+		t.Fatalf("expected aligned write at 320, got %d (%v)", offset, err)
+	}
+	if _, _, err = r.Alloc(256, 1); err == nil {
+		t.Fatalf("expected allocation beyond the region to fail")
+	}
+	r.EndFrame()
+	r.BeginFrame(0)
+	if offset, _ = r.Write([]byte{5}, 1); offset != 0 {
+		t.Fatalf("expected frame 0 to start at the beginning of the buffer, got %d", offset)
+	}
+}
+
+func TestStagingRingKeepsUnsubmittedWrites(t *testing.T) {
+	mem := make([]byte, 256)
+	r := newStagingRing(unsafe.Pointer(&mem[0]), 256, 1)
+	r.BeginFrame(0)
+	_, _ = r.Write([]byte{1, 2}, 1)
+	// The frame was not submitted, beginning it again must not hand out the same bytes twice
+	r.BeginFrame(0)
+	if offset, _ := r.Write([]byte{3}, 1); offset != 2 {
+		t.Fatalf("expected write after the unsubmitted ones at 2, got %d", offset)
+	}
+	r.EndFrame()
+	r.BeginFrame(0)
+	if r.Used() != 0 {
+		t.Fatalf("expected submitted region to be emptied, %d bytes in use", r.Used())
+	}
+}
+
+func TestStagingRingAvailable(t *testing.T) {
+	mem := make([]byte, 2*256)
+	r := newStagingRing(unsafe.Pointer(&mem[0]), 256, 2)
+	r.BeginFrame(1)
+	_, _ = r.Write([]byte{1, 2, 3}, 1)
+	if got := r.Available(64); got != 192 {
+		t.Fatalf("expected 192 bytes after aligning past the write, got %d", got)
+	}
+	if _, _, err := r.Alloc(r.Available(64), 64); err != nil {
+		t.Fatalf("expected all available bytes to be allocatable: %v", err)
+	}
+	if got := r.Available(1); got != 0 {
+		t.Fatalf("expected full region to have no bytes available, got %d", got)
+	}
+}
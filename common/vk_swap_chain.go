@@ -1,6 +1,7 @@
 package common
 
 import (
+	"fmt"
 	vk "github.com/goki/vulkan"
 	"log"
 )
@@ -20,20 +21,30 @@ type SwapChain struct {
 	FrameBuffers []vk.Framebuffer
 }
 
-func NewSwapChain(dc *Device, w *Window) *SwapChain {
+// NewSwapChain creates the swap chain for the window's surface together with one image view per swap chain image. The
+// format and present mode are used if the surface supports them, otherwise a fallback is selected. On failure the
+// handle and all views created so far are destroyed again.
+func NewSwapChain(dc *Device, w *Window, format vk.SurfaceFormat, presentMode vk.PresentMode) (*SwapChain, error) {
 	sc := &SwapChain{}
-	sc.chooseConfiguration(dc, w)
-	sc.createSwapChainHandle(dc, w)
+	sc.chooseConfiguration(dc, w, format, presentMode)
+	if err := sc.createSwapChainHandle(dc, w); err != nil {
+		return nil, err
+	}
 	sc.readImages(dc)
-	sc.createImageViews(dc)
+	if err := sc.createImageViews(dc); err != nil {
+		sc.Destroy(dc)
+		return nil, err
+	}
 
 	// Precalculate the images' aspect ratio for later
 	sc.Aspect = float32(sc.Extend.Width) / float32(sc.Extend.Height)
 
-	return sc
+	return sc, nil
 }
 
-func (sc *SwapChain) CreateFrameBuffers(dc *Device, renderPass vk.RenderPass, depthImageView *vk.ImageView) {
+// CreateFrameBuffers creates one frame buffer per swap chain image view. On failure the frame buffers created so far
+// are destroyed again.
+func (sc *SwapChain) CreateFrameBuffers(dc *Device, renderPass vk.RenderPass, depthImageView *vk.ImageView) error {
 	sc.FrameBuffers = make([]vk.Framebuffer, len(sc.ImgViews))
 	for i := range sc.ImgViews {
 		attachments := []vk.ImageView{sc.ImgViews[i]}
@@ -53,21 +64,32 @@ func (sc *SwapChain) CreateFrameBuffers(dc *Device, renderPass vk.RenderPass, de
 		}
 		fb, err := VkCreateFrameBuffer(dc.D, &framebufferInfo, nil)
 		if err != nil {
-			log.Panicf("Failed to create frame buffer [%d]", i)
+			sc.FrameBuffers = sc.FrameBuffers[:i]
+			sc.DestroyFrameBuffers(dc)
+			return fmt.Errorf("failed to create frame buffer [%d]: %w", i, err)
 		}
 		sc.FrameBuffers[i] = fb
 	}
 	log.Printf("Successfully created %d frame buffers %v", len(sc.FrameBuffers), sc.FrameBuffers)
+	return nil
+}
+
+// DestroyFrameBuffers destroys the frame buffers created by CreateFrameBuffers, leaving the swap chain itself intact
+func (sc *SwapChain) DestroyFrameBuffers(dc *Device) {
+	for i := range sc.FrameBuffers {
+		vk.DestroyFramebuffer(dc.D, sc.FrameBuffers[i], nil)
+	}
+	sc.FrameBuffers = nil
 }
 
-func (sc *SwapChain) chooseConfiguration(dc *Device, w *Window) {
+func (sc *SwapChain) chooseConfiguration(dc *Device, w *Window, format vk.SurfaceFormat, presentMode vk.PresentMode) {
 	sc.supDetails = ReadSwapChainSupportDetails(dc.PD, *w.Surf)
-	sc.Format = sc.supDetails.selectSwapSurfaceFormat(vk.FormatB8g8r8a8Srgb, vk.ColorSpaceSrgbNonlinear)
-	sc.PresentMode = sc.supDetails.selectSwapPresentMode(vk.PresentModeMailbox)
+	sc.Format = sc.supDetails.selectSwapSurfaceFormat(format.Format, format.ColorSpace)
+	sc.PresentMode = sc.supDetails.selectSwapPresentMode(presentMode)
 	sc.Extend = sc.supDetails.selectSwapExtent()
 }
 
-func (sc *SwapChain) createSwapChainHandle(dc *Device, w *Window) {
+func (sc *SwapChain) createSwapChainHandle(dc *Device, w *Window) error {
 	// Calc reasonable image count for swap chain
 	imgCount := sc.supDetails.capabilities.MinImageCount + 1
 	imgMaxCount := sc.supDetails.capabilities.MaxImageCount
@@ -115,9 +137,10 @@ func (sc *SwapChain) createSwapChainHandle(dc *Device, w *Window) {
 	var err error
 	sc.Handle, err = VkCreateSwapChain(dc.D, createInfo, nil)
 	if err != nil {
-		log.Panicf("Failed create swapchain due to: %s", "err")
+		return fmt.Errorf("failed to create swapchain: %w", err)
 	}
 	log.Println("Successfully created swap chain")
+	return nil
 }
 
 func (sc *SwapChain) readImages(dc *Device) {
@@ -125,18 +148,21 @@ func (sc *SwapChain) readImages(dc *Device) {
 	log.Printf("Read resulting image handles: %v", sc.Images)
 }
 
-func (sc *SwapChain) createImageViews(dc *Device) {
-	sc.ImgViews = make([]vk.ImageView, len(sc.Images))
+func (sc *SwapChain) createImageViews(dc *Device) error {
+	sc.ImgViews = make([]vk.ImageView, 0, len(sc.Images))
 	for i := range sc.Images {
-		sc.ImgViews[i] = CreateImageViewDC(dc, sc.Images[i], sc.Format.Format, vk.ImageAspectFlags(vk.ImageAspectColorBit))
+		view, err := CreateImageViewDC(dc, sc.Images[i], sc.Format.Format, vk.ImageAspectFlags(vk.ImageAspectColorBit))
+		if err != nil {
+			return fmt.Errorf("failed to create view of swap chain image [%d]: %w", i, err)
+		}
+		sc.ImgViews = append(sc.ImgViews, view)
 	}
 	log.Printf("Successfully created %d image views %v", len(sc.ImgViews), sc.ImgViews)
+	return nil
 }
 
 func (sc *SwapChain) Destroy(dc *Device) {
-	for i := range sc.FrameBuffers {
-		vk.DestroyFramebuffer(dc.D, sc.FrameBuffers[i], nil)
-	}
+	sc.DestroyFrameBuffers(dc)
 	for i := range sc.ImgViews {
 		vk.DestroyImageView(dc.D, sc.ImgViews[i], nil)
 	}
@@ -160,14 +186,30 @@ func (s *SwapChainDetails) selectSwapSurfaceFormat(desiredFormat vk.Format, desi
 	return fallbackFormat
 }
 
+// presentModeFallbacks lists the modes tried in order, if the desired one is not supported by the surface. Modes that
+// avoid tearing never fall back to one that tears. FIFO is the only mode every surface has to support and is used if
+// nothing else fits.
+var presentModeFallbacks = map[vk.PresentMode][]vk.PresentMode{
+	vk.PresentModeImmediate:   {vk.PresentModeMailbox, vk.PresentModeFifoRelaxed},
+	vk.PresentModeMailbox:     {},
+	vk.PresentModeFifoRelaxed: {},
+	vk.PresentModeFifo:        {},
+}
+
 func (s *SwapChainDetails) selectSwapPresentMode(desiredMode vk.PresentMode) vk.PresentMode {
-	for _, pm := range s.presentModes {
-		if pm == desiredMode {
-			return pm
+	candidates := append([]vk.PresentMode{desiredMode}, presentModeFallbacks[desiredMode]...)
+	for _, mode := range candidates {
+		for _, pm := range s.presentModes {
+			if pm == mode {
+				if mode != desiredMode {
+					log.Printf("Did not find prefered PresentMode (%v), falling back to %v", desiredMode, mode)
+				}
+				return pm
+			}
 		}
 	}
 	fallbackMode := vk.PresentModeFifo
-	log.Printf("Did not find prefered PresentMode, selecting FIFO. (%v)", fallbackMode)
+	log.Printf("Did not find prefered PresentMode (%v) or a close alternative, selecting FIFO. (%v)", desiredMode, fallbackMode)
 	return fallbackMode
 }
 
@@ -186,7 +228,7 @@ func checkSwapChainAdequacy(pd vk.PhysicalDevice, surface vk.Surface) bool {
 }
 
 // ToDo: Drop temporarily duplicated code. This should belong into and image wrapping file or allocations
-func CreateImageViewDC(dc *Device, image vk.Image, format vk.Format, aspectFlags vk.ImageAspectFlags) vk.ImageView {
+func CreateImageViewDC(dc *Device, image vk.Image, format vk.Format, aspectFlags vk.ImageAspectFlags) (vk.ImageView, error) {
 	createInfo := &vk.ImageViewCreateInfo{
 		SType:    vk.StructureTypeImageViewCreateInfo,
 		PNext:    nil,
@@ -210,7 +252,7 @@ func CreateImageViewDC(dc *Device, image vk.Image, format vk.Format, aspectFlags
 	}
 	imgView, err := VkCreateImageView(dc.D, createInfo, nil)
 	if err != nil {
-		log.Panicf("Failed create image view due to: %s", err)
+		return nil, fmt.Errorf("failed to create image view: %w", err)
 	}
-	return imgView
+	return imgView, nil
 }
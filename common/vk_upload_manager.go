@@ -0,0 +1,398 @@
+package common
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+
+	vk "github.com/goki/vulkan"
+)
+
+// UploadManager moves data into device local buffers and images on the transfer queue, so the graphics queue never
+// waits for uploads. Copies are queued by UploadBuffer and UploadImage and submitted together by Flush, one command
+// buffer and fence per batch. Poll checks which batches have finished and releases their staging buffers.
+//
+// If the transfer queue belongs to another family than the graphics queue, the ownership of the uploaded resources
+// has to be transferred: each batch ends with release barriers and the graphics queue has to record the matching
+// acquire barriers before it uses the resources, see RecordAcquires. An upload is only Done after that. With a shared
+// family, the batch makes the writes visible to the stages given on upload and uploads are Done once their batch is.
+//
+// Uploads may be queued from any goroutine. Flush submits to the transfer queue, which may be the graphics queue itself,
+// so it has to be called from the render thread like any other submission.
+type UploadManager struct {
+	dc        *Device
+	allocator *Allocator
+	pool      vk.CommandPool
+
+	mu       sync.Mutex
+	queued   []*Upload
+	inFlight []*uploadBatch
+	// Finished on the transfer queue, waiting for the graphics queue to acquire ownership
+	acquire []*Upload
+}
+
+type uploadBatch struct {
+	cmd     vk.CommandBuffer
+	fence   vk.Fence
+	uploads []*Upload
+	// Number of Wait calls blocked on the fence, the batch is only finished once it drops to 0
+	waiters int
+}
+
+// Upload is a single buffer or image upload handed out by the UploadManager
+type Upload struct {
+	Label   string
+	staging *Buffer
+	// Destination, either a buffer or an image with its size
+	buffer        *Buffer
+	image         vk.Image
+	width, height uint32
+	// Stages and access types the resource is used with once uploaded
+	dstStage  vk.PipelineStageFlags
+	dstAccess vk.AccessFlags
+
+	done      atomic.Bool
+	cancelled bool
+}
+
+// Done reports whether the data has arrived and may be used by commands recorded from now on
+func (u *Upload) Done() bool {
+	return u.done.Load()
+}
+
+// NewUploadManager creates the command pool uploads are recorded from on the transfer queue family. Staging buffers are
+// sub-allocated from the allocator.
+func NewUploadManager(dc *Device, allocator *Allocator) (*UploadManager, error) {
+	pool, err := VKSCreateCommandPool(
+		dc.D,
+		vk.CommandPoolCreateFlags(vk.CommandPoolCreateTransientBit),
+		*dc.QFamilies.TransferFamily,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create transfer command pool: %w", err)
+	}
+	return &UploadManager{dc: dc, allocator: allocator, pool: pool}, nil
+}
+
+// UploadBuffer queues copying the payload into dst, which needs vk.BufferUsageTransferDstBit. Once uploaded, the buffer
+// is used in dstStage with dstAccess, e.g.: vertex input and vertex attribute read for vertex buffers. The destination
+// must stay alive until the upload is Done, cancelled or the device is idle.
+func (m *UploadManager) UploadBuffer(label string, dst *Buffer, payload []byte, dstStage vk.PipelineStageFlags, dstAccess vk.AccessFlags) (*Upload, error) {
+	if vk.DeviceSize(len(payload)) > dst.Size {
+		return nil, fmt.Errorf("payload of %d bytes does not fit buffer '%s' of %d bytes", len(payload), label, dst.Size)
+	}
+	staging, err := m.stage(label, payload)
+	if err != nil {
+		return nil, err
+	}
+	return m.queue(&Upload{Label: label, staging: staging, buffer: dst, dstStage: dstStage, dstAccess: dstAccess}), nil
+}
+
+// UploadImage queues copying tightly packed pixels into the first mip level of a 2D color image, which needs
+// vk.ImageUsageTransferDstBit. The image is expected in the undefined layout and ends up shader read only, ready to be
+// sampled in the fragment shader.
+func (m *UploadManager) UploadImage(label string, dst vk.Image, w uint32, h uint32, pixels []byte) (*Upload, error) {
+	staging, err := m.stage(label, pixels)
+	if err != nil {
+		return nil, err
+	}
+	return m.queue(&Upload{
+		Label:     label,
+		staging:   staging,
+		image:     dst,
+		width:     w,
+		height:    h,
+		dstStage:  vk.PipelineStageFlags(vk.PipelineStageFragmentShaderBit),
+		dstAccess: vk.AccessFlags(vk.AccessShaderReadBit),
+	}), nil
+}
+
+func (m *UploadManager) stage(label string, payload []byte) (*Buffer, error) {
+	staging, err := m.allocator.CreateBuffer(
+		label+" staging",
+		vk.DeviceSize(len(payload)),
+		vk.BufferUsageFlags(vk.BufferUsageTransferSrcBit),
+		vk.MemoryPropertyFlags(vk.MemoryPropertyHostVisibleBit|vk.MemoryPropertyHostCoherentBit),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create staging buffer: %w", err)
+	}
+	// Sub-allocated host visible memory stays mapped
+	vk.Memcopy(staging.alloc.Mapped(), payload)
+	return staging, nil
+}
+
+func (m *UploadManager) queue(u *Upload) *Upload {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.queued = append(m.queued, u)
+	return u
+}
+
+// Cancel drops uploads whose destination is about to be destroyed, they are never acquired or marked Done. Uploads
+// already submitted still run, so the device has to be idle before destroying their destination.
+func (m *UploadManager) Cancel(uploads ...*Upload) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, u := range uploads {
+		u.cancelled = true
+	}
+}
+
+// Pending returns the number of uploads not Done yet
+func (m *UploadManager) Pending() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := len(m.queued) + len(m.acquire)
+	for _, b := range m.inFlight {
+		n += len(b.uploads)
+	}
+	return n
+}
+
+// Flush records all queued uploads into a single command buffer and submits it to the transfer queue. It does not wait
+// for the copies to finish.
+func (m *UploadManager) Flush() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var uploads []*Upload
+	for _, u := range m.queued {
+		if u.cancelled {
+			DestroyBuffer(m.dc, u.staging)
+			continue
+		}
+		uploads = append(uploads, u)
+	}
+	m.queued = m.queued[:0]
+	if len(uploads) == 0 {
+		return nil
+	}
+
+	cmd, err := VKBeginSingleTimeCommands(m.dc.D, m.pool)
+	if err != nil {
+		return fmt.Errorf("failed to begin upload command buffer: %w", err)
+	}
+	for _, u := range uploads {
+		m.recordCopy(cmd, u)
+	}
+	fenceInfo := vk.FenceCreateInfo{
+		SType: vk.StructureTypeFenceCreateInfo,
+		PNext: nil,
+		Flags: 0,
+	}
+	var fence vk.Fence
+	err = vk.Error(vk.EndCommandBuffer(cmd))
+	if err == nil {
+		err = vk.Error(vk.CreateFence(m.dc.D, &fenceInfo, nil, &fence))
+	}
+	if err == nil {
+		submitInfo := vk.SubmitInfo{
+			SType:              vk.StructureTypeSubmitInfo,
+			CommandBufferCount: 1,
+			PCommandBuffers:    []vk.CommandBuffer{cmd},
+		}
+		err = vk.Error(vk.QueueSubmit(m.dc.TransferQ, 1, []vk.SubmitInfo{submitInfo}, fence))
+	}
+	if err != nil {
+		// Nothing was submitted, so the uploads can be retried with the next flush
+		vk.DestroyFence(m.dc.D, fence, nil)
+		vk.FreeCommandBuffers(m.dc.D, m.pool, 1, []vk.CommandBuffer{cmd})
+		m.queued = append(m.queued, uploads...)
+		return fmt.Errorf("failed to submit %d uploads: %w", len(uploads), err)
+	}
+	m.inFlight = append(m.inFlight, &uploadBatch{cmd: cmd, fence: fence, uploads: uploads})
+	return nil
+}
+
+// recordCopy records the copy of a single upload followed by the barrier releasing it to the graphics queue
+func (m *UploadManager) recordCopy(cmd vk.CommandBuffer, u *Upload) {
+	if u.buffer != nil {
+		region := vk.BufferCopy{SrcOffset: 0, DstOffset: 0, Size: u.staging.Size}
+		vk.CmdCopyBuffer(cmd, u.staging.Handle, u.buffer.Handle, 1, []vk.BufferCopy{region})
+	} else {
+		toTransferDst := m.imageBarrier(u, vk.ImageLayoutUndefined, vk.ImageLayoutTransferDstOptimal)
+		toTransferDst.DstAccessMask = vk.AccessFlags(vk.AccessTransferWriteBit)
+		vk.CmdPipelineBarrier(
+			cmd,
+			vk.PipelineStageFlags(vk.PipelineStageTopOfPipeBit), vk.PipelineStageFlags(vk.PipelineStageTransferBit),
+			0,
+			0, nil,
+			0, nil,
+			1, []vk.ImageMemoryBarrier{toTransferDst},
+		)
+		region := vk.BufferImageCopy{
+			BufferOffset:      0,
+			BufferRowLength:   0,
+			BufferImageHeight: 0,
+			ImageSubresource: vk.ImageSubresourceLayers{
+				AspectMask:     vk.ImageAspectFlags(vk.ImageAspectColorBit),
+				MipLevel:       0,
+				BaseArrayLayer: 0,
+				LayerCount:     1,
+			},
+			ImageOffset: vk.Offset3D{X: 0, Y: 0, Z: 0},
+			ImageExtent: vk.Extent3D{Width: u.width, Height: u.height, Depth: 1},
+		}
+		vk.CmdCopyBufferToImage(cmd, u.staging.Handle, u.image, vk.ImageLayoutTransferDstOptimal, 1, []vk.BufferImageCopy{region})
+	}
+
+	// Without an ownership transfer, this barrier already makes the data visible to the stages using it. Otherwise it
+	// is the release half, its destination scope is ignored and covered by the acquire on the graphics queue instead.
+	srcStage := vk.PipelineStageFlags(vk.PipelineStageTransferBit)
+	dstStage, dstAccess := u.dstStage, u.dstAccess
+	if m.dc.QFamilies.HasDedicatedTransfer() {
+		dstStage, dstAccess = vk.PipelineStageFlags(vk.PipelineStageBottomOfPipeBit), 0
+	}
+	m.recordOwnershipBarrier(cmd, u, srcStage, vk.AccessFlags(vk.AccessTransferWriteBit), dstStage, dstAccess)
+}
+
+// RecordAcquires polls for finished batches and records the acquire barriers of all uploads waiting for the graphics
+// queue into cmd, which has to be submitted to the graphics queue. Recorded uploads are Done, commands recorded after
+// this call may use them. Returns the number of acquired uploads.
+func (m *UploadManager) RecordAcquires(cmd vk.CommandBuffer) int {
+	m.Poll()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for _, u := range m.acquire {
+		if u.cancelled {
+			continue
+		}
+		m.recordOwnershipBarrier(cmd, u, vk.PipelineStageFlags(vk.PipelineStageTopOfPipeBit), 0, u.dstStage, u.dstAccess)
+		u.done.Store(true)
+		n++
+	}
+	m.acquire = m.acquire[:0]
+	return n
+}
+
+// recordOwnershipBarrier records the barrier moving a finished upload from the transfer family to the graphics family.
+// Release and acquire use the same queue family indices and image layouts, only the access scopes differ.
+func (m *UploadManager) recordOwnershipBarrier(cmd vk.CommandBuffer, u *Upload, srcStage vk.PipelineStageFlags, srcAccess vk.AccessFlags, dstStage vk.PipelineStageFlags, dstAccess vk.AccessFlags) {
+	srcFamily, dstFamily := uint32(vk.QueueFamilyIgnored), uint32(vk.QueueFamilyIgnored)
+	if m.dc.QFamilies.HasDedicatedTransfer() {
+		srcFamily, dstFamily = *m.dc.QFamilies.TransferFamily, *m.dc.QFamilies.GraphicsFamily
+	}
+	if u.buffer != nil {
+		barrier := vk.BufferMemoryBarrier{
+			SType:               vk.StructureTypeBufferMemoryBarrier,
+			PNext:               nil,
+			SrcAccessMask:       srcAccess,
+			DstAccessMask:       dstAccess,
+			SrcQueueFamilyIndex: srcFamily,
+			DstQueueFamilyIndex: dstFamily,
+			Buffer:              u.buffer.Handle,
+			Offset:              0,
+			Size:                vk.DeviceSize(vk.WholeSize),
+		}
+		vk.CmdPipelineBarrier(cmd, srcStage, dstStage, 0, 0, nil, 1, []vk.BufferMemoryBarrier{barrier}, 0, nil)
+		return
+	}
+	barrier := m.imageBarrier(u, vk.ImageLayoutTransferDstOptimal, vk.ImageLayoutShaderReadOnlyOptimal)
+	barrier.SrcAccessMask = srcAccess
+	barrier.DstAccessMask = dstAccess
+	barrier.SrcQueueFamilyIndex = srcFamily
+	barrier.DstQueueFamilyIndex = dstFamily
+	vk.CmdPipelineBarrier(cmd, srcStage, dstStage, 0, 0, nil, 0, nil, 1, []vk.ImageMemoryBarrier{barrier})
+}
+
+func (m *UploadManager) imageBarrier(u *Upload, old vk.ImageLayout, new vk.ImageLayout) vk.ImageMemoryBarrier {
+	return vk.ImageMemoryBarrier{
+		SType:               vk.StructureTypeImageMemoryBarrier,
+		PNext:               nil,
+		OldLayout:           old,
+		NewLayout:           new,
+		SrcQueueFamilyIndex: vk.QueueFamilyIgnored,
+		DstQueueFamilyIndex: vk.QueueFamilyIgnored,
+		Image:               u.image,
+		SubresourceRange: vk.ImageSubresourceRange{
+			AspectMask:     vk.ImageAspectFlags(vk.ImageAspectColorBit),
+			BaseMipLevel:   0,
+			LevelCount:     1,
+			BaseArrayLayer: 0,
+			LayerCount:     1,
+		},
+	}
+}
+
+// Poll releases the staging memory of finished batches. Their uploads are Done, or wait for RecordAcquires if the
+// ownership has to be transferred. Batches somebody still Waits for are left to a later call, as finishing them
+// destroys the fence waited on.
+func (m *UploadManager) Poll() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	remaining := m.inFlight[:0]
+	for _, b := range m.inFlight {
+		if b.waiters > 0 || vk.GetFenceStatus(m.dc.D, b.fence) != vk.Success {
+			remaining = append(remaining, b)
+			continue
+		}
+		m.finishBatch(b)
+	}
+	m.inFlight = remaining
+}
+
+func (m *UploadManager) finishBatch(b *uploadBatch) {
+	for _, u := range b.uploads {
+		DestroyBuffer(m.dc, u.staging)
+		u.staging = nil
+		if u.cancelled {
+			continue
+		}
+		if m.dc.QFamilies.HasDedicatedTransfer() {
+			m.acquire = append(m.acquire, u)
+		} else {
+			u.done.Store(true)
+		}
+	}
+	vk.DestroyFence(m.dc.D, b.fence, nil)
+	vk.FreeCommandBuffers(m.dc.D, m.pool, 1, []vk.CommandBuffer{b.cmd})
+}
+
+// Wait blocks until all submitted batches have finished on the transfer queue. The lock is not held while waiting, so
+// uploads can still be queued and flushed meanwhile, the batches waited for are kept alive instead.
+func (m *UploadManager) Wait() error {
+	m.mu.Lock()
+	batches := append([]*uploadBatch{}, m.inFlight...)
+	fences := make([]vk.Fence, len(batches))
+	for i, b := range batches {
+		fences[i] = b.fence
+		b.waiters++
+	}
+	m.mu.Unlock()
+	if len(fences) == 0 {
+		return nil
+	}
+	res := vk.WaitForFences(m.dc.D, uint32(len(fences)), fences, vk.True, ^uint64(0))
+	m.mu.Lock()
+	for _, b := range batches {
+		b.waiters--
+	}
+	m.mu.Unlock()
+	if err := vk.Error(res); err != nil {
+		return fmt.Errorf("failed to wait for uploads: %w", err)
+	}
+	m.Poll()
+	return nil
+}
+
+// Destroy waits for submitted uploads, drops queued ones and destroys the command pool
+func (m *UploadManager) Destroy() {
+	if err := m.Wait(); err != nil {
+		log.Printf("Destroying upload manager without waiting: %v", err)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, b := range m.inFlight {
+		m.finishBatch(b)
+	}
+	for _, u := range m.queued {
+		DestroyBuffer(m.dc, u.staging)
+	}
+	if n := len(m.queued) + len(m.acquire); n > 0 {
+		log.Printf("Dropped %d uploads that were never submitted or acquired", n)
+	}
+	m.inFlight, m.queued, m.acquire = nil, nil, nil
+	vk.DestroyCommandPool(m.dc.D, m.pool, nil)
+}
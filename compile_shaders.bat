@@ -1,2 +1,4 @@
 G:\vulkan\Bin\glslc.exe shaders\shader.vert -o shaders_spv\vert.spv
-G:\vulkan\Bin\glslc.exe shaders\shader.frag -o shaders_spv\frag.spv
\ No newline at end of file
+G:\vulkan\Bin\glslc.exe shaders\shader.frag -o shaders_spv\frag.spv
+G:\vulkan\Bin\glslc.exe shaders\instanced.vert -o shaders_spv\instanced_vert.spv
+G:\vulkan\Bin\glslc.exe shaders\batched.vert -o shaders_spv\batched_vert.spv
\ No newline at end of file
@@ -0,0 +1,143 @@
+package input
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// Names of the mouse inputs in bindings. Keys use SDL's key names, see: https://wiki.libsdl.org/SDL2/SDL_GetKeyName
+var mouseButtonNames = map[string]uint8{
+	"Mouse Left":   sdl.BUTTON_LEFT,
+	"Mouse Middle": sdl.BUTTON_MIDDLE,
+	"Mouse Right":  sdl.BUTTON_RIGHT,
+	"Mouse X1":     sdl.BUTTON_X1,
+	"Mouse X2":     sdl.BUTTON_X2,
+}
+
+var mouseAxisNames = map[string]int32{
+	"Mouse X":     MOUSE_AXIS_X,
+	"Mouse Y":     MOUSE_AXIS_Y,
+	"Mouse Wheel": MOUSE_AXIS_WHEEL,
+}
+
+// Game controller inputs, named after the Xbox layout SDL maps all controllers onto
+var padButtonNames = map[string]uint8{
+	"Pad A":              sdl.CONTROLLER_BUTTON_A,
+	"Pad B":              sdl.CONTROLLER_BUTTON_B,
+	"Pad X":              sdl.CONTROLLER_BUTTON_X,
+	"Pad Y":              sdl.CONTROLLER_BUTTON_Y,
+	"Pad Back":           sdl.CONTROLLER_BUTTON_BACK,
+	"Pad Guide":          sdl.CONTROLLER_BUTTON_GUIDE,
+	"Pad Start":          sdl.CONTROLLER_BUTTON_START,
+	"Pad Left Stick":     sdl.CONTROLLER_BUTTON_LEFTSTICK,
+	"Pad Right Stick":    sdl.CONTROLLER_BUTTON_RIGHTSTICK,
+	"Pad Left Shoulder":  sdl.CONTROLLER_BUTTON_LEFTSHOULDER,
+	"Pad Right Shoulder": sdl.CONTROLLER_BUTTON_RIGHTSHOULDER,
+	"Pad Up":             sdl.CONTROLLER_BUTTON_DPAD_UP,
+	"Pad Down":           sdl.CONTROLLER_BUTTON_DPAD_DOWN,
+	"Pad Left":           sdl.CONTROLLER_BUTTON_DPAD_LEFT,
+	"Pad Right":          sdl.CONTROLLER_BUTTON_DPAD_RIGHT,
+}
+
+// Stick axes range from -1 to 1, positive is right and down. Triggers range from 0 to 1. Appending "+" or "-" to the
+// name of an axis only reads the half pointing in that direction, e.g.: "Pad Left Y-" is the left stick pushed up.
+var padAxisNames = map[string]uint8{
+	"Pad Left X":        sdl.CONTROLLER_AXIS_LEFTX,
+	"Pad Left Y":        sdl.CONTROLLER_AXIS_LEFTY,
+	"Pad Right X":       sdl.CONTROLLER_AXIS_RIGHTX,
+	"Pad Right Y":       sdl.CONTROLLER_AXIS_RIGHTY,
+	"Pad Left Trigger":  sdl.CONTROLLER_AXIS_TRIGGERLEFT,
+	"Pad Right Trigger": sdl.CONTROLLER_AXIS_TRIGGERRIGHT,
+}
+
+// AxisBinding is a single input contributing to an axis
+type AxisBinding struct {
+	Input string
+	Scale float32
+}
+
+// Config holds the bindings of actions and axes by name, as stored in a binding file. A binding file only needs to
+// contain the bindings it wants to change, e.g.:
+//
+//	{
+//	  "Actions": { "toggle_projection": ["P"] },
+//	  "Axes": { "fly_forward": [{ "Input": "Up", "Scale": 1 }, { "Input": "Down", "Scale": -1 }] }
+//	}
+type Config struct {
+	Actions map[string][]string
+	Axes    map[string][]AxisBinding
+}
+
+// LoadConfig reads a binding file and checks that all inputs in it are known
+func LoadConfig(path string) (Config, error) {
+	cfg := Config{}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	if err = json.Unmarshal(b, &cfg); err != nil {
+		return cfg, fmt.Errorf("failed to decode bindings '%s': %w", path, err)
+	}
+	for action, inputs := range cfg.Actions {
+		for _, in := range inputs {
+			if _, err = parseSource(in); err != nil {
+				return cfg, fmt.Errorf("invalid binding for action '%s' in '%s': %w", action, path, err)
+			}
+		}
+	}
+	for axis, bindings := range cfg.Axes {
+		for _, bind := range bindings {
+			if _, err = parseSource(bind.Input); err != nil {
+				return cfg, fmt.Errorf("invalid binding for axis '%s' in '%s': %w", axis, path, err)
+			}
+		}
+	}
+	return cfg, nil
+}
+
+// SaveConfig writes the bindings to a json file
+func SaveConfig(path string, cfg Config) error {
+	b, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode bindings: %w", err)
+	}
+	return os.WriteFile(path, b, 0644)
+}
+
+// parseSource resolves the name of an input to the physical input it refers to
+func parseSource(name string) (source, error) {
+	if btn, ok := mouseButtonNames[name]; ok {
+		return source{kind: SOURCE_MOUSE_BUTTON, code: int32(btn)}, nil
+	}
+	if axis, ok := mouseAxisNames[name]; ok {
+		return source{kind: SOURCE_MOUSE_AXIS, code: axis}, nil
+	}
+	if btn, ok := padButtonNames[name]; ok {
+		return source{kind: SOURCE_PAD_BUTTON, code: int32(btn)}, nil
+	}
+	if axis, ok := padAxisNames[name]; ok {
+		return source{kind: SOURCE_PAD_AXIS, code: int32(axis)}, nil
+	}
+	if half, ok := strings.CutSuffix(name, "+"); ok {
+		if axis, ok := padAxisNames[half]; ok {
+			return source{kind: SOURCE_PAD_AXIS, code: int32(axis), sign: 1}, nil
+		}
+	}
+	if half, ok := strings.CutSuffix(name, "-"); ok {
+		if axis, ok := padAxisNames[half]; ok {
+			return source{kind: SOURCE_PAD_AXIS, code: int32(axis), sign: -1}, nil
+		}
+	}
+	if strings.TrimSpace(name) == "" {
+		return source{}, fmt.Errorf("empty input name")
+	}
+	key := sdl.GetKeyFromName(name)
+	if key == sdl.K_UNKNOWN {
+		return source{}, fmt.Errorf("unknown input '%s'", name)
+	}
+	return source{kind: SOURCE_KEY, key: key}, nil
+}
@@ -0,0 +1,70 @@
+package input
+
+import (
+	"log"
+
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// Gamepads opens game controllers as they are plugged in and closes them once they are removed. SDL only reports
+// button and axis events of opened controllers. Controllers connected before startup are announced by SDL as added
+// devices as well, so no extra scan is required.
+type Gamepads struct {
+	controllers map[sdl.JoystickID]*sdl.GameController
+}
+
+func NewGamepads() *Gamepads {
+	return &Gamepads{
+		controllers: map[sdl.JoystickID]*sdl.GameController{},
+	}
+}
+
+// HandleEvent reacts to controllers being added or removed, all other events are ignored
+func (g *Gamepads) HandleEvent(event sdl.Event) {
+	ev, ok := event.(*sdl.ControllerDeviceEvent)
+	if !ok {
+		return
+	}
+	switch ev.Type {
+	case sdl.CONTROLLERDEVICEADDED:
+		// For added devices Which is the device index, not the instance id used by all other events
+		idx := int(ev.Which)
+		if !sdl.IsGameController(idx) {
+			return
+		}
+		ctrl := sdl.GameControllerOpen(idx)
+		if ctrl == nil {
+			log.Printf("Failed to open game controller %d: %v", idx, sdl.GetError())
+			return
+		}
+		id := ctrl.Joystick().InstanceID()
+		if _, open := g.controllers[id]; open {
+			// Already opened, SDL hands out the same controller again and counts the references
+			ctrl.Close()
+			return
+		}
+		g.controllers[id] = ctrl
+		log.Printf("Game controller connected: '%s'", ctrl.Name())
+	case sdl.CONTROLLERDEVICEREMOVED:
+		ctrl, open := g.controllers[ev.Which]
+		if !open {
+			return
+		}
+		log.Printf("Game controller disconnected: '%s'", ctrl.Name())
+		ctrl.Close()
+		delete(g.controllers, ev.Which)
+	}
+}
+
+// Count returns the number of connected controllers
+func (g *Gamepads) Count() int {
+	return len(g.controllers)
+}
+
+// Close closes all open controllers
+func (g *Gamepads) Close() {
+	for id, ctrl := range g.controllers {
+		ctrl.Close()
+		delete(g.controllers, id)
+	}
+}
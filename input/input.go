@@ -0,0 +1,306 @@
+package input
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// Kinds of physical inputs a binding can refer to
+const (
+	SOURCE_KEY          = iota
+	SOURCE_MOUSE_BUTTON = iota
+	SOURCE_MOUSE_AXIS   = iota
+	SOURCE_PAD_BUTTON   = iota
+	SOURCE_PAD_AXIS     = iota
+)
+
+// DEFAULT_DEAD_ZONE is the share of a stick's or trigger's range around its rest position that is read as 0. Sticks
+// rarely rest exactly in the center, without a dead zone the camera would slowly drift.
+const DEFAULT_DEAD_ZONE = 0.15
+
+// PAD_AXIS_PRESS_THRESHOLD is how far a stick or trigger bound to an action has to be moved to hold the action down
+const PAD_AXIS_PRESS_THRESHOLD = 0.5
+
+// Mouse axes, their values are the movement accumulated since the last EndFrame
+const (
+	MOUSE_AXIS_X     = iota
+	MOUSE_AXIS_Y     = iota
+	MOUSE_AXIS_WHEEL = iota
+)
+
+// source is a parsed physical input, see parseSource. Keys are identified by key, everything else by code. Pad axes
+// with a sign only report the half of the axis pointing in that direction.
+type source struct {
+	kind int
+	key  sdl.Keycode
+	code int32
+	sign float32
+}
+
+type actionState struct {
+	sources  []source
+	down     bool
+	pressed  bool
+	released bool
+}
+
+type axisBinding struct {
+	src   source
+	scale float32
+}
+
+// Map translates physical keys, mouse buttons and mouse movement into named actions and axes, so the code reacting
+// to input does not need to know which key the user chose. Actions are either down or up and additionally remember
+// whether they were pressed or released during the current frame. Axes sum up the scale of every held key or button
+// plus the mouse movement of the current frame and the position of bound sticks and triggers.
+//
+// Feed all events to HandleEvent and call EndFrame once all input of a frame has been consumed. Game controllers are
+// read from their events as well, so a recorded event stream can stand in for a physical controller. All connected
+// controllers act as one: a button is down if it is held on any of them and an axis reads the largest deflection.
+// Opening the controllers is left to Gamepads.
+type Map struct {
+	DeadZone float32
+
+	actions map[string]*actionState
+	axes    map[string][]axisBinding
+
+	keys       map[sdl.Keycode]bool
+	buttons    map[uint8]bool
+	mouseDelta [3]float32
+	// State of each controller by instance id, so unplugging one does not release the inputs held on the others
+	pads map[sdl.JoystickID]*padState
+}
+
+type padState struct {
+	buttons map[uint8]bool
+	axes    map[uint8]float32
+}
+
+func NewMap() *Map {
+	return &Map{
+		DeadZone: DEFAULT_DEAD_ZONE,
+		actions:  map[string]*actionState{},
+		axes:     map[string][]axisBinding{},
+		keys:     map[sdl.Keycode]bool{},
+		buttons:  map[uint8]bool{},
+		pads:     map[sdl.JoystickID]*padState{},
+	}
+}
+
+// Bind replaces the inputs triggering an action. Inputs are named as in the config file, e.g.: "W", "Left Shift" or
+// "Mouse Right". Mouse axes can not trigger actions, sticks and triggers hold an action down once they are moved past
+// PAD_AXIS_PRESS_THRESHOLD.
+func (m *Map) Bind(action string, inputs ...string) error {
+	sources := make([]source, 0, len(inputs))
+	for _, in := range inputs {
+		src, err := parseSource(in)
+		if err != nil {
+			return err
+		}
+		if src.kind == SOURCE_MOUSE_AXIS {
+			return fmt.Errorf("mouse axis '%s' can not be bound to action '%s'", in, action)
+		}
+		sources = append(sources, src)
+	}
+	m.actions[action] = &actionState{sources: sources}
+	m.updateActions()
+	return nil
+}
+
+// BindAxis replaces the inputs contributing to an axis. A held key or button adds its scale, a mouse axis adds its
+// movement multiplied by the scale.
+func (m *Map) BindAxis(axis string, bindings ...AxisBinding) error {
+	bs := make([]axisBinding, 0, len(bindings))
+	for _, b := range bindings {
+		src, err := parseSource(b.Input)
+		if err != nil {
+			return err
+		}
+		bs = append(bs, axisBinding{src: src, scale: b.Scale})
+	}
+	m.axes[axis] = bs
+	return nil
+}
+
+// Apply binds all actions and axes found in the config, leaving everything else as it is
+func (m *Map) Apply(cfg Config) error {
+	for action, inputs := range cfg.Actions {
+		if err := m.Bind(action, inputs...); err != nil {
+			return err
+		}
+	}
+	for axis, bindings := range cfg.Axes {
+		if err := m.BindAxis(axis, bindings...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HandleEvent updates the state of all physical inputs and the actions bound to them. Events not carrying input
+// are ignored, as are repeated key down events of held keys.
+func (m *Map) HandleEvent(event sdl.Event) {
+	switch ev := event.(type) {
+	case *sdl.KeyboardEvent:
+		if ev.Repeat != 0 {
+			return
+		}
+		m.keys[ev.Keysym.Sym] = ev.Type == sdl.KEYDOWN
+	case *sdl.MouseButtonEvent:
+		m.buttons[ev.Button] = ev.Type == sdl.MOUSEBUTTONDOWN
+	case *sdl.MouseMotionEvent:
+		m.mouseDelta[MOUSE_AXIS_X] += float32(ev.XRel)
+		m.mouseDelta[MOUSE_AXIS_Y] += float32(ev.YRel)
+		return
+	case *sdl.MouseWheelEvent:
+		m.mouseDelta[MOUSE_AXIS_WHEEL] += float32(ev.Y)
+		return
+	case *sdl.ControllerButtonEvent:
+		m.pad(ev.Which).buttons[ev.Button] = ev.Type == sdl.CONTROLLERBUTTONDOWN
+	case *sdl.ControllerAxisEvent:
+		m.pad(ev.Which).axes[ev.Axis] = applyDeadZone(float32(ev.Value)/math.MaxInt16, m.DeadZone)
+	case *sdl.ControllerDeviceEvent:
+		if ev.Type != sdl.CONTROLLERDEVICEREMOVED {
+			return
+		}
+		// A controller unplugged mid-press never sends its release events. For removed devices Which is the instance
+		// id, the same as for button and axis events.
+		delete(m.pads, ev.Which)
+	default:
+		return
+	}
+	m.updateActions()
+}
+
+// EndFrame forgets which actions were pressed or released and resets the mouse movement
+func (m *Map) EndFrame() {
+	for _, a := range m.actions {
+		a.pressed = false
+		a.released = false
+	}
+	m.mouseDelta = [3]float32{}
+}
+
+// Reset releases all inputs without reporting them as released, e.g. when the map stops receiving events
+func (m *Map) Reset() {
+	m.keys = map[sdl.Keycode]bool{}
+	m.buttons = map[uint8]bool{}
+	m.pads = map[sdl.JoystickID]*padState{}
+	for _, a := range m.actions {
+		a.down = false
+	}
+	m.EndFrame()
+}
+
+// Down reports whether any input bound to the action is held
+func (m *Map) Down(action string) bool {
+	a, ok := m.actions[action]
+	return ok && a.down
+}
+
+// JustPressed reports whether the action went down during the current frame
+func (m *Map) JustPressed(action string) bool {
+	a, ok := m.actions[action]
+	return ok && a.pressed
+}
+
+// JustReleased reports whether the action went up during the current frame
+func (m *Map) JustReleased(action string) bool {
+	a, ok := m.actions[action]
+	return ok && a.released
+}
+
+// Axis returns the current value of the axis, unknown axes are always 0
+func (m *Map) Axis(axis string) float32 {
+	v := float32(0)
+	for _, b := range m.axes[axis] {
+		v += m.value(b.src) * b.scale
+	}
+	return v
+}
+
+func (m *Map) value(src source) float32 {
+	switch src.kind {
+	case SOURCE_MOUSE_AXIS:
+		return m.mouseDelta[src.code]
+	case SOURCE_PAD_AXIS:
+		// The largest deflection of all controllers wins, so a controller at rest does not cancel out another one
+		v := float32(0)
+		for _, p := range m.pads {
+			pv := p.axes[uint8(src.code)]
+			if src.sign != 0 {
+				pv = float32(math.Max(0, float64(pv*src.sign)))
+			}
+			if math.Abs(float64(pv)) > math.Abs(float64(v)) {
+				v = pv
+			}
+		}
+		return v
+	default:
+		if m.isDown(src) {
+			return 1
+		}
+		return 0
+	}
+}
+
+func (m *Map) isDown(src source) bool {
+	switch src.kind {
+	case SOURCE_KEY:
+		return m.keys[src.key]
+	case SOURCE_MOUSE_BUTTON:
+		return m.buttons[uint8(src.code)]
+	case SOURCE_PAD_BUTTON:
+		for _, p := range m.pads {
+			if p.buttons[uint8(src.code)] {
+				return true
+			}
+		}
+		return false
+	case SOURCE_PAD_AXIS:
+		return math.Abs(float64(m.value(src))) >= PAD_AXIS_PRESS_THRESHOLD
+	default:
+		return false
+	}
+}
+
+// pad returns the state of the controller with the given instance id, which is created with its first event
+func (m *Map) pad(id sdl.JoystickID) *padState {
+	p, ok := m.pads[id]
+	if !ok {
+		p = &padState{buttons: map[uint8]bool{}, axes: map[uint8]float32{}}
+		m.pads[id] = p
+	}
+	return p
+}
+
+// applyDeadZone maps values inside the dead zone to 0 and rescales the rest, so leaving the dead zone starts at 0
+// instead of jumping to its edge
+func applyDeadZone(v float32, dz float32) float32 {
+	a := float32(math.Min(1, math.Abs(float64(v))))
+	if a <= dz {
+		return 0
+	}
+	return float32(math.Copysign(float64((a-dz)/(1-dz)), float64(v)))
+}
+
+// updateActions recomputes whether each action is down and records the transitions of this frame
+func (m *Map) updateActions() {
+	for _, a := range m.actions {
+		down := false
+		for _, src := range a.sources {
+			if m.isDown(src) {
+				down = true
+				break
+			}
+		}
+		if down && !a.down {
+			a.pressed = true
+		} else if !down && a.down {
+			a.released = true
+		}
+		a.down = down
+	}
+}
@@ -0,0 +1,229 @@
+package input
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+func TestMapActionTransitions(t *testing.T) {
+	m := NewMap()
+	if err := m.Bind("fire", "Mouse Left", "Mouse Right"); err != nil {
+		t.Fatal(err)
+	}
+	m.HandleEvent(&sdl.MouseButtonEvent{Type: sdl.MOUSEBUTTONDOWN, Button: sdl.BUTTON_LEFT})
+	if !m.Down("fire") || !m.JustPressed("fire") {
+		t.Fatalf("expected 'fire' to be pressed")
+	}
+	m.EndFrame()
+	if !m.Down("fire") || m.JustPressed("fire") {
+		t.Fatalf("expected 'fire' to be held without being pressed again")
+	}
+	// A second binding going down while the first is held does not press the action again
+	m.HandleEvent(&sdl.MouseButtonEvent{Type: sdl.MOUSEBUTTONDOWN, Button: sdl.BUTTON_RIGHT})
+	m.HandleEvent(&sdl.MouseButtonEvent{Type: sdl.MOUSEBUTTONUP, Button: sdl.BUTTON_LEFT})
+	if !m.Down("fire") || m.JustPressed("fire") || m.JustReleased("fire") {
+		t.Fatalf("expected 'fire' to stay held while any binding is down")
+	}
+	m.HandleEvent(&sdl.MouseButtonEvent{Type: sdl.MOUSEBUTTONUP, Button: sdl.BUTTON_RIGHT})
+	if m.Down("fire") || !m.JustReleased("fire") {
+		t.Fatalf("expected 'fire' to be released")
+	}
+}
+
+func TestMapAxis(t *testing.T) {
+	m := NewMap()
+	err := m.BindAxis("look", AxisBinding{Input: "Mouse X", Scale: 0.5}, AxisBinding{Input: "Mouse Left", Scale: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.HandleEvent(&sdl.MouseMotionEvent{XRel: 4})
+	m.HandleEvent(&sdl.MouseMotionEvent{XRel: 2})
+	m.HandleEvent(&sdl.MouseButtonEvent{Type: sdl.MOUSEBUTTONDOWN, Button: sdl.BUTTON_LEFT})
+	if v := m.Axis("look"); v != 5 {
+		t.Fatalf("expected axis value 5, got %f", v)
+	}
+	m.EndFrame()
+	if v := m.Axis("look"); v != 2 {
+		t.Fatalf("expected mouse movement to be reset, got %f", v)
+	}
+	if err = m.Bind("look", "Mouse Y"); err == nil {
+		t.Fatalf("expected binding a mouse axis to an action to fail")
+	}
+}
+
+// recordedPad is a short recording of a controller: the left stick drifting inside the dead zone, pushed fully up,
+// the right trigger pulled and A tapped, then the controller being unplugged with the stick still held
+var recordedPad = []sdl.Event{
+	&sdl.ControllerAxisEvent{Type: sdl.CONTROLLERAXISMOTION, Axis: sdl.CONTROLLER_AXIS_LEFTY, Value: 3000},
+	&sdl.ControllerAxisEvent{Type: sdl.CONTROLLERAXISMOTION, Axis: sdl.CONTROLLER_AXIS_LEFTY, Value: -32768},
+	&sdl.ControllerAxisEvent{Type: sdl.CONTROLLERAXISMOTION, Axis: sdl.CONTROLLER_AXIS_TRIGGERRIGHT, Value: 32767},
+	&sdl.ControllerButtonEvent{Type: sdl.CONTROLLERBUTTONDOWN, Button: sdl.CONTROLLER_BUTTON_A},
+	&sdl.ControllerButtonEvent{Type: sdl.CONTROLLERBUTTONUP, Button: sdl.CONTROLLER_BUTTON_A},
+	&sdl.ControllerDeviceEvent{Type: sdl.CONTROLLERDEVICEREMOVED},
+}
+
+func TestMapRecordedGamepad(t *testing.T) {
+	m := NewMap()
+	if err := m.BindAxis("forward", AxisBinding{Input: "Pad Left Y", Scale: -1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Bind("boost", "Pad Right Trigger"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Bind("up", "Pad Left Y-"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Bind("jump", "Pad A"); err != nil {
+		t.Fatal(err)
+	}
+
+	m.HandleEvent(recordedPad[0])
+	if v := m.Axis("forward"); v != 0 {
+		t.Fatalf("expected stick drift inside the dead zone to read 0, got %f", v)
+	}
+	for _, ev := range recordedPad[1:5] {
+		m.HandleEvent(ev)
+	}
+	if v := m.Axis("forward"); v != 1 {
+		t.Fatalf("expected fully pushed stick to read 1, got %f", v)
+	}
+	if !m.Down("boost") || !m.Down("up") {
+		t.Fatalf("expected trigger and stick to hold their actions down")
+	}
+	if m.Down("jump") || !m.JustPressed("jump") || !m.JustReleased("jump") {
+		t.Fatalf("expected tapped button to be pressed and released within the frame")
+	}
+
+	m.HandleEvent(recordedPad[5])
+	if v := m.Axis("forward"); v != 0 || m.Down("boost") || !m.JustReleased("boost") {
+		t.Fatalf("expected unplugging the controller to release everything")
+	}
+}
+
+func TestMapUnplugOnlyReleasesThatPad(t *testing.T) {
+	m := NewMap()
+	if err := m.BindAxis("forward", AxisBinding{Input: "Pad Left Y", Scale: -1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Bind("jump", "Pad A"); err != nil {
+		t.Fatal(err)
+	}
+	m.HandleEvent(&sdl.ControllerButtonEvent{Type: sdl.CONTROLLERBUTTONDOWN, Which: 1, Button: sdl.CONTROLLER_BUTTON_A})
+	m.HandleEvent(&sdl.ControllerAxisEvent{Type: sdl.CONTROLLERAXISMOTION, Which: 2, Axis: sdl.CONTROLLER_AXIS_LEFTY, Value: -32768})
+	// A controller at rest does not cancel out the other one
+	m.HandleEvent(&sdl.ControllerAxisEvent{Type: sdl.CONTROLLERAXISMOTION, Which: 1, Axis: sdl.CONTROLLER_AXIS_LEFTY, Value: 0})
+	if v := m.Axis("forward"); v != 1 || !m.Down("jump") {
+		t.Fatalf("expected both controllers to contribute, got axis %f and jump %t", v, m.Down("jump"))
+	}
+
+	m.HandleEvent(&sdl.ControllerDeviceEvent{Type: sdl.CONTROLLERDEVICEREMOVED, Which: 2})
+	if v := m.Axis("forward"); v != 0 || !m.Down("jump") {
+		t.Fatalf("expected only the unplugged controller to be released, got axis %f and jump %t", v, m.Down("jump"))
+	}
+	m.HandleEvent(&sdl.ControllerDeviceEvent{Type: sdl.CONTROLLERDEVICEREMOVED, Which: 1})
+	if m.Down("jump") || !m.JustReleased("jump") {
+		t.Fatalf("expected unplugging the last controller to release its button")
+	}
+}
+
+func TestRecordingRoundTrip(t *testing.T) {
+	rec := NewRecording()
+	rec.AddFrame(16*time.Millisecond, recordedPad[:3])
+	rec.AddFrame(33*time.Millisecond, nil)
+	rec.AddFrame(50*time.Millisecond, append(recordedPad[3:], &sdl.QuitEvent{Type: sdl.QUIT}))
+	path := filepath.Join(t.TempDir(), "recording.json")
+	if err := SaveRecording(path, rec); err != nil {
+		t.Fatal(err)
+	}
+	replay, err := LoadRecording(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Feeding the replay through a map has to end in the same state as feeding the original events
+	live, replayed := NewMap(), NewMap()
+	for _, m := range []*Map{live, replayed} {
+		if err = m.BindAxis("forward", AxisBinding{Input: "Pad Left Y", Scale: -1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := range rec.Frames {
+		f, ok := replay.NextFrame()
+		if !ok {
+			t.Fatalf("replay ended after %d of %d frames", i, len(rec.Frames))
+		}
+		if f.Elapsed != rec.Frames[i].Elapsed || len(f.Events) != len(rec.Frames[i].Events) {
+			t.Fatalf("frame %d differs: %v, expected %v", i, f, rec.Frames[i])
+		}
+		for j := range f.Events {
+			live.HandleEvent(rec.Frames[i].Events[j])
+			replayed.HandleEvent(f.Events[j])
+		}
+		if live.Axis("forward") != replayed.Axis("forward") {
+			t.Fatalf("frame %d: replayed axis %f, expected %f", i, replayed.Axis("forward"), live.Axis("forward"))
+		}
+	}
+	if _, ok := replay.NextFrame(); ok {
+		t.Fatalf("expected replay to end with the recording")
+	}
+}
+
+func TestRecordingAssetFrames(t *testing.T) {
+	rec := NewRecording()
+	rec.AddFrame(16*time.Millisecond, nil)
+	rec.AddFrame(33*time.Millisecond, nil)
+	rec.AddAsset("dragon")
+	path := filepath.Join(t.TempDir(), "recording.json")
+	if err := SaveRecording(path, rec); err != nil {
+		t.Fatal(err)
+	}
+	replay, err := LoadRecording(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if due := replay.AssetsDue(); len(due) != 0 {
+		t.Fatalf("expected no asset due by frame 0, got %v", due)
+	}
+	replay.NextFrame()
+	if due := replay.AssetsDue(); !reflect.DeepEqual(due, []string{"dragon"}) {
+		t.Fatalf("expected the dragon to be due by frame 1, got %v", due)
+	}
+	if replay.TakeAsset("dragon") {
+		t.Fatalf("expected the dragon to be held in frame 0")
+	}
+	replay.NextFrame()
+	if !replay.TakeAsset("dragon") {
+		t.Fatalf("expected the dragon to finish in frame 1")
+	}
+	if replay.TakeAsset("dragon") || len(replay.AssetsDue()) != 0 {
+		t.Fatalf("expected the dragon to finish only once")
+	}
+	if replay.TakeAsset("texture") {
+		t.Fatalf("expected an asset missing from the recording never to finish")
+	}
+}
+
+func TestRecordingCopiesReusedEvents(t *testing.T) {
+	// sdl.PollEvent returns every event of a frame in the same buffer, polling copies them one by one
+	buffer := &sdl.KeyboardEvent{Type: sdl.KEYDOWN, Keysym: sdl.Keysym{Sym: sdl.K_w}}
+	events := []sdl.Event{CopyEvent(buffer)}
+	buffer.Type, buffer.Keysym.Sym = sdl.KEYUP, sdl.K_s
+	events = append(events, CopyEvent(buffer), buffer)
+
+	rec := NewRecording()
+	rec.AddFrame(16*time.Millisecond, events)
+	buffer.Type, buffer.Keysym.Sym = sdl.KEYDOWN, sdl.K_ESCAPE
+	got := rec.Frames[0].Events
+	expected := []sdl.Event{
+		&sdl.KeyboardEvent{Type: sdl.KEYDOWN, Keysym: sdl.Keysym{Sym: sdl.K_w}},
+		&sdl.KeyboardEvent{Type: sdl.KEYUP, Keysym: sdl.Keysym{Sym: sdl.K_s}},
+		&sdl.KeyboardEvent{Type: sdl.KEYUP, Keysym: sdl.Keysym{Sym: sdl.K_s}},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected recorded events %v, got %v", expected, got)
+	}
+}
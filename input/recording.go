@@ -0,0 +1,209 @@
+package input
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"time"
+
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// recordable lists the events a Recording can store, keyed by their type name. These are all events the application
+// reacts to, anything else is dropped when saving.
+var recordable = map[string]func() sdl.Event{
+	"KeyboardEvent":         func() sdl.Event { return &sdl.KeyboardEvent{} },
+	"MouseMotionEvent":      func() sdl.Event { return &sdl.MouseMotionEvent{} },
+	"MouseButtonEvent":      func() sdl.Event { return &sdl.MouseButtonEvent{} },
+	"MouseWheelEvent":       func() sdl.Event { return &sdl.MouseWheelEvent{} },
+	"ControllerAxisEvent":   func() sdl.Event { return &sdl.ControllerAxisEvent{} },
+	"ControllerButtonEvent": func() sdl.Event { return &sdl.ControllerButtonEvent{} },
+	"ControllerDeviceEvent": func() sdl.Event { return &sdl.ControllerDeviceEvent{} },
+	"WindowEvent":           func() sdl.Event { return &sdl.WindowEvent{} },
+	"QuitEvent":             func() sdl.Event { return &sdl.QuitEvent{} },
+}
+
+// Frame is one iteration of the event loop: the time elapsed since the loop started and all events that arrived
+// before the frame was drawn
+type Frame struct {
+	Elapsed time.Duration
+	Events  []sdl.Event
+}
+
+// AssetFrame is the index of the frame an asset finished loading in, see: Recording.AddAsset
+type AssetFrame struct {
+	Name  string
+	Frame int
+}
+
+// Recording is a sequence of frames. Replaying it feeds the same events at the same frame times into the loop, so
+// everything driven by events and elapsed time behaves exactly as when it was recorded. Assets loaded in the background
+// are part of it as well, they have to finish in the same frames when replayed.
+type Recording struct {
+	Frames []Frame
+	Assets []AssetFrame
+
+	next int
+	// Marks the entries of Assets taken while replaying, see: TakeAsset
+	taken []bool
+}
+
+func NewRecording() *Recording {
+	return &Recording{}
+}
+
+// CopyEvent returns a copy of the event that does not share memory with it. Events returned by sdl.PollEvent all point
+// into the same static buffer, which the next poll overwrites, so they have to be copied before polling again.
+func CopyEvent(ev sdl.Event) sdl.Event {
+	v := reflect.ValueOf(ev)
+	if v.Kind() != reflect.Pointer || v.IsNil() {
+		return ev
+	}
+	c := reflect.New(v.Elem().Type())
+	c.Elem().Set(v.Elem())
+	return c.Interface().(sdl.Event)
+}
+
+// AddFrame appends a frame to the recording. The events are copied, so they may be reused by the caller.
+func (r *Recording) AddFrame(elapsed time.Duration, events []sdl.Event) {
+	copied := make([]sdl.Event, len(events))
+	for i, ev := range events {
+		copied[i] = CopyEvent(ev)
+	}
+	r.Frames = append(r.Frames, Frame{Elapsed: elapsed, Events: copied})
+}
+
+// NextFrame returns the next frame to replay, ok is false once all frames have been replayed
+func (r *Recording) NextFrame() (f Frame, ok bool) {
+	if r.next >= len(r.Frames) {
+		return Frame{}, false
+	}
+	f = r.Frames[r.next]
+	r.next++
+	return f, true
+}
+
+// Rewind restarts the replay at the first frame
+func (r *Recording) Rewind() {
+	r.next = 0
+	r.taken = nil
+}
+
+// AddAsset notes that the named asset finished loading in the frame added last
+func (r *Recording) AddAsset(name string) {
+	r.Assets = append(r.Assets, AssetFrame{Name: name, Frame: len(r.Frames) - 1})
+}
+
+// AssetsDue returns the names of the assets that had finished loading by the frame NextFrame returns next and have not
+// been taken yet
+func (r *Recording) AssetsDue() []string {
+	var names []string
+	for i, a := range r.Assets {
+		if a.Frame <= r.next && !r.isTaken(i) {
+			names = append(names, a.Name)
+		}
+	}
+	return names
+}
+
+// TakeAsset reports whether the named asset may finish loading in the frame replayed last, as it did so by this frame
+// when recorded. Assets the recording never saw finish are never taken, they keep loading just as they did.
+func (r *Recording) TakeAsset(name string) bool {
+	for i, a := range r.Assets {
+		if a.Name != name || r.isTaken(i) {
+			continue
+		}
+		if a.Frame > r.next-1 {
+			return false
+		}
+		if r.taken == nil {
+			r.taken = make([]bool, len(r.Assets))
+		}
+		r.taken[i] = true
+		return true
+	}
+	return false
+}
+
+func (r *Recording) isTaken(i int) bool {
+	return r.taken != nil && r.taken[i]
+}
+
+// File handling
+// ----------------------------------------------------------------------------------------------------------
+
+type recordedEvent struct {
+	Kind  string
+	Event json.RawMessage
+}
+
+type recordedFrame struct {
+	Elapsed time.Duration
+	Events  []recordedEvent
+}
+
+type recordingFile struct {
+	Frames []recordedFrame
+	Assets []AssetFrame
+}
+
+// SaveRecording writes the recording to a json file. Events of types not listed in recordable are dropped.
+func SaveRecording(path string, r *Recording) error {
+	frames := make([]recordedFrame, len(r.Frames))
+	for i, f := range r.Frames {
+		frames[i].Elapsed = f.Elapsed
+		for _, ev := range f.Events {
+			kind := reflect.TypeOf(ev).Elem().Name()
+			if _, ok := recordable[kind]; !ok {
+				continue
+			}
+			b, err := json.Marshal(ev)
+			if err != nil {
+				return fmt.Errorf("failed to encode %s of frame %d: %w", kind, i, err)
+			}
+			frames[i].Events = append(frames[i].Events, recordedEvent{Kind: kind, Event: b})
+		}
+	}
+	b, err := json.Marshal(recordingFile{Frames: frames, Assets: r.Assets})
+	if err != nil {
+		return fmt.Errorf("failed to encode recording: %w", err)
+	}
+	return os.WriteFile(path, b, 0644)
+}
+
+// LoadRecording reads a recording written by SaveRecording
+func LoadRecording(path string) (*Recording, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file recordingFile
+	if err = json.Unmarshal(b, &file); err != nil {
+		// Recordings made before assets were recorded hold only their frames
+		if legacyErr := json.Unmarshal(b, &file.Frames); legacyErr != nil {
+			return nil, fmt.Errorf("failed to decode recording '%s': %w", path, err)
+		}
+	}
+	frames := file.Frames
+	if len(frames) == 0 {
+		return nil, errors.New("recording contains no frames")
+	}
+	r := &Recording{Frames: make([]Frame, len(frames)), Assets: file.Assets}
+	for i, f := range frames {
+		r.Frames[i].Elapsed = f.Elapsed
+		for _, re := range f.Events {
+			newEvent, ok := recordable[re.Kind]
+			if !ok {
+				return nil, fmt.Errorf("unknown event '%s' in frame %d of '%s'", re.Kind, i, path)
+			}
+			ev := newEvent()
+			if err = json.Unmarshal(re.Event, ev); err != nil {
+				return nil, fmt.Errorf("failed to decode %s in frame %d of '%s': %w", re.Kind, i, path, err)
+			}
+			r.Frames[i].Events = append(r.Frames[i].Events, ev)
+		}
+	}
+	return r, nil
+}
@@ -2,13 +2,14 @@ package main
 
 import "C"
 import (
+	"GPU_fluid_simulation/input"
 	"GPU_fluid_simulation/model"
 	"GPU_fluid_simulation/renderer"
-	"GPU_fluid_simulation/stl"
+	"errors"
+	"flag"
 	"fmt"
 	vm "local/vector_math"
 	"log"
-	"math"
 	"os"
 	"runtime"
 	"time"
@@ -16,10 +17,61 @@ import (
 	"github.com/veandco/go-sdl2/sdl"
 )
 
-const MOV_UNITS_PER_SEC = 5
-const MOUSE_SENSITIVITY = 0.5
+const FRAME_PADDING = 0.1
+const DRAGON_PATH = "C:\\Users\\tizia\\GolandProjects\\GPU_fluid_simulation\\stl\\tree01.stl"
+const CAM_PATH_FILE = "camera_path.json"
+const CAM_PATH_KEYFRAME_GAP = 2
+const BINDINGS_FILE = "bindings.json"
+const RENDERER_CONFIG_FILE = "renderer.json"
+
+// FRAME_LIMIT_FPS is the limit toggled on by ACTION_TOGGLE_FRAME_LIMIT, unless the renderer options set another one
+const FRAME_LIMIT_FPS = 60
+
+// Actions and axes of the application, their default bindings are set in defaultBindings
+const (
+	ACTION_TOGGLE_PROJECTION  = "toggle_projection"
+	ACTION_TOGGLE_TARGET      = "toggle_target"
+	ACTION_RESET_CAMERA       = "reset_camera"
+	ACTION_FRAME_SCENE        = "frame_scene"
+	ACTION_FRAME_DRAGON       = "frame_dragon"
+	ACTION_CYCLE_DEPTH        = "cycle_depth"
+	ACTION_ADD_KEYFRAME       = "add_keyframe"
+	ACTION_PLAY_PATH          = "play_path"
+	ACTION_SAVE_PATH          = "save_path"
+	ACTION_LOAD_PATH          = "load_path"
+	ACTION_CYCLE_CONTROLLER   = "cycle_controller"
+	ACTION_CYCLE_PRESENT_MODE = "cycle_present_mode"
+	ACTION_TOGGLE_FRAME_LIMIT = "toggle_frame_limit"
+	ACTION_MEMORY_REPORT      = "memory_report"
+	AXIS_ZOOM                 = "zoom"
+)
+
+var defaultBindings = input.Config{
+	Actions: map[string][]string{
+		ACTION_TOGGLE_PROJECTION:  {"1", "Pad Back"},
+		ACTION_TOGGLE_TARGET:      {"2"},
+		ACTION_RESET_CAMERA:       {"3", "Pad Start"},
+		ACTION_FRAME_SCENE:        {"4", "Pad Left Shoulder"},
+		ACTION_FRAME_DRAGON:       {"5", "Pad Right Shoulder"},
+		ACTION_CYCLE_DEPTH:        {"6"},
+		ACTION_ADD_KEYFRAME:       {"7"},
+		ACTION_PLAY_PATH:          {"8", "Pad X"},
+		ACTION_SAVE_PATH:          {"9"},
+		ACTION_LOAD_PATH:          {"0"},
+		ACTION_CYCLE_CONTROLLER:   {"C", "Pad Y"},
+		ACTION_CYCLE_PRESENT_MODE: {"V"},
+		ACTION_TOGGLE_FRAME_LIMIT: {"L"},
+		ACTION_MEMORY_REPORT:      {"M"},
+	},
+	Axes: map[string][]input.AxisBinding{
+		AXIS_ZOOM: {{Input: "Mouse Wheel", Scale: 1}},
+	},
+}
 
 func init() {
+	// SDL's window and event functions, and with them the render loop, must stay on the main OS thread. Locking it in
+	// init keeps main's goroutine on it. The renderer's record workers lock OS threads of their own.
+	runtime.LockOSThread()
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 	log.SetOutput(os.Stdout)
 	log.Println("Stating fluid simulation")
@@ -30,97 +82,286 @@ var dtDraw = time.Now()
 var fpsIdx = 0
 var fpsAcc = [64]float64{}
 var fps = 0.0
-var currentlyPressed []sdl.Keycode
+
+// Camera controllers can be cycled at runtime, the fly controller is the default
+var camCtrls = []model.CameraController{
+	model.NewFlyController(),
+	model.NewOrbitController(vm.Vec3{}),
+	model.NewArcballController(vm.Vec3{}),
+}
+var ctrlIdx = 0
+var camCtrl = camCtrls[ctrlIdx]
+var camPath = model.NewCameraPath(model.PATH_CATMULL_ROM)
+var actions = input.NewMap()
+
+// Assets loading in the background, shown in the window title until they are done
+var loading []*renderer.Asset
+var gamepads = input.NewGamepads()
+
+var recordPath = flag.String("record", "", "record all input with frame timings to this file")
+var replayPath = flag.String("replay", "", "replay input recorded with -record instead of reading it live")
+var configPath = flag.String("config", RENDERER_CONFIG_FILE, "renderer options file, flags of single options take precedence")
+var applyRendererFlags = renderer.RegisterFlags(flag.CommandLine)
 
 func onIteration(event sdl.Event, c *renderer.Core) {
-	switch ev := event.(type) {
-	case *sdl.MouseMotionEvent:
-		if ev.State == 4 {
-			if ev.YRel != 0 {
-				yRotAxis := c.Cam.LookDir.Cross(c.Cam.Up).ScalarMul(-float32(ev.YRel))
-				c.Cam.Turn(MOUSE_SENSITIVITY, yRotAxis)
-			}
-			if ev.XRel != 0 {
-				xRotAxis := c.Cam.Up.ScalarMul(-float32(ev.XRel))
-				c.Cam.Turn(MOUSE_SENSITIVITY, xRotAxis)
+	gamepads.HandleEvent(event)
+	actions.HandleEvent(event)
+	camCtrl.HandleEvent(c.Cam, event)
+	// Inactive controllers still follow the window size, to have it right once cycled to
+	if _, ok := event.(*sdl.WindowEvent); ok {
+		for _, ctrl := range camCtrls {
+			if ctrl != camCtrl {
+				ctrl.HandleEvent(c.Cam, event)
 			}
 		}
-	case *sdl.KeyboardEvent:
-		if ev.Type == sdl.KEYUP {
-			removePressedKey(ev.Keysym.Sym)
-			switch ev.Keysym.Sym {
-			case sdl.K_1:
-				var newProj int
-				if c.Cam.ProjectionType == model.CAM_PERSPECTIVE_PROJECTION {
-					newProj = model.CAM_ORTHOGRAPHIC_PROJECTION
-				} else {
-					newProj = model.CAM_PERSPECTIVE_PROJECTION
-				}
-				log.Printf("Switching projection to -> %d", newProj)
-				c.Cam.ProjectionType = newProj
-			case sdl.K_2:
-				if c.Cam.LookTarget != nil {
-					c.Cam.LookTarget = nil
-					log.Printf("Free camera resumed at Pos:%v, LookDir:%v", c.Cam.Pos, c.Cam.LookDir)
-				} else {
-					c.Cam.SetTarget(vm.Vec3{})
-					log.Printf("Locked camera to Pos:%v, LookTarget:%v", c.Cam.Pos, c.Cam.LookTarget)
-				}
-			case sdl.K_3:
-				// Reset camera
-				c.Cam.Pos = vm.Vec3{Z: -3}
-				c.Cam.LookDir = vm.Vec3{Z: 1}
-				c.Cam.LookTarget = nil
-				log.Printf("Reset camera to Pos:%v, LookDir:%v", c.Cam.Pos, c.Cam.LookDir)
+	}
+}
+
+// handleActions reacts to the actions triggered during the last frame. Each action is checked on its own, as several
+// may have been pressed in the same frame. Actions moving the camera run between the update steps, so they snap it to
+// its new pose instead of having it drawn on the way there, see: Core.SnapCamera.
+func handleActions(c *renderer.Core) {
+	defer actions.EndFrame()
+	// Moving an orthographic camera does not change the size of things on screen, zoom instead
+	if zoom := actions.Axis(AXIS_ZOOM); zoom != 0 && c.Cam.ProjectionType == model.CAM_ORTHOGRAPHIC_PROJECTION {
+		c.Cam.ZoomBy(int32(zoom))
+	}
+	if actions.JustPressed(ACTION_TOGGLE_PROJECTION) {
+		var newProj int
+		if c.Cam.ProjectionType == model.CAM_PERSPECTIVE_PROJECTION {
+			newProj = model.CAM_ORTHOGRAPHIC_PROJECTION
+		} else {
+			newProj = model.CAM_PERSPECTIVE_PROJECTION
+		}
+		log.Printf("Switching projection to -> %d", newProj)
+		c.Cam.ProjectionType = newProj
+	}
+	if actions.JustPressed(ACTION_TOGGLE_TARGET) {
+		if c.Cam.LookTarget != nil {
+			c.Cam.LookTarget = nil
+			log.Printf("Free camera resumed at Pos:%v, LookDir:%v", c.Cam.Pos, c.Cam.LookDir)
+		} else {
+			c.Cam.SetTarget(vm.Vec3{})
+			log.Printf("Locked camera to Pos:%v, LookTarget:%v", c.Cam.Pos, c.Cam.LookTarget)
+		}
+		c.SnapCamera()
+	}
+	if actions.JustPressed(ACTION_RESET_CAMERA) {
+		// Reset camera
+		c.Cam.Pos = vm.Vec3{Z: -3}
+		c.Cam.LookDir = vm.Vec3{Z: 1}
+		c.Cam.LookTarget = nil
+		c.Cam.Up = vm.Vec3{Y: -1}
+		camCtrl.Attach(c.Cam)
+		c.SnapCamera()
+		log.Printf("Reset camera to Pos:%v, LookDir:%v", c.Cam.Pos, c.Cam.LookDir)
+	}
+	if actions.JustPressed(ACTION_FRAME_SCENE) {
+		// Fit the whole scene into view
+		b, err := c.SceneBounds()
+		if err != nil {
+			log.Println(err)
+		} else {
+			frameCamera(c, b)
+			log.Printf("Framed scene, camera at Pos:%v, LookDir:%v", c.Cam.Pos, c.Cam.LookDir)
+		}
+	}
+	if actions.JustPressed(ACTION_FRAME_DRAGON) {
+		// Fit the dragon into view
+		m, err := c.FindInScene("Dragon")
+		if err != nil {
+			log.Println(err)
+		} else {
+			frameCamera(c, m.WorldBounds())
+			log.Printf("Framed '%s', camera at Pos:%v, LookDir:%v", m.Name, c.Cam.Pos, c.Cam.LookDir)
+		}
+	}
+	if actions.JustPressed(ACTION_CYCLE_DEPTH) {
+		// Cycle through standard, reverse-Z and infinite reverse-Z depth
+		c.Cam.DepthMode = (c.Cam.DepthMode + 1) % (model.CAM_DEPTH_REVERSE_Z_INF + 1)
+		log.Printf("Switching depth mode to -> %d", c.Cam.DepthMode)
+	}
+	if actions.JustPressed(ACTION_ADD_KEYFRAME) {
+		// Record the current camera state as the next keyframe
+		t := 0.0
+		if len(camPath.Keyframes) > 0 {
+			t = camPath.Duration() + CAM_PATH_KEYFRAME_GAP
+		}
+		camPath.AddKeyframe(t, c.Cam)
+		log.Printf("Added camera keyframe %d at Pos:%v", len(camPath.Keyframes), c.Cam.Pos)
+	}
+	if actions.JustPressed(ACTION_PLAY_PATH) {
+		// Start or stop playing the recorded camera path
+		if _, playing := camCtrl.(*model.CameraPathController); playing {
+			camCtrl = camCtrls[ctrlIdx]
+			log.Printf("Stopped camera path")
+		} else if len(camPath.Keyframes) > 0 {
+			camCtrl = model.NewCameraPathController(camPath)
+			log.Printf("Playing camera path of %.2fs", camPath.Duration())
+		}
+		camCtrl.Attach(c.Cam)
+		c.SnapCamera()
+	}
+	if actions.JustPressed(ACTION_SAVE_PATH) {
+		if err := model.SaveCameraPath(CAM_PATH_FILE, camPath); err != nil {
+			log.Println(err)
+		} else {
+			log.Printf("Saved camera path to %s", CAM_PATH_FILE)
+		}
+	}
+	if actions.JustPressed(ACTION_LOAD_PATH) {
+		p, err := model.LoadCameraPath(CAM_PATH_FILE)
+		if err != nil {
+			log.Println(err)
+		} else {
+			camPath = p
+			log.Printf("Loaded camera path with %d keyframes from %s", len(p.Keyframes), CAM_PATH_FILE)
+		}
+	}
+	if actions.JustPressed(ACTION_CYCLE_CONTROLLER) {
+		// Cycle through the camera controllers
+		ctrlIdx = (ctrlIdx + 1) % len(camCtrls)
+		camCtrl = camCtrls[ctrlIdx]
+		camCtrl.Attach(c.Cam)
+		c.SnapCamera()
+		log.Printf("Switched camera controller to -> %T", camCtrl)
+	}
+	if actions.JustPressed(ACTION_CYCLE_PRESENT_MODE) {
+		// Cycle through the present modes, the swap chain is recreated before the next frame
+		modes := renderer.PresentModes()
+		next := modes[0]
+		for i, m := range modes {
+			if m == c.Options().PresentMode {
+				next = modes[(i+1)%len(modes)]
 			}
 		}
-		if ev.Type == sdl.KEYDOWN {
-			addPressedKey(ev.Keysym.Sym)
+		if err := c.SetPresentMode(next); err != nil {
+			log.Println(err)
+		} else {
+			log.Printf("Switching present mode to -> %s", next)
+		}
+	}
+	if actions.JustPressed(ACTION_TOGGLE_FRAME_LIMIT) {
+		if c.Limiter.MaxFPS() > 0 {
+			c.Limiter.SetMaxFPS(0)
+			log.Printf("Frame rate limit disabled")
+		} else {
+			limit := c.Options().MaxFPS
+			if limit == 0 {
+				limit = FRAME_LIMIT_FPS
+			}
+			c.Limiter.SetMaxFPS(limit)
+			log.Printf("Frame rate limited to %.0f fps", limit)
 		}
 	}
+	if actions.JustPressed(ACTION_MEMORY_REPORT) {
+		log.Printf("GPU memory usage:\n%s", c.MemoryReport())
+	}
+}
+
+// frameCamera fits the given bounds into view and moves the pivot of orbiting controllers onto their center. The camera
+// is snapped to the new view.
+func frameCamera(c *renderer.Core, b model.Bounds) {
+	c.Cam.Frame(b, FRAME_PADDING)
+	switch ctrl := camCtrl.(type) {
+	case *model.OrbitController:
+		ctrl.Pivot = b.Sphere.Center
+	case *model.ArcballController:
+		ctrl.Pivot = b.Sphere.Center
+	}
+	camCtrl.Attach(c.Cam)
+	c.SnapCamera()
+}
+
+// onUpdate moves everything in the world. It runs with a fixed timestep, so movement does not depend on the frame rate.
+func onUpdate(dt time.Duration, c *renderer.Core) {
+	camCtrl.Update(c.Cam, dt)
+	// Hand the camera back to the user once a played path has ended
+	if path, ok := camCtrl.(*model.CameraPathController); ok && path.Done() {
+		camCtrl = camCtrls[ctrlIdx]
+		camCtrl.Attach(c.Cam)
+		log.Printf("Camera path finished")
+	}
 }
 
-func onDraw(elapsed time.Duration, c *renderer.Core) {
+func onDraw(elapsed time.Duration, alpha float64, c *renderer.Core) {
 	drawLast := dtDraw
 	dtDraw = time.Now()
 	delta := dtDraw.Sub(drawLast)
 
-	mod2, err := c.FindInScene("Cube 2")
-	mod1, err := c.FindInScene("Cube 1")
-	if err != nil {
-		log.Println(err)
-	} else {
-		mod1.Rotate(1*0.01, vm.Vec3{X: -0.5, Y: 1})
-		mod2.Rotate(math.Sin(elapsed.Seconds())*45*0.01, vm.Vec3{X: 0.5, Y: 1})
-	}
-
-	// Interactions with the world that should not happen each event, but each frame
-	// ToDo: Introduce third function hook
-	// 	-> Non-render relevant things that happen each frame, e.g.: Scene interactions like moving camera
-	for _, key := range currentlyPressed {
-		switch key {
-		case sdl.K_w:
-			movScale := float32(delta.Seconds()) * MOV_UNITS_PER_SEC
-			c.Cam.Move(c.Cam.LookDir.ScalarMul(movScale))
-		case sdl.K_s:
-			movScale := float32(delta.Seconds()) * MOV_UNITS_PER_SEC
-			c.Cam.Move(c.Cam.LookDir.ScalarMul(-movScale))
-		case sdl.K_d:
-			movScale := float32(delta.Seconds()) * MOV_UNITS_PER_SEC
-			c.Cam.Move(c.Cam.LookDir.Cross(c.Cam.Up).ScalarMul(movScale))
-		case sdl.K_a:
-			movScale := float32(delta.Seconds()) * MOV_UNITS_PER_SEC
-			c.Cam.Move(c.Cam.LookDir.Cross(c.Cam.Up).ScalarMul(-movScale))
-		case sdl.K_SPACE:
-			movScale := float32(delta.Seconds()) * MOV_UNITS_PER_SEC
-			c.Cam.Move(c.Cam.Up.ScalarMul(movScale))
-		case sdl.K_LSHIFT:
-			movScale := float32(delta.Seconds()) * MOV_UNITS_PER_SEC
-			c.Cam.Move(c.Cam.Up.ScalarMul(-movScale))
-		}
-
-	}
-	c.Win.Win.SetTitle(fmt.Sprintf("%s - FPS:%8.2f", c.Win.Title, trackFps(delta)))
+	handleActions(c)
+	title := fmt.Sprintf(
+		"%s - FPS:%8.2f (%s) - Drawn: %d, Culled: %d",
+		c.Win.Title, trackFps(delta), c.PresentMode(), c.Stats.Drawn, c.Stats.Culled,
+	)
+	stillLoading := loading[:0]
+	for _, a := range loading {
+		if a.State() < renderer.ASSET_READY {
+			stillLoading = append(stillLoading, a)
+			title += fmt.Sprintf(" - Loading %v", a)
+		}
+	}
+	loading = stillLoading
+	c.Win.Win.SetTitle(title)
+}
+
+// normalizeDragon fits the loaded dragon into a unit sphere around the origin, as STL files come in arbitrary units
+func normalizeDragon(dragonModel *model.Model) {
+	dragonBounds := dragonModel.Bounds()
+	log.Printf("Dragon bounds: %v, radius: %f", dragonBounds.Box, dragonBounds.Sphere.Radius)
+	dragonModel.Rotate(-90, vm.Vec3{X: 1, Y: 0})
+	if dragonBounds.Sphere.Radius > 0 {
+		s := 1 / dragonBounds.Sphere.Radius
+		dragonModel.Scale(vm.Vec3{X: s, Y: s, Z: s})
+	}
+	dragonModel.Translate(dragonBounds.Sphere.Center.ScalarMul(-1))
+}
+
+// loadBindings sets up the default bindings and overrides them with the ones found in BINDINGS_FILE. The file is
+// applied to the camera controllers as well, so their movement keys and sticks can be rebound the same way.
+func loadBindings() {
+	if err := actions.Apply(defaultBindings); err != nil {
+		log.Panicf("Invalid default bindings: %v", err)
+	}
+	cfg, err := input.LoadConfig(BINDINGS_FILE)
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	} else if err != nil {
+		log.Printf("Ignoring bindings: %v", err)
+		return
+	}
+	if err = actions.Apply(cfg); err != nil {
+		log.Printf("Failed to apply bindings: %v", err)
+	}
+	for _, ctrl := range camCtrls {
+		var in *input.Map
+		switch c := ctrl.(type) {
+		case *model.FlyController:
+			in = c.Input
+		case *model.OrbitController:
+			in = c.Input
+		case *model.ArcballController:
+			in = c.Input
+		default:
+			continue
+		}
+		if err = in.Apply(cfg); err != nil {
+			log.Printf("Failed to apply bindings to %T: %v", ctrl, err)
+		}
+	}
+	log.Printf("Loaded bindings from %s", BINDINGS_FILE)
+}
+
+// loadRendererOptions reads the renderer options from the config file, keeping the defaults if there is none, and
+// applies the renderer's command line flags on top
+func loadRendererOptions() (renderer.Options, error) {
+	opts, err := renderer.LoadOptions(*configPath)
+	if err == nil {
+		log.Printf("Loaded renderer options from %s", *configPath)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return opts, err
+	}
+	return opts, applyRendererFlags(&opts)
 }
 
 func trackFps(dt time.Duration) float64 {
@@ -137,33 +378,12 @@ func trackFps(dt time.Duration) float64 {
 	return fps
 }
 
-func addPressedKey(key sdl.Keycode) {
-	inList := false
-	for i := range currentlyPressed {
-		if currentlyPressed[i] == key {
-			inList = true
-			break
-		}
-	}
-	if !inList {
-		currentlyPressed = append(currentlyPressed, key)
-	}
-}
-
-func removePressedKey(key sdl.Keycode) {
-	for i := range currentlyPressed {
-		if currentlyPressed[i] == key {
-			currentlyPressed[i] = currentlyPressed[len(currentlyPressed)-1]
-			currentlyPressed = currentlyPressed[:len(currentlyPressed)-1]
-			return
-		}
-	}
-}
-
 func main() {
-	dragon := stl.ReadStlFile("C:\\Users\\tizia\\GolandProjects\\GPU_fluid_simulation\\stl\\tree01.stl")
-	dragonModel := model.NewModel(dragon, "Dragon")
-	dragonModel.Rotate(-90, vm.Vec3{X: 1, Y: 0})
+	flag.Parse()
+	loadBindings()
+
+	// A cube stands in for the dragon until it is loaded in the background
+	dragonModel := model.NewCubeModel("Dragon")
 
 	myModel := model.NewCubeModel("Cube 1")
 	myModel.Translate(vm.Vec3{X: 1, Y: 1, Z: -0.5})
@@ -175,17 +395,81 @@ func main() {
 	grid := model.NewGridPlane("Grid")
 	grid.Translate(vm.Vec3{X: -1, Y: 1, Z: -0.5})
 
-	core := renderer.NewRenderCore()
+	opts, err := loadRendererOptions()
+	if err != nil {
+		log.Panicf("Invalid renderer options: %v", err)
+	}
+	core, err := renderer.NewRenderCore(opts)
+	if err != nil {
+		log.Panicf("Failed to initialize renderer: %v", err)
+	}
 	defer core.Destroy()
+	defer gamepads.Close()
 
 	core.DefaultCam()
-	core.AddToScene(dragonModel)
-	core.AddToScene(grid)
-	core.AddToScene(myModel)
-	core.AddToScene(myModel2)
-	core.Loop(
+	for _, ctrl := range camCtrls {
+		if arcball, ok := ctrl.(*model.ArcballController); ok {
+			arcball.Resize(opts.Width, opts.Height)
+		}
+	}
+	if *replayPath != "" {
+		r, err := input.LoadRecording(*replayPath)
+		if err != nil {
+			log.Panicf("Failed to load replay: %v", err)
+		}
+		core.Replay = r
+		log.Printf("Replaying %d frames from %s", len(r.Frames), *replayPath)
+	}
+	if *recordPath != "" {
+		core.Record = input.NewRecording()
+	}
+	camCtrl.Attach(core.Cam)
+	// The dragon's mesh is replaced once loaded, the meshes of the others never change and are drawn in one batch
+	if err = core.AddToScene(dragonModel); err != nil {
+		log.Panicf("Failed to add model to scene: %v", err)
+	}
+	for _, m := range []*model.Model{grid, myModel, myModel2} {
+		if err = core.AddStaticToScene(m); err != nil {
+			log.Panicf("Failed to add static model to scene: %v", err)
+		}
+	}
+	loading = append(loading, core.LoadMesh(dragonModel, DRAGON_PATH, normalizeDragon))
+
+	// Cube 1 spins around its up axis, Cube 2 swings back and forth while bobbing up and down
+	spin := model.NewAnimation(model.ANIM_LOOP)
+	spin.Rotation = model.NewVec3Track(model.INTERP_LINEAR,
+		model.Vec3Keyframe{Time: 0, Value: vm.Vec3{}},
+		model.Vec3Keyframe{Time: 6, Value: vm.Vec3{Y: 360}},
+	)
+	core.Animator.Play(myModel, spin)
+
+	swing := model.NewAnimation(model.ANIM_PING_PONG)
+	swing.Rotation = model.NewVec3Track(model.INTERP_CUBIC,
+		model.Vec3Keyframe{Time: 0, Value: vm.Vec3{Y: -45}},
+		model.Vec3Keyframe{Time: 2, Value: vm.Vec3{Y: 45}},
+	)
+	swing.Translation = model.NewVec3Track(model.INTERP_CUBIC,
+		model.Vec3Keyframe{Time: 0, Value: vm.Vec3{}},
+		model.Vec3Keyframe{Time: 1, Value: vm.Vec3{Y: -0.25}},
+		model.Vec3Keyframe{Time: 2, Value: vm.Vec3{}},
+	)
+	core.Animator.Play(myModel2, swing)
+	err = core.Loop(
 		onIteration,
+		onUpdate,
 		onDraw,
 	)
-	core.ClearScene()
+	if err != nil {
+		log.Printf("Render loop stopped: %v", err)
+	}
+	if err = core.ClearScene(); err != nil {
+		log.Printf("Failed to clear scene: %v", err)
+	}
+	if core.Record != nil {
+		if err := input.SaveRecording(*recordPath, core.Record); err != nil {
+			log.Printf("Failed to save recording: %v", err)
+		} else {
+			log.Printf("Saved %d recorded frames to %s", len(core.Record.Frames), *recordPath)
+		}
+	}
 }
@@ -0,0 +1,249 @@
+package model
+
+import (
+	vm "local/vector_math"
+	"math"
+	"sort"
+	"time"
+)
+
+// Interpolation between two keyframes of a track
+const (
+	INTERP_STEP   = iota // hold the previous keyframe's value until the next one is reached
+	INTERP_LINEAR = iota
+	INTERP_CUBIC  = iota // Catmull-Rom through all keyframes, see catmullRom
+)
+
+// Playback modes deciding what happens once an animation reaches its end
+const (
+	ANIM_ONCE      = iota // stop on the last keyframe
+	ANIM_LOOP      = iota // jump back to the start
+	ANIM_PING_PONG = iota // play backwards to the start, then forwards again
+)
+
+// Vec3Keyframe is a value a track has to reach at a given time in seconds
+type Vec3Keyframe struct {
+	Time  float64
+	Value vm.Vec3
+}
+
+// Vec3Track is a list of keyframes sorted by time for a single animated property
+type Vec3Track struct {
+	Keyframes     []Vec3Keyframe
+	Interpolation int
+}
+
+func NewVec3Track(interpolation int, kfs ...Vec3Keyframe) *Vec3Track {
+	t := &Vec3Track{Interpolation: interpolation, Keyframes: kfs}
+	sort.SliceStable(t.Keyframes, func(i, j int) bool { return t.Keyframes[i].Time < t.Keyframes[j].Time })
+	return t
+}
+
+// Duration returns the time of the last keyframe
+func (tr *Vec3Track) Duration() float64 {
+	if tr == nil || len(tr.Keyframes) == 0 {
+		return 0
+	}
+	return tr.Keyframes[len(tr.Keyframes)-1].Time
+}
+
+// Sample returns the track's value at time t, clamped to the first and last keyframe
+func (tr *Vec3Track) Sample(t float64) vm.Vec3 {
+	kfs := tr.Keyframes
+	if len(kfs) == 0 {
+		return vm.Vec3{}
+	}
+	if t <= kfs[0].Time {
+		return kfs[0].Value
+	}
+	if t >= kfs[len(kfs)-1].Time {
+		return kfs[len(kfs)-1].Value
+	}
+	i := sort.Search(len(kfs), func(i int) bool { return kfs[i].Time > t }) - 1
+	b, c := kfs[i], kfs[i+1]
+	u := float32((t - b.Time) / (c.Time - b.Time))
+	switch tr.Interpolation {
+	case INTERP_STEP:
+		return b.Value
+	case INTERP_CUBIC:
+		a, d := kfs[max(i-1, 0)], kfs[min(i+2, len(kfs)-1)]
+		return catmullRom(a.Value, b.Value, c.Value, d.Value, u)
+	default:
+		return b.Value.Lerp(c.Value, u)
+	}
+}
+
+// Animation moves a model by translation, rotation and scale tracks. Rotation keyframes are euler angles in degrees
+// (X: roll, Y: pitch, Z: yaw) and are interpolated per component, so going from 0 to 720 spins twice. Tracks left nil
+// keep their identity value. The resulting transform is applied on top of the model's transform at the time the
+// animation started, see Animator.
+type Animation struct {
+	Translation *Vec3Track
+	Rotation    *Vec3Track
+	Scale       *Vec3Track
+
+	Mode    int
+	Speed   float64
+	Playing bool
+
+	time float64
+}
+
+func NewAnimation(mode int) *Animation {
+	return &Animation{
+		Mode:    mode,
+		Speed:   1,
+		Playing: true,
+	}
+}
+
+// Duration returns the length of the longest track
+func (a *Animation) Duration() float64 {
+	return math.Max(a.Translation.Duration(), math.Max(a.Rotation.Duration(), a.Scale.Duration()))
+}
+
+// Advance moves the playhead by dt seconds scaled by the animation's speed
+func (a *Animation) Advance(dt float64) {
+	if !a.Playing {
+		return
+	}
+	a.time += dt * a.Speed
+	if a.Mode == ANIM_ONCE {
+		d := a.Duration()
+		if a.time >= d {
+			a.time = d
+			a.Playing = false
+		} else if a.time < 0 {
+			a.time = 0
+			a.Playing = false
+		}
+	}
+}
+
+// Seek sets the playhead to t seconds
+func (a *Animation) Seek(t float64) {
+	a.time = t
+}
+
+// sampleTime maps the playhead onto the track's time range according to the playback mode
+func (a *Animation) sampleTime() float64 {
+	d := a.Duration()
+	if d <= 0 {
+		return 0
+	}
+	switch a.Mode {
+	case ANIM_LOOP:
+		t := math.Mod(a.time, d)
+		if t < 0 {
+			t += d
+		}
+		return t
+	case ANIM_PING_PONG:
+		t := math.Mod(a.time, 2*d)
+		if t < 0 {
+			t += 2 * d
+		}
+		if t > d {
+			return 2*d - t
+		}
+		return t
+	default:
+		return math.Max(0, math.Min(a.time, d))
+	}
+}
+
+// Transform returns the animation's current transform as translation * rotation * scale
+func (a *Animation) Transform() vm.Mat {
+	t := a.sampleTime()
+	m := vm.NewUnitMat(4)
+	if a.Translation != nil {
+		m = vm.NewTranslation(a.Translation.Sample(t))
+	}
+	if a.Rotation != nil {
+		r := a.Rotation.Sample(t)
+		rm := vm.New4x4RotMat(vm.ToRad(float64(r.Z)), vm.ToRad(float64(r.Y)), vm.ToRad(float64(r.X)))
+		m, _ = m.Mult(&rm)
+	}
+	if a.Scale != nil {
+		sm := vm.NewScale(a.Scale.Sample(t))
+		m, _ = m.Mult(&sm)
+	}
+	return m
+}
+
+// Animator
+// ----------------------------------------------------------------------------------------------------------
+
+type animBinding struct {
+	model *Model
+	anim  *Animation
+	base  vm.Mat
+}
+
+// Animator drives all running animations. It is meant to be updated with the time passed since its last update, which
+// makes animation speed independent of the frame rate.
+type Animator struct {
+	bindings []animBinding
+}
+
+func NewAnimator() *Animator {
+	return &Animator{}
+}
+
+// Play attaches an animation to a model. The model's current transform becomes the base the animation is applied on,
+// an animation already playing on the model is replaced and its base kept.
+func (an *Animator) Play(m *Model, a *Animation) {
+	for i := range an.bindings {
+		if an.bindings[i].model == m {
+			an.bindings[i].anim = a
+			return
+		}
+	}
+	an.bindings = append(an.bindings, animBinding{model: m, anim: a, base: m.Mesh.ModelMat})
+}
+
+// Stop detaches the model's animation and restores the transform it had before the animation started
+func (an *Animator) Stop(m *Model) {
+	for i := range an.bindings {
+		if an.bindings[i].model == m {
+			m.Mesh.ModelMat = an.bindings[i].base
+			an.remove(i)
+			return
+		}
+	}
+}
+
+// Remove detaches the model's animation and leaves the model where it currently is
+func (an *Animator) Remove(m *Model) {
+	for i := range an.bindings {
+		if an.bindings[i].model == m {
+			an.remove(i)
+			return
+		}
+	}
+}
+
+// Animation returns the animation currently attached to the model, or nil
+func (an *Animator) Animation(m *Model) *Animation {
+	for i := range an.bindings {
+		if an.bindings[i].model == m {
+			return an.bindings[i].anim
+		}
+	}
+	return nil
+}
+
+// Update advances all animations by dt and writes the resulting transforms into the models
+func (an *Animator) Update(dt time.Duration) {
+	for i := range an.bindings {
+		b := &an.bindings[i]
+		b.anim.Advance(dt.Seconds())
+		t := b.anim.Transform()
+		b.model.Mesh.ModelMat, _ = b.base.Mult(&t)
+	}
+}
+
+func (an *Animator) remove(i int) {
+	an.bindings[i] = an.bindings[len(an.bindings)-1]
+	an.bindings = an.bindings[:len(an.bindings)-1]
+}
@@ -0,0 +1,122 @@
+package model
+
+import (
+	vm "local/vector_math"
+	"testing"
+	"time"
+)
+
+func testTrack(interpolation int) *Vec3Track {
+	return NewVec3Track(interpolation,
+		Vec3Keyframe{Time: 2, Value: vm.Vec3{X: 4, Y: 2}},
+		Vec3Keyframe{Time: 0, Value: vm.Vec3{}},
+		Vec3Keyframe{Time: 1, Value: vm.Vec3{X: 2}},
+	)
+}
+
+func TestVec3TrackSample(t *testing.T) {
+	tests := []struct {
+		name          string
+		interpolation int
+		t             float64
+		want          vm.Vec3
+	}{
+		{"linear between keyframes", INTERP_LINEAR, 0.25, vm.Vec3{X: 0.5}},
+		{"linear after sorting", INTERP_LINEAR, 1.5, vm.Vec3{X: 3, Y: 1}},
+		{"linear on keyframe", INTERP_LINEAR, 1, vm.Vec3{X: 2}},
+		{"step holds previous keyframe", INTERP_STEP, 1.9, vm.Vec3{X: 2}},
+		{"cubic passes inner keyframe", INTERP_CUBIC, 1, vm.Vec3{X: 2}},
+		{"cubic continuous into inner keyframe", INTERP_CUBIC, 1 - 1e-6, vm.Vec3{X: 2}},
+		{"clamped before start", INTERP_LINEAR, -1, vm.Vec3{}},
+		{"clamped after end", INTERP_CUBIC, 3, vm.Vec3{X: 4, Y: 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := testTrack(tt.interpolation).Sample(tt.t); !nearlyEqualTol(got, tt.want, 1e-4) {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestAnimationPlayback(t *testing.T) {
+	tests := []struct {
+		name    string
+		mode    int
+		speed   float64
+		advance []float64
+		want    vm.Vec3
+		playing bool
+	}{
+		{"once clamps at the end", ANIM_ONCE, 1, []float64{1.5, 1.5}, vm.Vec3{X: 4, Y: 2}, false},
+		{"once clamps at the start backwards", ANIM_ONCE, -1, []float64{0.5}, vm.Vec3{}, false},
+		{"loop wraps to the start", ANIM_LOOP, 1, []float64{1.5, 1}, vm.Vec3{X: 1}, true},
+		{"loop wraps backwards", ANIM_LOOP, -1, []float64{0.5}, vm.Vec3{X: 3, Y: 1}, true},
+		{"ping-pong plays back", ANIM_PING_PONG, 1, []float64{2, 0.5}, vm.Vec3{X: 3, Y: 1}, true},
+		{"ping-pong plays forwards again", ANIM_PING_PONG, 1, []float64{4, 0.5}, vm.Vec3{X: 1}, true},
+		{"speed scales time", ANIM_ONCE, 2, []float64{0.25}, vm.Vec3{X: 1}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := NewAnimation(tt.mode)
+			a.Translation = testTrack(INTERP_LINEAR)
+			a.Speed = tt.speed
+			for _, dt := range tt.advance {
+				a.Advance(dt)
+			}
+			got := a.Transform()
+			want := vm.NewTranslation(tt.want)
+			if !matNearlyEqual(got, want) {
+				t.Fatalf("expected translation %v, got %v", tt.want, got)
+			}
+			if a.Playing != tt.playing {
+				t.Fatalf("expected playing to be %v", tt.playing)
+			}
+		})
+	}
+}
+
+func TestAnimatorRemoveAndStop(t *testing.T) {
+	base := vm.NewTranslation(vm.Vec3{Z: 5})
+	newAnimated := func(an *Animator) *Model {
+		m := NewModel(NewMesh(make([]Vertex, 3), make([]uint32, 3)), "anim")
+		m.Mesh.ModelMat = base
+		a := NewAnimation(ANIM_LOOP)
+		a.Translation = testTrack(INTERP_LINEAR)
+		an.Play(m, a)
+		return m
+	}
+
+	an := NewAnimator()
+	removed, stopped := newAnimated(an), newAnimated(an)
+	an.Update(time.Second)
+	step := vm.NewTranslation(vm.Vec3{X: 2})
+	moved, _ := base.Mult(&step)
+
+	an.Remove(removed)
+	if an.Animation(removed) != nil || an.Animation(stopped) == nil {
+		t.Fatalf("expected only the removed model to be detached")
+	}
+	an.Stop(stopped)
+	if an.Animation(stopped) != nil {
+		t.Fatalf("expected the stopped model to be detached")
+	}
+	an.Update(time.Second)
+	if !matNearlyEqual(removed.Mesh.ModelMat, moved) {
+		t.Fatalf("expected removed model to stay where the animation left it, got %v", removed.Mesh.ModelMat)
+	}
+	if !matNearlyEqual(stopped.Mesh.ModelMat, base) {
+		t.Fatalf("expected stopped model to be back at its base, got %v", stopped.Mesh.ModelMat)
+	}
+}
+
+func matNearlyEqual(a vm.Mat, b vm.Mat) bool {
+	for i := range a {
+		for j := range a[i] {
+			if d := a[i][j] - b[i][j]; d > 1e-4 || d < -1e-4 {
+				return false
+			}
+		}
+	}
+	return true
+}
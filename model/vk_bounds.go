@@ -0,0 +1,179 @@
+package model
+
+import (
+	vm "local/vector_math"
+	"math"
+)
+
+// AABB is an axis-aligned bounding box spanning from Min to Max.
+type AABB struct {
+	Min vm.Vec3
+	Max vm.Vec3
+}
+
+// Center returns the midpoint of the box
+func (b AABB) Center() vm.Vec3 {
+	return b.Min.Add(b.Max).ScalarMul(0.5)
+}
+
+// Extents returns the half size of the box along each axis
+func (b AABB) Extents() vm.Vec3 {
+	return b.Max.Sub(b.Min).ScalarMul(0.5)
+}
+
+// Size returns the full size of the box along each axis
+func (b AABB) Size() vm.Vec3 {
+	return b.Max.Sub(b.Min)
+}
+
+// Union returns the smallest box containing both b and o
+func (b AABB) Union(o AABB) AABB {
+	return AABB{
+		Min: b.Min.Min(o.Min),
+		Max: b.Max.Max(o.Max),
+	}
+}
+
+// BoundingSphere is a sphere enclosing all points of a mesh. It is cheaper to test against than a box but usually
+// looser, which makes it a good first rejection test.
+type BoundingSphere struct {
+	Center vm.Vec3
+	Radius float32
+}
+
+// OBB is an oriented bounding box. It is what an AABB turns into when it is transformed by a model matrix containing
+// a rotation. Axes are normalized, their lengths are folded into HalfExtents.
+type OBB struct {
+	Center      vm.Vec3
+	Axes        [3]vm.Vec3
+	HalfExtents vm.Vec3
+}
+
+// Corners returns the 8 corner points of the oriented box
+func (o OBB) Corners() [8]vm.Vec3 {
+	var corners [8]vm.Vec3
+	for i := range corners {
+		p := o.Center
+		for a, h := range [3]float32{o.HalfExtents.X, o.HalfExtents.Y, o.HalfExtents.Z} {
+			if i&(1<<a) != 0 {
+				p = p.Add(o.Axes[a].ScalarMul(h))
+			} else {
+				p = p.Sub(o.Axes[a].ScalarMul(h))
+			}
+		}
+		corners[i] = p
+	}
+	return corners
+}
+
+// Bounds bundles all bounding volumes known for a mesh. Box and Sphere are always set, Oriented is only meaningful
+// for world space bounds, as the local space bounds are axis-aligned by definition.
+type Bounds struct {
+	Box      AABB
+	Sphere   BoundingSphere
+	Oriented OBB
+}
+
+// computeBounds walks all vertices once to find the AABB, then a second time to find the sphere radius around the
+// box center. This is not the minimal enclosing sphere, but it is stable and cheap to compute.
+func computeBounds(vertices []Vertex) Bounds {
+	if len(vertices) == 0 {
+		return Bounds{}
+	}
+	box := AABB{Min: vertices[0].Pos, Max: vertices[0].Pos}
+	for i := range vertices {
+		box.Min = box.Min.Min(vertices[i].Pos)
+		box.Max = box.Max.Max(vertices[i].Pos)
+	}
+	center := box.Center()
+	radius := float32(0)
+	for i := range vertices {
+		d := vertices[i].Pos.Sub(center).Len()
+		if d > radius {
+			radius = d
+		}
+	}
+	return Bounds{
+		Box:    box,
+		Sphere: BoundingSphere{Center: center, Radius: radius},
+		Oriented: OBB{
+			Center:      center,
+			Axes:        [3]vm.Vec3{{X: 1}, {Y: 1}, {Z: 1}},
+			HalfExtents: box.Extents(),
+		},
+	}
+}
+
+// TransformBounds moves local space bounds into the space described by m. The box is transformed as an oriented box
+// first, then the world AABB is fitted around it. The sphere radius is scaled by the largest axis scale of m.
+func TransformBounds(b Bounds, m vm.Mat) Bounds {
+	center := vm.Apply(b.Box.Center(), 1, m)
+	ext := b.Box.Extents()
+	local := [3]float32{ext.X, ext.Y, ext.Z}
+
+	// Columns of the upper 3x3 are the images of the local basis vectors
+	obb := OBB{Center: center}
+	half := [3]float32{}
+	maxScale := float32(0)
+	for i := 0; i < 3; i++ {
+		col := vm.Vec3{X: m[0][i], Y: m[1][i], Z: m[2][i]}
+		s := col.Len()
+		if s > maxScale {
+			maxScale = s
+		}
+		if s == 0 {
+			obb.Axes[i] = [3]vm.Vec3{{X: 1}, {Y: 1}, {Z: 1}}[i]
+		} else {
+			obb.Axes[i] = col.ScalarMul(1 / s)
+		}
+		half[i] = local[i] * s
+	}
+	obb.HalfExtents = vm.Vec3{X: half[0], Y: half[1], Z: half[2]}
+
+	// World AABB extents along each world axis j: sum_i |m[j][i]| * local extent i
+	var worldExt [3]float32
+	for j := 0; j < 3; j++ {
+		for i := 0; i < 3; i++ {
+			worldExt[j] += float32(math.Abs(float64(m[j][i]))) * local[i]
+		}
+	}
+	we := vm.Vec3{X: worldExt[0], Y: worldExt[1], Z: worldExt[2]}
+
+	return Bounds{
+		Box: AABB{Min: center.Sub(we), Max: center.Add(we)},
+		Sphere: BoundingSphere{
+			Center: vm.Apply(b.Sphere.Center, 1, m),
+			Radius: b.Sphere.Radius * maxScale,
+		},
+		Oriented: obb,
+	}
+}
+
+// MergeBounds returns bounds enclosing all given bounds. The resulting sphere is centered on the merged box and grown
+// until it contains every input sphere. Merging nothing returns zero bounds.
+func MergeBounds(bs ...Bounds) Bounds {
+	if len(bs) == 0 {
+		return Bounds{}
+	}
+	box := bs[0].Box
+	for i := range bs {
+		box = box.Union(bs[i].Box)
+	}
+	center := box.Center()
+	radius := float32(0)
+	for i := range bs {
+		r := bs[i].Sphere.Center.Sub(center).Len() + bs[i].Sphere.Radius
+		if r > radius {
+			radius = r
+		}
+	}
+	return Bounds{
+		Box:    box,
+		Sphere: BoundingSphere{Center: center, Radius: radius},
+		Oriented: OBB{
+			Center:      center,
+			Axes:        [3]vm.Vec3{{X: 1}, {Y: 1}, {Z: 1}},
+			HalfExtents: box.Extents(),
+		},
+	}
+}
@@ -0,0 +1,195 @@
+package model
+
+import (
+	vm "local/vector_math"
+	"math"
+	"testing"
+)
+
+const epsilon = 1e-5
+
+func nearlyEqual(a vm.Vec3, b vm.Vec3) bool {
+	return math.Abs(float64(a.X-b.X)) < epsilon &&
+		math.Abs(float64(a.Y-b.Y)) < epsilon &&
+		math.Abs(float64(a.Z-b.Z)) < epsilon
+}
+
+// boxVertices returns the corners of the box from min to max
+func boxVertices(min vm.Vec3, max vm.Vec3) []Vertex {
+	vs := make([]Vertex, 8)
+	for i := range vs {
+		p := min
+		if i&1 != 0 {
+			p.X = max.X
+		}
+		if i&2 != 0 {
+			p.Y = max.Y
+		}
+		if i&4 != 0 {
+			p.Z = max.Z
+		}
+		vs[i].Pos = p
+	}
+	return vs
+}
+
+func nearlyEqualBox(a AABB, b AABB) bool {
+	return nearlyEqual(a.Min, b.Min) && nearlyEqual(a.Max, b.Max)
+}
+
+func nearlyEqualScalar(a float32, b float32) bool {
+	return math.Abs(float64(a-b)) < epsilon
+}
+
+func TestComputeBounds(t *testing.T) {
+	b := computeBounds(boxVertices(vm.Vec3{Y: -2, Z: -3}, vm.Vec3{X: 2, Y: 2, Z: 3}))
+	if !nearlyEqualBox(b.Box, AABB{Min: vm.Vec3{Y: -2, Z: -3}, Max: vm.Vec3{X: 2, Y: 2, Z: 3}}) {
+		t.Fatalf("expected the box to span the vertices, got %v", b.Box)
+	}
+	if !nearlyEqual(b.Sphere.Center, vm.Vec3{X: 1}) || !nearlyEqualScalar(b.Sphere.Radius, float32(math.Sqrt(14))) {
+		t.Fatalf("expected the sphere to be centered on the box through its corners, got %v", b.Sphere)
+	}
+	if !nearlyEqual(b.Oriented.Center, vm.Vec3{X: 1}) || !nearlyEqual(b.Oriented.HalfExtents, vm.Vec3{X: 1, Y: 2, Z: 3}) {
+		t.Fatalf("expected the oriented box to match the box, got %v", b.Oriented)
+	}
+	if empty := computeBounds(nil); empty != (Bounds{}) {
+		t.Fatalf("expected a mesh without vertices to have zero bounds, got %v", empty)
+	}
+}
+
+func TestTransformBounds(t *testing.T) {
+	local := computeBounds(boxVertices(vm.Vec3{Y: -2, Z: -3}, vm.Vec3{X: 2, Y: 2, Z: 3}))
+	unitAxes := [3]vm.Vec3{{X: 1}, {Y: 1}, {Z: 1}}
+	tests := []struct {
+		name   string
+		m      vm.Mat
+		box    AABB
+		sphere BoundingSphere
+		axes   [3]vm.Vec3
+		half   vm.Vec3
+	}{
+		{
+			"identity", vm.NewUnitMat(4),
+			AABB{Min: vm.Vec3{Y: -2, Z: -3}, Max: vm.Vec3{X: 2, Y: 2, Z: 3}},
+			BoundingSphere{Center: vm.Vec3{X: 1}, Radius: float32(math.Sqrt(14))},
+			unitAxes, vm.Vec3{X: 1, Y: 2, Z: 3},
+		},
+		{
+			"translate", vm.NewTranslation(vm.Vec3{X: 5, Z: -1}),
+			AABB{Min: vm.Vec3{X: 5, Y: -2, Z: -4}, Max: vm.Vec3{X: 7, Y: 2, Z: 2}},
+			BoundingSphere{Center: vm.Vec3{X: 6, Z: -1}, Radius: float32(math.Sqrt(14))},
+			unitAxes, vm.Vec3{X: 1, Y: 2, Z: 3},
+		},
+		{
+			// x turns into y, the world box swaps its x and y extents
+			"rotate", vm.NewRotation(math.Pi/2, vm.Vec3{Z: 1}),
+			AABB{Min: vm.Vec3{X: -2, Z: -3}, Max: vm.Vec3{X: 2, Y: 2, Z: 3}},
+			BoundingSphere{Center: vm.Vec3{Y: 1}, Radius: float32(math.Sqrt(14))},
+			[3]vm.Vec3{{Y: 1}, {X: -1}, {Z: 1}}, vm.Vec3{X: 1, Y: 2, Z: 3},
+		},
+		{
+			// The sphere grows by the largest scale, staying conservative
+			"scale", vm.NewScale(vm.Vec3{X: 2, Y: 1, Z: 0.5}),
+			AABB{Min: vm.Vec3{Y: -2, Z: -1.5}, Max: vm.Vec3{X: 4, Y: 2, Z: 1.5}},
+			BoundingSphere{Center: vm.Vec3{X: 2}, Radius: 2 * float32(math.Sqrt(14))},
+			unitAxes, vm.Vec3{X: 2, Y: 2, Z: 1.5},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := TransformBounds(local, tt.m)
+			if !nearlyEqualBox(b.Box, tt.box) {
+				t.Fatalf("expected box %v, got %v", tt.box, b.Box)
+			}
+			if !nearlyEqual(b.Sphere.Center, tt.sphere.Center) || !nearlyEqualScalar(b.Sphere.Radius, tt.sphere.Radius) {
+				t.Fatalf("expected sphere %v, got %v", tt.sphere, b.Sphere)
+			}
+			if !nearlyEqual(b.Oriented.Center, tt.sphere.Center) || !nearlyEqual(b.Oriented.HalfExtents, tt.half) {
+				t.Fatalf("expected oriented box around %v with half extents %v, got %v", tt.sphere.Center, tt.half, b.Oriented)
+			}
+			for i := range tt.axes {
+				if !nearlyEqual(b.Oriented.Axes[i], tt.axes[i]) {
+					t.Fatalf("expected oriented box axes %v, got %v", tt.axes, b.Oriented.Axes)
+				}
+			}
+			// Every transformed corner of the mesh lies within the world box
+			for _, c := range b.Oriented.Corners() {
+				if c.Min(b.Box.Min).Sub(b.Box.Min).Len() > epsilon || c.Max(b.Box.Max).Sub(b.Box.Max).Len() > epsilon {
+					t.Fatalf("expected corner %v to lie within %v", c, b.Box)
+				}
+			}
+		})
+	}
+}
+
+func TestMergeBounds(t *testing.T) {
+	a := computeBounds(boxVertices(vm.Vec3{X: -1, Y: -1, Z: -1}, vm.Vec3{X: 1, Y: 1, Z: 1}))
+	b := TransformBounds(a, vm.NewTranslation(vm.Vec3{X: 4}))
+	merged := MergeBounds(a, b)
+	if !nearlyEqualBox(merged.Box, AABB{Min: vm.Vec3{X: -1, Y: -1, Z: -1}, Max: vm.Vec3{X: 5, Y: 1, Z: 1}}) {
+		t.Fatalf("expected the box to enclose both boxes, got %v", merged.Box)
+	}
+	// Centered on the merged box, reaching the far side of both spheres
+	if !nearlyEqual(merged.Sphere.Center, vm.Vec3{X: 2}) || !nearlyEqualScalar(merged.Sphere.Radius, 2+float32(math.Sqrt(3))) {
+		t.Fatalf("expected the sphere to enclose both spheres, got %v", merged.Sphere)
+	}
+	if !nearlyEqual(merged.Oriented.HalfExtents, vm.Vec3{X: 3, Y: 1, Z: 1}) {
+		t.Fatalf("expected the oriented box to match the merged box, got %v", merged.Oriented)
+	}
+	if empty := MergeBounds(); empty != (Bounds{}) {
+		t.Fatalf("expected merging nothing to return zero bounds, got %v", empty)
+	}
+}
+
+func TestMeshBoundsCache(t *testing.T) {
+	small := boxVertices(vm.Vec3{}, vm.Vec3{X: 1, Y: 1, Z: 1})
+	far := Vertex{Pos: vm.Vec3{X: 10}}
+	// static returns a model pooling exactly the mesh's vertices and indices, as the renderer does on upload
+	static := func(m *Mesh) *Model {
+		mdl := NewModel(m, "m")
+		mdl.Static = true
+		mdl.PooledVertices = MeshRange{Count: len(m.Vertices)}
+		mdl.PooledIndices = MeshRange{Count: len(m.VIndices)}
+		return mdl
+	}
+	tests := []struct {
+		name    string
+		edit    func(m *Mesh) error
+		maxX    float32
+		wantErr bool
+	}{
+		{"direct edit keeps cached bounds", func(m *Mesh) error { m.Vertices[0] = far; return nil }, 1, false},
+		{"direct edit and invalidate", func(m *Mesh) error { m.Vertices[0] = far; m.InvalidateBounds(); return nil }, 10, false},
+		{"set vertex", func(m *Mesh) error { m.SetVertex(0, far); return nil }, 10, false},
+		{"set vertices", func(m *Mesh) error { m.SetVertices(append(m.Vertices, far)); return nil }, 10, false},
+		{"mark dirty", func(m *Mesh) error {
+			m.Vertices[0] = far
+			return NewModel(m, "m").MarkDirty(MeshRange{First: 0, Count: 1})
+		}, 10, false},
+		{"mark dirty within static pool", func(m *Mesh) error {
+			m.Vertices[0] = far
+			return static(m).MarkDirty(MeshRange{First: 0, Count: 1})
+		}, 10, false},
+		// A rejected range marks nothing, so the cached bounds stay
+		{"mark dirty past static pool", func(m *Mesh) error {
+			mdl := static(m)
+			m.Vertices = append(m.Vertices, far)
+			return mdl.MarkDirty(MeshRange{First: len(small), Count: 1})
+		}, 1, true},
+		{"mark indices dirty past static pool", func(m *Mesh) error {
+			return static(m).MarkIndicesDirty(MeshRange{First: len(m.VIndices), Count: 3})
+		}, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMesh(append([]Vertex{}, small...), nil)
+			m.Bounds()
+			if err := tt.edit(m); (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if got := m.Bounds().Box.Max.X; got != tt.maxX {
+				t.Fatalf("expected bounds reaching to x=%f, got %f", tt.maxX, got)
+			}
+		})
+	}
+}
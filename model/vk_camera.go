@@ -11,14 +11,34 @@ const (
 	CAM_ORTHOGRAPHIC_PROJECTION = iota
 )
 
+// Depth modes decide how view space depth is mapped onto the 0..1 depth range. The standard mapping puts near at 0
+// and far at 1, concentrating floating point precision close to the camera. Reverse-Z flips this, so the float's
+// own precision distribution cancels out the projection's and distant geometry stops z-fighting. The infinite
+// variant drops the far plane entirely. Reverse modes require the renderer to clear depth to 0 and compare greater.
+const (
+	CAM_DEPTH_STANDARD      = iota
+	CAM_DEPTH_REVERSE_Z     = iota
+	CAM_DEPTH_REVERSE_Z_INF = iota
+)
+
+const ORTHO_ZOOM_STEP = 0.1
+const ORTHO_MIN_ZOOM, ORTHO_MAX_ZOOM = 0.001, 1000
+
 type Camera struct {
 	ProjectionType int
+	DepthMode      int
 
 	Fov    float32
 	Aspect float32
 	Near   float32
 	Far    float32
 
+	// OrthoHeight is the height of the orthographic view volume in world units at Zoom = 1, its width follows from
+	// Aspect. OrthoOffset shifts the volume's center away from the view axis, allowing for off-center volumes.
+	OrthoHeight float32
+	OrthoOffset vector_math.Vec2
+	Zoom        float32
+
 	Pos        vector_math.Vec3
 	LookDir    vector_math.Vec3
 	LookTarget *vector_math.Vec3
@@ -29,13 +49,15 @@ type Camera struct {
 
 func NewCamera(fov float32, near float32, far float32) *Camera {
 	return &Camera{
-		Fov:        fov,
-		Near:       near,
-		Far:        far,
-		LookDir:    vector_math.Vec3{Z: 1},
-		LookTarget: nil,
-		Up:         vector_math.Vec3{Y: -1},
-		View:       vector_math.NewUnitMat(4),
+		Fov:         fov,
+		Near:        near,
+		Far:         far,
+		OrthoHeight: 2,
+		Zoom:        1,
+		LookDir:     vector_math.Vec3{Z: 1},
+		LookTarget:  nil,
+		Up:          vector_math.Vec3{Y: -1},
+		View:        vector_math.NewUnitMat(4),
 	}
 }
 
@@ -55,19 +77,56 @@ func (c *Camera) SetTarget(v vector_math.Vec3) {
 func (c *Camera) GetProjection() vector_math.Mat {
 	switch c.ProjectionType {
 	case CAM_PERSPECTIVE_PROJECTION:
-		return newPerspectiveProjection(
-			vector_math.ToRad(float64(c.Fov)), float64(c.Aspect), c.Near, c.Far,
-		)
+		fovy := vector_math.ToRad(float64(c.Fov))
+		switch c.DepthMode {
+		case CAM_DEPTH_REVERSE_Z:
+			return newReversePerspectiveProjection(fovy, float64(c.Aspect), c.Near, c.Far)
+		case CAM_DEPTH_REVERSE_Z_INF:
+			return newInfiniteReversePerspectiveProjection(fovy, float64(c.Aspect), c.Near)
+		default:
+			return newPerspectiveProjection(fovy, float64(c.Aspect), c.Near, c.Far)
+		}
 	case CAM_ORTHOGRAPHIC_PROJECTION:
-		return newOrthographicProjection(
-			vector_math.Vec3{X: -c.Aspect, Y: 1, Z: c.Near}, vector_math.Vec3{X: c.Aspect, Y: -1, Z: c.Far},
-		)
+		m := newOrthographicProjection(c.OrthoVolume())
+		// An orthographic projection has no notion of an infinite far plane, both reverse modes flip depth only
+		if c.IsReverseZ() {
+			return reverseDepth(m)
+		}
+		return m
 	default:
 		log.Printf("Failed to select projection type, returning identity.")
 		return vector_math.NewUnitMat(4)
 	}
 }
 
+// IsReverseZ reports whether the camera's projection maps near to depth 1 and far to depth 0
+func (c *Camera) IsReverseZ() bool {
+	return c.DepthMode == CAM_DEPTH_REVERSE_Z || c.DepthMode == CAM_DEPTH_REVERSE_Z_INF
+}
+
+// OrthoVolume returns the view space cuboid shown by the orthographic projection as its left-bottom-near and
+// right-top-far corners. Bottom is +Y as Vulkan's y-axis points down.
+func (c *Camera) OrthoVolume() (vector_math.Vec3, vector_math.Vec3) {
+	zoom := c.Zoom
+	if zoom <= 0 {
+		zoom = 1
+	}
+	h := c.OrthoHeight / 2 / zoom
+	w := h * c.Aspect
+	o := c.OrthoOffset
+	return vector_math.Vec3{X: o.X - w, Y: o.Y + h, Z: c.Near}, vector_math.Vec3{X: o.X + w, Y: o.Y - h, Z: c.Far}
+}
+
+// ZoomBy scales the orthographic zoom by ORTHO_ZOOM_STEP per step, positive steps zoom in. This is meant to be fed
+// with mouse wheel steps directly.
+func (c *Camera) ZoomBy(steps int32) {
+	if c.Zoom <= 0 {
+		c.Zoom = 1
+	}
+	c.Zoom *= float32(math.Pow(1+ORTHO_ZOOM_STEP, float64(steps)))
+	c.Zoom = float32(math.Max(ORTHO_MIN_ZOOM, math.Min(ORTHO_MAX_ZOOM, float64(c.Zoom))))
+}
+
 func (c *Camera) GetView() vector_math.Mat {
 	if c.LookTarget != nil {
 		return NewTargetView(c.Pos, *c.LookTarget, c.Up)
@@ -77,6 +136,64 @@ func (c *Camera) GetView() vector_math.Mat {
 	}
 }
 
+// Frame moves the camera back along its current look direction until the given bounds fit into the viewport. The
+// padding is added relative to the bounds' radius, e.g.: 0.1 leaves a 10% margin. In orthographic mode the camera
+// distance does not change the size on screen, so OrthoHeight is adjusted instead. Far is pushed out if the bounds
+// would otherwise be clipped.
+func (c *Camera) Frame(b Bounds, padding float32) {
+	center := b.Sphere.Center
+	radius := b.Sphere.Radius * (1 + padding)
+	if radius <= 0 {
+		radius = 1
+	}
+	aspect := c.Aspect
+	if aspect <= 0 {
+		aspect = 1
+	}
+	dir := c.LookDir.Norm()
+	if c.LookTarget != nil {
+		dir = c.LookTarget.Sub(c.Pos).Norm()
+	}
+
+	var dist float32
+	switch c.ProjectionType {
+	case CAM_ORTHOGRAPHIC_PROJECTION:
+		// The smaller side of the viewport has to span the full sphere
+		c.OrthoHeight = 2 * radius * float32(math.Max(1, 1/float64(aspect)))
+		c.Zoom = 1
+		c.OrthoOffset = vector_math.Vec2{}
+		dist = radius + c.Near
+	default:
+		fovy := vector_math.ToRad(float64(c.Fov))
+		fovx := 2 * math.Atan(math.Tan(fovy/2)*float64(aspect))
+		halfFov := math.Min(fovy, fovx) / 2
+		dist = radius / float32(math.Sin(halfFov))
+	}
+
+	c.Pos = center.Sub(dir.ScalarMul(dist))
+	c.LookDir = dir
+	if c.LookTarget != nil {
+		c.SetTarget(center)
+	}
+	if c.Far < dist+radius {
+		c.Far = dist + radius
+	}
+}
+
+// Frustum returns the world space view volume of the camera. Aspect needs to be up-to-date for this to match what
+// is actually shown on screen.
+func (c *Camera) Frustum() Frustum {
+	proj := c.GetProjection()
+	view := c.GetView()
+	viewProj, _ := proj.Mult(&view)
+	f := NewFrustum(viewProj)
+	// With reverse-Z, the plane extracted as near is actually the far plane and vice versa
+	if c.IsReverseZ() {
+		f.Planes[FRUSTUM_NEAR], f.Planes[FRUSTUM_FAR] = f.Planes[FRUSTUM_FAR], f.Planes[FRUSTUM_NEAR]
+	}
+	return f
+}
+
 // newPerspectiveProjection implemented after: https://www.youtube.com/watch?v=U0_ONQQ5ZNM
 func newPerspectiveProjection(fovy float64, aspect float64, near float32, far float32) vector_math.Mat {
 	focalLen := 1 / math.Tan(fovy/2)
@@ -89,6 +206,34 @@ func newPerspectiveProjection(fovy float64, aspect float64, near float32, far fl
 	return m
 }
 
+// newReversePerspectiveProjection is newPerspectiveProjection with the depth range flipped: near maps to 1 and far
+// maps to 0.
+func newReversePerspectiveProjection(fovy float64, aspect float64, near float32, far float32) vector_math.Mat {
+	return reverseDepth(newPerspectiveProjection(fovy, aspect, near, far))
+}
+
+// newInfiniteReversePerspectiveProjection is the limit of newReversePerspectiveProjection for far -> infinity.
+// Depth becomes near / z, which reaches 0 only at infinity, so nothing is ever clipped by a far plane.
+func newInfiniteReversePerspectiveProjection(fovy float64, aspect float64, near float32) vector_math.Mat {
+	focalLen := 1 / math.Tan(fovy/2)
+	m, _ := vector_math.NewMat(4, 4)
+	m[0][0] = float32(focalLen / aspect)
+	m[1][1] = float32(focalLen)
+	m[2][2] = 0
+	m[2][3] = near
+	m[3][2] = 1
+	return m
+}
+
+// reverseDepth maps a projection's output depth d onto 1 - d. In homogeneous coordinates this is done by replacing
+// the depth row with w - z, which works for both perspective and orthographic projections.
+func reverseDepth(proj vector_math.Mat) vector_math.Mat {
+	for j := 0; j < 4; j++ {
+		proj[2][j] = proj[3][j] - proj[2][j]
+	}
+	return proj
+}
+
 // newOrthographicProjection constructs a new matrix representing an orthographic projection from
 // a cuboid on to Vulkan's canonical view volume (CVV), which spans from (-1, 1, 0) to (1, -1, 1). The
 // returned projection takes any cuboid spanning from lbn (Left-Bottom-Near) to rtf (Right-Top-Far)
@@ -97,17 +242,20 @@ func newPerspectiveProjection(fovy float64, aspect float64, near float32, far fl
 // Setting the orthographic view volume to have the same aspect ratio as the viewport will avoid stretching
 // any points. To do this, let the following term be true: "right - left = aspect * (bottom - top)". The
 // current aspect ratio of the viewport can be retrieved via the swap chain's width and height.
+// -------------------------------------------------------------
+// The cuboid is first moved so its center (x, y) and its near plane (z) sit on the origin, then scaled to the CVV's
+// size. Scaling factors keep their sign, so a volume with flipped corners results in a mirrored image.
 func newOrthographicProjection(lbn vector_math.Vec3, rtf vector_math.Vec3) vector_math.Mat {
-	// Scaling factors assume the given CVV cuboids dimensions as fixed (width: 2, height: 2, depth: 2)
+	// Scaling factors assume the given CVV cuboids dimensions as fixed (width: 2, height: 2, depth: 1)
 	mScale := vector_math.NewScale(vector_math.Vec3{
-		X: float32(2 / (math.Abs(float64(rtf.X) - float64(lbn.X)))),
-		Y: float32(2 / (math.Abs(float64(lbn.Y) - float64(rtf.Y)))),
-		Z: float32(1 / (math.Abs(float64(rtf.Z) - float64(lbn.Z)))),
+		X: 2 / (rtf.X - lbn.X),
+		Y: 2 / (lbn.Y - rtf.Y),
+		Z: 1 / (rtf.Z - lbn.Z),
 	})
 	mTrans := vector_math.NewTranslation(vector_math.Vec3{
-		X: -(rtf.X + lbn.X) / (rtf.X - lbn.X),
-		Y: -(lbn.X + rtf.X) / (lbn.X - rtf.X),
-		Z: -lbn.Z / (rtf.Z - lbn.Z),
+		X: -(rtf.X + lbn.X) / 2,
+		Y: -(lbn.Y + rtf.Y) / 2,
+		Z: -lbn.Z,
 	})
 	mOrt, _ := mScale.Mult(&mTrans)
 	return mOrt
@@ -0,0 +1,417 @@
+package model
+
+import (
+	"GPU_fluid_simulation/input"
+	vm "local/vector_math"
+	"math"
+	"time"
+
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// CameraController drives a Camera from user input. Events are handed over as they arrive, Update is called once per
+// frame with the time passed since the last one. Attach is called whenever the controller takes over a camera, so it
+// can pick up the camera's current state and the controllers can be swapped at runtime without the view jumping.
+type CameraController interface {
+	Attach(cam *Camera)
+	HandleEvent(cam *Camera, event sdl.Event)
+	Update(cam *Camera, dt time.Duration)
+}
+
+const DEFAULT_MOVE_SPEED = 5
+const DEFAULT_MOUSE_SENSITIVITY = 0.5
+const DEFAULT_ORBIT_DISTANCE = 3
+
+// DEFAULT_PAD_LOOK_SPEED is how fast a fully deflected stick turns the camera in degrees per second
+const DEFAULT_PAD_LOOK_SPEED = 120
+
+// DEFAULT_PAD_ZOOM_SPEED is how many mouse wheel steps a fully deflected stick zooms per second
+const DEFAULT_PAD_ZOOM_SPEED = 10
+
+// minimal distance an orbiting camera can dolly towards its pivot
+const minOrbitDistance = 0.01
+
+// cameraBasis returns the right (u), down (v) and forward (w) vectors the view matrix is built from. These match the
+// screen axes, as SDL's y-axis and Vulkan's y-axis both point down.
+func cameraBasis(cam *Camera) (vm.Vec3, vm.Vec3, vm.Vec3) {
+	w := viewDir(cam)
+	u := w.Cross(cam.Up)
+	if u.Len() < 1e-6 {
+		// Looking straight along the up axis, any right vector will do
+		u = w.Cross(vm.Vec3{Z: 1})
+		if u.Len() < 1e-6 {
+			u = w.Cross(vm.Vec3{X: 1})
+		}
+	}
+	u = u.Norm()
+	v := w.Cross(u)
+	return u, v, w
+}
+
+// viewDir returns the normalized direction the camera looks in. A look target on top of the camera has no direction,
+// then the look direction is used, and +z if that is zero as well.
+func viewDir(cam *Camera) vm.Vec3 {
+	if cam.LookTarget != nil {
+		if d := cam.LookTarget.Sub(cam.Pos); d.Len() >= 1e-6 {
+			return d.Norm()
+		}
+	}
+	if cam.LookDir.Len() < 1e-6 {
+		return vm.Vec3{Z: 1}
+	}
+	return cam.LookDir.Norm()
+}
+
+// Fly
+// ----------------------------------------------------------------------------------------------------------
+
+// Actions and axes the fly controller reacts to. They can be rebound through FlyController.Input.
+const (
+	FLY_LOOK    = "fly_look"
+	FLY_FORWARD = "fly_forward"
+	FLY_RIGHT   = "fly_right"
+	FLY_UP      = "fly_up"
+	FLY_TURN_X  = "fly_turn_x"
+	FLY_TURN_Y  = "fly_turn_y"
+)
+
+// FlyController is a free flying first person camera. By default WASD moves along the look direction, space and left
+// shift move along the up axis. Holding the right mouse button turns the camera. On a game controller the left stick
+// moves, the right stick turns and the triggers move up and down.
+type FlyController struct {
+	Speed        float32
+	Sensitivity  float64
+	PadLookSpeed float64
+	Input        *input.Map
+}
+
+func NewFlyController() *FlyController {
+	in := input.NewMap()
+	// The default bindings only use known names, they can not fail
+	_ = in.Bind(FLY_LOOK, "Mouse Right")
+	_ = in.BindAxis(FLY_FORWARD,
+		input.AxisBinding{Input: "W", Scale: 1},
+		input.AxisBinding{Input: "S", Scale: -1},
+		input.AxisBinding{Input: "Pad Left Y", Scale: -1},
+	)
+	_ = in.BindAxis(FLY_RIGHT,
+		input.AxisBinding{Input: "D", Scale: 1},
+		input.AxisBinding{Input: "A", Scale: -1},
+		input.AxisBinding{Input: "Pad Left X", Scale: 1},
+	)
+	_ = in.BindAxis(FLY_UP,
+		input.AxisBinding{Input: "Space", Scale: 1},
+		input.AxisBinding{Input: "Left Shift", Scale: -1},
+		input.AxisBinding{Input: "Pad Right Trigger", Scale: 1},
+		input.AxisBinding{Input: "Pad Left Trigger", Scale: -1},
+	)
+	_ = in.BindAxis(FLY_TURN_X, input.AxisBinding{Input: "Pad Right X", Scale: 1})
+	_ = in.BindAxis(FLY_TURN_Y, input.AxisBinding{Input: "Pad Right Y", Scale: 1})
+	return &FlyController{
+		Speed:        DEFAULT_MOVE_SPEED,
+		Sensitivity:  DEFAULT_MOUSE_SENSITIVITY,
+		PadLookSpeed: DEFAULT_PAD_LOOK_SPEED,
+		Input:        in,
+	}
+}
+
+func (f *FlyController) Attach(cam *Camera) {
+	// The fly camera is driven by its look direction, a target would override it
+	if cam.LookTarget != nil {
+		cam.LookDir = viewDir(cam)
+		cam.LookTarget = nil
+	}
+	// Keys held while another controller was active never got their release event
+	f.Input.Reset()
+}
+
+func (f *FlyController) HandleEvent(cam *Camera, event sdl.Event) {
+	f.Input.HandleEvent(event)
+	if ev, ok := event.(*sdl.MouseMotionEvent); ok && f.Input.Down(FLY_LOOK) {
+		if ev.YRel != 0 {
+			yRotAxis := cam.LookDir.Cross(cam.Up).ScalarMul(-float32(ev.YRel))
+			cam.Turn(f.Sensitivity, yRotAxis)
+		}
+		if ev.XRel != 0 {
+			xRotAxis := cam.Up.ScalarMul(-float32(ev.XRel))
+			cam.Turn(f.Sensitivity, xRotAxis)
+		}
+	}
+}
+
+// Update moves the camera by the held movement keys and sticks. Mouse movement bound to an axis is consumed by the
+// first update after it happened.
+func (f *FlyController) Update(cam *Camera, dt time.Duration) {
+	movScale := float32(dt.Seconds()) * f.Speed
+	right := cam.LookDir.Cross(cam.Up)
+	// Turning by stick matches the mouse: right turns right, down looks down
+	if tx := f.Input.Axis(FLY_TURN_X); tx != 0 {
+		cam.Turn(float64(tx)*f.PadLookSpeed*dt.Seconds(), cam.Up.ScalarMul(-1))
+	}
+	if ty := f.Input.Axis(FLY_TURN_Y); ty != 0 {
+		cam.Turn(float64(ty)*f.PadLookSpeed*dt.Seconds(), right.ScalarMul(-1))
+	}
+	right = cam.LookDir.Cross(cam.Up)
+	cam.Move(cam.LookDir.ScalarMul(f.Input.Axis(FLY_FORWARD) * movScale))
+	cam.Move(right.ScalarMul(f.Input.Axis(FLY_RIGHT) * movScale))
+	cam.Move(cam.Up.ScalarMul(f.Input.Axis(FLY_UP) * movScale))
+	f.Input.EndFrame()
+}
+
+// Orbit
+// ----------------------------------------------------------------------------------------------------------
+
+// Axes the orbit and arcball controllers read from game controllers. They can be rebound through the controllers'
+// Input.
+const (
+	ORBIT_TURN_X = "orbit_turn_x"
+	ORBIT_TURN_Y = "orbit_turn_y"
+	ORBIT_ZOOM   = "orbit_zoom"
+)
+
+// newOrbitInput binds the right stick to orbiting, like dragging with the left mouse button, and the left stick's
+// vertical axis to zooming in and out
+func newOrbitInput() *input.Map {
+	in := input.NewMap()
+	// The default bindings only use known names, they can not fail
+	_ = in.BindAxis(ORBIT_TURN_X, input.AxisBinding{Input: "Pad Right X", Scale: 1})
+	_ = in.BindAxis(ORBIT_TURN_Y, input.AxisBinding{Input: "Pad Right Y", Scale: 1})
+	_ = in.BindAxis(ORBIT_ZOOM, input.AxisBinding{Input: "Pad Left Y", Scale: -1})
+	return in
+}
+
+// OrbitController rotates the camera around a pivot point while keeping the camera's up axis fixed (turntable style).
+// Left mouse drag orbits, the mouse wheel dollies towards the pivot and middle mouse drag pans the pivot. On a game
+// controller the right stick orbits and the left stick zooms.
+type OrbitController struct {
+	Pivot        vm.Vec3
+	Distance     float32
+	Sensitivity  float64
+	ZoomStep     float32
+	PanSpeed     float32
+	PadLookSpeed float64
+	PadZoomSpeed float32
+	Input        *input.Map
+
+	dir vm.Vec3
+}
+
+func NewOrbitController(pivot vm.Vec3) *OrbitController {
+	return &OrbitController{
+		Pivot:        pivot,
+		Distance:     DEFAULT_ORBIT_DISTANCE,
+		Sensitivity:  DEFAULT_MOUSE_SENSITIVITY,
+		ZoomStep:     0.1,
+		PanSpeed:     0.002,
+		PadLookSpeed: DEFAULT_PAD_LOOK_SPEED,
+		PadZoomSpeed: DEFAULT_PAD_ZOOM_SPEED,
+		Input:        newOrbitInput(),
+		dir:          vm.Vec3{Z: 1},
+	}
+}
+
+// Attach keeps the camera where it is and looks at the pivot from there
+func (o *OrbitController) Attach(cam *Camera) {
+	d := o.Pivot.Sub(cam.Pos)
+	// Keys held while another controller was active never got their release event
+	o.Input.Reset()
+	if d.Len() < minOrbitDistance {
+		o.dir = viewDir(cam)
+		return
+	}
+	o.Distance = d.Len()
+	o.dir = d.Norm()
+}
+
+func (o *OrbitController) HandleEvent(cam *Camera, event sdl.Event) {
+	o.Input.HandleEvent(event)
+	switch ev := event.(type) {
+	case *sdl.MouseMotionEvent:
+		if ev.State&sdl.ButtonLMask() != 0 {
+			o.orbit(cam, float64(ev.XRel)*o.Sensitivity, float64(ev.YRel)*o.Sensitivity)
+		}
+		if ev.State&sdl.ButtonMMask() != 0 {
+			o.pan(cam, ev.XRel, ev.YRel)
+		}
+	case *sdl.MouseWheelEvent:
+		o.Distance = dolly(o.Distance, float32(ev.Y), o.ZoomStep)
+	}
+}
+
+// Update places the camera around the pivot, after orbiting and zooming by the sticks of game controllers
+func (o *OrbitController) Update(cam *Camera, dt time.Duration) {
+	tx, ty := o.Input.Axis(ORBIT_TURN_X), o.Input.Axis(ORBIT_TURN_Y)
+	if tx != 0 || ty != 0 {
+		o.orbit(cam, float64(tx)*o.PadLookSpeed*dt.Seconds(), float64(ty)*o.PadLookSpeed*dt.Seconds())
+	}
+	if zoom := o.Input.Axis(ORBIT_ZOOM); zoom != 0 {
+		o.Distance = dolly(o.Distance, zoom*o.PadZoomSpeed*float32(dt.Seconds()), o.ZoomStep)
+	}
+	o.Input.EndFrame()
+	cam.Pos = o.Pivot.Sub(o.dir.ScalarMul(o.Distance))
+	cam.LookDir = o.dir
+	cam.LookTarget = nil
+}
+
+// orbit yaws around the camera's up axis and pitches by the given angles in degrees, as dragging the mouse right and
+// down does
+func (o *OrbitController) orbit(cam *Camera, yaw float64, pitch float64) {
+	up := cam.Up.Norm()
+	yawed := vm.Apply(o.dir, 0, vm.NewRotation(vm.ToRad(-yaw), up))
+	right := yawed.Cross(up).Norm()
+	pitched := vm.Apply(yawed, 0, vm.NewRotation(vm.ToRad(-pitch), right)).Norm()
+	// Refuse to pitch over the poles as the view would flip around
+	if math.Abs(float64(pitched.Dot(up))) < 0.99 {
+		o.dir = pitched
+	} else {
+		o.dir = yawed.Norm()
+	}
+}
+
+func (o *OrbitController) pan(cam *Camera, dx int32, dy int32) {
+	u, v, _ := cameraBasis(cam)
+	scale := o.PanSpeed * o.Distance
+	o.Pivot = o.Pivot.Sub(u.ScalarMul(float32(dx) * scale)).Sub(v.ScalarMul(float32(dy) * scale))
+}
+
+// Arcball
+// ----------------------------------------------------------------------------------------------------------
+
+// ArcballController rotates the camera around a pivot by dragging a virtual trackball, after Shoemake's arcball:
+// https://www.talisman.org/~erlkonig/misc/shoemake92-arcball.pdf. Unlike the orbit controller, the up axis rotates
+// with the ball, so any orientation can be reached. Wheel and middle mouse behave the same as for the orbit
+// controller, as do the sticks of game controllers.
+type ArcballController struct {
+	Pivot        vm.Vec3
+	Distance     float32
+	ZoomStep     float32
+	PanSpeed     float32
+	PadLookSpeed float64
+	PadZoomSpeed float32
+	Input        *input.Map
+
+	offset vm.Vec3 // normalized direction from pivot to camera
+	up     vm.Vec3 // the camera's up axis when first attached, zero before
+	width  int32   // window size drags are normalized against, see: Resize
+	height int32
+}
+
+func NewArcballController(pivot vm.Vec3) *ArcballController {
+	return &ArcballController{
+		Pivot:        pivot,
+		Distance:     DEFAULT_ORBIT_DISTANCE,
+		ZoomStep:     0.1,
+		PanSpeed:     0.002,
+		PadLookSpeed: DEFAULT_PAD_LOOK_SPEED,
+		PadZoomSpeed: DEFAULT_PAD_ZOOM_SPEED,
+		Input:        newOrbitInput(),
+		offset:       vm.Vec3{Z: -1},
+	}
+}
+
+// Attach keeps the camera where it is and looks at the pivot from there. The camera's up axis is remembered on the
+// first attach, later attachments set it back to that, undoing the roll left behind by the previous one.
+func (a *ArcballController) Attach(cam *Camera) {
+	a.Input.Reset()
+	if a.up == (vm.Vec3{}) {
+		a.up = cam.Up
+	}
+	cam.Up = a.up
+	d := cam.Pos.Sub(a.Pivot)
+	if d.Len() < minOrbitDistance {
+		a.offset = viewDir(cam).ScalarMul(-1)
+		return
+	}
+	a.Distance = d.Len()
+	a.offset = d.Norm()
+}
+
+// Resize sets the window size mouse drags are mapped onto the ball with. It has to be set to the initial window size,
+// later changes are picked up from the window's size change events.
+func (a *ArcballController) Resize(width int32, height int32) {
+	a.width, a.height = width, height
+}
+
+func (a *ArcballController) HandleEvent(cam *Camera, event sdl.Event) {
+	a.Input.HandleEvent(event)
+	switch ev := event.(type) {
+	case *sdl.WindowEvent:
+		// Taken from the events rather than queried, so replayed recordings rotate the same as they did live
+		if ev.Event == sdl.WINDOWEVENT_SIZE_CHANGED {
+			a.Resize(ev.Data1, ev.Data2)
+		}
+	case *sdl.MouseMotionEvent:
+		if ev.State&sdl.ButtonLMask() != 0 && a.width > 0 && a.height > 0 {
+			p0 := arcballPoint(ev.X-ev.XRel, ev.Y-ev.YRel, a.width, a.height)
+			p1 := arcballPoint(ev.X, ev.Y, a.width, a.height)
+			a.rotate(cam, p0, p1)
+		}
+		if ev.State&sdl.ButtonMMask() != 0 {
+			u, v, _ := cameraBasis(cam)
+			scale := a.PanSpeed * a.Distance
+			a.Pivot = a.Pivot.Sub(u.ScalarMul(float32(ev.XRel) * scale)).Sub(v.ScalarMul(float32(ev.YRel) * scale))
+		}
+	case *sdl.MouseWheelEvent:
+		a.Distance = dolly(a.Distance, float32(ev.Y), a.ZoomStep)
+	}
+}
+
+// Update places the camera around the pivot, after rotating and zooming by the sticks of game controllers. A stick
+// rolls the ball as if it was dragged from its center in the stick's direction.
+func (a *ArcballController) Update(cam *Camera, dt time.Duration) {
+	tx, ty := a.Input.Axis(ORBIT_TURN_X), a.Input.Axis(ORBIT_TURN_Y)
+	if tx != 0 || ty != 0 {
+		angle := vm.ToRad(math.Hypot(float64(tx), float64(ty)) * a.PadLookSpeed * dt.Seconds())
+		p1 := vm.Vec3{X: tx, Y: ty}.Norm().ScalarMul(float32(math.Sin(angle)))
+		p1.Z = float32(math.Cos(angle))
+		a.rotate(cam, vm.Vec3{Z: 1}, p1)
+	}
+	if zoom := a.Input.Axis(ORBIT_ZOOM); zoom != 0 {
+		a.Distance = dolly(a.Distance, zoom*a.PadZoomSpeed*float32(dt.Seconds()), a.ZoomStep)
+	}
+	a.Input.EndFrame()
+	cam.Pos = a.Pivot.Add(a.offset.ScalarMul(a.Distance))
+	cam.LookDir = a.offset.ScalarMul(-1)
+	cam.LookTarget = nil
+}
+
+// rotate turns the camera around the pivot by the rotation that takes p0 onto p1. Both points are given in camera
+// space (right, down, towards the viewer). Dragging the ball rotates the scene, so the camera rotates the other way.
+func (a *ArcballController) rotate(cam *Camera, p0 vm.Vec3, p1 vm.Vec3) {
+	axis := p0.Cross(p1)
+	if axis.Len() < 1e-6 {
+		return
+	}
+	angle := math.Acos(math.Max(-1, math.Min(1, float64(p0.Dot(p1)))))
+	u, v, w := cameraBasis(cam)
+	worldAxis := u.ScalarMul(axis.X).Add(v.ScalarMul(axis.Y)).Add(w.ScalarMul(-axis.Z))
+	rm := vm.NewRotation(-angle, worldAxis)
+	a.offset = vm.Apply(a.offset, 0, rm).Norm()
+	cam.Up = vm.Apply(cam.Up, 0, rm).Norm()
+}
+
+// arcballPoint maps a window position onto the unit sphere centered in the viewport. Points outside the ball are
+// pulled onto its silhouette.
+func arcballPoint(x int32, y int32, w int32, h int32) vm.Vec3 {
+	s := float32(math.Min(float64(w), float64(h)))
+	p := vm.Vec3{
+		X: (2*float32(x) - float32(w)) / s,
+		Y: (2*float32(y) - float32(h)) / s,
+	}
+	d := p.X*p.X + p.Y*p.Y
+	if d > 1 {
+		return p.Norm()
+	}
+	p.Z = float32(math.Sqrt(float64(1 - d)))
+	return p
+}
+
+// dolly moves the distance towards or away from the pivot by the given number of wheel steps, scaled by the current
+// distance so zooming feels the same close up and far away
+func dolly(dist float32, wheel float32, step float32) float32 {
+	d := dist * (1 - step*wheel)
+	if d < minOrbitDistance {
+		return minOrbitDistance
+	}
+	return d
+}
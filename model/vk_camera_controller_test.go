@@ -0,0 +1,224 @@
+package model
+
+import (
+	"GPU_fluid_simulation/input"
+	vm "local/vector_math"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// padEvents pushes the right stick fully to the right and the left stick fully forward
+var padEvents = []sdl.Event{
+	&sdl.ControllerAxisEvent{Type: sdl.CONTROLLERAXISMOTION, Axis: sdl.CONTROLLER_AXIS_RIGHTX, Value: math.MaxInt16},
+	&sdl.ControllerAxisEvent{Type: sdl.CONTROLLERAXISMOTION, Axis: sdl.CONTROLLER_AXIS_LEFTY, Value: math.MinInt16},
+}
+
+func TestOrbitingControllersFollowSticks(t *testing.T) {
+	orbit, arcball := NewOrbitController(vm.Vec3{}), NewArcballController(vm.Vec3{})
+	tests := []struct {
+		name     string
+		ctrl     CameraController
+		distance func() float32
+	}{
+		{"orbit", orbit, func() float32 { return orbit.Distance }},
+		{"arcball", arcball, func() float32 { return arcball.Distance }},
+	}
+	for _, tt := range tests {
+		ctrl := tt.ctrl
+		t.Run(tt.name, func(t *testing.T) {
+			cam := NewCamera(45, 0.1, 100)
+			cam.Pos = vm.Vec3{Z: -3}
+			cam.LookDir = vm.Vec3{Z: 1}
+			ctrl.Attach(cam)
+			for _, ev := range padEvents {
+				ctrl.HandleEvent(cam, ev)
+			}
+			ctrl.Update(cam, 100*time.Millisecond)
+			if tt.distance() >= 3 {
+				t.Fatalf("expected the left stick to zoom in, distance is %f", tt.distance())
+			}
+			if cam.Pos.X == 0 || math.Abs(float64(cam.Pos.Len()-tt.distance())) > epsilon {
+				t.Fatalf("expected the right stick to orbit around the pivot, camera at %v", cam.Pos)
+			}
+			if !nearlyEqual(cam.LookDir, cam.Pos.ScalarMul(-1/cam.Pos.Len())) {
+				t.Fatalf("expected the camera to keep looking at the pivot, looking along %v from %v", cam.LookDir, cam.Pos)
+			}
+		})
+	}
+}
+
+func TestControllersAttachToCameraOnItsTarget(t *testing.T) {
+	tests := []struct {
+		name string
+		ctrl CameraController
+	}{
+		{"fly", NewFlyController()},
+		{"orbit", NewOrbitController(vm.Vec3{X: 1})},
+		{"arcball", NewArcballController(vm.Vec3{X: 1})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cam := NewCamera(45, 0.1, 100)
+			cam.Pos = vm.Vec3{X: 1}
+			cam.LookTarget = &vm.Vec3{X: 1}
+			tt.ctrl.Attach(cam)
+			tt.ctrl.HandleEvent(cam, &sdl.MouseMotionEvent{Type: sdl.MOUSEMOTION, State: sdl.ButtonMMask(), XRel: 4, YRel: 2})
+			tt.ctrl.Update(cam, 100*time.Millisecond)
+			for _, v := range []vm.Vec3{cam.Pos, cam.LookDir, cam.Up} {
+				if math.IsNaN(float64(v.X + v.Y + v.Z)) {
+					t.Fatalf("expected a finite camera, got position %v looking along %v", cam.Pos, cam.LookDir)
+				}
+			}
+		})
+	}
+}
+
+func TestArcballAttachRestoresUp(t *testing.T) {
+	arcball := NewArcballController(vm.Vec3{})
+	cam := NewCamera(45, 0.1, 100)
+	cam.Pos = vm.Vec3{Z: -3}
+	cam.Up = vm.Vec3{X: 1}
+	arcball.Attach(cam)
+	if !nearlyEqual(cam.Up, vm.Vec3{X: 1}) {
+		t.Fatalf("expected the first attach to keep the camera's up axis, got %v", cam.Up)
+	}
+	arcball.rotate(cam, vm.Vec3{Z: 1}, vm.Vec3{Y: 0.6, Z: 0.8})
+	if nearlyEqual(cam.Up, vm.Vec3{X: 1}) {
+		t.Fatalf("expected rolling the ball to rotate the up axis")
+	}
+	arcball.Attach(cam)
+	if !nearlyEqual(cam.Up, vm.Vec3{X: 1}) {
+		t.Fatalf("expected attaching again to restore the up axis, got %v", cam.Up)
+	}
+}
+
+func TestFlyControllerFollowsBindings(t *testing.T) {
+	key := func(sym sdl.Keycode) sdl.Event {
+		return &sdl.KeyboardEvent{Type: sdl.KEYDOWN, Keysym: sdl.Keysym{Sym: sym}}
+	}
+	look := []sdl.Event{
+		&sdl.MouseButtonEvent{Type: sdl.MOUSEBUTTONDOWN, Button: sdl.BUTTON_RIGHT},
+		&sdl.MouseMotionEvent{Type: sdl.MOUSEMOTION, XRel: 10},
+	}
+	tests := []struct {
+		name   string
+		rebind func(in *input.Map) error
+		events []sdl.Event
+		moved  bool
+		turned bool
+	}{
+		{"W moves forward", nil, []sdl.Event{key(sdl.K_w)}, true, false},
+		{"unbound key", nil, []sdl.Event{key(sdl.K_UP)}, false, false},
+		{"rebound forward", func(in *input.Map) error {
+			return in.BindAxis(FLY_FORWARD, input.AxisBinding{Input: "Up", Scale: 1})
+		}, []sdl.Event{key(sdl.K_UP)}, true, false},
+		{"rebound forward drops W", func(in *input.Map) error {
+			return in.BindAxis(FLY_FORWARD, input.AxisBinding{Input: "Up", Scale: 1})
+		}, []sdl.Event{key(sdl.K_w)}, false, false},
+		{"right drag turns", nil, look, false, true},
+		{"drag without look button", nil, look[1:], false, false},
+		{"rebound look", func(in *input.Map) error {
+			return in.Bind(FLY_LOOK, "Mouse Left")
+		}, look, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fly := NewFlyController()
+			if tt.rebind != nil {
+				if err := tt.rebind(fly.Input); err != nil {
+					t.Fatalf("rebinding failed: %v", err)
+				}
+			}
+			cam := NewCamera(45, 0.1, 100)
+			cam.LookDir = vm.Vec3{Z: 1}
+			fly.Attach(cam)
+			for _, ev := range tt.events {
+				fly.HandleEvent(cam, ev)
+			}
+			fly.Update(cam, 100*time.Millisecond)
+			if moved := cam.Pos != (vm.Vec3{}); moved != tt.moved {
+				t.Fatalf("expected moved to be %v, camera at %v", tt.moved, cam.Pos)
+			}
+			if turned := !nearlyEqual(cam.LookDir, vm.Vec3{Z: 1}); turned != tt.turned {
+				t.Fatalf("expected turned to be %v, looking along %v", tt.turned, cam.LookDir)
+			}
+		})
+	}
+}
+
+func TestOrbitingControllersMapMouse(t *testing.T) {
+	orbit, arcball := NewOrbitController(vm.Vec3{}), NewArcballController(vm.Vec3{})
+	arcball.Resize(200, 200)
+	tests := []struct {
+		name  string
+		ctrl  CameraController
+		pivot func() vm.Vec3
+		dist  func() float32
+	}{
+		{"orbit", orbit, func() vm.Vec3 { return orbit.Pivot }, func() float32 { return orbit.Distance }},
+		{"arcball", arcball, func() vm.Vec3 { return arcball.Pivot }, func() float32 { return arcball.Distance }},
+	}
+	for _, tt := range tests {
+		ctrl := tt.ctrl
+		t.Run(tt.name, func(t *testing.T) {
+			cam := NewCamera(45, 0.1, 100)
+			cam.Pos = vm.Vec3{Z: -3}
+			ctrl.Attach(cam)
+			ctrl.HandleEvent(cam, &sdl.MouseWheelEvent{Type: sdl.MOUSEWHEEL, Y: 1})
+			if tt.dist() >= 3 {
+				t.Fatalf("expected scrolling up to zoom in, distance is %f", tt.dist())
+			}
+			ctrl.HandleEvent(cam, &sdl.MouseMotionEvent{Type: sdl.MOUSEMOTION, State: sdl.ButtonMMask(), XRel: 10})
+			if tt.pivot() == (vm.Vec3{}) || tt.pivot().Z != 0 {
+				t.Fatalf("expected middle mouse drag to pan the pivot sideways, got %v", tt.pivot())
+			}
+			pivot := tt.pivot()
+			ctrl.HandleEvent(cam, &sdl.MouseMotionEvent{Type: sdl.MOUSEMOTION, State: sdl.ButtonLMask(), X: 105, Y: 100, XRel: 10})
+			ctrl.Update(cam, 100*time.Millisecond)
+			if tt.pivot() != pivot {
+				t.Fatalf("expected left mouse drag to keep the pivot, moved to %v", tt.pivot())
+			}
+			offset := cam.Pos.Sub(pivot)
+			if math.Abs(float64(offset.Len()-tt.dist())) > epsilon || nearlyEqual(offset.Norm(), vm.Vec3{Z: -1}) {
+				t.Fatalf("expected left mouse drag to orbit around the pivot, camera at %v", cam.Pos)
+			}
+		})
+	}
+}
+
+func TestArcballDragUsesRecordedWindowSize(t *testing.T) {
+	// Drags 10 pixels to the right through the center of a window of the given size
+	drag := func(w int32, h int32) sdl.Event {
+		return &sdl.MouseMotionEvent{Type: sdl.MOUSEMOTION, State: sdl.ButtonLMask(), X: w/2 + 5, Y: h / 2, XRel: 10}
+	}
+	resized := func(w int32, h int32) sdl.Event {
+		return &sdl.WindowEvent{Type: sdl.WINDOWEVENT, Event: sdl.WINDOWEVENT_SIZE_CHANGED, Data1: w, Data2: h}
+	}
+	angle := func(events ...sdl.Event) float64 {
+		arcball := NewArcballController(vm.Vec3{})
+		cam := NewCamera(45, 0.1, 100)
+		cam.Pos = vm.Vec3{Z: -3}
+		arcball.Attach(cam)
+		for _, ev := range events {
+			arcball.HandleEvent(cam, ev)
+		}
+		arcball.Update(cam, 0)
+		return math.Acos(math.Max(-1, math.Min(1, float64(cam.Pos.Norm().Dot(vm.Vec3{Z: -1})))))
+	}
+	if a := angle(drag(200, 150)); a != 0 {
+		t.Fatalf("expected no rotation before the window size is known, rotated by %f", a)
+	}
+	small, large := angle(resized(200, 150), drag(200, 150)), angle(resized(800, 600), drag(800, 600))
+	if small == 0 || large == 0 {
+		t.Fatalf("expected dragging to rotate, rotated by %f and %f", small, large)
+	}
+	if small <= large {
+		t.Fatalf("expected the same drag to rotate further in a smaller window, %f in the small one, %f in the large one", small, large)
+	}
+	if a := angle(resized(200, 150), resized(800, 600), drag(800, 600)); math.Abs(a-large) > epsilon {
+		t.Fatalf("expected the latest size to be used, rotated by %f instead of %f", a, large)
+	}
+}
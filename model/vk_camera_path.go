@@ -0,0 +1,232 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	vm "local/vector_math"
+	"math"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+const (
+	// PATH_CATMULL_ROM passes through every keyframe, using its neighbours to derive the tangents
+	PATH_CATMULL_ROM = iota
+	// PATH_BEZIER treats all keyframes as control points of a single Bezier curve. The curve only passes through the
+	// first and last keyframe and is pulled towards the others, which gives a smoother but less exact path.
+	PATH_BEZIER = iota
+)
+
+// CameraKeyframe is a camera state at a given point in time. Time is in seconds from the start of the path. Fov is
+// optional, 0 keeps the field of view the camera has.
+type CameraKeyframe struct {
+	Time   float64
+	Pos    vm.Vec3
+	Target vm.Vec3
+	Fov    float32 `json:",omitempty"`
+}
+
+// CameraPath is a list of keyframes sorted by time that a camera can follow. Together with Camera.Pos and
+// Camera.LookTarget this allows for repeatable fly-throughs.
+type CameraPath struct {
+	Keyframes     []CameraKeyframe
+	Interpolation int
+	Loop          bool
+}
+
+func NewCameraPath(interpolation int) *CameraPath {
+	return &CameraPath{
+		Interpolation: interpolation,
+	}
+}
+
+// AddKeyframe captures the camera's current state at time t. If the camera has no target, a point one unit along
+// its look direction is used instead.
+func (p *CameraPath) AddKeyframe(t float64, cam *Camera) {
+	target := cam.Pos.Add(cam.LookDir.Norm())
+	if cam.LookTarget != nil {
+		target = *cam.LookTarget
+	}
+	p.Keyframes = append(p.Keyframes, CameraKeyframe{
+		Time:   t,
+		Pos:    cam.Pos,
+		Target: target,
+		Fov:    cam.Fov,
+	})
+	sort.SliceStable(p.Keyframes, func(i, j int) bool { return p.Keyframes[i].Time < p.Keyframes[j].Time })
+}
+
+// Duration returns the time of the last keyframe
+func (p *CameraPath) Duration() float64 {
+	if len(p.Keyframes) == 0 {
+		return 0
+	}
+	return p.Keyframes[len(p.Keyframes)-1].Time
+}
+
+// Evaluate returns the interpolated keyframe at time t. Times outside the path are clamped, or wrapped around if the
+// path loops. The Fov is only interpolated if all keyframes set one, otherwise it is 0.
+func (p *CameraPath) Evaluate(t float64) CameraKeyframe {
+	kf := p.evaluate(t)
+	if !p.HasFov() {
+		kf.Fov = 0
+	}
+	return kf
+}
+
+// HasFov reports whether all keyframes set a field of view, only then the path changes the camera's
+func (p *CameraPath) HasFov() bool {
+	for _, kf := range p.Keyframes {
+		if kf.Fov <= 0 {
+			return false
+		}
+	}
+	return len(p.Keyframes) > 0
+}
+
+func (p *CameraPath) evaluate(t float64) CameraKeyframe {
+	kfs := p.Keyframes
+	if len(kfs) == 0 {
+		return CameraKeyframe{}
+	}
+	t0, t1 := kfs[0].Time, kfs[len(kfs)-1].Time
+	if p.Loop && t1 > t0 && t > t1 {
+		t = t0 + math.Mod(t-t0, t1-t0)
+	}
+	if t <= t0 || len(kfs) == 1 {
+		return withTime(kfs[0], t)
+	}
+	if t >= t1 {
+		return withTime(kfs[len(kfs)-1], t)
+	}
+
+	switch p.Interpolation {
+	case PATH_BEZIER:
+		u := float32((t - t0) / (t1 - t0))
+		pos := make([]vm.Vec3, len(kfs))
+		target := make([]vm.Vec3, len(kfs))
+		fov := make([]vm.Vec3, len(kfs))
+		for i := range kfs {
+			pos[i], target[i], fov[i] = kfs[i].Pos, kfs[i].Target, vm.Vec3{X: kfs[i].Fov}
+		}
+		return CameraKeyframe{Time: t, Pos: deCasteljau(pos, u), Target: deCasteljau(target, u), Fov: deCasteljau(fov, u).X}
+	default:
+		// Find the segment [i, i+1] containing t, neighbours are clamped at both ends
+		i := sort.Search(len(kfs), func(i int) bool { return kfs[i].Time > t }) - 1
+		a, b, c, d := kfs[max(i-1, 0)], kfs[i], kfs[i+1], kfs[min(i+2, len(kfs)-1)]
+		u := float32((t - b.Time) / (c.Time - b.Time))
+		return CameraKeyframe{
+			Time:   t,
+			Pos:    catmullRom(a.Pos, b.Pos, c.Pos, d.Pos, u),
+			Target: catmullRom(a.Target, b.Target, c.Target, d.Target, u),
+			Fov:    catmullRom(vm.Vec3{X: a.Fov}, vm.Vec3{X: b.Fov}, vm.Vec3{X: c.Fov}, vm.Vec3{X: d.Fov}, u).X,
+		}
+	}
+}
+
+// Apply moves the camera onto the path at time t. The camera keeps its Fov, unless the keyframes set one.
+func (p *CameraPath) Apply(cam *Camera, t float64) {
+	kf := p.Evaluate(t)
+	cam.Pos = kf.Pos
+	cam.SetTarget(kf.Target)
+	if kf.Fov > 0 {
+		cam.Fov = kf.Fov
+	}
+}
+
+func withTime(kf CameraKeyframe, t float64) CameraKeyframe {
+	kf.Time = t
+	return kf
+}
+
+// catmullRom evaluates the uniform Catmull-Rom spline segment between p1 and p2, see:
+// https://www.mvps.org/directx/articles/catmull/
+func catmullRom(p0 vm.Vec3, p1 vm.Vec3, p2 vm.Vec3, p3 vm.Vec3, t float32) vm.Vec3 {
+	t2 := t * t
+	t3 := t2 * t
+	return p1.ScalarMul(2).
+		Add(p2.Sub(p0).ScalarMul(t)).
+		Add(p0.ScalarMul(2).Sub(p1.ScalarMul(5)).Add(p2.ScalarMul(4)).Sub(p3).ScalarMul(t2)).
+		Add(p1.ScalarMul(3).Sub(p0).Sub(p2.ScalarMul(3)).Add(p3).ScalarMul(t3)).
+		ScalarMul(0.5)
+}
+
+// deCasteljau evaluates the Bezier curve defined by all control points at t
+func deCasteljau(points []vm.Vec3, t float32) vm.Vec3 {
+	tmp := append([]vm.Vec3{}, points...)
+	for n := len(tmp) - 1; n > 0; n-- {
+		for i := 0; i < n; i++ {
+			tmp[i] = tmp[i].Lerp(tmp[i+1], t)
+		}
+	}
+	return tmp[0]
+}
+
+// File handling
+// ----------------------------------------------------------------------------------------------------------
+
+// SaveCameraPath writes the path to a json file
+func SaveCameraPath(path string, p *CameraPath) error {
+	b, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode camera path: %w", err)
+	}
+	return os.WriteFile(path, b, 0644)
+}
+
+// LoadCameraPath reads a path written by SaveCameraPath
+func LoadCameraPath(path string) (*CameraPath, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p := &CameraPath{}
+	if err = json.Unmarshal(b, p); err != nil {
+		return nil, fmt.Errorf("failed to decode camera path '%s': %w", path, err)
+	}
+	if len(p.Keyframes) == 0 {
+		return nil, errors.New("camera path contains no keyframes")
+	}
+	sort.SliceStable(p.Keyframes, func(i, j int) bool { return p.Keyframes[i].Time < p.Keyframes[j].Time })
+	return p, nil
+}
+
+// Playback
+// ----------------------------------------------------------------------------------------------------------
+
+// CameraPathController is a CameraController playing back a CameraPath. User input is ignored while playing.
+type CameraPathController struct {
+	Path  *CameraPath
+	Speed float64
+
+	elapsed float64
+}
+
+func NewCameraPathController(p *CameraPath) *CameraPathController {
+	return &CameraPathController{
+		Path:  p,
+		Speed: 1,
+	}
+}
+
+// Attach restarts the playback from the beginning
+func (pc *CameraPathController) Attach(cam *Camera) {
+	pc.elapsed = 0
+	pc.Path.Apply(cam, 0)
+}
+
+func (pc *CameraPathController) HandleEvent(*Camera, sdl.Event) {}
+
+func (pc *CameraPathController) Update(cam *Camera, dt time.Duration) {
+	pc.elapsed += dt.Seconds() * pc.Speed
+	pc.Path.Apply(cam, pc.elapsed)
+}
+
+// Done reports whether a non looping path has been played back completely
+func (pc *CameraPathController) Done() bool {
+	return !pc.Path.Loop && pc.elapsed >= pc.Path.Duration()
+}
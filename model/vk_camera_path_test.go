@@ -0,0 +1,115 @@
+package model
+
+import (
+	vm "local/vector_math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func testPath(interpolation int, loop bool) *CameraPath {
+	return &CameraPath{
+		Keyframes: []CameraKeyframe{
+			{Time: 0, Pos: vm.Vec3{}, Target: vm.Vec3{Z: 1}, Fov: 40},
+			{Time: 1, Pos: vm.Vec3{X: 1}, Target: vm.Vec3{X: 1, Z: 1}, Fov: 60},
+			{Time: 3, Pos: vm.Vec3{X: 1, Y: 2}, Target: vm.Vec3{X: 1, Y: 2, Z: 1}, Fov: 50},
+		},
+		Interpolation: interpolation,
+		Loop:          loop,
+	}
+}
+
+func TestCameraPathEvaluate(t *testing.T) {
+	tests := []struct {
+		name          string
+		interpolation int
+		loop          bool
+		t             float64
+		pos           vm.Vec3
+		fov           float32
+	}{
+		{"catmull-rom start", PATH_CATMULL_ROM, false, 0, vm.Vec3{}, 40},
+		{"catmull-rom passes inner keyframe", PATH_CATMULL_ROM, false, 1, vm.Vec3{X: 1}, 60},
+		{"catmull-rom continuous into inner keyframe", PATH_CATMULL_ROM, false, 1 - 1e-6, vm.Vec3{X: 1}, 60},
+		{"catmull-rom end", PATH_CATMULL_ROM, false, 3, vm.Vec3{X: 1, Y: 2}, 50},
+		{"clamped before start", PATH_CATMULL_ROM, false, -1, vm.Vec3{}, 40},
+		{"clamped after end", PATH_CATMULL_ROM, false, 5, vm.Vec3{X: 1, Y: 2}, 50},
+		{"wrapped when looping", PATH_CATMULL_ROM, true, 4, vm.Vec3{X: 1}, 60},
+		{"bezier start", PATH_BEZIER, false, 0, vm.Vec3{}, 40},
+		{"bezier pulled towards inner keyframe", PATH_BEZIER, false, 1.5, vm.Vec3{X: 0.75, Y: 0.5}, 52.5},
+		{"bezier end", PATH_BEZIER, false, 3, vm.Vec3{X: 1, Y: 2}, 50},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kf := testPath(tt.interpolation, tt.loop).Evaluate(tt.t)
+			if !nearlyEqualTol(kf.Pos, tt.pos, 1e-4) || !nearlyEqualTol(kf.Target, tt.pos.Add(vm.Vec3{Z: 1}), 1e-4) {
+				t.Fatalf("expected position %v, got %v looking at %v", tt.pos, kf.Pos, kf.Target)
+			}
+			if d := kf.Fov - tt.fov; d > 1e-3 || d < -1e-3 {
+				t.Fatalf("expected fov %f, got %f", tt.fov, kf.Fov)
+			}
+		})
+	}
+}
+
+func TestCameraPathKeepsFov(t *testing.T) {
+	p := testPath(PATH_CATMULL_ROM, false)
+	p.Keyframes[1].Fov = 0
+	cam := NewCamera(75, 0.1, 100)
+	p.Apply(cam, 0.5)
+	if cam.Fov != 75 {
+		t.Fatalf("expected path with keyframes lacking a fov to keep the camera's, got %f", cam.Fov)
+	}
+	p.Keyframes[1].Fov = 60
+	p.Apply(cam, 1)
+	if cam.Fov != 60 {
+		t.Fatalf("expected path with fov on all keyframes to set it, got %f", cam.Fov)
+	}
+}
+
+func TestCameraPathFileRoundTrip(t *testing.T) {
+	p := testPath(PATH_BEZIER, true)
+	p.Keyframes[0].Fov = 0
+	path := filepath.Join(t.TempDir(), "path.json")
+	if err := SaveCameraPath(path, p); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadCameraPath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, p) {
+		t.Fatalf("expected loaded path %+v, got %+v", p, loaded)
+	}
+
+	if err = os.WriteFile(path, []byte(`{"Keyframes": []}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = LoadCameraPath(path); err == nil {
+		t.Fatalf("expected path without keyframes to be rejected")
+	}
+}
+
+func TestCameraPathControllerDone(t *testing.T) {
+	cam := NewCamera(45, 0.1, 100)
+	pc := NewCameraPathController(testPath(PATH_CATMULL_ROM, false))
+	pc.Attach(cam)
+	pc.Update(cam, 2*time.Second)
+	if pc.Done() {
+		t.Fatalf("expected playback to go on until the last keyframe")
+	}
+	pc.Update(cam, time.Second)
+	if !pc.Done() || !nearlyEqual(cam.Pos, vm.Vec3{X: 1, Y: 2}) {
+		t.Fatalf("expected playback to end on the last keyframe, camera at %v", cam.Pos)
+	}
+	pc.Path.Loop = true
+	if pc.Done() {
+		t.Fatalf("expected looping playback to never end")
+	}
+}
+
+func nearlyEqualTol(a vm.Vec3, b vm.Vec3, tol float32) bool {
+	return a.Sub(b).Len() < tol
+}
@@ -0,0 +1,194 @@
+package model
+
+import (
+	vm "local/vector_math"
+	"math"
+	"testing"
+)
+
+// project applies a projection to a point and does the perspective divide
+func project(m vm.Mat, p vm.Vec3) vm.Vec3 {
+	v := vm.Apply(p, 1, m)
+	w := m[3][0]*p.X + m[3][1]*p.Y + m[3][2]*p.Z + m[3][3]
+	return v.ScalarMul(1 / w)
+}
+
+// expectCorners checks all 8 corners of the cuboid spanned by lbn and rtf land on the matching CVV corner
+func expectCorners(t *testing.T, m vm.Mat, lbn vm.Vec3, rtf vm.Vec3) {
+	t.Helper()
+	for i := 0; i < 8; i++ {
+		p := lbn
+		cvv := vm.Vec3{X: -1, Y: 1, Z: 0}
+		if i&1 != 0 {
+			p.X = rtf.X
+			cvv.X = 1
+		}
+		if i&2 != 0 {
+			p.Y = rtf.Y
+			cvv.Y = -1
+		}
+		if i&4 != 0 {
+			p.Z = rtf.Z
+			cvv.Z = 1
+		}
+		if got := project(m, p); !nearlyEqual(got, cvv) {
+			t.Errorf("Corner %v projected to %v, expected CVV corner %v", p, got, cvv)
+		}
+	}
+}
+
+func TestOrthographicProjectionSymmetric(t *testing.T) {
+	lbn := vm.Vec3{X: -2, Y: 1, Z: 0.1}
+	rtf := vm.Vec3{X: 2, Y: -1, Z: 100}
+	expectCorners(t, newOrthographicProjection(lbn, rtf), lbn, rtf)
+}
+
+func TestOrthographicProjectionOffCenter(t *testing.T) {
+	lbn := vm.Vec3{X: 1, Y: 5, Z: 2}
+	rtf := vm.Vec3{X: 3, Y: 2, Z: 10}
+	m := newOrthographicProjection(lbn, rtf)
+	expectCorners(t, m, lbn, rtf)
+
+	center := vm.Vec3{X: 2, Y: 3.5, Z: 6}
+	if got := project(m, center); !nearlyEqual(got, vm.Vec3{Z: 0.5}) {
+		t.Errorf("Volume center projected to %v, expected CVV center", got)
+	}
+}
+
+func TestCameraOrthographicZoom(t *testing.T) {
+	cam := NewCamera(45, 1, 11)
+	cam.ProjectionType = CAM_ORTHOGRAPHIC_PROJECTION
+	cam.Aspect = 2
+	cam.OrthoHeight = 4
+	cam.Zoom = 2
+
+	// Zoom 2 halves the visible height to 2, the width follows the aspect ratio
+	lbn, rtf := cam.OrthoVolume()
+	if !nearlyEqual(lbn, vm.Vec3{X: -2, Y: 1, Z: 1}) || !nearlyEqual(rtf, vm.Vec3{X: 2, Y: -1, Z: 11}) {
+		t.Errorf("Unexpected ortho volume lbn: %v, rtf: %v", lbn, rtf)
+	}
+	expectCorners(t, cam.GetProjection(), lbn, rtf)
+
+	cam.ZoomBy(1)
+	if math.Abs(float64(cam.Zoom-2.2)) > epsilon {
+		t.Errorf("ZoomBy(1) should zoom in by one step, got zoom %f", cam.Zoom)
+	}
+}
+
+func TestCameraOrthographicOffset(t *testing.T) {
+	cam := NewCamera(45, 1, 11)
+	cam.ProjectionType = CAM_ORTHOGRAPHIC_PROJECTION
+	cam.Aspect = 1
+	cam.OrthoOffset = vm.Vec2{X: 3, Y: -1}
+
+	lbn, rtf := cam.OrthoVolume()
+	expectCorners(t, cam.GetProjection(), lbn, rtf)
+	if got := project(cam.GetProjection(), vm.Vec3{X: 3, Y: -1, Z: 1}); !nearlyEqual(got, vm.Vec3{}) {
+		t.Errorf("Offset center projected to %v, expected (0, 0, 0)", got)
+	}
+}
+
+func TestPerspectiveProjectionDepth(t *testing.T) {
+	m := newPerspectiveProjection(vm.ToRad(90), 1, 0.5, 50)
+	if got := project(m, vm.Vec3{Z: 0.5}); !nearlyEqual(got, vm.Vec3{}) {
+		t.Errorf("Near plane projected to %v, expected depth 0", got)
+	}
+	if got := project(m, vm.Vec3{Z: 50}); !nearlyEqual(got, vm.Vec3{Z: 1}) {
+		t.Errorf("Far plane projected to %v, expected depth 1", got)
+	}
+	// A 90° fov reaches x = z on the right edge
+	if got := project(m, vm.Vec3{X: 10, Y: -10, Z: 10}); math.Abs(float64(got.X-1)) > epsilon || math.Abs(float64(got.Y+1)) > epsilon {
+		t.Errorf("Frustum corner projected to %v, expected x: 1, y: -1", got)
+	}
+}
+
+func TestReverseZProjectionDepth(t *testing.T) {
+	m := newReversePerspectiveProjection(vm.ToRad(90), 1, 0.5, 50)
+	if got := project(m, vm.Vec3{Z: 0.5}); !nearlyEqual(got, vm.Vec3{Z: 1}) {
+		t.Errorf("Near plane projected to %v, expected depth 1", got)
+	}
+	if got := project(m, vm.Vec3{Z: 50}); !nearlyEqual(got, vm.Vec3{}) {
+		t.Errorf("Far plane projected to %v, expected depth 0", got)
+	}
+
+	inf := newInfiniteReversePerspectiveProjection(vm.ToRad(90), 1, 0.5)
+	if got := project(inf, vm.Vec3{Z: 0.5}); !nearlyEqual(got, vm.Vec3{Z: 1}) {
+		t.Errorf("Near plane projected to %v, expected depth 1", got)
+	}
+	if got := project(inf, vm.Vec3{Z: 1e6}); got.Z <= 0 || got.Z > epsilon {
+		t.Errorf("Distant point projected to depth %f, expected a tiny positive depth", got.Z)
+	}
+
+	cam := NewCamera(45, 1, 11)
+	cam.ProjectionType = CAM_ORTHOGRAPHIC_PROJECTION
+	cam.DepthMode = CAM_DEPTH_REVERSE_Z
+	cam.Aspect = 1
+	if got := project(cam.GetProjection(), vm.Vec3{Z: 11}); !nearlyEqual(got, vm.Vec3{}) {
+		t.Errorf("Orthographic far plane projected to %v, expected depth 0", got)
+	}
+}
+
+func TestCameraFrame(t *testing.T) {
+	sphere := BoundingSphere{Center: vm.Vec3{X: 3, Y: -1, Z: 7}, Radius: 2}
+	const padding = 0.25
+	padded := sphere.Radius * (1 + padding)
+	tests := []struct {
+		name       string
+		projection int
+		aspect     float32
+		target     bool
+		far        float32
+	}{
+		{"perspective", CAM_PERSPECTIVE_PROJECTION, 1, false, 100},
+		{"perspective wide", CAM_PERSPECTIVE_PROJECTION, 2, false, 100},
+		{"perspective tall", CAM_PERSPECTIVE_PROJECTION, 0.5, false, 100},
+		{"perspective look target", CAM_PERSPECTIVE_PROJECTION, 1.5, true, 100},
+		{"perspective far pushed out", CAM_PERSPECTIVE_PROJECTION, 1, false, 1},
+		{"orthographic wide", CAM_ORTHOGRAPHIC_PROJECTION, 1.5, false, 100},
+		{"orthographic tall", CAM_ORTHOGRAPHIC_PROJECTION, 0.5, false, 100},
+		{"orthographic look target", CAM_ORTHOGRAPHIC_PROJECTION, 1, true, 100},
+		{"orthographic far pushed out", CAM_ORTHOGRAPHIC_PROJECTION, 1, false, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cam := NewCamera(60, 0.1, tt.far)
+			cam.ProjectionType = tt.projection
+			cam.Aspect = tt.aspect
+			cam.Pos = vm.Vec3{X: -5, Y: 2}
+			cam.LookDir = vm.Vec3{X: 1, Z: 1}.Norm()
+			if tt.target {
+				cam.SetTarget(vm.Vec3{X: 1, Y: 2, Z: 5})
+			}
+			dir := cam.LookDir
+			if tt.target {
+				dir = cam.LookTarget.Sub(cam.Pos).Norm()
+			}
+			cam.Frame(Bounds{Sphere: sphere}, padding)
+
+			if !nearlyEqual(cam.Pos.Add(dir.ScalarMul(sphere.Center.Sub(cam.Pos).Len())), sphere.Center) {
+				t.Fatalf("expected the camera to keep looking along %v at the sphere, placed at %v", dir, cam.Pos)
+			}
+			if tt.target && !nearlyEqual(*cam.LookTarget, sphere.Center) {
+				t.Fatalf("expected the look target to move to the sphere's center, got %v", *cam.LookTarget)
+			}
+			// The padded sphere is inside every plane and touches the closest one
+			closest := float32(math.Inf(1))
+			for i, plane := range cam.Frustum().Planes {
+				d := plane.Distance(sphere.Center)
+				if d < padded-1e-3 {
+					t.Fatalf("expected the padded sphere to be inside plane %d, center is %f away", i, d)
+				}
+				closest = min(closest, d)
+			}
+			if closest > padded+1e-3 {
+				t.Fatalf("expected the padded sphere to touch the frustum, closest plane is %f away", closest)
+			}
+			if dist := sphere.Center.Sub(cam.Pos).Len(); cam.Far < dist+padded-1e-3 {
+				t.Fatalf("expected far to be pushed out behind the sphere, far is %f", cam.Far)
+			}
+			if tt.far == 100 && cam.Far != 100 {
+				t.Fatalf("expected a far plane already behind the sphere to stay, got %f", cam.Far)
+			}
+		})
+	}
+}
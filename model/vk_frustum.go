@@ -0,0 +1,100 @@
+package model
+
+import (
+	vm "local/vector_math"
+)
+
+// Plane in the form Normal . p + D = 0. Points with a positive distance lie on the side the normal points to.
+type Plane struct {
+	Normal vm.Vec3
+	D      float32
+}
+
+// Distance returns the signed distance of p to the plane. This is only a true distance for normalized planes.
+func (p Plane) Distance(v vm.Vec3) float32 {
+	return p.Normal.Dot(v) + p.D
+}
+
+func (p Plane) normalized() Plane {
+	l := p.Normal.Len()
+	if l == 0 {
+		return p
+	}
+	return Plane{Normal: p.Normal.ScalarMul(1 / l), D: p.D / l}
+}
+
+const (
+	FRUSTUM_LEFT = iota
+	FRUSTUM_RIGHT
+	FRUSTUM_BOTTOM
+	FRUSTUM_TOP
+	FRUSTUM_NEAR
+	FRUSTUM_FAR
+)
+
+// Frustum is the view volume of a camera, described by 6 inward facing planes in world space.
+type Frustum struct {
+	Planes [6]Plane
+}
+
+// NewFrustum extracts the frustum planes from a combined projection * view matrix, after Gribb & Hartmann:
+// https://www.gribblegames.com/articles/game_programming/frustum_culling/ (Fast Extraction of Viewing Frustum Planes)
+// As Vulkan's CVV spans 0..1 in depth, the near plane is the third row alone instead of row4 + row3 as in OpenGL. Its
+// y-axis points down, so y = -w bounds the top instead of the bottom.
+func NewFrustum(viewProj vm.Mat) Frustum {
+	row := func(i int) Plane {
+		return Plane{Normal: vm.Vec3{X: viewProj[i][0], Y: viewProj[i][1], Z: viewProj[i][2]}, D: viewProj[i][3]}
+	}
+	add := func(a Plane, b Plane) Plane {
+		return Plane{Normal: a.Normal.Add(b.Normal), D: a.D + b.D}
+	}
+	sub := func(a Plane, b Plane) Plane {
+		return Plane{Normal: a.Normal.Sub(b.Normal), D: a.D - b.D}
+	}
+	r0, r1, r2, r3 := row(0), row(1), row(2), row(3)
+	f := Frustum{}
+	f.Planes[FRUSTUM_LEFT] = add(r3, r0).normalized()
+	f.Planes[FRUSTUM_RIGHT] = sub(r3, r0).normalized()
+	f.Planes[FRUSTUM_TOP] = add(r3, r1).normalized()
+	f.Planes[FRUSTUM_BOTTOM] = sub(r3, r1).normalized()
+	f.Planes[FRUSTUM_NEAR] = r2.normalized()
+	f.Planes[FRUSTUM_FAR] = sub(r3, r2).normalized()
+	return f
+}
+
+// IntersectsSphere reports whether the sphere is at least partially inside the frustum
+func (f Frustum) IntersectsSphere(s BoundingSphere) bool {
+	for i := range f.Planes {
+		if f.Planes[i].Distance(s.Center) < -s.Radius {
+			return false
+		}
+	}
+	return true
+}
+
+// IntersectsAABB reports whether the box is at least partially inside the frustum. It tests the corner furthest
+// along each plane normal (the positive vertex), which is conservative near the frustum's edges.
+func (f Frustum) IntersectsAABB(b AABB) bool {
+	for i := range f.Planes {
+		n := f.Planes[i].Normal
+		p := b.Min
+		if n.X >= 0 {
+			p.X = b.Max.X
+		}
+		if n.Y >= 0 {
+			p.Y = b.Max.Y
+		}
+		if n.Z >= 0 {
+			p.Z = b.Max.Z
+		}
+		if f.Planes[i].Distance(p) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// IntersectsBounds tests the cheap sphere first and only falls back to the tighter box if the sphere is visible.
+func (f Frustum) IntersectsBounds(b Bounds) bool {
+	return f.IntersectsSphere(b.Sphere) && f.IntersectsAABB(b.Box)
+}
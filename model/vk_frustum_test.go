@@ -0,0 +1,109 @@
+package model
+
+import (
+	vm "local/vector_math"
+	"testing"
+)
+
+// frustumCameras look from the origin along +z. The perspective ones see x and y within ±z, the orthographic ones
+// within ±2. Near is at 0.5, far at 10 unless infinite.
+func frustumCameras() map[string]*Camera {
+	cams := map[string]*Camera{}
+	for name, mode := range map[string]int{
+		"standard":           CAM_DEPTH_STANDARD,
+		"reverse-z":          CAM_DEPTH_REVERSE_Z,
+		"infinite reverse-z": CAM_DEPTH_REVERSE_Z_INF,
+	} {
+		for proj, projName := range []string{"perspective", "orthographic"} {
+			cam := NewCamera(90, 0.5, 10)
+			cam.Aspect = 1
+			cam.OrthoHeight = 4
+			cam.DepthMode = mode
+			cam.ProjectionType = []int{CAM_PERSPECTIVE_PROJECTION, CAM_ORTHOGRAPHIC_PROJECTION}[proj]
+			cams[projName+" "+name] = cam
+		}
+	}
+	return cams
+}
+
+func TestFrustumPlanes(t *testing.T) {
+	tests := []struct {
+		name    string
+		p       vm.Vec3
+		outside int  // plane the point lies behind, -1 for inside all of them
+		only    bool // the point may lie behind other planes as well
+	}{
+		{"inside", vm.Vec3{X: 1, Y: -1, Z: 5}, -1, false},
+		{"left", vm.Vec3{X: -6, Z: 5}, FRUSTUM_LEFT, false},
+		{"right", vm.Vec3{X: 6, Z: 5}, FRUSTUM_RIGHT, false},
+		// Vulkan's y-axis points down, so does the camera's
+		{"bottom", vm.Vec3{Y: 6, Z: 5}, FRUSTUM_BOTTOM, false},
+		{"top", vm.Vec3{Y: -6, Z: 5}, FRUSTUM_TOP, false},
+		{"before near", vm.Vec3{Z: 0.25}, FRUSTUM_NEAR, false},
+		// Behind a perspective camera, the side planes have crossed over as well
+		{"behind camera", vm.Vec3{Z: -1}, FRUSTUM_NEAR, true},
+		{"beyond far", vm.Vec3{Z: 20}, FRUSTUM_FAR, false},
+	}
+	for camName, cam := range frustumCameras() {
+		f := cam.Frustum()
+		for _, tt := range tests {
+			t.Run(camName+" "+tt.name, func(t *testing.T) {
+				outside := tt.outside
+				if outside == FRUSTUM_FAR && cam.DepthMode == CAM_DEPTH_REVERSE_Z_INF && cam.ProjectionType == CAM_PERSPECTIVE_PROJECTION {
+					// Without a far plane, nothing in front of the camera is too far
+					outside = -1
+				}
+				for i, plane := range f.Planes {
+					d := plane.Distance(tt.p)
+					if i == outside && d >= 0 {
+						t.Fatalf("expected %v to be behind plane %d, distance is %f", tt.p, i, d)
+					}
+					if i != outside && !tt.only && d < 0 {
+						t.Fatalf("expected %v to be in front of plane %d, distance is %f", tt.p, i, d)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestFrustumIntersections(t *testing.T) {
+	box := func(center vm.Vec3, half float32) AABB {
+		ext := vm.Vec3{X: half, Y: half, Z: half}
+		return AABB{Min: center.Sub(ext), Max: center.Add(ext)}
+	}
+	tests := []struct {
+		name    string
+		box     AABB
+		visible bool
+	}{
+		{"inside", box(vm.Vec3{Z: 5}, 0.5), true},
+		{"straddling left", box(vm.Vec3{X: -6, Z: 5}, 5), true},
+		{"straddling near", box(vm.Vec3{}, 1), true},
+		{"straddling far", box(vm.Vec3{Z: 10}, 1), true},
+		{"left", box(vm.Vec3{X: -8, Z: 5}, 1), false},
+		{"right", box(vm.Vec3{X: 8, Z: 5}, 1), false},
+		{"bottom", box(vm.Vec3{Y: 8, Z: 5}, 1), false},
+		{"top", box(vm.Vec3{Y: -8, Z: 5}, 1), false},
+		{"behind camera", box(vm.Vec3{Z: -5}, 1), false},
+		{"beyond far", box(vm.Vec3{Z: 20}, 1), false},
+	}
+	for camName, cam := range frustumCameras() {
+		f := cam.Frustum()
+		for _, tt := range tests {
+			t.Run(camName+" "+tt.name, func(t *testing.T) {
+				visible := tt.visible
+				if tt.name == "beyond far" && cam.DepthMode == CAM_DEPTH_REVERSE_Z_INF && cam.ProjectionType == CAM_PERSPECTIVE_PROJECTION {
+					visible = true
+				}
+				sphere := BoundingSphere{Center: tt.box.Center(), Radius: tt.box.Extents().X}
+				if got := f.IntersectsAABB(tt.box); got != visible {
+					t.Fatalf("expected box %v to be visible: %v", tt.box, visible)
+				}
+				if got := f.IntersectsSphere(sphere); got != visible {
+					t.Fatalf("expected sphere %v to be visible: %v", sphere, visible)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package model
+
+import (
+	"GPU_fluid_simulation/common"
+	"fmt"
+	vk "github.com/goki/vulkan"
+	vm "local/vector_math"
+	"unsafe"
+)
+
+// INSTANCE_BINDING is the vertex input binding the per-instance data is read from, binding 0 holds the vertices
+const INSTANCE_BINDING = 1
+
+// INSTANCE_STRIDE is the size of a single instance within an instance buffer: a 4x4 transform and an RGB color
+const INSTANCE_STRIDE = 16*4 + 3*4
+
+// Instance is one copy of an instanced model's mesh. Transform is applied before the model's Mesh.ModelMat, so moving
+// the model moves all of its instances. Color is multiplied with the vertex colors, white keeps them as they are.
+type Instance struct {
+	Transform vm.Mat
+	Color     vm.Vec3
+}
+
+func NewInstance(transform vm.Mat) Instance {
+	return Instance{Transform: transform, Color: vm.Vec3{X: 1, Y: 1, Z: 1}}
+}
+
+// InstanceHandle identifies an instance within its Instances. It stays valid until the instance is removed, while the
+// instance's position in the instance buffer changes as others are removed.
+type InstanceHandle uint32
+
+// Instances are the per-instance data of a model drawn many times with a single draw call. The instances are kept
+// packed, so the first Len() of them can be drawn: removing one moves the last instance into its place. Changes are
+// tracked the same way as for dynamic meshes, see: Model.MarkDirty.
+type Instances struct {
+	data    []Instance
+	handles []InstanceHandle
+	index   map[InstanceHandle]int
+	next    InstanceHandle
+	dirty   MeshRange
+	// Number of instances from the start the instance buffer holds, see: Uploaded
+	uploaded int
+}
+
+func NewInstances() *Instances {
+	return &Instances{index: make(map[InstanceHandle]int)}
+}
+
+func (in *Instances) Len() int {
+	return len(in.data)
+}
+
+// Add appends an instance and returns its handle
+func (in *Instances) Add(inst Instance) InstanceHandle {
+	h := in.next
+	in.next++
+	in.index[h] = len(in.data)
+	in.data = append(in.data, inst)
+	in.handles = append(in.handles, h)
+	in.dirty = in.dirty.Union(MeshRange{First: len(in.data) - 1, Count: 1})
+	return h
+}
+
+// Get returns the instance of the handle
+func (in *Instances) Get(h InstanceHandle) (Instance, error) {
+	i, ok := in.index[h]
+	if !ok {
+		return Instance{}, fmt.Errorf("instance %d not found", h)
+	}
+	return in.data[i], nil
+}
+
+// Set replaces the instance of the handle
+func (in *Instances) Set(h InstanceHandle, inst Instance) error {
+	i, ok := in.index[h]
+	if !ok {
+		return fmt.Errorf("instance %d not found", h)
+	}
+	in.data[i] = inst
+	in.dirty = in.dirty.Union(MeshRange{First: i, Count: 1})
+	return nil
+}
+
+// Remove drops the instance of the handle, the last instance takes its place
+func (in *Instances) Remove(h InstanceHandle) error {
+	i, ok := in.index[h]
+	if !ok {
+		return fmt.Errorf("instance %d not found", h)
+	}
+	last := len(in.data) - 1
+	if i != last {
+		in.data[i], in.handles[i] = in.data[last], in.handles[last]
+		in.index[in.handles[i]] = i
+		in.dirty = in.dirty.Union(MeshRange{First: i, Count: 1})
+	}
+	delete(in.index, h)
+	in.data, in.handles = in.data[:last], in.handles[:last]
+	return nil
+}
+
+// IsDirty reports whether instances are waiting to be uploaded
+func (in *Instances) IsDirty() bool {
+	return !in.dirty.Empty()
+}
+
+// TakeDirty returns up to n instances from the start of the range changed since the last call, cut down to the current
+// number of instances, and clears only those. The rest stays dirty, so the renderer can upload large changes over
+// several frames.
+func (in *Instances) TakeDirty(n int) MeshRange {
+	var taken MeshRange
+	taken, in.dirty = in.dirty.Clamp(len(in.data)).Split(n)
+	return taken
+}
+
+// Uploaded is called by the renderer once the range of instances has been uploaded and returns the number of instances
+// that can be drawn. These are the ones uploaded from the start without a gap, the same way as for indices, see:
+// Model.IndicesUploaded.
+func (in *Instances) Uploaded(r MeshRange) int {
+	in.uploaded = min(in.uploaded, len(in.data))
+	if !r.Empty() && r.First <= in.uploaded {
+		in.uploaded = max(in.uploaded, r.End())
+	}
+	return in.uploaded
+}
+
+// MarkAllDirty flags every instance to be uploaded again, e.g.: into a new instance buffer, which holds none of them yet
+func (in *Instances) MarkAllDirty() {
+	in.dirty = AllOf(len(in.data))
+	in.uploaded = 0
+}
+
+// GetRangeBytes returns the raw bytes of the instances in the range, placed at offset r.First * INSTANCE_STRIDE
+// within the instance buffer
+func (in *Instances) GetRangeBytes(r MeshRange) []byte {
+	raw := make([]byte, 0, r.Count*INSTANCE_STRIDE)
+	for _, inst := range in.data[r.First:r.End()] {
+		raw = append(raw, common.RawBytes(inst.Transform.Unroll())...)
+		raw = append(raw, common.RawBytes(inst.Color)...)
+	}
+	return raw
+}
+
+// GetInstanceBindingDescription describes the instance buffer, advanced once per instance instead of per vertex
+func GetInstanceBindingDescription() vk.VertexInputBindingDescription {
+	return vk.VertexInputBindingDescription{
+		Binding:   INSTANCE_BINDING,
+		Stride:    INSTANCE_STRIDE,
+		InputRate: vk.VertexInputRateInstance,
+	}
+}
+
+// GetInstanceAttributeDescriptions follows the vertex attributes. A mat4 attribute takes up one location per column.
+func GetInstanceAttributeDescriptions() []vk.VertexInputAttributeDescription {
+	var attrs []vk.VertexInputAttributeDescription
+	column := uint32(4 * unsafe.Sizeof(float32(0)))
+	for i := uint32(0); i < 4; i++ {
+		attrs = append(attrs, vk.VertexInputAttributeDescription{
+			Location: 3 + i,
+			Binding:  INSTANCE_BINDING,
+			Format:   vk.FormatR32g32b32a32Sfloat,
+			Offset:   i * column,
+		})
+	}
+	return append(attrs, vk.VertexInputAttributeDescription{
+		Location: 7,
+		Binding:  INSTANCE_BINDING,
+		Format:   vk.FormatR32g32b32Sfloat,
+		Offset:   4 * column,
+	})
+}
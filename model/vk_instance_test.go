@@ -0,0 +1,70 @@
+package model
+
+import (
+	vm "local/vector_math"
+	"math"
+	"testing"
+)
+
+func TestInstancesRemoveKeepsHandles(t *testing.T) {
+	in := NewInstances()
+	var hs []InstanceHandle
+	for i := 0; i < 3; i++ {
+		hs = append(hs, in.Add(NewInstance(vm.NewUnitMat(4))))
+	}
+	in.TakeDirty(math.MaxInt)
+	moved := Instance{Transform: vm.NewUnitMat(4), Color: vm.Vec3{X: 1}}
+	if err := in.Set(hs[2], moved); err != nil {
+		t.Fatal(err)
+	}
+	in.TakeDirty(math.MaxInt)
+	if err := in.Remove(hs[0]); err != nil {
+		t.Fatal(err)
+	}
+	// The last instance moved into the gap and has to be uploaded again at its new position
+	if got := in.TakeDirty(math.MaxInt); got != (MeshRange{First: 0, Count: 1}) {
+		t.Fatalf("expected the moved instance to be dirty, got %v", got)
+	}
+	if inst, err := in.Get(hs[2]); err != nil || inst.Color != moved.Color {
+		t.Fatalf("expected handle to follow the moved instance, got %v (%v)", inst, err)
+	}
+	if _, err := in.Get(hs[0]); err == nil || in.Len() != 2 {
+		t.Fatalf("expected removed instance to be gone, %d left", in.Len())
+	}
+}
+
+func TestInstanceBytes(t *testing.T) {
+	in := NewInstances()
+	in.Add(NewInstance(vm.NewUnitMat(4)))
+	in.Add(NewInstance(vm.NewUnitMat(4)))
+	if got := len(in.GetRangeBytes(AllOf(2))); got != 2*INSTANCE_STRIDE {
+		t.Fatalf("expected %d bytes, got %d", 2*INSTANCE_STRIDE, got)
+	}
+}
+
+func TestInstancesUploadedInParts(t *testing.T) {
+	in := NewInstances()
+	for i := 0; i < 5; i++ {
+		in.Add(NewInstance(vm.NewUnitMat(4)))
+	}
+	in.MarkAllDirty()
+	first := in.TakeDirty(3)
+	if first != (MeshRange{First: 0, Count: 3}) || !in.IsDirty() {
+		t.Fatalf("expected the first 3 instances with the rest left dirty, got %v", first)
+	}
+	if got := in.Uploaded(first); got != 3 {
+		t.Fatalf("expected only the uploaded instances to be drawn, got %d", got)
+	}
+	rest := in.TakeDirty(3)
+	if rest != (MeshRange{First: 3, Count: 2}) || in.IsDirty() {
+		t.Fatalf("expected the remaining 2 instances, got %v", rest)
+	}
+	if got := in.Uploaded(rest); got != 5 {
+		t.Fatalf("expected all instances to be drawn, got %d", got)
+	}
+	// A new instance buffer holds none of them
+	in.MarkAllDirty()
+	if got := in.Uploaded(MeshRange{}); got != 0 {
+		t.Fatalf("expected no instance to be drawn from a new buffer, got %d", got)
+	}
+}
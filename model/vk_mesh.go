@@ -2,12 +2,21 @@ package model
 
 import (
 	"local/vector_math"
+	"unsafe"
 )
 
+// INDEX_STRIDE is the size of a single index within an index buffer, indices are always uint32
+const INDEX_STRIDE = int(unsafe.Sizeof(uint32(0)))
+
 type Mesh struct {
+	// Vertices may be edited directly, but the cached bounds then have to be dropped by InvalidateBounds, otherwise
+	// culling keeps testing the old volume. SetVertex, SetVertices and Model.MarkDirty do so already.
 	Vertices []Vertex
 	VIndices []uint32
 	ModelMat vector_math.Mat
+
+	// bounds is computed lazily by Bounds() and dropped whenever vertices are edited through the Mesh functions
+	bounds *Bounds
 }
 
 func NewMesh(v []Vertex, id []uint32) *Mesh {
@@ -17,3 +26,31 @@ func NewMesh(v []Vertex, id []uint32) *Mesh {
 		ModelMat: vector_math.NewUnitMat(4),
 	}
 }
+
+// Bounds returns the local space bounding volumes of the mesh. The result is cached until the vertices change via
+// SetVertex, SetVertices or an explicit call to InvalidateBounds.
+func (m *Mesh) Bounds() Bounds {
+	if m.bounds == nil {
+		b := computeBounds(m.Vertices)
+		m.bounds = &b
+	}
+	return *m.bounds
+}
+
+// InvalidateBounds drops the cached bounds. It must be called after editing Mesh.Vertices directly, unless the edit is
+// marked through Model.MarkDirty.
+func (m *Mesh) InvalidateBounds() {
+	m.bounds = nil
+}
+
+// SetVertex replaces a single vertex and invalidates the cached bounds
+func (m *Mesh) SetVertex(i int, v Vertex) {
+	m.Vertices[i] = v
+	m.InvalidateBounds()
+}
+
+// SetVertices replaces all vertices and invalidates the cached bounds
+func (m *Mesh) SetVertices(v []Vertex) {
+	m.Vertices = v
+	m.InvalidateBounds()
+}
@@ -0,0 +1,47 @@
+package model
+
+// MeshRange is a contiguous range of vertices or indices of a mesh, e.g.: the part edited since the last frame
+type MeshRange struct {
+	First int
+	Count int
+}
+
+// AllOf returns the range covering n elements
+func AllOf(n int) MeshRange {
+	return MeshRange{First: 0, Count: n}
+}
+
+func (r MeshRange) Empty() bool {
+	return r.Count <= 0
+}
+
+// End returns the index after the last element of the range
+func (r MeshRange) End() int {
+	return r.First + r.Count
+}
+
+// Union returns the smallest range covering both ranges. Ranges are merged instead of kept apart, as uploading the
+// few unchanged elements in between is cheaper than issuing a copy per range.
+func (r MeshRange) Union(o MeshRange) MeshRange {
+	if r.Empty() {
+		return o
+	}
+	if o.Empty() {
+		return r
+	}
+	first := min(r.First, o.First)
+	return MeshRange{First: first, Count: max(r.End(), o.End()) - first}
+}
+
+// Clamp cuts the range down to the first n elements, e.g.: after the mesh shrank
+func (r MeshRange) Clamp(n int) MeshRange {
+	first := min(max(r.First, 0), n)
+	return MeshRange{First: first, Count: max(min(r.End(), n)-first, 0)}
+}
+
+// Split returns the first n elements of the range and the rest of it, e.g.: the part uploaded this frame and the part
+// left for the next ones
+func (r MeshRange) Split(n int) (head MeshRange, tail MeshRange) {
+	count := max(min(n, r.Count), 0)
+	return MeshRange{First: r.First, Count: count}, MeshRange{First: r.First + count, Count: r.Count - count}
+}
@@ -0,0 +1,136 @@
+package model
+
+import "testing"
+
+func TestMeshRangeUnion(t *testing.T) {
+	tests := []struct {
+		a, b, want MeshRange
+	}{
+		{MeshRange{}, MeshRange{First: 4, Count: 2}, MeshRange{First: 4, Count: 2}},
+		{MeshRange{First: 4, Count: 2}, MeshRange{}, MeshRange{First: 4, Count: 2}},
+		{MeshRange{First: 0, Count: 2}, MeshRange{First: 8, Count: 2}, MeshRange{First: 0, Count: 10}},
+		{MeshRange{First: 2, Count: 8}, MeshRange{First: 4, Count: 2}, MeshRange{First: 2, Count: 8}},
+	}
+	for _, tt := range tests {
+		if got := tt.a.Union(tt.b); got != tt.want {
+			t.Errorf("%v union %v: expected %v, got %v", tt.a, tt.b, tt.want, got)
+		}
+	}
+}
+
+func TestMeshRangeClamp(t *testing.T) {
+	if got := (MeshRange{First: 6, Count: 10}).Clamp(10); got != (MeshRange{First: 6, Count: 4}) {
+		t.Fatalf("expected range cut at the end, got %v", got)
+	}
+	if got := (MeshRange{First: 12, Count: 4}).Clamp(10); !got.Empty() {
+		t.Fatalf("expected range past the end to be empty, got %v", got)
+	}
+}
+
+func TestMeshRangeSplit(t *testing.T) {
+	head, tail := (MeshRange{First: 4, Count: 10}).Split(3)
+	if head != (MeshRange{First: 4, Count: 3}) || tail != (MeshRange{First: 7, Count: 7}) {
+		t.Fatalf("expected split after 3 elements, got %v and %v", head, tail)
+	}
+	if head, tail = (MeshRange{First: 4, Count: 2}).Split(3); head != (MeshRange{First: 4, Count: 2}) || !tail.Empty() {
+		t.Fatalf("expected whole range in the head, got %v and %v", head, tail)
+	}
+}
+
+func TestModelTakeDirtyInParts(t *testing.T) {
+	m := NewModel(NewMesh(make([]Vertex, 8), make([]uint32, 12)), "dynamic")
+	m.MarkDirty(AllOf(8))
+	if got := m.TakeDirtyVertices(5); got != (MeshRange{First: 0, Count: 5}) {
+		t.Fatalf("expected the first 5 vertices, got %v", got)
+	}
+	if !m.IsDirty() {
+		t.Fatalf("expected the rest of the range to stay dirty")
+	}
+	// Edits marked in between are merged with the rest
+	m.MarkDirty(MeshRange{First: 1, Count: 1})
+	if got := m.TakeDirtyVertices(16); got != (MeshRange{First: 1, Count: 7}) {
+		t.Fatalf("expected the rest merged with the new edit, got %v", got)
+	}
+	if m.IsDirty() {
+		t.Fatalf("expected ranges to be cleared")
+	}
+}
+
+func TestModelTakeDirty(t *testing.T) {
+	m := NewModel(NewMesh(make([]Vertex, 8), make([]uint32, 12)), "dynamic")
+	m.MarkDirty(MeshRange{First: 1, Count: 2})
+	m.MarkDirty(MeshRange{First: 6, Count: 4})
+	if !m.IsDirty() {
+		t.Fatalf("expected model to be dirty")
+	}
+	vertices, indices := m.TakeDirty()
+	if vertices != (MeshRange{First: 1, Count: 7}) || !indices.Empty() {
+		t.Fatalf("expected merged vertex range cut at the mesh size, got %v and %v", vertices, indices)
+	}
+	if m.IsDirty() {
+		t.Fatalf("expected ranges to be cleared")
+	}
+}
+
+func TestStaticModelRejectsGrowth(t *testing.T) {
+	m := NewModel(NewMesh(make([]Vertex, 8), make([]uint32, 12)), "static")
+	m.Static, m.PooledVertices, m.PooledIndices = true, AllOf(8), AllOf(12)
+	m.Mesh.Vertices = append(m.Mesh.Vertices, Vertex{})
+	if err := m.MarkDirty(AllOf(9)); err == nil {
+		t.Fatalf("expected vertices past the pooled ones to be rejected")
+	}
+	if err := m.MarkIndicesDirty(MeshRange{First: 10, Count: 3}); err == nil {
+		t.Fatalf("expected indices past the pooled ones to be rejected")
+	}
+	if m.IsDirty() {
+		t.Fatalf("expected rejected ranges not to be marked")
+	}
+	if err := m.MarkDirty(AllOf(8)); err != nil || !m.IsDirty() {
+		t.Fatalf("expected the pooled vertices to be marked: %v", err)
+	}
+}
+
+func TestModelShrunkIndicesAreDirty(t *testing.T) {
+	m := NewModel(NewMesh(make([]Vertex, 8), make([]uint32, 12)), "dynamic")
+	m.IndexCount = 12
+	if m.IsDirty() {
+		t.Fatalf("expected uploaded model to be clean")
+	}
+	// Dropping the last triangles marks nothing, the stale indices must not be drawn anyway
+	m.Mesh.VIndices = m.Mesh.VIndices[:6]
+	if !m.IsDirty() {
+		t.Fatalf("expected model with fewer indices than drawn to be dirty")
+	}
+	if vertices, indices := m.TakeDirty(); !vertices.Empty() || !indices.Empty() {
+		t.Fatalf("expected no ranges to upload, got %v and %v", vertices, indices)
+	}
+	m.IndexCount = uint32(len(m.Mesh.VIndices))
+	if m.IsDirty() {
+		t.Fatalf("expected model to be clean once the index count is cut down")
+	}
+}
+
+func TestModelDrawsOnlyUploadedIndices(t *testing.T) {
+	m := NewModel(NewMesh(make([]Vertex, 8), make([]uint32, 12)), "dynamic")
+	m.IndicesUploaded(AllOf(12))
+	tests := []struct {
+		name     string
+		edit     func()
+		uploaded MeshRange
+		count    uint32
+	}{
+		{"appended without marking", func() { m.Mesh.VIndices = append(m.Mesh.VIndices, 0, 1, 2) }, MeshRange{}, 12},
+		{"appended and marked", func() {}, MeshRange{First: 12, Count: 3}, 15},
+		{"removed from the end", func() { m.Mesh.VIndices = m.Mesh.VIndices[:6] }, MeshRange{}, 6},
+		{"regrown without marking", func() { m.Mesh.VIndices = m.Mesh.VIndices[:12] }, MeshRange{}, 6},
+		{"marked past a gap", func() {}, MeshRange{First: 9, Count: 3}, 6},
+		{"gap marked as well", func() {}, MeshRange{First: 6, Count: 3}, 9},
+	}
+	for _, tt := range tests {
+		tt.edit()
+		m.IndicesUploaded(tt.uploaded)
+		if m.IndexCount != tt.count {
+			t.Fatalf("%s: expected %d indices to be drawn, got %d", tt.name, tt.count, m.IndexCount)
+		}
+	}
+}
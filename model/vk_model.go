@@ -2,19 +2,38 @@ package model
 
 import (
 	"GPU_fluid_simulation/common"
+	"fmt"
 	vm "local/vector_math"
+	"math"
 	"unsafe"
-
-	vk "github.com/goki/vulkan"
 )
 
 type Model struct {
-	Mesh            *Mesh
-	Name            string
-	VertexBuffer    vk.Buffer
-	VertexBufferMem vk.DeviceMemory
-	IndexBuffer     vk.Buffer
-	IndexBufferMem  vk.DeviceMemory
+	Mesh *Mesh
+	Name string
+	// Device buffers, set once the model has been added to a scene
+	VertexBuffer *common.Buffer
+	IndexBuffer  *common.Buffer
+	// Set for instanced models only, see: NewInstancedModel
+	InstanceBuffer *common.Buffer
+	// Number of indices drawn from IndexBuffer. It follows len(Mesh.VIndices) once changed indices have been uploaded,
+	// see: IndicesUploaded
+	IndexCount uint32
+	// Number of instances drawn from InstanceBuffer, it follows Instances.Len() once changed instances have been uploaded
+	InstanceCount uint32
+	// Per-instance data of instanced models, nil for models drawn once
+	Instances *Instances
+	// Set for static models. Their mesh is packed into the renderer's shared vertex and index buffers at these ranges
+	// instead of VertexBuffer and IndexBuffer, which only hold the mesh while it is uploaded.
+	Static         bool
+	PooledVertices MeshRange
+	PooledIndices  MeshRange
+
+	// Ranges of Mesh.Vertices and Mesh.VIndices edited since the renderer last uploaded them, see: MarkDirty
+	dirtyVertices MeshRange
+	dirtyIndices  MeshRange
+	// Number of indices from the start of Mesh.VIndices the index buffer holds, see: IndicesUploaded
+	uploadedIndices int
 }
 
 func NewModel(m *Mesh, n string) *Model {
@@ -24,6 +43,19 @@ func NewModel(m *Mesh, n string) *Model {
 	}
 }
 
+// NewInstancedModel creates a model drawing its mesh once per instance with a single draw call. It starts without any
+// instance, see: Instances.
+func NewInstancedModel(m *Mesh, n string) *Model {
+	model := NewModel(m, n)
+	model.Instances = NewInstances()
+	return model
+}
+
+// IsInstanced reports whether the model is drawn once per instance
+func (m *Model) IsInstanced() bool {
+	return m.Instances != nil
+}
+
 // 3D Space
 // ----------------------------------------------------------------------------------------------------------
 
@@ -42,15 +74,101 @@ func (m *Model) Scale(factors vm.Vec3) {
 	m.Mesh.ModelMat = scl
 }
 
+// Bounds returns the bounding volumes of the model's mesh in local (model) space
+func (m *Model) Bounds() Bounds {
+	return m.Mesh.Bounds()
+}
+
+// WorldBounds returns the bounding volumes of the model after applying Mesh.ModelMat. Box is the axis-aligned box
+// fitted around the transformed mesh bounds, Oriented is the transformed box itself.
+func (m *Model) WorldBounds() Bounds {
+	return TransformBounds(m.Mesh.Bounds(), m.Mesh.ModelMat)
+}
+
+// Dynamic meshes
+// ----------------------------------------------------------------------------------------------------------
+
+// MarkDirty flags vertices edited in Mesh.Vertices, the renderer uploads them before drawing the next frame. Vertices
+// appended to the mesh have to be included in the range, the vertex buffer grows to fit them. Ranges marked before
+// being uploaded are merged. The cached bounds are dropped as well. Static meshes can not grow beyond their pooled
+// vertices, a range past them is rejected and nothing is marked.
+func (m *Model) MarkDirty(vertices MeshRange) error {
+	if m.Static && vertices.End() > m.PooledVertices.Count {
+		return fmt.Errorf("static mesh of '%s' can not grow beyond %d vertices", m.Name, m.PooledVertices.Count)
+	}
+	m.dirtyVertices = m.dirtyVertices.Union(vertices)
+	m.Mesh.InvalidateBounds()
+	return nil
+}
+
+// MarkIndicesDirty flags indices edited in Mesh.VIndices, the same way MarkDirty does for vertices. Removing indices
+// from the end needs no range, the model counts as dirty until IndexCount is cut down to the mesh on the next upload.
+func (m *Model) MarkIndicesDirty(indices MeshRange) error {
+	if m.Static && indices.End() > m.PooledIndices.Count {
+		return fmt.Errorf("static mesh of '%s' can not grow beyond %d indices", m.Name, m.PooledIndices.Count)
+	}
+	m.dirtyIndices = m.dirtyIndices.Union(indices)
+	return nil
+}
+
+// IsDirty reports whether vertices or indices are waiting to be uploaded, or indices were removed from the end of the
+// mesh while IndexCount still draws them
+func (m *Model) IsDirty() bool {
+	return !m.dirtyVertices.Empty() || !m.dirtyIndices.Empty() || len(m.Mesh.VIndices) < int(m.IndexCount)
+}
+
+// TakeDirty returns the ranges marked since the last call, cut down to the current size of the mesh, and clears them.
+// Meant for the renderer, which has to upload them.
+func (m *Model) TakeDirty() (vertices MeshRange, indices MeshRange) {
+	return m.TakeDirtyVertices(math.MaxInt), m.TakeDirtyIndices(math.MaxInt)
+}
+
+// TakeDirtyVertices returns up to n vertices from the start of the dirty range, cut down to the current size of the
+// mesh, and clears only those. The rest stays dirty, so the renderer can upload large edits over several frames.
+func (m *Model) TakeDirtyVertices(n int) MeshRange {
+	var taken MeshRange
+	taken, m.dirtyVertices = m.dirtyVertices.Clamp(len(m.Mesh.Vertices)).Split(n)
+	return taken
+}
+
+// TakeDirtyIndices returns up to n indices from the start of the dirty range, the same way TakeDirtyVertices does
+func (m *Model) TakeDirtyIndices(n int) MeshRange {
+	var taken MeshRange
+	taken, m.dirtyIndices = m.dirtyIndices.Clamp(len(m.Mesh.VIndices)).Split(n)
+	return taken
+}
+
+// IndicesUploaded is called by the renderer once the given range of Mesh.VIndices has been uploaded and sets
+// IndexCount to the indices that can be drawn. These are the ones uploaded from the start without a gap, so indices
+// appended without being marked dirty are never drawn, even if the index buffer has room for them.
+func (m *Model) IndicesUploaded(indices MeshRange) {
+	m.uploadedIndices = min(m.uploadedIndices, len(m.Mesh.VIndices))
+	if !indices.Empty() && indices.First <= m.uploadedIndices {
+		m.uploadedIndices = max(m.uploadedIndices, indices.End())
+	}
+	m.IndexCount = uint32(m.uploadedIndices)
+}
+
 // GPU memory info
 // ----------------------------------------------------------------------------------------------------------
 
+// ModelPushConstants are pushed for every model drawn on its own, matching the push constants of shader.vert and
+// instanced.vert. ModelType tells the shaders how to color the model: type 0 is drawn untextured.
+type ModelPushConstants struct {
+	Model     vm.Mat
+	ModelType uint32
+}
+
+func (pc *ModelPushConstants) Bytes() []byte {
+	return append(common.RawBytes(pc.Model.Unroll()), common.RawBytes(pc.ModelType)...)
+}
+
 // ModelPushConstantsSize reports the memory size required for all push constants that the Model expects to
-// get bound. The actual layout for the constants in memory is decided by the render pipeline. For now only
-// the Mesh.ModelMat (4x4) needs to be provided.
+// get bound. The actual layout for the constants in memory is decided by the render pipeline, see: ModelPushConstants.
+// The Mesh.ModelMat (4x4) is followed by the model type.
 func ModelPushConstantsSize() uint32 {
 	mat := vm.NewUnitMat(4)
-	return uint32(mat.ByteSize())
+	return uint32(mat.ByteSize()) + 4
 }
 
 // GetVBufferSize returns the size required for keeping this model in device memory.
@@ -78,3 +196,15 @@ func (m *Model) GetIdxBufferSize() int {
 func (m *Model) GetIdxBufferBytes() []byte {
 	return common.RawBytes(m.Mesh.VIndices)
 }
+
+// GetVRangeBytes returns the raw bytes of the vertices in the range, placed at offset r.First * VERTEX_STRIDE within
+// the vertex buffer
+func (m *Model) GetVRangeBytes(r MeshRange) []byte {
+	return common.RawBytes(m.Mesh.Vertices[r.First:r.End()])
+}
+
+// GetIdxRangeBytes returns the raw bytes of the indices in the range, placed at offset r.First * INDEX_STRIDE within
+// the index buffer
+func (m *Model) GetIdxRangeBytes(r MeshRange) []byte {
+	return common.RawBytes(m.Mesh.VIndices[r.First:r.End()])
+}
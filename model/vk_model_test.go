@@ -0,0 +1,24 @@
+package model
+
+import (
+	"encoding/binary"
+	vm "local/vector_math"
+	"math"
+	"testing"
+)
+
+func TestModelPushConstantsLayout(t *testing.T) {
+	pc := ModelPushConstants{Model: vm.NewTranslation(vm.Vec3{X: 1, Y: 2, Z: 3}), ModelType: 7}
+	b := pc.Bytes()
+	if len(b) != int(ModelPushConstantsSize()) {
+		t.Fatalf("expected %d bytes of push constants, got %d", ModelPushConstantsSize(), len(b))
+	}
+	for i, f := range pc.Model.Unroll() {
+		if got := math.Float32frombits(binary.LittleEndian.Uint32(b[4*i:])); got != f {
+			t.Fatalf("expected matrix element %d to be %f, got %f", i, f, got)
+		}
+	}
+	if got := binary.LittleEndian.Uint32(b[64:]); got != 7 {
+		t.Fatalf("expected model type 7 after the matrix, got %d", got)
+	}
+}
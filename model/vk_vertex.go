@@ -6,6 +6,9 @@ import (
 	"unsafe"
 )
 
+// VERTEX_STRIDE is the size of a single vertex within a vertex buffer
+const VERTEX_STRIDE = int(unsafe.Sizeof(Vertex{}))
+
 type Vertex struct {
 	Pos      vector_math.Vec3
 	Color    vector_math.Vec3
@@ -15,7 +18,7 @@ type Vertex struct {
 func GetVertexBindingDescription() vk.VertexInputBindingDescription {
 	return vk.VertexInputBindingDescription{
 		Binding:   0,
-		Stride:    uint32(unsafe.Sizeof(Vertex{})),
+		Stride:    uint32(VERTEX_STRIDE),
 		InputRate: vk.VertexInputRateVertex,
 	}
 }
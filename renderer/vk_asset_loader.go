@@ -0,0 +1,256 @@
+package renderer
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"sync/atomic"
+)
+
+// ASSET_WORKERS is the number of assets parsed or decoded at the same time
+const ASSET_WORKERS = 2
+
+// States an Asset goes through. Loading runs on a worker goroutine, uploading on the render thread. An asset ends up
+// either ready or failed.
+const (
+	ASSET_QUEUED = iota
+	ASSET_LOADING
+	ASSET_UPLOADING
+	ASSET_READY
+	ASSET_FAILED
+)
+
+var assetStateNames = []string{"queued", "loading", "uploading", "ready", "failed"}
+
+var errLoaderClosed = errors.New("asset loader closed")
+
+// Asset is the handle of a single background load. It is safe to query from any goroutine.
+type Asset struct {
+	Name string
+
+	state    atomic.Int32
+	progress atomic.Uint64
+	err      error
+	done     chan struct{}
+
+	// Runs on a worker goroutine, reads and decodes the file and keeps the result in the closure
+	load func(a *Asset) error
+	// Runs once on the render thread after loading, creates device resources and queues their upload
+	upload func() error
+	// Runs on the render thread once per frame after uploading until it reports true, e.g.: once the upload is done
+	ready func() (bool, error)
+	// Runs once on the render thread when the asset completes, e.g.: swapping in the result
+	apply func()
+	// Set while the asset is ready but held back by AssetLoader.Hold, only accessed from the render thread
+	held bool
+}
+
+// State returns one of the ASSET_* states
+func (a *Asset) State() int {
+	return int(a.state.Load())
+}
+
+// Progress returns how much of the file has been loaded, in [0, 1]. Ready assets are always at 1.
+func (a *Asset) Progress() float64 {
+	return math.Float64frombits(a.progress.Load())
+}
+
+// SetProgress is called by the load function with the fraction of the work done
+func (a *Asset) SetProgress(p float64) {
+	a.progress.Store(math.Float64bits(min(max(p, 0), 1)))
+}
+
+// Done is closed once the asset is ready or failed
+func (a *Asset) Done() <-chan struct{} {
+	return a.done
+}
+
+// Err returns why the asset failed, nil while it is not done or if it is ready
+func (a *Asset) Err() error {
+	select {
+	case <-a.done:
+		return a.err
+	default:
+		return nil
+	}
+}
+
+// Wait blocks until the asset is ready or failed. As the last steps run on the render thread, it must not be called
+// from there.
+func (a *Asset) Wait() error {
+	<-a.done
+	return a.err
+}
+
+func (a *Asset) String() string {
+	return fmt.Sprintf("%s (%s, %.0f%%)", a.Name, assetStateNames[a.State()], a.Progress()*100)
+}
+
+func (a *Asset) finish(err error) {
+	a.err = err
+	if err != nil {
+		a.state.Store(ASSET_FAILED)
+		log.Printf("Failed to load asset %s: %v", a.Name, err)
+	} else {
+		a.SetProgress(1)
+		a.state.Store(ASSET_READY)
+		log.Printf("Loaded asset %s", a.Name)
+	}
+	close(a.done)
+}
+
+// AssetLoader parses files on worker goroutines and hands the results back to the render thread, where device
+// resources can be created without racing the draw loop. Load may be called from any goroutine, Process must be called
+// from the render thread once per frame.
+type AssetLoader struct {
+	// Hold is called on the render thread for assets ready to complete, those it returns true for wait for a later
+	// Process, e.g.: to complete them in the same frame as when input was recorded. Nil completes them right away.
+	Hold func(a *Asset) bool
+	// Completed is called on the render thread for every asset that became ready, right after it was applied
+	Completed func(a *Asset)
+
+	// Limits the number of workers, each running load holds a slot
+	slots chan struct{}
+	wg    sync.WaitGroup
+
+	mu        sync.Mutex
+	closed    bool
+	loaded    []*Asset
+	uploading []*Asset
+	// All assets not ready or failed yet, see: Behind
+	pending []*Asset
+}
+
+func NewAssetLoader(workers int) *AssetLoader {
+	return &AssetLoader{slots: make(chan struct{}, workers)}
+}
+
+// Load starts loading an asset in the background. The functions are described on Asset, upload, ready and apply may be
+// nil. Load never blocks, assets wait for a free worker instead.
+func (l *AssetLoader) Load(name string, load func(a *Asset) error, upload func() error, ready func() (bool, error), apply func()) *Asset {
+	a := &Asset{Name: name, done: make(chan struct{}), load: load, upload: upload, ready: ready, apply: apply}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		a.finish(errLoaderClosed)
+		return a
+	}
+	l.pending = append(l.pending, a)
+	l.wg.Add(1)
+	go l.run(a)
+	return a
+}
+
+func (l *AssetLoader) run(a *Asset) {
+	defer l.wg.Done()
+	l.slots <- struct{}{}
+	// Assets still waiting for a slot when the loader is closed are never loaded, so Close does not wait for them
+	l.mu.Lock()
+	closed := l.closed
+	l.mu.Unlock()
+	if closed {
+		<-l.slots
+		a.finish(errLoaderClosed)
+		return
+	}
+	a.state.Store(ASSET_LOADING)
+	err := a.load(a)
+	<-l.slots
+	if err != nil {
+		a.finish(err)
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		a.finish(errLoaderClosed)
+		return
+	}
+	l.loaded = append(l.loaded, a)
+}
+
+// Process runs the render thread steps of all loaded assets: Uploads are started for assets finished since the last
+// call and assets still uploading are checked whether they are ready.
+func (l *AssetLoader) Process() {
+	l.mu.Lock()
+	loaded := l.loaded
+	l.loaded = nil
+	l.mu.Unlock()
+
+	uploading := l.uploading[:0]
+	for _, a := range l.uploading {
+		if l.step(a) {
+			uploading = append(uploading, a)
+		}
+	}
+	for _, a := range loaded {
+		a.state.Store(ASSET_UPLOADING)
+		if a.upload != nil {
+			if err := a.upload(); err != nil {
+				a.finish(err)
+				continue
+			}
+		}
+		if l.step(a) {
+			uploading = append(uploading, a)
+		}
+	}
+	l.uploading = uploading
+}
+
+// step checks whether an uploading asset is ready and applies it unless it is held, it returns true if the asset has to
+// be checked again
+func (l *AssetLoader) step(a *Asset) bool {
+	ok, err := true, error(nil)
+	if a.ready != nil {
+		ok, err = a.ready()
+	}
+	if err != nil {
+		a.finish(err)
+		return false
+	}
+	a.held = ok && l.Hold != nil && l.Hold(a)
+	if !ok || a.held {
+		return true
+	}
+	if a.apply != nil {
+		a.apply()
+	}
+	a.finish(nil)
+	if l.Completed != nil {
+		l.Completed(a)
+	}
+	return false
+}
+
+// Behind reports whether an asset of the given name is still on its way, neither ready to complete nor done. It must be
+// called from the render thread.
+func (l *AssetLoader) Behind(name string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	pending := l.pending[:0]
+	behind := false
+	for _, a := range l.pending {
+		if a.State() >= ASSET_READY {
+			continue
+		}
+		pending = append(pending, a)
+		behind = behind || (a.Name == name && !a.held)
+	}
+	l.pending = pending
+	return behind
+}
+
+// Close waits for running loads and fails all assets not ready yet, their upload and ready functions are never called
+func (l *AssetLoader) Close() {
+	l.mu.Lock()
+	l.closed = true
+	l.mu.Unlock()
+	l.wg.Wait()
+	for _, a := range append(l.loaded, l.uploading...) {
+		a.finish(errLoaderClosed)
+	}
+	l.loaded, l.uploading = nil, nil
+}
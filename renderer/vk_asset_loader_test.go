@@ -0,0 +1,164 @@
+package renderer
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// processUntilDone runs the render thread side of the loader once per millisecond until the asset is done
+func processUntilDone(t *testing.T, l *AssetLoader, a *Asset) {
+	timeout := time.After(time.Second)
+	for {
+		l.Process()
+		select {
+		case <-a.Done():
+			return
+		case <-timeout:
+			t.Fatalf("asset %v did not finish", a)
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+func TestAssetLoaderStages(t *testing.T) {
+	l := NewAssetLoader(1)
+	defer l.Close()
+	frames := 0
+	var loaded, uploaded bool
+	a := l.Load(
+		"test",
+		func(a *Asset) error {
+			a.SetProgress(0.5)
+			loaded = true
+			return nil
+		},
+		func() error {
+			uploaded = loaded
+			return nil
+		},
+		func() (bool, error) {
+			// Ready only on the third frame after uploading
+			frames++
+			return frames == 3, nil
+		},
+		nil,
+	)
+	processUntilDone(t, l, a)
+	if err := a.Err(); err != nil || !uploaded || frames != 3 {
+		t.Fatalf("expected asset to be uploaded after loading and ready after 3 frames, got %d frames, err %v", frames, err)
+	}
+	if a.State() != ASSET_READY || a.Progress() != 1 {
+		t.Fatalf("expected ready asset at full progress, got %v", a)
+	}
+}
+
+func TestAssetLoaderLoadFails(t *testing.T) {
+	l := NewAssetLoader(1)
+	defer l.Close()
+	errMissing := errors.New("missing file")
+	a := l.Load("test", func(a *Asset) error { return errMissing }, func() error {
+		t.Fatalf("upload must not run for a failed load")
+		return nil
+	}, nil, nil)
+	if err := a.Wait(); !errors.Is(err, errMissing) || a.State() != ASSET_FAILED {
+		t.Fatalf("expected asset to fail with the load error, got %v", err)
+	}
+}
+
+func TestAssetLoaderCloseFailsPending(t *testing.T) {
+	l := NewAssetLoader(1)
+	a := l.Load("test", func(a *Asset) error { return nil }, nil, func() (bool, error) { return false, nil }, nil)
+	l.Process()
+	l.Close()
+	if err := a.Wait(); !errors.Is(err, errLoaderClosed) {
+		t.Fatalf("expected pending asset to fail on close, got %v", err)
+	}
+	if b := l.Load("late", func(a *Asset) error { return nil }, nil, nil, nil); !errors.Is(b.Wait(), errLoaderClosed) {
+		t.Fatalf("expected load after close to fail")
+	}
+}
+
+func TestAssetLoaderHoldsReadyAssets(t *testing.T) {
+	l := NewAssetLoader(1)
+	defer l.Close()
+	release := false
+	l.Hold = func(a *Asset) bool { return !release }
+	var completed []string
+	l.Completed = func(a *Asset) { completed = append(completed, a.Name) }
+	applied := 0
+	a := l.Load("test", func(a *Asset) error { return nil }, nil, nil, func() { applied++ })
+	if !l.Behind("test") {
+		t.Fatalf("expected loading asset to be behind")
+	}
+	// Once ready, the asset waits for the hold to be released without being applied
+	timeout := time.After(time.Second)
+	for l.Behind("test") {
+		l.Process()
+		select {
+		case <-timeout:
+			t.Fatalf("asset %v did not get ready", a)
+		case <-time.After(time.Millisecond):
+		}
+	}
+	l.Process()
+	if applied != 0 || a.State() == ASSET_READY {
+		t.Fatalf("expected held asset not to be applied, got %v applied %d times", a, applied)
+	}
+	release = true
+	l.Process()
+	if applied != 1 || a.State() != ASSET_READY || len(completed) != 1 {
+		t.Fatalf("expected released asset to be applied and completed once, got %v applied %d times", a, applied)
+	}
+	if l.Behind("test") {
+		t.Fatalf("expected ready asset not to be behind")
+	}
+}
+
+func TestAssetLoaderCloseSkipsQueuedLoads(t *testing.T) {
+	l := NewAssetLoader(1)
+	release := make(chan struct{})
+	started := make(chan struct{})
+	running := l.Load("running", func(a *Asset) error {
+		close(started)
+		<-release
+		return nil
+	}, nil, nil, nil)
+	<-started
+	// The only worker is busy, these wait for its slot
+	var queued []*Asset
+	loads := make(chan string, 2)
+	for _, name := range []string{"queued 1", "queued 2"} {
+		queued = append(queued, l.Load(name, func(a *Asset) error {
+			loads <- a.Name
+			return nil
+		}, nil, nil, nil))
+	}
+	go func() {
+		// The running load frees the slot only once Close has begun
+		for {
+			l.mu.Lock()
+			closed := l.closed
+			l.mu.Unlock()
+			if closed {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		close(release)
+	}()
+	l.Close()
+	if err := running.Wait(); !errors.Is(err, errLoaderClosed) {
+		t.Fatalf("expected running asset to fail on close, got %v", err)
+	}
+	for _, a := range queued {
+		if err := a.Wait(); !errors.Is(err, errLoaderClosed) {
+			t.Fatalf("expected queued asset %s to fail on close, got %v", a.Name, err)
+		}
+	}
+	select {
+	case name := <-loads:
+		t.Fatalf("expected queued assets never to be loaded, %s was", name)
+	default:
+	}
+}
@@ -0,0 +1,281 @@
+package renderer
+
+import (
+	com "GPU_fluid_simulation/common"
+	"GPU_fluid_simulation/model"
+	"fmt"
+	"log"
+	"unsafe"
+
+	vk "github.com/goki/vulkan"
+)
+
+// These functions are part of the rendering core but are split into their own file for logical separation. Their focus
+// is batching: the meshes of static models are packed into two shared buffers, one for vertices and one for indices,
+// so all of them are drawn with a single indirect draw instead of binding buffers and recording a draw per model. Each
+// draw's parameters are written into an indirect buffer every frame, its model matrix into a storage buffer indexed by
+// the draw's ID. Both live in the staging ring, so culling still happens per model on the CPU.
+
+// Capacities of the mesh pools, in vertices and indices. Static meshes have to fit into the free ranges left.
+const (
+	MESH_POOL_VERTICES = 1 << 20
+	MESH_POOL_INDICES  = 1 << 22
+)
+
+// MAX_BATCHED_DRAWS limits the number of static models, as each frame reserves room for all of their draw data
+const MAX_BATCHED_DRAWS = 4096
+
+// BATCH_DRAW_DATA_STRIDE is the size of a draw's data in the storage buffer: the model matrix and the model type as in
+// model.ModelPushConstants, padded to the 16 byte alignment of the struct in the std430 layout
+const BATCH_DRAW_DATA_STRIDE = 80
+
+// BATCH_DRAW_DATA_SIZE is the storage buffer range reserved in the staging ring every frame
+const BATCH_DRAW_DATA_SIZE = vk.DeviceSize(MAX_BATCHED_DRAWS * BATCH_DRAW_DATA_STRIDE)
+
+// drawIndexedIndirectCommand mirrors VkDrawIndexedIndirectCommand, as the bindings' struct can not be written as raw
+// bytes. FirstInstance carries the draw's ID, see: batched.vert.
+type drawIndexedIndirectCommand struct {
+	IndexCount    uint32
+	InstanceCount uint32
+	FirstIndex    uint32
+	VertexOffset  int32
+	FirstInstance uint32
+}
+
+const DRAW_INDEXED_INDIRECT_STRIDE = uint32(unsafe.Sizeof(drawIndexedIndirectCommand{}))
+
+// batchedDraws are the draws of the static models visible in a frame, as written into the staging ring
+type batchedDraws struct {
+	// Dynamic offset of the draw data in the storage buffer
+	dataOffset uint32
+	// Offset of the first command in the staging ring
+	cmdOffset vk.DeviceSize
+	commands  []drawIndexedIndirectCommand
+}
+
+func (c *Core) createMeshPools() error {
+	var err error
+	c.vertexPool, err = com.NewBufferPool(
+		c.allocator, "mesh pool vertices", vk.DeviceSize(model.VERTEX_STRIDE), MESH_POOL_VERTICES,
+		vk.BufferUsageFlags(vk.BufferUsageVertexBufferBit),
+	)
+	if err != nil {
+		return err
+	}
+	c.indexPool, err = com.NewBufferPool(
+		c.allocator, "mesh pool indices", vk.DeviceSize(model.INDEX_STRIDE), MESH_POOL_INDICES,
+		vk.BufferUsageFlags(vk.BufferUsageIndexBufferBit),
+	)
+	if err != nil {
+		c.vertexPool.Destroy(c.device)
+		return err
+	}
+	nameObject(c, vk.ObjectTypeBuffer, c.vertexPool.Buffer.Handle, "mesh pool vertices")
+	nameObject(c, vk.ObjectTypeBuffer, c.indexPool.Buffer.Handle, "mesh pool indices")
+	return nil
+}
+
+func (c *Core) destroyMeshPools() {
+	c.indexPool.Destroy(c.device)
+	c.vertexPool.Destroy(c.device)
+}
+
+// AddStaticToScene adds a model whose mesh is packed into the shared mesh pools, it is drawn together with all other
+// static models. The mesh is uploaded like any other first and packed once the upload is done. Static meshes can be
+// updated in place (see: Model.MarkDirty, which rejects ranges past the pooled ones), but neither grow nor be replaced
+// by LoadMesh. Their model matrix is free to change every frame.
+func (c *Core) AddStaticToScene(m *model.Model) error {
+	if m.IsInstanced() {
+		return fmt.Errorf("instanced model '%s' can not be static", m.Name)
+	}
+	static := 0
+	for _, other := range c.models {
+		if other.Static {
+			static++
+		}
+	}
+	if static >= MAX_BATCHED_DRAWS {
+		return fmt.Errorf("failed to add '%s', the scene already holds %d static models", m.Name, static)
+	}
+	vertices, indices := model.AllOf(len(m.Mesh.Vertices)), model.AllOf(len(m.Mesh.VIndices))
+	var err error
+	if vertices.First, err = c.vertexPool.Alloc(vertices.Count); err != nil {
+		return fmt.Errorf("failed to pack vertices of '%s': %w", m.Name, err)
+	}
+	if indices.First, err = c.indexPool.Alloc(indices.Count); err != nil {
+		c.vertexPool.Free(vertices.First, vertices.Count)
+		return fmt.Errorf("failed to pack indices of '%s': %w", m.Name, err)
+	}
+	if err = c.AddToScene(m); err != nil {
+		c.vertexPool.Free(vertices.First, vertices.Count)
+		c.indexPool.Free(indices.First, indices.Count)
+		return err
+	}
+	m.Static, m.PooledVertices, m.PooledIndices = true, vertices, indices
+	return nil
+}
+
+// isPacked reports whether a static model's mesh has been moved into the mesh pools, so it can be drawn
+func (c *Core) isPacked(m *model.Model) bool {
+	return m.VertexBuffer == nil && m.IndexBuffer == nil
+}
+
+// packStaticMeshes copies the uploaded meshes of static models into their ranges of the mesh pools. The buffers they
+// were uploaded to are retired with the current frame, which is the last one reading them.
+func (c *Core) packStaticMeshes() {
+	for _, m := range c.models {
+		if !m.Static || c.isPacked(m) || !c.isUploaded(m) {
+			continue
+		}
+		vBuf, idxBuf := m.VertexBuffer, m.IndexBuffer
+		vSize := vk.DeviceSize(m.PooledVertices.Count * model.VERTEX_STRIDE)
+		idxSize := vk.DeviceSize(m.PooledIndices.Count * model.INDEX_STRIDE)
+		vDst, idxDst := c.vertexPool.Offset(m.PooledVertices.First), c.indexPool.Offset(m.PooledIndices.First)
+		c.streamCopies = append(c.streamCopies, func(cmd vk.CommandBuffer) {
+			vertexStage := vk.PipelineStageFlags(vk.PipelineStageVertexInputBit)
+			transferStage := vk.PipelineStageFlags(vk.PipelineStageTransferBit)
+			transferWrite := vk.AccessFlags(vk.AccessTransferWriteBit)
+			// The uploads were acquired for the vertex input stage by an earlier frame
+			before := []vk.BufferMemoryBarrier{
+				bufferBarrier(vBuf, 0, vSize, transferWrite, vk.AccessFlags(vk.AccessTransferReadBit)),
+				bufferBarrier(idxBuf, 0, idxSize, transferWrite, vk.AccessFlags(vk.AccessTransferReadBit)),
+			}
+			vk.CmdPipelineBarrier(cmd, transferStage|vertexStage, transferStage, 0, 0, nil, uint32(len(before)), before, 0, nil)
+			vk.CmdCopyBuffer(cmd, vBuf.Handle, c.vertexPool.Buffer.Handle, 1, []vk.BufferCopy{{SrcOffset: 0, DstOffset: vDst, Size: vSize}})
+			vk.CmdCopyBuffer(cmd, idxBuf.Handle, c.indexPool.Buffer.Handle, 1, []vk.BufferCopy{{SrcOffset: 0, DstOffset: idxDst, Size: idxSize}})
+			// Ranges freed by removed models may have been read by earlier frames, they are done by now as the device
+			// was idle when removing them
+			after := []vk.BufferMemoryBarrier{
+				bufferBarrier(c.vertexPool.Buffer, vDst, vSize, transferWrite, vk.AccessFlags(vk.AccessVertexAttributeReadBit)),
+				bufferBarrier(c.indexPool.Buffer, idxDst, idxSize, transferWrite, vk.AccessFlags(vk.AccessIndexReadBit)),
+			}
+			vk.CmdPipelineBarrier(cmd, transferStage, vertexStage, 0, 0, nil, uint32(len(after)), after, 0, nil)
+		})
+		c.retireWithFrame(func() {
+			com.DestroyBuffer(c.device, vBuf)
+			com.DestroyBuffer(c.device, idxBuf)
+		})
+		m.VertexBuffer, m.IndexBuffer = nil, nil
+	}
+}
+
+// updateStaticMesh streams the dirty ranges of a packed static mesh into its ranges of the mesh pools, in parts within
+// the frame's budget the same way updateDynamicMeshes does. Ranges past the pooled ones are rejected by MarkDirty, but
+// the mesh may have been edited before it became static. The elements beyond are dropped, the pools keep their old
+// contents there.
+func (c *Core) updateStaticMesh(m *model.Model, budget *vk.DeviceSize) error {
+	vertexStage := vk.PipelineStageFlags(vk.PipelineStageVertexInputBit)
+	n := c.streamableCount(*budget, model.VERTEX_STRIDE)
+	vertices := m.TakeDirtyVertices(n)
+	if vertices.Count == n {
+		*budget = 0
+	}
+	if vertices.End() > m.PooledVertices.Count {
+		log.Printf("Dropped vertices of static mesh '%s' beyond its %d pooled ones", m.Name, m.PooledVertices.Count)
+		vertices = vertices.Clamp(m.PooledVertices.Count)
+	}
+	if !vertices.Empty() {
+		offset := c.vertexPool.Offset(m.PooledVertices.First + vertices.First)
+		err := c.streamToBuffer(c.vertexPool.Buffer, offset, m.GetVRangeBytes(vertices), vertexStage, vk.AccessFlags(vk.AccessVertexAttributeReadBit))
+		if err != nil {
+			return fmt.Errorf("failed to update vertices %v of '%s': %w", vertices, m.Name, err)
+		}
+		*budget -= min(*budget, vk.DeviceSize(vertices.Count*model.VERTEX_STRIDE))
+	}
+	indices := m.TakeDirtyIndices(c.streamableCount(*budget, model.INDEX_STRIDE))
+	if indices.End() > m.PooledIndices.Count {
+		log.Printf("Dropped indices of static mesh '%s' beyond its %d pooled ones", m.Name, m.PooledIndices.Count)
+		indices = indices.Clamp(m.PooledIndices.Count)
+	}
+	if !indices.Empty() {
+		offset := c.indexPool.Offset(m.PooledIndices.First + indices.First)
+		err := c.streamToBuffer(c.indexPool.Buffer, offset, m.GetIdxRangeBytes(indices), vertexStage, vk.AccessFlags(vk.AccessIndexReadBit))
+		if err != nil {
+			return fmt.Errorf("failed to update indices %v of '%s': %w", indices, m.Name, err)
+		}
+		*budget -= min(*budget, vk.DeviceSize(indices.Count*model.INDEX_STRIDE))
+	}
+	m.IndicesUploaded(indices)
+	return nil
+}
+
+// releasePooled returns the ranges of a static model to the mesh pools, the device has to be idle
+func (c *Core) releasePooled(m *model.Model) {
+	if !m.Static {
+		return
+	}
+	c.vertexPool.Free(m.PooledVertices.First, m.PooledVertices.Count)
+	c.indexPool.Free(m.PooledIndices.First, m.PooledIndices.Count)
+	m.Static, m.PooledVertices, m.PooledIndices = false, model.MeshRange{}, model.MeshRange{}
+}
+
+// writeBatchedDraws culls the static models and writes the draw data and indirect commands of the visible ones into
+// the staging ring. The draw data range is reserved even without any draw, as the descriptor set needs its offset.
+func (c *Core) writeBatchedDraws(frustum model.Frustum) (batchedDraws, error) {
+	dataOffset, ptr, err := c.ring.Alloc(BATCH_DRAW_DATA_SIZE, c.device.PdProps.Limits.MinStorageBufferOffsetAlignment)
+	if err != nil {
+		return batchedDraws{}, fmt.Errorf("failed to write draw data: %w", err)
+	}
+	data := unsafe.Slice((*byte)(ptr), BATCH_DRAW_DATA_SIZE)
+	b := batchedDraws{dataOffset: uint32(dataOffset)}
+	for i, m := range c.models {
+		if !m.Static {
+			continue
+		}
+		if !c.isPacked(m) {
+			c.Stats.Pending++
+			continue
+		}
+		if !frustum.IntersectsBounds(m.WorldBounds()) {
+			c.Stats.Culled++
+			continue
+		}
+		c.Stats.Drawn++
+		c.Stats.Batched++
+		// The draw data has the layout of the push constants of models drawn on their own, padded to the stride
+		drawID := uint32(len(b.commands))
+		pc := c.modelConstants(i)
+		copy(data[int(drawID)*BATCH_DRAW_DATA_STRIDE:], pc.Bytes())
+		b.commands = append(b.commands, drawIndexedIndirectCommand{
+			IndexCount:    m.IndexCount,
+			InstanceCount: 1,
+			FirstIndex:    uint32(m.PooledIndices.First),
+			VertexOffset:  int32(m.PooledVertices.First),
+			FirstInstance: drawID,
+		})
+	}
+	if len(b.commands) > 0 {
+		if b.cmdOffset, err = c.ring.Write(com.RawBytes(b.commands), 4); err != nil {
+			return batchedDraws{}, fmt.Errorf("failed to write indirect draws: %w", err)
+		}
+	}
+	return b, nil
+}
+
+// recordBatchedDraws draws all static models written by writeBatchedDraws, it must be called inside the render pass.
+// Devices without multi draw indirect get one indirect draw per model, devices unable to pass the draw ID as first
+// instance of indirect draws get direct draws instead. Returns whether the batched pipeline was bound.
+func (c *Core) recordBatchedDraws(cmd vk.CommandBuffer, b batchedDraws, pipelineIdx int, uboOffset uint32) bool {
+	if len(b.commands) == 0 {
+		return false
+	}
+	vk.CmdBindPipeline(cmd, vk.PipelineBindPointGraphics, c.pipelines[PIPELINE_BATCHED+pipelineIdx])
+	sets := []vk.DescriptorSet{c.provisioner.descriptorSets[c.currentFrameIdx]}
+	vk.CmdBindDescriptorSets(cmd, vk.PipelineBindPointGraphics, c.pipelineLayout, 0, 1, sets, 2, []uint32{uboOffset, b.dataOffset})
+	vk.CmdBindVertexBuffers(cmd, 0, 1, []vk.Buffer{c.vertexPool.Buffer.Handle}, []vk.DeviceSize{0})
+	vk.CmdBindIndexBuffer(cmd, c.indexPool.Buffer.Handle, 0, vk.IndexTypeUint32)
+	switch {
+	case c.device.Features.DrawIndirectFirstInstance != vk.True:
+		for _, d := range b.commands {
+			vk.CmdDrawIndexed(cmd, d.IndexCount, d.InstanceCount, d.FirstIndex, d.VertexOffset, d.FirstInstance)
+		}
+	case c.device.Features.MultiDrawIndirect == vk.True:
+		vk.CmdDrawIndexedIndirect(cmd, c.ring.Buffer.Handle, b.cmdOffset, uint32(len(b.commands)), DRAW_INDEXED_INDIRECT_STRIDE)
+	default:
+		for i := range b.commands {
+			offset := b.cmdOffset + vk.DeviceSize(uint32(i)*DRAW_INDEXED_INDIRECT_STRIDE)
+			vk.CmdDrawIndexedIndirect(cmd, c.ring.Buffer.Handle, offset, 1, DRAW_INDEXED_INDIRECT_STRIDE)
+		}
+	}
+	return true
+}
@@ -3,9 +3,14 @@ package renderer
 import "C"
 import (
 	com "GPU_fluid_simulation/common"
+	"GPU_fluid_simulation/input"
 	"GPU_fluid_simulation/model"
+	"errors"
+	"fmt"
+	"image"
 	"log"
 	"math"
+	"os"
 	"time"
 	"unsafe"
 
@@ -14,11 +19,51 @@ import (
 	"neilpa.me/go-stbi"
 )
 
-const PROGRAM_NAME = "GPU fluid simulation"
-const WINDOW_WIDTH, WINDOW_HEIGHT int32 = 1280, 720
-const MAX_FRAMES_IN_FLIGHT = 3
+// UPDATE_TIMESTEP is the fixed amount of time each call to the update handler simulates
+const UPDATE_TIMESTEP = time.Second / 60
+
+// TEXTURE_PATH is the image sampled by the standard pipeline
+const TEXTURE_PATH = "textures/statue-1275469_1280.jpg"
+
+// STAGING_RING_FRAME_SIZE is the amount of data that can be streamed to the device per frame, e.g.: uniforms, vertices of
+// dynamic meshes and texture updates. The staging ring holds one such region per frame in flight.
+const STAGING_RING_FRAME_SIZE = 8 * 1024 * 1024
+
+// MESH_STREAM_FRAME_SIZE limits the vertices, indices and instances of dynamic meshes streamed per frame, the rest of
+// the staging ring's region is left for uniforms, texture updates and draw data. Edits exceeding it are streamed over
+// the next frames.
+const MESH_STREAM_FRAME_SIZE = STAGING_RING_FRAME_SIZE / 2
+
+// PLACEHOLDER_TEXTURE_SIZE is the edge length of the checkerboard sampled until a texture is loaded, see: LoadTexture.
+// PLACEHOLDER_TEXTURE_CELL is the edge length of a single checkerboard cell.
+const (
+	PLACEHOLDER_TEXTURE_SIZE = 64
+	PLACEHOLDER_TEXTURE_CELL = 8
+)
+
+// MAX_UPDATE_STEPS limits how many updates may run before a frame is drawn. If updating takes longer than the time it
+// simulates, the loop would otherwise fall further behind every frame (spiral of death). Time exceeding the limit is
+// dropped, so the simulation slows down instead.
+const MAX_UPDATE_STEPS = 5
+
+// Indices into Core.pipelines. Standard and reverse-Z pipelines are identical except for their depth compare op, which
+// has to match the depth mode of the camera used to draw.
+const (
+	PIPELINE_STANDARD_Z = iota
+	PIPELINE_REVERSE_Z  = iota
+)
+
+// Offsets of the pipeline variants in Core.pipelines, each variant comes in the same depth modes: PIPELINE_INSTANCED +
+// PIPELINE_REVERSE_Z is the instanced reverse-Z pipeline. Instanced pipelines read per-instance data from a second
+// vertex binding, batched pipelines read the model matrix of each draw from a storage buffer.
+const (
+	PIPELINE_INSTANCED = 2
+	PIPELINE_BATCHED   = 4
+)
 
 type Core struct {
+	opts Options
+
 	// OS/Window level
 	Win    *com.Window
 	device *com.Device
@@ -32,89 +77,218 @@ type Core struct {
 	pipelines      []vk.Pipeline
 	commandPool    vk.CommandPool
 	provisioner    *DescriptorProvisioner
+	allocator      *com.Allocator
+	uploads        *com.UploadManager
+	loader         *AssetLoader
 
 	// Frame level
-	commandBuffers     []vk.CommandBuffer
+	commandBuffers []vk.CommandBuffer
+	// Records the draws of large scenes into secondary command buffers on worker goroutines
+	recorder           *parallelRecorder
 	currentFrameIdx    int32
+	recreateRequested  bool
+	Limiter            *FrameLimiter
 	imageAvailableSems []vk.Semaphore
 	renderFinishedSems []vk.Semaphore
 	inFlightFens       []vk.Fence
+	Stats              FrameStats
+	// State before the last update step and how far the frame lies between it and the current state, see: Loop
+	prevState interpolationState
+	alpha     float32
+	// Destroy functions of resources replaced while frames in flight may still use them, one list per frame index
+	retired [][]func()
 
 	// Data level
-	uniformBuffers       []vk.Buffer
-	uniformBufferMems    []vk.DeviceMemory
-	uniformBuffersMapped []unsafe.Pointer
+	ring *com.StagingRing
+	// Copies out of the staging ring, recorded into the next frame's command buffer before its render pass
+	streamCopies []func(vk.CommandBuffer)
+	// Shared vertex and index buffers the meshes of static models are packed into, see: AddStaticToScene
+	vertexPool *com.BufferPool
+	indexPool  *com.BufferPool
 
 	// 3D World
-	Cam                     *model.Camera
-	models                  []*model.Model
-	ctxUniformBuffer        []vk.Buffer
-	ctxUniformBufferMem     []vk.DeviceMemory
-	ctxUniformBuffersMapped []unsafe.Pointer
-
+	Cam            *model.Camera
+	Animator       *model.Animator
+	Record         *input.Recording
+	Replay         *input.Recording
+	models         []*model.Model
+	pendingUploads map[*model.Model][]*com.Upload
+	meshSwaps      []*meshSwap
+
+	textureName      string
+	textureExtent    vk.Extent2D
 	textureImage     vk.Image
 	textureImageMem  vk.DeviceMemory
 	textureImageView vk.ImageView
 	textureSampler   vk.Sampler
+	// Loaded textures waiting to replace the current one, oldest first
+	textureSwaps []*textureSwap
 
 	depthImage     vk.Image
 	depthImageMem  vk.DeviceMemory
 	depthImageView vk.ImageView
+
+	// Teardown functions of everything created by Initialize, run in reverse order on Destroy or failed initialization
+	teardown []func()
+}
+
+// FrameStats collects counters about the last recorded frame. It is reset at the start of each recordDrawCommands.
+type FrameStats struct {
+	Drawn  int
+	Culled int
+	// Models skipped because their vertex or index data is still being uploaded
+	Pending int
+	// Instances drawn by the instanced models among the drawn ones
+	Instances int
+	// Static models among the drawn ones, drawn together by a single indirect draw
+	Batched int
 }
 
 // Externally facing functions
 
-func NewRenderCore() *Core {
+// NewRenderCore creates the window and everything needed to draw into it. If any part fails to be created, all parts
+// created before it are destroyed again and the error is returned. The core must be created, driven and destroyed on the
+// OS thread the window is created on, which SDL requires to be the main thread (see runtime.LockOSThread).
+func NewRenderCore(opts Options) (*Core, error) {
 	c := &Core{}
-	c.Initialize()
-	return c
-}
-
-func (c *Core) Initialize() {
-	c.Win = com.NewWindow(PROGRAM_NAME, WINDOW_WIDTH, WINDOW_HEIGHT, []string{
-		"VK_LAYER_KHRONOS_validation",
-	})
-	c.device = com.NewDevice(c.Win)
-	c.swapChain = com.NewSwapChain(c.device, c.Win)
-	c.provisioner = NewDescriptorProvisioner(c.device.D)
-
-	c.createRenderPass()
-	c.provisioner.createDescriptorSetLayout()
-	c.provisioner.createModelDescriptorSetLayout()
-	c.createGraphicsPipeline()
-	c.createCommandPool()
-	c.createDepthResources()
-	c.createFrameBuffers()
-
-	c.createTexture()
-	c.createTextureViews()
-	c.createTextureSampler()
-
-	c.createUniformBuffers()
-	c.createCtxUniformBuffers()
-	c.provisioner.createDescriptorPool()
-	c.provisioner.createModelDescriptorPool()
-	c.provisioner.createDescriptorSets(c.uniformBuffers, c.textureSampler, c.textureImageView)
-	c.provisioner.createModelDescriptorSets(c.ctxUniformBuffer)
-	c.createCommandBuffers()
-	c.createSyncObjects()
+	if err := c.Initialize(opts); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// initStep is a single step of Initialize. Each create function cleans up after itself if it fails, destroy undoes a
+// successful create and may be nil if there is nothing to destroy (e.g.: resources owned by a parent resource).
+type initStep struct {
+	name    string
+	create  func() error
+	destroy func()
+}
+
+// Initialize runs all creation steps in order. Once a step succeeded its destroy function is registered, so Destroy
+// (or a later failing step) tears everything down in reverse order of creation.
+func (c *Core) Initialize(opts Options) error {
+	if err := opts.Validate(); err != nil {
+		return fmt.Errorf("invalid options: %w", err)
+	}
+	c.opts = opts
+	c.Animator = model.NewAnimator()
+	c.Limiter = NewFrameLimiter(opts.MaxFPS)
+	c.pendingUploads = make(map[*model.Model][]*com.Upload)
+	c.retired = make([][]func(), opts.FramesInFlight)
+	steps := []initStep{
+		{"window", c.createWindow, c.destroyWindow},
+		{"device", c.createDevice, c.destroyDevice},
+		{"asset loader", c.createAssetLoader, c.destroyAssetLoader},
+		{"memory allocator", c.createAllocator, c.destroyAllocator},
+		{"swap chain", c.createSwapChain, c.destroySwapChain},
+		{"render pass", c.createRenderPass, c.destroyRenderPass},
+		{"descriptor set layout", c.createDescriptorSetLayout, c.destroyDescriptorSetLayout},
+		{"graphics pipeline", c.createGraphicsPipeline, c.destroyGraphicsPipeline},
+		{"command pool", c.createCommandPool, c.destroyCommandPool},
+		{"upload manager", c.createUploadManager, c.destroyUploadManager},
+		{"mesh pools", c.createMeshPools, c.destroyMeshPools},
+		{"depth resources", c.createDepthResources, c.destroyDepthResources},
+		{"frame buffers", c.createFrameBuffers, c.destroyFrameBuffers},
+		{"texture", c.createTexture, c.destroyTexture},
+		{"texture view", c.createTextureViews, c.destroyTextureViews},
+		{"texture sampler", c.createTextureSampler, c.destroyTextureSampler},
+		{"staging ring", c.createStagingRing, c.destroyStagingRing},
+		{"descriptor pool", c.createDescriptorPool, c.destroyDescriptorPool},
+		{"descriptor sets", c.createDescriptorSets, nil},
+		{"command buffers", c.createCommandBuffers, nil},
+		{"parallel recorder", c.createParallelRecorder, c.destroyParallelRecorder},
+		{"sync objects", c.createSyncObjects, c.destroySyncObjects},
+	}
+	if err := c.runSteps(steps); err != nil {
+		return err
+	}
+	if err := c.Win.Debug.Err(); err != nil {
+		c.runTeardown()
+		return fmt.Errorf("validation failed during initialization: %w", err)
+	}
+	// The placeholder is sampled until the texture is loaded, if loading fails it stays in place
+	c.LoadTexture(TEXTURE_PATH)
+	return nil
+}
+
+// runSteps creates the steps in order and registers their destroy functions. If a step fails, the ones created before
+// it are torn down in reverse order and no later step runs.
+func (c *Core) runSteps(steps []initStep) error {
+	for _, step := range steps {
+		if err := step.create(); err != nil {
+			c.runTeardown()
+			return fmt.Errorf("failed to create %s: %w", step.name, err)
+		}
+		if step.destroy != nil {
+			c.teardown = append(c.teardown, step.destroy)
+		}
+	}
+	return nil
+}
+
+// runTeardown calls all registered teardown functions, last created first
+func (c *Core) runTeardown() {
+	for i := len(c.teardown) - 1; i >= 0; i-- {
+		c.teardown[i]()
+	}
+	c.teardown = nil
 }
 
 type iterationHandler func(sdl.Event, *Core)
 
-type drawHandler func(time.Duration, *Core)
+// updateHandler is called with the fixed UPDATE_TIMESTEP, independent of the frame rate
+type updateHandler func(time.Duration, *Core)
+
+// drawHandler is called once per frame with the total elapsed time and the interpolation alpha in [0, 1). Alpha tells
+// how far the current frame lies between the last and the next update step, which allows smoothing out movement when
+// rendering faster than updating. The core draws the camera and model transforms interpolated by it already.
+type drawHandler func(time.Duration, float64, *Core)
 
 // Loop this function represents the event-loop for user interaction and currently also contains
 // the primary draw call that renders each frame. The whole purpose of this function is to provide
 // a neat interface for call backs and all basic functionality a well-behaved app should have. E.g.:
 // Not rendering if minimized, close on Window 'close button', close on ESC key.
-func (c *Core) Loop(ih iterationHandler, dh drawHandler) {
+// World changes happen in the update handler, which is stepped with a fixed timestep using an accumulator, see:
+// https://gafferongames.com/post/fix_your_timestep/. Model animations are advanced in the same steps, so simulation
+// and movement behave the same regardless of the frame rate. Frames show the camera and models interpolated between
+// their states before and after the last step.
+// If Record is set, each frame's events and elapsed time are appended to it, together with the frames assets finished
+// loading in. If Replay is set, events and frame times are taken from the recording instead of SDL and the clock, and
+// the loop ends once the recording does. Assets finish in the same frames as when recorded, see: awaitReplayAssets.
+// Should drawing a frame fail, the loop stops and returns the error, the core can then only be destroyed. With
+// Options.StrictValidation, validation errors reported up to the end of a frame stop the loop the same way.
+func (c *Core) Loop(ih iterationHandler, uh updateHandler, dh drawHandler) error {
 	t0 := time.Now()
 	frames := 0
-	var event sdl.Event
+	lastFrame := time.Duration(0)
+	accumulator := time.Duration(0)
+	paused := false
 	c.Win.Close = false
+	c.loader.Hold, c.loader.Completed = nil, nil
+	if c.Replay != nil {
+		c.loader.Hold = func(a *Asset) bool {
+			return !c.Replay.TakeAsset(a.Name)
+		}
+	}
+	if c.Record != nil {
+		c.loader.Completed = func(a *Asset) {
+			c.Record.AddAsset(a.Name)
+		}
+	}
 	for !c.Win.Close {
-		for event = sdl.PollEvent(); event != nil; event = sdl.PollEvent() {
+		if err := c.awaitReplayAssets(); err != nil {
+			return err
+		}
+		frame, ok := c.nextFrame(t0)
+		if !ok {
+			log.Printf("Replay finished after %d frames", frames)
+			break
+		}
+		if c.Record != nil {
+			c.Record.AddFrame(frame.Elapsed, frame.Events)
+		}
+		for _, event := range frame.Events {
 			// Doing some basic functionality for basic window handling
 			switch ev := event.(type) {
 			case *sdl.QuitEvent:
@@ -135,18 +309,122 @@ func (c *Core) Loop(ih iterationHandler, dh drawHandler) {
 			ih(event, c)
 		}
 		if !c.Win.Minimized {
-			dh(time.Since(t0), c)
-			c.drawFrame()
+			c.beginFrame()
+			// The simulation pauses while minimized instead of catching up once restored
+			if paused {
+				lastFrame = frame.Elapsed
+				paused = false
+			}
+			accumulator += frame.Elapsed - lastFrame
+			lastFrame = frame.Elapsed
+			steps := 0
+			for accumulator >= UPDATE_TIMESTEP && steps < MAX_UPDATE_STEPS {
+				c.snapshotState()
+				c.Animator.Update(UPDATE_TIMESTEP)
+				uh(UPDATE_TIMESTEP, c)
+				accumulator -= UPDATE_TIMESTEP
+				steps++
+			}
+			if accumulator >= UPDATE_TIMESTEP {
+				accumulator = accumulator % UPDATE_TIMESTEP
+			}
+			alpha := float64(accumulator) / float64(UPDATE_TIMESTEP)
+			c.alpha = float32(alpha)
+			dh(frame.Elapsed, alpha, c)
+			if err := c.drawFrame(); err != nil {
+				return fmt.Errorf("failed to draw frame %d: %w", frames, err)
+			}
+			if err := c.Win.Debug.Err(); err != nil {
+				return fmt.Errorf("validation failed in frame %d: %w", frames, err)
+			}
 			frames++
+			c.Limiter.Wait()
 		} else {
-			// Sleep until new events change c.winMinimized
-			sdl.WaitEvent()
+			paused = true
+			if c.Replay == nil {
+				// Sleep until new events change c.winMinimized. The event waited for is put back, so it is handled
+				// (and recorded) like any other.
+				if event := sdl.WaitEvent(); event != nil {
+					_, _ = sdl.PushEvent(event)
+				}
+			}
 		}
 	}
 	dt := time.Since(t0)
 	log.Printf("Elapsed: %v, rough avg fps: %v fps", dt, float64(frames)/dt.Seconds())
+	return nil
+}
+
+// nextFrame collects the events and elapsed time of the next frame, either live from SDL or from the replay. While
+// replaying, SDL events are still drained to keep the window responsive, but only quitting is honored.
+// Each polled event is copied, as SDL reuses the same buffer for all of them.
+func (c *Core) nextFrame(t0 time.Time) (input.Frame, bool) {
+	var events []sdl.Event
+	for event := sdl.PollEvent(); event != nil; event = sdl.PollEvent() {
+		events = append(events, input.CopyEvent(event))
+	}
+	if c.Replay == nil {
+		return input.Frame{Elapsed: time.Since(t0), Events: events}, true
+	}
+	for _, event := range events {
+		if ev, ok := event.(*sdl.KeyboardEvent); ok && ev.Keysym.Sym == sdl.K_ESCAPE {
+			c.Win.Close = true
+		} else if _, ok := event.(*sdl.QuitEvent); ok {
+			c.Win.Close = true
+		}
+	}
+	return c.Replay.NextFrame()
+}
+
+// awaitReplayAssets draws frames while assets that had finished loading by the next replayed frame are still on their
+// way, so they can finish in that frame just as when recorded. These frames handle no events and run no updates, they
+// only keep uploads moving and show the same state again.
+func (c *Core) awaitReplayAssets() error {
+	if c.Replay == nil {
+		return nil
+	}
+	for _, name := range c.Replay.AssetsDue() {
+		// Nothing can be drawn while minimized, the asset may finish late then
+		for !c.Win.Minimized && c.loader.Behind(name) {
+			sdl.PumpEvents()
+			c.beginFrame()
+			if err := c.drawFrame(); err != nil {
+				return fmt.Errorf("failed to draw frame while waiting for %s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Options returns the options the core is running with, including changes made at runtime
+func (c *Core) Options() Options {
+	return c.opts
+}
+
+// SetPresentMode selects another present mode, one of PresentModes. The swap chain is recreated with the new mode
+// before the next frame is drawn.
+func (c *Core) SetPresentMode(name string) error {
+	if _, ok := presentModeNames[name]; !ok {
+		return fmt.Errorf("unknown present mode '%s', expected one of %v", name, PresentModes())
+	}
+	c.opts.PresentMode = name
+	c.recreateRequested = true
+	return nil
 }
 
+// PresentMode returns the name of the present mode in use. This differs from the selected one if the surface does not
+// support it and a fallback had to be used.
+func (c *Core) PresentMode() string {
+	for name, mode := range presentModeNames {
+		if mode == c.swapChain.PresentMode {
+			return name
+		}
+	}
+	return fmt.Sprintf("unknown (%d)", c.swapChain.PresentMode)
+}
+
+// Destroy waits for the device to finish all work and destroys everything created by Initialize in reverse order.
+// Buffers and images nobody destroyed are listed with their creation stack once the device goes.
 func (c *Core) Destroy() {
 	// If user has not cleaned up all models manually, warn and remove them now
 	if len(c.models) > 0 {
@@ -156,66 +434,108 @@ func (c *Core) Destroy() {
 
 	// We need to wait for the last asynchronous call to finish before tear down
 	vk.DeviceWaitIdle(c.device.D)
-	c.destroySwapChainAndDerivatives()
+	for i := range c.retired {
+		c.runRetired(int32(i))
+	}
+	c.runTeardown()
+}
 
-	vk.DestroySampler(c.device.D, c.textureSampler, nil)
-	vk.DestroyImageView(c.device.D, c.textureImageView, nil)
-	vk.DestroyImage(c.device.D, c.textureImage, nil)
-	vk.FreeMemory(c.device.D, c.textureImageMem, nil)
+// OS/Window level creation and destruction
 
-	// Destroy all buffers (application data)
-	for i := 0; i < MAX_FRAMES_IN_FLIGHT; i++ {
-		vk.DestroyBuffer(c.device.D, c.uniformBuffers[i], nil)
-		vk.FreeMemory(c.device.D, c.uniformBufferMems[i], nil)
-	}
-	// context ubo
-	modelCount := 4
-	for i := 0; i < modelCount; i++ {
-		vk.DestroyBuffer(c.device.D, c.ctxUniformBuffer[i], nil)
-		vk.FreeMemory(c.device.D, c.ctxUniformBufferMem[i], nil)
+func (c *Core) createWindow() error {
+	var err error
+	c.Win, err = com.NewWindow(c.opts.Title, c.opts.Width, c.opts.Height, c.opts.enabledLayers())
+	if err != nil {
+		return err
 	}
+	c.Win.Debug.SetStrict(c.opts.StrictValidation)
+	return nil
+}
 
-	vk.DestroyDescriptorPool(c.device.D, c.provisioner.descriptorPool, nil)
-	vk.DestroyDescriptorSetLayout(c.device.D, c.provisioner.descriptorSetLayout, nil)
+func (c *Core) destroyWindow() {
+	c.Win.Destroy()
+}
 
-	vk.DestroyDescriptorPool(c.device.D, c.provisioner.modelDescriptorPool, nil)
-	vk.DestroyDescriptorSetLayout(c.device.D, c.provisioner.modelDescriptorSetLayout, nil)
+func (c *Core) createDevice() error {
+	var err error
+	c.device, err = com.NewDevice(c.Win, c.opts.enabledLayers())
+	return err
+}
 
-	// Destroy all infrastructure up to the sdl window
-	for i := 0; i < MAX_FRAMES_IN_FLIGHT; i++ {
-		vk.DestroySemaphore(c.device.D, c.imageAvailableSems[i], nil)
-		vk.DestroySemaphore(c.device.D, c.renderFinishedSems[i], nil)
-		vk.DestroyFence(c.device.D, c.inFlightFens[i], nil)
-	}
-	vk.DestroyCommandPool(c.device.D, c.commandPool, nil)
+func (c *Core) destroyDevice() {
+	c.device.Destroy()
+}
 
-	for i := range c.pipelines {
-		vk.DestroyPipeline(c.device.D, c.pipelines[i], nil)
-	}
-	vk.DestroyPipelineLayout(c.device.D, c.pipelineLayout, nil)
-	vk.DestroyRenderPass(c.device.D, c.renderPass, nil)
+func (c *Core) createAssetLoader() error {
+	c.loader = NewAssetLoader(ASSET_WORKERS)
+	return nil
+}
 
-	c.device.Destroy()
-	c.Win.Destroy()
+// destroyAssetLoader waits for running loads, assets not ready by then fail
+func (c *Core) destroyAssetLoader() {
+	c.loader.Close()
 }
 
-func (c *Core) destroySwapChainAndDerivatives() {
-	vk.DestroyImageView(c.device.D, c.depthImageView, nil)
-	vk.DestroyImage(c.device.D, c.depthImage, nil)
-	vk.FreeMemory(c.device.D, c.depthImageMem, nil)
+func (c *Core) createAllocator() error {
+	c.allocator = com.NewAllocator(c.device, com.DEFAULT_MEMORY_BLOCK_SIZE)
+	return nil
+}
+
+func (c *Core) destroyAllocator() {
+	c.allocator.Destroy()
+}
+
+// MemoryStats reports the device memory held by the core's allocator
+func (c *Core) MemoryStats() com.AllocatorStats {
+	return c.allocator.Stats()
+}
+
+// MemoryReport summarizes the buffers and images alive per memory heap, followed by the allocator's block usage
+func (c *Core) MemoryReport() string {
+	return c.device.Resources.Report(c.device.PdMemoryProps) + "allocator: " + c.allocator.Stats().String()
+}
 
+func (c *Core) createSwapChain() error {
+	var err error
+	c.swapChain, err = com.NewSwapChain(c.device, c.Win, c.opts.surfaceFormat(), c.opts.presentMode())
+	return err
+}
+
+// destroySwapChain destroys the swap chain along with its image views and frame buffers. It is a no-op if the swap
+// chain has already been destroyed, e.g.: when recreating it failed.
+func (c *Core) destroySwapChain() {
+	if c.swapChain == nil {
+		return
+	}
 	c.swapChain.Destroy(c.device)
+	c.swapChain = nil
+}
+
+func (c *Core) createFrameBuffers() error {
+	return c.swapChain.CreateFrameBuffers(c.device, c.renderPass, &c.depthImageView)
 }
 
-func (c *Core) createImageView(image vk.Image, format vk.Format, aspectFlags vk.ImageAspectFlags) vk.ImageView {
+func (c *Core) destroyFrameBuffers() {
+	if c.swapChain != nil {
+		c.swapChain.DestroyFrameBuffers(c.device)
+	}
+}
+
+func (c *Core) createImageView(image vk.Image, format vk.Format, aspectFlags vk.ImageAspectFlags) (vk.ImageView, error) {
 	imgView, err := com.VKCreate2DFullSizeImageView(c.device.D, image, format, aspectFlags)
 	if err != nil {
-		log.Panicf("Failed to create image view: %v", err)
+		return nil, fmt.Errorf("failed to create image view: %w", err)
 	}
-	return imgView
+	return imgView, nil
 }
 
-func (c *Core) createRenderPass() {
+// Drawing infrastructure level creation and destruction
+
+func (c *Core) createRenderPass() error {
+	depthFormat, err := c.findDepthFormat()
+	if err != nil {
+		return err
+	}
 	colorAttachment := vk.AttachmentDescription{
 		Flags:          0,
 		Format:         c.swapChain.Format.Format,
@@ -233,7 +553,7 @@ func (c *Core) createRenderPass() {
 	}
 	depthAttachment := vk.AttachmentDescription{
 		Flags:          0,
-		Format:         c.findDepthFormat(),
+		Format:         depthFormat,
 		Samples:        vk.SampleCount1Bit,
 		LoadOp:         vk.AttachmentLoadOpClear,
 		StoreOp:        vk.AttachmentStoreOpDontCare,
@@ -278,21 +598,52 @@ func (c *Core) createRenderPass() {
 		DependencyCount: 1,
 		PDependencies:   []vk.SubpassDependency{dependency},
 	}
-	var err error
 	c.renderPass, err = com.VkCreateRenderPass(c.device.D, &renderPassInfo, nil)
 	if err != nil {
-		log.Panicf("Failed create render pass due to: %s", "err")
+		return err
 	}
 	log.Println("Successfully created render pass")
+	return nil
+}
+
+func (c *Core) destroyRenderPass() {
+	vk.DestroyRenderPass(c.device.D, c.renderPass, nil)
+}
+
+func (c *Core) createDescriptorSetLayout() error {
+	c.provisioner = NewDescriptorProvisioner(c.device.D, c.opts.FramesInFlight)
+	return c.provisioner.createDescriptorSetLayout()
+}
+
+func (c *Core) destroyDescriptorSetLayout() {
+	c.provisioner.destroyDescriptorSetLayout()
 }
 
-func (c *Core) createGraphicsPipeline() {
+func (c *Core) createGraphicsPipeline() error {
 	// Shader mode deletion can be done right after pipeline creation
-	vertShaderMod, vertStageInfo := LoadVert(c.device.D, "shaders_spv/vert.spv")
+	vertShaderMod, vertStageInfo, err := LoadVert(c.device.D, "shaders_spv/vert.spv")
+	if err != nil {
+		return err
+	}
 	defer DeleteShaderMod(c.device.D, vertShaderMod)
-	fragShaderMod, fragStageInfo := LoadFrag(c.device.D, "shaders_spv/frag.spv")
+	fragShaderMod, fragStageInfo, err := LoadFrag(c.device.D, "shaders_spv/frag.spv")
+	if err != nil {
+		return err
+	}
 	defer DeleteShaderMod(c.device.D, fragShaderMod)
+	instVertShaderMod, instVertStageInfo, err := LoadVert(c.device.D, "shaders_spv/instanced_vert.spv")
+	if err != nil {
+		return err
+	}
+	defer DeleteShaderMod(c.device.D, instVertShaderMod)
+	batchVertShaderMod, batchVertStageInfo, err := LoadVert(c.device.D, "shaders_spv/batched_vert.spv")
+	if err != nil {
+		return err
+	}
+	defer DeleteShaderMod(c.device.D, batchVertShaderMod)
 	shaderStages := []vk.PipelineShaderStageCreateInfo{vertStageInfo, fragStageInfo}
+	instShaderStages := []vk.PipelineShaderStageCreateInfo{instVertStageInfo, fragStageInfo}
+	batchShaderStages := []vk.PipelineShaderStageCreateInfo{batchVertStageInfo, fragStageInfo}
 	log.Printf("Prepared %d shader stages for pipeline creation: %v", len(shaderStages), shaderStages)
 
 	// Dynamic state
@@ -320,6 +671,14 @@ func (c *Core) createGraphicsPipeline() {
 		VertexAttributeDescriptionCount: uint32(len(attributeDesc)),
 		PVertexAttributeDescriptions:    attributeDesc,
 	}
+	// Instanced models read their transform and color from a per-instance binding in addition to their vertices
+	instBindingDesc := append(bindingDesc, model.GetInstanceBindingDescription())
+	instAttributeDesc := append(attributeDesc, model.GetInstanceAttributeDescriptions()...)
+	instVertexInputInfo := vertexInputInfo
+	instVertexInputInfo.VertexBindingDescriptionCount = uint32(len(instBindingDesc))
+	instVertexInputInfo.PVertexBindingDescriptions = instBindingDesc
+	instVertexInputInfo.VertexAttributeDescriptionCount = uint32(len(instAttributeDesc))
+	instVertexInputInfo.PVertexAttributeDescriptions = instAttributeDesc
 	// Input assembly - this is how the vertices are "put together" and allows us to do optimizations on what
 	// data is passed to the GPU. Its interesting, but we will stick to the tutorial for now. See:
 	// https://vulkan-tutorial.com/Drawing_a_triangle/Graphics_pipeline_basics/Fixed_functions for more.
@@ -387,7 +746,8 @@ func (c *Core) createGraphicsPipeline() {
 	}
 	log.Printf("PipelineColorBlendStateCreateInfo: %v", colorBlendingInfo)
 
-	// Pipeline layouts are used to pass uniforms as they will be specified during pipeline creation
+	// Pipeline layouts are used to pass uniforms as they will be specified during pipeline creation. Everything that
+	// differs between models is pushed as constants, so a single descriptor set serves any number of models.
 	modelPushConstantRange := vk.PushConstantRange{
 		StageFlags: vk.ShaderStageFlags(vk.ShaderStageVertexBit),
 		Offset:     0,
@@ -397,14 +757,14 @@ func (c *Core) createGraphicsPipeline() {
 		SType:                  vk.StructureTypePipelineLayoutCreateInfo,
 		PNext:                  nil,
 		Flags:                  0,
-		SetLayoutCount:         2,
-		PSetLayouts:            []vk.DescriptorSetLayout{c.provisioner.descriptorSetLayout, c.provisioner.modelDescriptorSetLayout},
+		SetLayoutCount:         1,
+		PSetLayouts:            []vk.DescriptorSetLayout{c.provisioner.descriptorSetLayout},
 		PushConstantRangeCount: 1,
 		PPushConstantRanges:    []vk.PushConstantRange{modelPushConstantRange},
 	}
 	layouts, err := com.VkCreatePipelineLayout(c.device.D, &pipelineLayoutInfo, nil)
 	if err != nil {
-		log.Panicf("Failed to create pipeline layout")
+		return fmt.Errorf("failed to create pipeline layout: %w", err)
 	}
 	c.pipelineLayout = layouts
 
@@ -423,6 +783,10 @@ func (c *Core) createGraphicsPipeline() {
 		MaxDepthBounds:        1,
 	}
 
+	// Reverse-Z clears depth to 0 and keeps fragments closer to 1
+	depthStencilReverse := depthStencil
+	depthStencilReverse.DepthCompareOp = vk.CompareOpGreater
+
 	// The actual pipeline
 	pipelineInfo := vk.GraphicsPipelineCreateInfo{
 		SType:               vk.StructureTypeGraphicsPipelineCreateInfo,
@@ -445,46 +809,88 @@ func (c *Core) createGraphicsPipeline() {
 		BasePipelineHandle:  nil,
 		BasePipelineIndex:   -1,
 	}
-	pipelineInfos := []vk.GraphicsPipelineCreateInfo{pipelineInfo}
-	pipelines, err := com.VkCreateGraphicsPipelines(c.device.D, nil, 1, pipelineInfos, nil)
+	pipelineInfoReverse := pipelineInfo
+	pipelineInfoReverse.PDepthStencilState = &depthStencilReverse
+
+	pipelineInfos := make([]vk.GraphicsPipelineCreateInfo, 6)
+	pipelineInfos[PIPELINE_STANDARD_Z] = pipelineInfo
+	pipelineInfos[PIPELINE_REVERSE_Z] = pipelineInfoReverse
+	for _, idx := range []int{PIPELINE_STANDARD_Z, PIPELINE_REVERSE_Z} {
+		instPipelineInfo := pipelineInfos[idx]
+		instPipelineInfo.PStages = instShaderStages
+		instPipelineInfo.PVertexInputState = &instVertexInputInfo
+		pipelineInfos[PIPELINE_INSTANCED+idx] = instPipelineInfo
+		batchPipelineInfo := pipelineInfos[idx]
+		batchPipelineInfo.PStages = batchShaderStages
+		pipelineInfos[PIPELINE_BATCHED+idx] = batchPipelineInfo
+	}
+	pipelines, err := com.VkCreateGraphicsPipelines(c.device.D, nil, uint32(len(pipelineInfos)), pipelineInfos, nil)
 	if err != nil {
-		log.Panicf("Failed to create graphics pipeline")
+		vk.DestroyPipelineLayout(c.device.D, c.pipelineLayout, nil)
+		return err
 	}
 	c.pipelines = pipelines
-	log.Printf("Successfully created graphics pipeline")
-
+	nameObject(c, vk.ObjectTypePipelineLayout, c.pipelineLayout, "standard pipeline layout")
+	nameObject(c, vk.ObjectTypePipeline, c.pipelines[PIPELINE_STANDARD_Z], "standard z pipeline")
+	nameObject(c, vk.ObjectTypePipeline, c.pipelines[PIPELINE_REVERSE_Z], "reverse z pipeline")
+	nameObject(c, vk.ObjectTypePipeline, c.pipelines[PIPELINE_INSTANCED+PIPELINE_STANDARD_Z], "instanced standard z pipeline")
+	nameObject(c, vk.ObjectTypePipeline, c.pipelines[PIPELINE_INSTANCED+PIPELINE_REVERSE_Z], "instanced reverse z pipeline")
+	nameObject(c, vk.ObjectTypePipeline, c.pipelines[PIPELINE_BATCHED+PIPELINE_STANDARD_Z], "batched standard z pipeline")
+	nameObject(c, vk.ObjectTypePipeline, c.pipelines[PIPELINE_BATCHED+PIPELINE_REVERSE_Z], "batched reverse z pipeline")
+	log.Printf("Successfully created %d graphics pipelines", len(pipelines))
+	return nil
 }
 
-func (c *Core) createFrameBuffers() {
-	c.swapChain.CreateFrameBuffers(c.device, c.renderPass, &c.depthImageView)
+func (c *Core) destroyGraphicsPipeline() {
+	for i := range c.pipelines {
+		vk.DestroyPipeline(c.device.D, c.pipelines[i], nil)
+	}
+	vk.DestroyPipelineLayout(c.device.D, c.pipelineLayout, nil)
 }
 
-func (c *Core) createCommandPool() {
+func (c *Core) createCommandPool() error {
 	commandPool, err := com.VKSCreateCommandPool(
 		c.device.D,
 		vk.CommandPoolCreateFlags(vk.CommandPoolCreateResetCommandBufferBit),
 		*c.device.QFamilies.GraphicsFamily,
 	)
 	if err != nil {
-		log.Panicf("Failed to create command pool")
+		return err
 	}
 	log.Printf("Successfully created command pool")
 	c.commandPool = commandPool
+	return nil
+}
+
+// destroyCommandPool destroys the pool, which frees all command buffers allocated from it as well
+func (c *Core) destroyCommandPool() {
+	vk.DestroyCommandPool(c.device.D, c.commandPool, nil)
 }
 
-func (c *Core) createCommandBuffers() {
-	buffers, err := com.VKAllocateCommandBuffersPrimary(c.device.D, c.commandPool, uint32(MAX_FRAMES_IN_FLIGHT))
+func (c *Core) createUploadManager() error {
+	var err error
+	c.uploads, err = com.NewUploadManager(c.device, c.allocator)
+	return err
+}
+
+func (c *Core) destroyUploadManager() {
+	c.uploads.Destroy()
+}
+
+func (c *Core) createCommandBuffers() error {
+	buffers, err := com.VKAllocateCommandBuffersPrimary(c.device.D, c.commandPool, uint32(c.opts.FramesInFlight))
 	if err != nil {
-		log.Panicf("Failed to allocate command buffers")
+		return err
 	}
 	log.Printf("Successfully allocated %d command buffers", len(buffers))
 	c.commandBuffers = buffers
+	return nil
 }
 
-func (c *Core) createSyncObjects() {
-	ias := make([]vk.Semaphore, MAX_FRAMES_IN_FLIGHT)
-	rfs := make([]vk.Semaphore, MAX_FRAMES_IN_FLIGHT)
-	iff := make([]vk.Fence, MAX_FRAMES_IN_FLIGHT)
+func (c *Core) createSyncObjects() error {
+	c.imageAvailableSems = make([]vk.Semaphore, c.opts.FramesInFlight)
+	c.renderFinishedSems = make([]vk.Semaphore, c.opts.FramesInFlight)
+	c.inFlightFens = make([]vk.Fence, c.opts.FramesInFlight)
 	semCreateInfo := vk.SemaphoreCreateInfo{
 		SType: vk.StructureTypeSemaphoreCreateInfo,
 		PNext: nil,
@@ -495,81 +901,105 @@ func (c *Core) createSyncObjects() {
 		PNext: nil,
 		Flags: vk.FenceCreateFlags(vk.FenceCreateSignaledBit),
 	}
-	for i := 0; i < MAX_FRAMES_IN_FLIGHT; i++ {
-		if vk.CreateSemaphore(c.device.D, &semCreateInfo, nil, &ias[i]) != vk.Success ||
-			vk.CreateSemaphore(c.device.D, &semCreateInfo, nil, &rfs[i]) != vk.Success ||
-			vk.CreateFence(c.device.D, &fenCreateInfo, nil, &iff[i]) != vk.Success {
-			log.Panicf("Failed tocreate sync objects")
+	for i := 0; i < c.opts.FramesInFlight; i++ {
+		if vk.CreateSemaphore(c.device.D, &semCreateInfo, nil, &c.imageAvailableSems[i]) != vk.Success ||
+			vk.CreateSemaphore(c.device.D, &semCreateInfo, nil, &c.renderFinishedSems[i]) != vk.Success ||
+			vk.CreateFence(c.device.D, &fenCreateInfo, nil, &c.inFlightFens[i]) != vk.Success {
+			// Sync objects not created yet are null handles, destroying those is a no-op
+			c.destroySyncObjects()
+			return fmt.Errorf("failed to create sync objects of frame %d", i)
 		}
 	}
-	c.imageAvailableSems = ias
-	c.renderFinishedSems = rfs
-	c.inFlightFens = iff
+	return nil
 }
 
-func (c *Core) allocateVBuffer(m *model.Model) (vk.Buffer, vk.DeviceMemory) {
-	// Create staging buffer
-	bufSize := vk.DeviceSize(m.GetVBufferSize())
-	stgBuf := com.CreateBuffer(
-		c.device,
-		bufSize,
-		vk.BufferUsageFlags(vk.BufferUsageTransferSrcBit),
-		vk.MemoryPropertyFlags(vk.MemoryPropertyHostVisibleBit|vk.MemoryPropertyHostCoherentBit),
-	)
-	defer com.DestroyBuffer(c.device, stgBuf)
+func (c *Core) destroySyncObjects() {
+	for i := range c.inFlightFens {
+		vk.DestroySemaphore(c.device.D, c.imageAvailableSems[i], nil)
+		vk.DestroySemaphore(c.device.D, c.renderFinishedSems[i], nil)
+		vk.DestroyFence(c.device.D, c.inFlightFens[i], nil)
+	}
+}
 
-	// Copy our vertex data into staging (device) memory
-	com.CopyToDeviceBuffer(c.device, stgBuf, m.GetVBufferBytes())
+// Data level creation and destruction
 
-	// Create vertex buffer
-	vertBuf := com.CreateBuffer(
-		c.device,
-		bufSize,
-		vk.BufferUsageFlags(vk.BufferUsageTransferDstBit|vk.BufferUsageVertexBufferBit),
-		vk.MemoryPropertyFlags(vk.MemoryPropertyDeviceLocalBit),
+func (c *Core) allocateVBuffer(m *model.Model) (*com.Buffer, *com.Upload, error) {
+	buf, up, err := c.uploadToDeviceLocal(
+		m.Name+" vertices",
+		m.GetVBufferBytes(),
+		vk.BufferUsageFlags(vk.BufferUsageVertexBufferBit),
+		vk.AccessFlags(vk.AccessVertexAttributeReadBit),
 	)
+	if err != nil {
+		return nil, nil, err
+	}
+	nameObject(c, vk.ObjectTypeBuffer, buf.Handle, m.Name+" vertices")
 	log.Printf(
-		"Created vertex buffer (\"%s\": [handleRef@%p, bufferRef@%p, Size: %d Byte])",
-		m.Name, &vertBuf.Handle, &vertBuf.DeviceMem, bufSize,
+		"Created vertex buffer (\"%s\": [handleRef@%p, memory@%p+%d, Size: %d Byte])",
+		m.Name, &buf.Handle, buf.DeviceMem, buf.Offset, buf.Size,
 	)
-
-	// Move memory to vertex buffer
-	c.copyBuffer(stgBuf, vertBuf, bufSize)
-	return vertBuf.Handle, vertBuf.DeviceMem
+	return buf, up, nil
 }
 
-func (c *Core) allocateIdxBuffer(m *model.Model) (vk.Buffer, vk.DeviceMemory) {
-	// Create staging buffer
-	bufSize := vk.DeviceSize(m.GetIdxBufferSize())
-	stgBuf := com.CreateBuffer(
-		c.device,
-		bufSize,
-		vk.BufferUsageFlags(vk.BufferUsageTransferSrcBit),
-		vk.MemoryPropertyFlags(vk.MemoryPropertyHostVisibleBit|vk.MemoryPropertyHostCoherentBit),
-	)
-	com.CopyToDeviceBuffer(c.device, stgBuf, m.GetIdxBufferBytes())
-	// Create vertex buffer
-	idxBuf := com.CreateBuffer(
-		c.device,
-		bufSize,
-		vk.BufferUsageFlags(vk.BufferUsageTransferDstBit|vk.BufferUsageIndexBufferBit),
-		vk.MemoryPropertyFlags(vk.MemoryPropertyDeviceLocalBit),
+func (c *Core) allocateIdxBuffer(m *model.Model) (*com.Buffer, *com.Upload, error) {
+	buf, up, err := c.uploadToDeviceLocal(
+		m.Name+" indices",
+		m.GetIdxBufferBytes(),
+		vk.BufferUsageFlags(vk.BufferUsageIndexBufferBit),
+		vk.AccessFlags(vk.AccessIndexReadBit),
 	)
+	if err != nil {
+		return nil, nil, err
+	}
+	nameObject(c, vk.ObjectTypeBuffer, buf.Handle, m.Name+" indices")
 	log.Printf(
-		"Created index buffer (\"%s\": [handleRef@%p, bufferRef@%p, Size: %d Byte])",
-		m.Name, &idxBuf.Handle, &idxBuf.DeviceMem, bufSize,
+		"Created index buffer (\"%s\": [handleRef@%p, memory@%p+%d, Size: %d Byte])",
+		m.Name, &buf.Handle, buf.DeviceMem, buf.Offset, buf.Size,
 	)
-	// Move memory to index buffer & delete staging buffer afterwards
-	c.copyBuffer(stgBuf, idxBuf, bufSize)
-	vk.DestroyBuffer(c.device.D, stgBuf.Handle, nil)
-	vk.FreeMemory(c.device.D, stgBuf.DeviceMem, nil)
+	return buf, up, nil
+}
+
+// uploadToDeviceLocal creates a device local buffer of the given usage, sub-allocated from the core's allocator, and
+// queues filling it with the payload on the upload manager. The payload is copied right away, the copy to the device
+// happens asynchronously, the buffer must not be used before the returned upload is done. The buffer is read in the
+// vertex input stage with the given access. On failure no buffer is left behind.
+func (c *Core) uploadToDeviceLocal(label string, payload []byte, usage vk.BufferUsageFlags, access vk.AccessFlags) (*com.Buffer, *com.Upload, error) {
+	buf, err := c.allocator.CreateBuffer(
+		label,
+		vk.DeviceSize(len(payload)),
+		// Copy source as well, so the buffer can be copied over when it has to grow, see: growBuffer
+		vk.BufferUsageFlags(vk.BufferUsageTransferDstBit|vk.BufferUsageTransferSrcBit)|usage,
+		vk.MemoryPropertyFlags(vk.MemoryPropertyDeviceLocalBit),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	up, err := c.uploads.UploadBuffer(label, buf, payload, vk.PipelineStageFlags(vk.PipelineStageVertexInputBit), access)
+	if err != nil {
+		com.DestroyBuffer(c.device, buf)
+		return nil, nil, err
+	}
+	return buf, up, nil
+}
 
-	return idxBuf.Handle, idxBuf.DeviceMem
+// isUploaded reports whether all uploads queued for the model are done, so it can be drawn
+func (c *Core) isUploaded(m *model.Model) bool {
+	for _, up := range c.pendingUploads[m] {
+		if !up.Done() {
+			return false
+		}
+	}
+	delete(c.pendingUploads, m)
+	return true
 }
 
-func (c *Core) transitionImageLayout(img vk.Image, format vk.Format, old vk.ImageLayout, new vk.ImageLayout) {
-	cmdBuf := c.beginSingleTimeCommands()
+// cancelUploads drops the model's uploads that are not done yet, before its buffers are destroyed
+func (c *Core) cancelUploads(m *model.Model) {
+	c.uploads.Cancel(c.pendingUploads[m]...)
+	delete(c.pendingUploads, m)
+}
 
+func (c *Core) transitionImageLayout(img vk.Image, format vk.Format, old vk.ImageLayout, new vk.ImageLayout) error {
 	var aspectFlags vk.ImageAspectFlags
 	if new == vk.ImageLayoutDepthStencilAttachmentOptimal {
 		aspectFlags = vk.ImageAspectFlags(vk.ImageAspectDepthBit)
@@ -617,9 +1047,13 @@ func (c *Core) transitionImageLayout(img vk.Image, format vk.Format, old vk.Imag
 		srcStage = vk.PipelineStageFlags(vk.PipelineStageTopOfPipeBit)
 		dstStage = vk.PipelineStageFlags(vk.PipelineStageEarlyFragmentTestsBit)
 	} else {
-		log.Panicf("unsupported image layout transition!")
+		return fmt.Errorf("unsupported image layout transition from %d to %d", old, new)
 	}
 
+	cmdBuf, err := c.beginSingleTimeCommands()
+	if err != nil {
+		return err
+	}
 	vk.CmdPipelineBarrier(
 		cmdBuf,
 		srcStage, dstStage,
@@ -629,86 +1063,193 @@ func (c *Core) transitionImageLayout(img vk.Image, format vk.Format, old vk.Imag
 		1, []vk.ImageMemoryBarrier{barrier},
 	)
 
-	c.endSingleTimeCommands(cmdBuf, c.device.GraphicsQ)
+	return c.endSingleTimeCommands(cmdBuf, c.device.GraphicsQ)
 }
 
-func (c *Core) copyBufferToImage(buffer vk.Buffer, img vk.Image, w uint32, h uint32) {
-	cmdBuf := c.beginSingleTimeCommands()
-	region := vk.BufferImageCopy{
-		BufferOffset:      0,
-		BufferRowLength:   0,
-		BufferImageHeight: 0,
-		ImageSubresource: vk.ImageSubresourceLayers{
-			AspectMask:     vk.ImageAspectFlags(vk.ImageAspectColorBit),
-			MipLevel:       0,
-			BaseArrayLayer: 0,
-			LayerCount:     1,
-		},
-		ImageOffset: vk.Offset3D{
-			X: 0,
-			Y: 0,
-			Z: 0,
-		},
-		ImageExtent: vk.Extent3D{
-			Width:  w,
-			Height: h,
-			Depth:  1,
-		},
+// createTexture creates the checkerboard placeholder sampled until a texture is loaded with LoadTexture. It is needed
+// by the first frame already, so the upload is waited for. If the ownership has to be transferred, the first frame
+// acquires it before its render pass.
+func (c *Core) createTexture() error {
+	size := uint32(PLACEHOLDER_TEXTURE_SIZE)
+	var up *com.Upload
+	var err error
+	c.textureName = "placeholder texture"
+	c.textureExtent = vk.Extent2D{Width: size, Height: size}
+	c.textureImage, c.textureImageMem, up, err = c.createTextureImage(c.textureName, size, size, placeholderPixels(size, PLACEHOLDER_TEXTURE_CELL))
+	if err != nil {
+		return err
+	}
+	err = c.uploads.Flush()
+	if err == nil {
+		err = c.uploads.Wait()
 	}
-	vk.CmdCopyBufferToImage(cmdBuf, buffer, img, vk.ImageLayoutTransferDstOptimal, 1, []vk.BufferImageCopy{region})
-	c.endSingleTimeCommands(cmdBuf, c.device.GraphicsQ)
-}
-
-func (c *Core) createTexture() {
-	path := "textures/statue-1275469_1280.jpg"
-	img, err := stbi.Load(path)
 	if err != nil {
-		log.Panicf("Failed to load %s: %v", path, err)
+		c.uploads.Cancel(up)
+		c.destroyTexture()
+		return fmt.Errorf("failed to upload %s: %w", c.textureName, err)
 	}
-	w := img.Rect.Dx()
-	h := img.Rect.Dy()
-	bytesPerPixel := 4
-	imgSize := vk.DeviceSize(w * h * bytesPerPixel)
-	log.Printf("Loaded image %s (w: %dp, h:%d) %d Byte", path, w, h, imgSize)
+	return nil
+}
 
-	stgBuf := com.CreateBuffer(
-		c.device,
-		imgSize,
-		vk.BufferUsageFlags(vk.BufferUsageTransferSrcBit),
-		vk.MemoryPropertyFlags(vk.MemoryPropertyHostVisibleBit|vk.MemoryPropertyHostCoherentBit),
-	)
-	// Map staging memory - copy our vertex data into staging - unmap staging again
-	var pData unsafe.Pointer
-	err = vk.Error(vk.MapMemory(c.device.D, stgBuf.DeviceMem, 0, imgSize, 0, &pData))
-	if err != nil {
-		log.Panicf("Failed to map device memory")
+// destroyTexture destroys the texture along with all loaded textures that did not replace it yet
+func (c *Core) destroyTexture() {
+	for _, s := range c.textureSwaps {
+		c.uploads.Cancel(s.upload)
+		s.destroy(c)
 	}
-	vk.Memcopy(pData, img.Pix)
-	vk.UnmapMemory(c.device.D, stgBuf.DeviceMem)
+	c.textureSwaps = nil
+	com.DestroyImage(c.device, c.textureImage, c.textureImageMem)
+}
 
-	c.textureImage, c.textureImageMem = com.CreateImage(
+// createTextureImage creates a sampled image and queues uploading the pixels (tightly packed RGBA) into it
+func (c *Core) createTextureImage(label string, w uint32, h uint32, pixels []byte) (vk.Image, vk.DeviceMemory, *com.Upload, error) {
+	img, mem, err := com.CreateImage(
 		c.device,
-		uint32(w),
-		uint32(h),
+		label,
+		w,
+		h,
 		vk.FormatR8g8b8a8Srgb,
 		vk.ImageTilingOptimal,
 		vk.ImageUsageFlags(vk.ImageUsageTransferDstBit|vk.ImageUsageSampledBit),
 		vk.MemoryPropertyFlags(vk.MemoryPropertyDeviceLocalBit),
 	)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	nameObject(c, vk.ObjectTypeImage, img, label)
+	nameObject(c, vk.ObjectTypeDeviceMemory, mem, label+" memory")
+	up, err := c.uploads.UploadImage(label, img, w, h, pixels)
+	if err != nil {
+		com.DestroyImage(c.device, img, mem)
+		return nil, nil, nil, fmt.Errorf("failed to upload %s: %w", label, err)
+	}
+	return img, mem, up, nil
+}
+
+// placeholderPixels returns a grey RGBA checkerboard of size x size pixels with cells of cell x cell pixels
+func placeholderPixels(size uint32, cell uint32) []byte {
+	pixels := make([]byte, 0, size*size*4)
+	for y := uint32(0); y < size; y++ {
+		for x := uint32(0); x < size; x++ {
+			v := byte(96)
+			if (x/cell+y/cell)%2 == 0 {
+				v = 160
+			}
+			pixels = append(pixels, v, v, v, 255)
+		}
+	}
+	return pixels
+}
+
+func (c *Core) createTextureViews() error {
+	var err error
+	c.textureImageView, err = c.createImageView(c.textureImage, vk.FormatR8g8b8a8Srgb, vk.ImageAspectFlags(vk.ImageAspectColorBit))
+	if err == nil {
+		nameObject(c, vk.ObjectTypeImageView, c.textureImageView, c.textureName+" view")
+	}
+	return err
+}
 
-	c.transitionImageLayout(c.textureImage, vk.FormatR8g8b8a8Srgb, vk.ImageLayoutUndefined, vk.ImageLayoutTransferDstOptimal)
-	c.copyBufferToImage(stgBuf.Handle, c.textureImage, uint32(w), uint32(h))
-	c.transitionImageLayout(c.textureImage, vk.FormatR8g8b8a8Srgb, vk.ImageLayoutTransferDstOptimal, vk.ImageLayoutShaderReadOnlyOptimal)
+func (c *Core) destroyTextureViews() {
+	vk.DestroyImageView(c.device.D, c.textureImageView, nil)
+}
 
-	vk.DestroyBuffer(c.device.D, stgBuf.Handle, nil)
-	vk.FreeMemory(c.device.D, stgBuf.DeviceMem, nil)
+// textureSwap is a loaded texture replacing the current one. Descriptor sets can not be updated while a frame in flight
+// uses them, so each frame's set is switched right before that frame is recorded again.
+type textureSwap struct {
+	name   string
+	extent vk.Extent2D
+	image  vk.Image
+	mem    vk.DeviceMemory
+	view   vk.ImageView
+	upload *com.Upload
+	// Frame indices whose descriptor set samples the new texture already
+	switched []bool
+	done     bool
 }
 
-func (c *Core) createTextureViews() {
-	c.textureImageView = c.createImageView(c.textureImage, vk.FormatR8g8b8a8Srgb, vk.ImageAspectFlags(vk.ImageAspectColorBit))
+func (s *textureSwap) destroy(c *Core) {
+	vk.DestroyImageView(c.device.D, s.view, nil)
+	com.DestroyImage(c.device, s.image, s.mem)
+}
+
+// LoadTexture replaces the texture sampled by the standard pipeline with the image at path. The image is decoded in
+// the background, until it is uploaded the current texture (at first the placeholder) stays in use. Textures loaded in
+// quick succession replace each other in the order they were requested.
+func (c *Core) LoadTexture(path string) *Asset {
+	var img *image.RGBA
+	var swap *textureSwap
+	load := func(a *Asset) error {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		a.SetProgress(0.5)
+		img, err = stbi.LoadMemory(b)
+		if err != nil {
+			return fmt.Errorf("failed to decode %s: %w", path, err)
+		}
+		log.Printf("Loaded image %s (w: %dp, h:%d) %d Byte", path, img.Rect.Dx(), img.Rect.Dy(), len(img.Pix))
+		return nil
+	}
+	upload := func() error {
+		w, h := uint32(img.Rect.Dx()), uint32(img.Rect.Dy())
+		texImg, texMem, up, err := c.createTextureImage(path, w, h, img.Pix)
+		if err != nil {
+			return err
+		}
+		view, err := c.createImageView(texImg, vk.FormatR8g8b8a8Srgb, vk.ImageAspectFlags(vk.ImageAspectColorBit))
+		if err != nil {
+			c.uploads.Cancel(up)
+			// Nothing has been submitted yet, the cancelled upload is dropped on the next flush
+			com.DestroyImage(c.device, texImg, texMem)
+			return err
+		}
+		nameObject(c, vk.ObjectTypeImageView, view, path+" view")
+		swap = &textureSwap{
+			name:     path,
+			extent:   vk.Extent2D{Width: w, Height: h},
+			image:    texImg,
+			mem:      texMem,
+			view:     view,
+			upload:   up,
+			switched: make([]bool, c.opts.FramesInFlight),
+		}
+		c.textureSwaps = append(c.textureSwaps, swap)
+		return nil
+	}
+	ready := func() (bool, error) {
+		return swap.done, nil
+	}
+	return c.loader.Load(path, load, upload, ready, nil)
+}
+
+// switchTexture points the descriptor set of the current frame at the oldest loaded texture once it is uploaded. After
+// all frames have been switched, the replaced texture is retired.
+func (c *Core) switchTexture() {
+	if len(c.textureSwaps) == 0 || !c.textureSwaps[0].upload.Done() {
+		return
+	}
+	s := c.textureSwaps[0]
+	if !s.switched[c.currentFrameIdx] {
+		c.provisioner.writeTextureDescriptor(int(c.currentFrameIdx), c.textureSampler, s.view)
+		s.switched[c.currentFrameIdx] = true
+	}
+	for _, ok := range s.switched {
+		if !ok {
+			return
+		}
+	}
+	old := &textureSwap{image: c.textureImage, mem: c.textureImageMem, view: c.textureImageView}
+	c.retire(func() { old.destroy(c) })
+	c.textureName, c.textureExtent = s.name, s.extent
+	c.textureImage, c.textureImageMem, c.textureImageView = s.image, s.mem, s.view
+	s.done = true
+	c.textureSwaps = c.textureSwaps[1:]
+	log.Printf("Switched texture to %s", s.name)
 }
 
-func (c *Core) createTextureSampler() {
+func (c *Core) createTextureSampler() error {
 	samplerInfo := &vk.SamplerCreateInfo{
 		SType:                   vk.StructureTypeSamplerCreateInfo,
 		PNext:                   nil,
@@ -731,15 +1272,24 @@ func (c *Core) createTextureSampler() {
 	}
 	var sampler vk.Sampler
 	if vk.CreateSampler(c.device.D, samplerInfo, nil, &sampler) != vk.Success {
-		log.Panicf("Failed to create texture sampler")
+		return errors.New("failed to create texture sampler")
 	}
 	c.textureSampler = sampler
+	return nil
 }
 
-func (c *Core) createDepthResources() {
-	dFormat := c.findDepthFormat()
-	dImg, dImgMem := com.CreateImage(
+func (c *Core) destroyTextureSampler() {
+	vk.DestroySampler(c.device.D, c.textureSampler, nil)
+}
+
+func (c *Core) createDepthResources() error {
+	dFormat, err := c.findDepthFormat()
+	if err != nil {
+		return err
+	}
+	dImg, dImgMem, err := com.CreateImage(
 		c.device,
+		"depth buffer",
 		c.swapChain.Extend.Width,
 		c.swapChain.Extend.Height,
 		dFormat,
@@ -747,15 +1297,34 @@ func (c *Core) createDepthResources() {
 		vk.ImageUsageFlags(vk.ImageUsageDepthStencilAttachmentBit),
 		vk.MemoryPropertyFlags(vk.MemoryPropertyDeviceLocalBit),
 	)
-	dImgView := c.createImageView(dImg, dFormat, vk.ImageAspectFlags(vk.ImageAspectDepthBit))
+	if err != nil {
+		return err
+	}
 	c.depthImage = dImg
 	c.depthImageMem = dImgMem
-	c.depthImageView = dImgView
+	nameObject(c, vk.ObjectTypeImage, c.depthImage, "depth buffer")
+	nameObject(c, vk.ObjectTypeDeviceMemory, c.depthImageMem, "depth buffer memory")
+	c.depthImageView, err = c.createImageView(dImg, dFormat, vk.ImageAspectFlags(vk.ImageAspectDepthBit))
+	if err == nil {
+		err = c.transitionImageLayout(c.depthImage, dFormat, vk.ImageLayoutUndefined, vk.ImageLayoutDepthStencilAttachmentOptimal)
+	}
+	if err != nil {
+		c.destroyDepthResources()
+		return err
+	}
+	return nil
+}
 
-	c.transitionImageLayout(c.depthImage, dFormat, vk.ImageLayoutUndefined, vk.ImageLayoutDepthStencilAttachmentOptimal)
+// destroyDepthResources destroys the depth image and resets the handles, so calling it twice is harmless
+func (c *Core) destroyDepthResources() {
+	vk.DestroyImageView(c.device.D, c.depthImageView, nil)
+	com.DestroyImage(c.device, c.depthImage, c.depthImageMem)
+	c.depthImageView, c.depthImage, c.depthImageMem = nil, nil, nil
 }
 
-func (c *Core) findDepthFormat() vk.Format {
+// findDepthFormat prefers a 32bit float depth format, as reverse-Z only pays off with floating point depth values.
+// Fixed point formats have a uniform precision, which reverse-Z can not improve on.
+func (c *Core) findDepthFormat() (vk.Format, error) {
 	return c.findSupportedFormat(
 		[]vk.Format{vk.FormatD32Sfloat, vk.FormatD32SfloatS8Uint, vk.FormatD24UnormS8Uint},
 		vk.ImageTilingOptimal,
@@ -767,23 +1336,23 @@ func hasStencilComponent(format vk.Format) bool {
 	return format == vk.FormatD32SfloatS8Uint || format == vk.FormatD24UnormS8Uint
 }
 
-func (c *Core) findSupportedFormat(candidates []vk.Format, tiling vk.ImageTiling, features vk.FormatFeatureFlags) vk.Format {
+func (c *Core) findSupportedFormat(candidates []vk.Format, tiling vk.ImageTiling, features vk.FormatFeatureFlags) (vk.Format, error) {
 	for _, format := range candidates {
 		var fProps vk.FormatProperties
 		vk.GetPhysicalDeviceFormatProperties(c.device.PD, format, &fProps)
 		fProps.Deref()
 		if tiling == vk.ImageTilingLinear && (fProps.LinearTilingFeatures&features) == features {
-			return format
+			return format, nil
 		} else if tiling == vk.ImageTilingOptimal && (fProps.OptimalTilingFeatures&features) == features {
-			return format
+			return format, nil
 		}
 	}
-	panic("No supported format found")
+	return 0, fmt.Errorf("none of the formats %v supports the required features", candidates)
 }
 
 // Drawing and derivative functionality
 
-func (c *Core) recordDrawCommands(buffer vk.CommandBuffer, imageIdx uint32) {
+func (c *Core) recordDrawCommands(buffer vk.CommandBuffer, imageIdx uint32, cam *model.Camera) error {
 	// Begin recording
 	beginInfo := vk.CommandBufferBeginInfo{
 		SType:            vk.StructureTypeCommandBufferBeginInfo,
@@ -791,8 +1360,24 @@ func (c *Core) recordDrawCommands(buffer vk.CommandBuffer, imageIdx uint32) {
 		Flags:            0,
 		PInheritanceInfo: nil,
 	}
-	if vk.BeginCommandBuffer(buffer, &beginInfo) != vk.Success {
-		log.Panicf("Failed to begin recording command buffer")
+	if err := vk.Error(vk.BeginCommandBuffer(buffer, &beginInfo)); err != nil {
+		return fmt.Errorf("failed to begin recording command buffer: %w", err)
+	}
+	// Take over finished uploads from the transfer queue, models become drawable from this frame on. Data streamed
+	// for this frame is copied in place before the render pass as well.
+	c.uploads.RecordAcquires(buffer)
+	c.recordStreamCopies(buffer)
+	uboOffset, err := c.writeUniforms(cam)
+	if err != nil {
+		return err
+	}
+	// Models outside the camera's view volume are skipped entirely. Static models are culled while writing their
+	// indirect draws, the remaining ones by visibleModels.
+	c.Stats = FrameStats{}
+	frustum := cam.Frustum()
+	batch, err := c.writeBatchedDraws(frustum)
+	if err != nil {
+		return err
 	}
 
 	// Start render pass
@@ -800,9 +1385,16 @@ func (c *Core) recordDrawCommands(buffer vk.CommandBuffer, imageIdx uint32) {
 		Offset: vk.Offset2D{X: 0, Y: 0},
 		Extent: c.swapChain.Extend,
 	}
+	// Depth is cleared to the value furthest away, which is 0 when using reverse-Z
+	pipelineIdx := PIPELINE_STANDARD_Z
+	clearDepth := float32(1)
+	if cam.IsReverseZ() {
+		pipelineIdx = PIPELINE_REVERSE_Z
+		clearDepth = 0
+	}
 	clearValues := []vk.ClearValue{
-		vk.NewClearValue([]float32{0.01, 0.01, 0.01, 1}), // color
-		vk.NewClearDepthStencil(1, 0),                    // depthStencil <- Go bindings are strange here ! dont really know about the necessary values
+		vk.NewClearValue(c.opts.ClearColor[:]), // color
+		vk.NewClearDepthStencil(clearDepth, 0), // depthStencil <- Go bindings are strange here ! dont really know about the necessary values
 	}
 	renderPassInfo := vk.RenderPassBeginInfo{
 		SType:           vk.StructureTypeRenderPassBeginInfo,
@@ -813,9 +1405,65 @@ func (c *Core) recordDrawCommands(buffer vk.CommandBuffer, imageIdx uint32) {
 		ClearValueCount: uint32(len(clearValues)),
 		PClearValues:    clearValues,
 	}
-	vk.CmdBeginRenderPass(buffer, &renderPassInfo, vk.SubpassContentsInline)
+	// Culling and the upload checks stay on the render thread, workers only record the draws of the visible models
+	visible := c.visibleModels(frustum)
+	parts := c.recordParts(len(visible))
+	if parts <= 1 {
+		vk.CmdBeginRenderPass(buffer, &renderPassInfo, vk.SubpassContentsInline)
+		c.recordPassState(buffer, pipelineIdx)
+		bound := pipelineIdx
+		if c.recordBatchedDraws(buffer, batch, pipelineIdx, uboOffset) {
+			bound = PIPELINE_BATCHED + pipelineIdx
+		}
+		c.recordModelDraws(buffer, visible, pipelineIdx, bound, uboOffset, batch.dataOffset)
+	} else {
+		vk.CmdBeginRenderPass(buffer, &renderPassInfo, vk.SubpassContentsSecondaryCommandBuffers)
+		if err := c.recordSecondaries(buffer, imageIdx, visible, parts, batch, pipelineIdx, uboOffset); err != nil {
+			return err
+		}
+	}
 
-	vk.CmdBindPipeline(buffer, vk.PipelineBindPointGraphics, c.pipelines[0])
+	vk.CmdEndRenderPass(buffer)
+	if err := vk.Error(vk.EndCommandBuffer(buffer)); err != nil {
+		return fmt.Errorf("failed to record command buffer: %w", err)
+	}
+	return nil
+}
+
+// visibleModels returns the indices of the non-static models to draw this frame and counts them in c.Stats together
+// with the culled and pending ones. The indices are positions in c.models, which the shaders get as ModelType, see:
+// modelConstants. Instanced models are not culled, their instances may be spread anywhere around the mesh.
+func (c *Core) visibleModels(frustum model.Frustum) []int {
+	visible := make([]int, 0, len(c.models))
+	for i := range c.models {
+		if c.models[i].Static {
+			continue
+		}
+		if !c.isUploaded(c.models[i]) {
+			c.Stats.Pending++
+			continue
+		}
+		instanced := c.models[i].IsInstanced()
+		if instanced && c.models[i].InstanceCount == 0 {
+			continue
+		}
+		if !instanced && !frustum.IntersectsBounds(c.models[i].WorldBounds()) {
+			c.Stats.Culled++
+			continue
+		}
+		c.Stats.Drawn++
+		if instanced {
+			c.Stats.Instances += int(c.models[i].InstanceCount)
+		}
+		visible = append(visible, i)
+	}
+	return visible
+}
+
+// recordPassState binds the pipeline and sets the dynamic state of the render pass. Secondary command buffers inherit
+// none of it from the primary one, so each of them has to record it again.
+func (c *Core) recordPassState(cmd vk.CommandBuffer, pipelineIdx int) {
+	vk.CmdBindPipeline(cmd, vk.PipelineBindPointGraphics, c.pipelines[pipelineIdx])
 
 	viewport := []vk.Viewport{
 		{
@@ -827,7 +1475,7 @@ func (c *Core) recordDrawCommands(buffer vk.CommandBuffer, imageIdx uint32) {
 			MaxDepth: 1.0,
 		},
 	}
-	vk.CmdSetViewport(buffer, 0, 1, viewport)
+	vk.CmdSetViewport(cmd, 0, 1, viewport)
 
 	scissor := []vk.Rect2D{
 		{
@@ -835,46 +1483,101 @@ func (c *Core) recordDrawCommands(buffer vk.CommandBuffer, imageIdx uint32) {
 			Extent: c.swapChain.Extend,
 		},
 	}
-	vk.CmdSetScissor(buffer, 0, 1, scissor)
+	vk.CmdSetScissor(cmd, 0, 1, scissor)
+}
 
-	for i := range c.models {
-		vk.CmdBindDescriptorSets(buffer, vk.PipelineBindPointGraphics, c.pipelineLayout, 0, 2, []vk.DescriptorSet{c.provisioner.descriptorSets[imageIdx], c.provisioner.modelDescriptorSets[i]}, 0, nil)
-		vertBuffers := []vk.Buffer{c.models[i].VertexBuffer}
+// recordModelDraws records the draws of the given models, as returned by visibleModels. bound is the pipeline bound on
+// cmd at this point. It only reads the core's state, so it is safe to run on several goroutines at once as long as the
+// render thread waits for them.
+func (c *Core) recordModelDraws(cmd vk.CommandBuffer, indices []int, pipelineIdx int, bound int, uboOffset uint32, dataOffset uint32) {
+	for _, i := range indices {
+		instanced := c.models[i].IsInstanced()
+		wanted := pipelineIdx
+		if instanced {
+			wanted = PIPELINE_INSTANCED + pipelineIdx
+		}
+		if wanted != bound {
+			vk.CmdBindPipeline(cmd, vk.PipelineBindPointGraphics, c.pipelines[wanted])
+			bound = wanted
+		}
+		// Descriptor sets are indexed by frame independently of the swap chain image, the dynamic offsets select the
+		// frame's uniforms and draw data in the staging ring
+		vk.CmdBindDescriptorSets(cmd, vk.PipelineBindPointGraphics, c.pipelineLayout, 0, 1, []vk.DescriptorSet{c.provisioner.descriptorSets[c.currentFrameIdx]}, 2, []uint32{uboOffset, dataOffset})
+		vertBuffers := []vk.Buffer{c.models[i].VertexBuffer.Handle}
 		offsets := []vk.DeviceSize{0}
-		vk.CmdBindVertexBuffers(buffer, 0, uint32(len(vertBuffers)), vertBuffers, offsets)
-		vk.CmdBindIndexBuffer(buffer, c.models[i].IndexBuffer, 0, vk.IndexTypeUint32)
-		pPConst := com.UnsafeMatPtr(&c.models[i].Mesh.ModelMat)
-		vk.CmdPushConstants(buffer, c.pipelineLayout, vk.ShaderStageFlags(vk.ShaderStageVertexBit), 0, model.ModelPushConstantsSize(), pPConst)
-		vk.CmdDrawIndexed(buffer, uint32(len(c.models[i].Mesh.VIndices)), 1, 0, 0, 0)
+		instanceCount := uint32(1)
+		if instanced {
+			vertBuffers = append(vertBuffers, c.models[i].InstanceBuffer.Handle)
+			offsets = append(offsets, 0)
+			instanceCount = c.models[i].InstanceCount
+		}
+		vk.CmdBindVertexBuffers(cmd, 0, uint32(len(vertBuffers)), vertBuffers, offsets)
+		vk.CmdBindIndexBuffer(cmd, c.models[i].IndexBuffer.Handle, 0, vk.IndexTypeUint32)
+		pc := c.modelConstants(i)
+		pPConst := unsafe.Pointer(&pc.Bytes()[0])
+		vk.CmdPushConstants(cmd, c.pipelineLayout, vk.ShaderStageFlags(vk.ShaderStageVertexBit), 0, model.ModelPushConstantsSize(), pPConst)
+		vk.CmdDrawIndexed(cmd, c.models[i].IndexCount, instanceCount, 0, 0, 0)
 	}
+}
 
-	vk.CmdEndRenderPass(buffer)
-	if vk.EndCommandBuffer(buffer) != vk.Success {
-		log.Printf("Failed to record commandbuffer")
-	}
+// modelConstants returns what the shaders get to know about the model at index i of the scene. They are pushed for
+// models drawn on their own and written into the draw data of batched ones. The model type is the model's index, it
+// does not select any per-model resource, so the scene may hold any number of models.
+func (c *Core) modelConstants(i int) model.ModelPushConstants {
+	return model.ModelPushConstants{Model: c.drawModelMat(c.models[i]), ModelType: uint32(i)}
 }
 
-func (c *Core) drawFrame() {
-	// Wait for frame to be ready - signalled by the inFlightFens
+// beginFrame waits until the current frame index is free again - signalled by the inFlightFens - and prepares its part
+// of the staging ring. From here on until drawFrame, data can be streamed for the frame.
+func (c *Core) beginFrame() {
 	vk.WaitForFences(c.device.D, 1, []vk.Fence{c.inFlightFens[c.currentFrameIdx]}, vk.True, math.MaxUint64)
+	c.runRetired(c.currentFrameIdx)
+	c.ring.BeginFrame(int(c.currentFrameIdx))
+}
+
+func (c *Core) drawFrame() error {
+	if c.recreateRequested {
+		c.recreateRequested = false
+		if err := c.recreateSwapChain(); err != nil {
+			return err
+		}
+	}
+
+	// The frame's fence has been waited for by beginFrame already, so assets loaded in the background can be uploaded
+	// and swapped in now
+	c.loader.Process()
+	c.switchTexture()
 
 	var imgIdx uint32
 	result := vk.AcquireNextImage(c.device.D, c.swapChain.Handle, math.MaxUint64, c.imageAvailableSems[c.currentFrameIdx], nil, &imgIdx)
 	// React on surface changes and other possible causes for failure (e.g.: Window resizing)
 	if result == vk.ErrorOutOfDate {
-		c.recreateSwapChain()
-		return
+		return c.recreateSwapChain()
 	} else if result != vk.Success && result != vk.Suboptimal {
-		log.Panicf("Failed to aquire image, AcquireNextImage(...) result code: %d", result)
+		return fmt.Errorf("failed to aquire image: %w", vk.Error(result))
 	}
 
 	// Reset the fence only if we are actually going to execute work that will put the fence into the signalled state
 	vk.ResetFences(c.device.D, 1, []vk.Fence{c.inFlightFens[c.currentFrameIdx]})
 
-	vk.ResetCommandBuffer(c.commandBuffers[c.currentFrameIdx], 0)
-	c.recordDrawCommands(c.commandBuffers[c.currentFrameIdx], imgIdx)
+	// Uploads queued since the last frame start copying on the transfer queue while this frame is recorded
+	if err := c.uploads.Flush(); err != nil {
+		return err
+	}
+	// Only now the frame is certain to be recorded and submitted, buffers replaced while updating are retired with it
+	c.packStaticMeshes()
+	if err := c.updateDynamicMeshes(); err != nil {
+		return err
+	}
 
-	c.updateUniformBuffer(c.currentFrameIdx)
+	// The camera's aspect is needed for culling while recording as well as for the uniform buffer
+	c.Cam.Aspect = c.swapChain.Aspect
+	// The camera and models are drawn in between the last two update steps
+	cam := c.drawCamera()
+	vk.ResetCommandBuffer(c.commandBuffers[c.currentFrameIdx], 0)
+	if err := c.recordDrawCommands(c.commandBuffers[c.currentFrameIdx], imgIdx, cam); err != nil {
+		return err
+	}
 
 	submitInfo := vk.SubmitInfo{
 		SType:              vk.StructureTypeSubmitInfo,
@@ -889,9 +1592,10 @@ func (c *Core) drawFrame() {
 		SignalSemaphoreCount: 1,
 		PSignalSemaphores:    []vk.Semaphore{c.renderFinishedSems[c.currentFrameIdx]},
 	}
-	if vk.QueueSubmit(c.device.GraphicsQ, 1, []vk.SubmitInfo{submitInfo}, c.inFlightFens[c.currentFrameIdx]) != vk.Success {
-		log.Panicf("Failed to submit commandbuffer")
+	if err := vk.Error(vk.QueueSubmit(c.device.GraphicsQ, 1, []vk.SubmitInfo{submitInfo}, c.inFlightFens[c.currentFrameIdx])); err != nil {
+		return fmt.Errorf("failed to submit command buffer: %w", err)
 	}
+	c.ring.EndFrame()
 
 	presentInfo := vk.PresentInfo{
 		SType:              vk.StructureTypePresentInfo,
@@ -905,81 +1609,96 @@ func (c *Core) drawFrame() {
 	}
 	result = vk.QueuePresent(c.device.PresentQ, &presentInfo)
 	// React on surface changes and other possible causes for failure (e.g.: Window resizing)
+	c.currentFrameIdx = (c.currentFrameIdx + 1) % int32(c.opts.FramesInFlight)
 	if result == vk.ErrorOutOfDate || result == vk.Suboptimal || c.Win.Resized {
 		c.Win.Resized = false
-		c.recreateSwapChain()
+		return c.recreateSwapChain()
 	} else if result != vk.Success {
-		log.Panicf("Failed to present image, QueuePresent(...) result code: %d", result)
+		return fmt.Errorf("failed to present image: %w", vk.Error(result))
 	}
-
-	c.currentFrameIdx = (c.currentFrameIdx + 1) % MAX_FRAMES_IN_FLIGHT
+	return nil
 }
 
-func (c *Core) recreateSwapChain() {
-	vk.DeviceWaitIdle(c.device.D)
-	c.destroySwapChainAndDerivatives()
-	c.swapChain = com.NewSwapChain(c.device, c.Win)
-	c.createDepthResources()
-	c.createFrameBuffers()
+// retire defers destroying a resource until no frame in flight can use it anymore. Frames recorded up to this call may
+// still use it, the last of them has the frame index before the current one. destroy runs once that index's fence has
+// been waited for the next time, as fences signal in submission order, all earlier frames are done by then as well.
+func (c *Core) retire(destroy func()) {
+	n := int32(c.opts.FramesInFlight)
+	idx := (c.currentFrameIdx + n - 1) % n
+	c.retired[idx] = append(c.retired[idx], destroy)
 }
 
-func (c *Core) createUniformBuffers() {
-	uboBufSize := model.SizeOfUbo()
-	log.Printf("UBO buffer size: %d Byte", uboBufSize)
-
-	c.uniformBuffers = make([]vk.Buffer, MAX_FRAMES_IN_FLIGHT)
-	c.uniformBufferMems = make([]vk.DeviceMemory, MAX_FRAMES_IN_FLIGHT)
-	c.uniformBuffersMapped = make([]unsafe.Pointer, MAX_FRAMES_IN_FLIGHT)
+// retireWithFrame defers destroying a resource the current frame still uses, it must only be called once the frame is
+// certain to be submitted. destroy runs once the current frame index's fence has been waited for the next time.
+func (c *Core) retireWithFrame(destroy func()) {
+	c.retired[c.currentFrameIdx] = append(c.retired[c.currentFrameIdx], destroy)
+}
 
-	memProps := vk.MemoryPropertyFlags(vk.MemoryPropertyHostVisibleBit | vk.MemoryPropertyHostCoherentBit)
-	for i := 0; i < MAX_FRAMES_IN_FLIGHT; i++ {
-		uboBuf := com.CreateBuffer(
-			c.device,
-			uboBufSize,
-			vk.BufferUsageFlags(vk.BufferUsageUniformBufferBit),
-			memProps,
-		)
-		c.uniformBuffers[i] = uboBuf.Handle
-		c.uniformBufferMems[i] = uboBuf.DeviceMem
-		vk.MapMemory(c.device.D, c.uniformBufferMems[i], 0, uboBufSize, 0, &c.uniformBuffersMapped[i])
+// runRetired destroys the resources retired for a frame index, its fence has to be signalled
+func (c *Core) runRetired(frameIdx int32) {
+	for _, destroy := range c.retired[frameIdx] {
+		destroy()
 	}
+	c.retired[frameIdx] = nil
 }
 
-func (c *Core) createCtxUniformBuffers() {
+// recreateSwapChain replaces the swap chain and everything depending on its size. If this fails, the core is left
+// without a swap chain and can only be destroyed.
+func (c *Core) recreateSwapChain() error {
+	vk.DeviceWaitIdle(c.device.D)
+	c.destroyFrameBuffers()
+	c.destroyDepthResources()
+	c.destroySwapChain()
+	if err := c.createSwapChain(); err != nil {
+		return fmt.Errorf("failed to recreate swap chain: %w", err)
+	}
+	if err := c.createDepthResources(); err != nil {
+		return fmt.Errorf("failed to recreate depth resources: %w", err)
+	}
+	if err := c.createFrameBuffers(); err != nil {
+		return fmt.Errorf("failed to recreate frame buffers: %w", err)
+	}
+	return nil
+}
 
-	modelCount := 4
-	c.ctxUniformBuffer = make([]vk.Buffer, modelCount)
-	c.ctxUniformBufferMem = make([]vk.DeviceMemory, modelCount)
-	c.ctxUniformBuffersMapped = make([]unsafe.Pointer, modelCount)
+func (c *Core) createStagingRing() error {
+	var err error
+	c.ring, err = com.NewStagingRing(c.allocator, "staging ring", STAGING_RING_FRAME_SIZE, c.opts.FramesInFlight)
+	if err != nil {
+		return err
+	}
+	nameObject(c, vk.ObjectTypeBuffer, c.ring.Buffer.Handle, "staging ring")
+	return nil
+}
 
-	memProps := vk.MemoryPropertyFlags(vk.MemoryPropertyHostVisibleBit | vk.MemoryPropertyHostCoherentBit)
-	uboSize := model.SizeOfCtxUbo()
+func (c *Core) destroyStagingRing() {
+	c.ring.Destroy(c.device)
+}
 
-	for i := 0; i < modelCount; i++ {
-		uboBuf := com.CreateBuffer(
-			c.device,
-			uboSize,
-			vk.BufferUsageFlags(vk.BufferUsageUniformBufferBit),
-			memProps,
-		)
-		c.ctxUniformBuffer[i] = uboBuf.Handle
-		c.ctxUniformBufferMem[i] = uboBuf.DeviceMem
-		vk.MapMemory(c.device.D, c.ctxUniformBufferMem[i], 0, uboSize, 0, &c.ctxUniformBuffersMapped[i])
+func (c *Core) createDescriptorPool() error {
+	return c.provisioner.createDescriptorPool()
+}
 
-		// Copy over
-		cubo := model.ContextUniformBufferObject{
-			ModelType: uint32(i),
-		}
-		vk.Memcopy(c.ctxUniformBuffersMapped[i], cubo.Bytes())
-	}
+func (c *Core) destroyDescriptorPool() {
+	c.provisioner.destroyDescriptorPool()
+}
 
+// createDescriptorSets allocates the sets from the pool and points them at the buffers and texture. The sets are
+// freed together with their pool.
+func (c *Core) createDescriptorSets() error {
+	return c.provisioner.createDescriptorSets(c.ring.Buffer, BATCH_DRAW_DATA_SIZE, c.textureSampler, c.textureImageView)
 }
 
-func (c *Core) updateUniformBuffer(frameIdx int32) {
-	c.Cam.Aspect = c.swapChain.Aspect
+// writeUniforms streams the matrices of the camera the frame is drawn with into the staging ring, the returned offset is
+// passed to the frame's descriptor set as dynamic offset
+func (c *Core) writeUniforms(cam *model.Camera) (uint32, error) {
 	ubo := model.UniformBufferObject{
-		View:       c.Cam.GetView(),
-		Projection: c.Cam.GetProjection(),
+		View:       cam.GetView(),
+		Projection: cam.GetProjection(),
+	}
+	offset, err := c.ring.Write(ubo.Bytes(), c.device.PdProps.Limits.MinUniformBufferOffsetAlignment)
+	if err != nil {
+		return 0, fmt.Errorf("failed to write uniforms: %w", err)
 	}
-	vk.Memcopy(c.uniformBuffersMapped[frameIdx], ubo.Bytes())
+	return uint32(offset), nil
 }
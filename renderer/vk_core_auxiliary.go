@@ -2,7 +2,7 @@ package renderer
 
 import (
 	com "GPU_fluid_simulation/common"
-	"log"
+	"fmt"
 
 	vk "github.com/goki/vulkan"
 )
@@ -11,37 +11,24 @@ import (
 // defaults where possible. These differ from the VKS function in vk_simplifications.go by being tied to a given
 // Core Struct and are closer to helper function in the class than being a general abstraction of the API.
 
-func (c *Core) beginSingleTimeCommands() vk.CommandBuffer {
+// nameObject labels a Vulkan object, the name shows up in validation messages and debugging tools. Without validation
+// there is no debug messenger and nothing is named.
+func nameObject[T any](c *Core, objType vk.ObjectType, handle T, name string) {
+	com.NameObject(c.Win.Debug, c.device.D, objType, handle, name)
+}
+
+func (c *Core) beginSingleTimeCommands() (vk.CommandBuffer, error) {
 	cmdBuffer, err := com.VKBeginSingleTimeCommands(c.device.D, c.commandPool)
 	if err != nil {
-		log.Panicf("Failed to create command buffer for single time use: %v", err)
+		return nil, fmt.Errorf("failed to create command buffer for single time use: %w", err)
 	}
-	return cmdBuffer
+	return cmdBuffer, nil
 }
 
-func (c *Core) endSingleTimeCommands(cmdBuf vk.CommandBuffer, queue vk.Queue) {
+func (c *Core) endSingleTimeCommands(cmdBuf vk.CommandBuffer, queue vk.Queue) error {
 	err := com.VKEndSingleTimeCommands(c.device.D, c.commandPool, queue, cmdBuf)
 	if err != nil {
-		log.Panicf("Failed to end single time use command buffer: %v", err)
+		return fmt.Errorf("failed to end single time use command buffer: %w", err)
 	}
-}
-
-// copyVkBuffer is a subroutine that prepares a command buffer that is then executed on the device.
-// The command buffer is allocated, records the copy command and is submitted to the device. After idle
-// the command buffer is freed.
-func (c *Core) copyVkBuffer(src vk.Buffer, dst vk.Buffer, s vk.DeviceSize) {
-	cmdBuf := c.beginSingleTimeCommands()
-	copyRegions := []vk.BufferCopy{
-		{
-			SrcOffset: 0,
-			DstOffset: 0,
-			Size:      s,
-		},
-	}
-	vk.CmdCopyBuffer(cmdBuf, src, dst, 1, copyRegions)
-	c.endSingleTimeCommands(cmdBuf, c.device.GraphicsQ)
-}
-
-func (c *Core) copyBuffer(src *com.Buffer, dst *com.Buffer, s vk.DeviceSize) {
-	c.copyVkBuffer(src.Handle, dst.Handle, s)
+	return nil
 }
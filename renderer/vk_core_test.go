@@ -0,0 +1,68 @@
+package renderer
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestInitStepsTearDownInReverseOnFailure(t *testing.T) {
+	errFailed := errors.New("failed")
+	for failing := 0; failing < 4; failing++ {
+		var calls []string
+		steps := make([]initStep, 4)
+		for i := range steps {
+			name := fmt.Sprintf("step %d", i)
+			steps[i] = initStep{
+				name: name,
+				create: func() error {
+					calls = append(calls, "create "+name)
+					if i == failing {
+						return errFailed
+					}
+					return nil
+				},
+				destroy: func() { calls = append(calls, "destroy "+name) },
+			}
+		}
+		// A step without destroy function is skipped on teardown
+		steps[1].destroy = nil
+
+		c := &Core{}
+		if err := c.runSteps(steps); !errors.Is(err, errFailed) {
+			t.Fatalf("step %d: expected the step's error, got %v", failing, err)
+		}
+		var expected []string
+		for i := 0; i <= failing; i++ {
+			expected = append(expected, fmt.Sprintf("create step %d", i))
+		}
+		for i := failing - 1; i >= 0; i-- {
+			if i != 1 {
+				expected = append(expected, fmt.Sprintf("destroy step %d", i))
+			}
+		}
+		if !reflect.DeepEqual(calls, expected) {
+			t.Fatalf("step %d: expected calls %v, got %v", failing, expected, calls)
+		}
+		if c.teardown != nil {
+			t.Fatalf("step %d: expected no teardown left after failing", failing)
+		}
+	}
+}
+
+func TestInitStepsRegisterTeardown(t *testing.T) {
+	var destroyed []int
+	c := &Core{}
+	err := c.runSteps([]initStep{
+		{"first", func() error { return nil }, func() { destroyed = append(destroyed, 0) }},
+		{"second", func() error { return nil }, func() { destroyed = append(destroyed, 1) }},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.runTeardown()
+	if !reflect.DeepEqual(destroyed, []int{1, 0}) {
+		t.Fatalf("expected steps to be destroyed last created first, got %v", destroyed)
+	}
+}
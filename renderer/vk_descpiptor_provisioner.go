@@ -3,31 +3,30 @@ package renderer
 import (
 	com "GPU_fluid_simulation/common"
 	"GPU_fluid_simulation/model"
-	"log"
+	"errors"
+	"fmt"
 
 	vk "github.com/goki/vulkan"
 )
 
 type DescriptorProvisioner struct {
-	device vk.Device
+	device         vk.Device
+	framesInFlight int
 
 	descriptorSetLayout vk.DescriptorSetLayout
 	descriptorPool      vk.DescriptorPool
 	descriptorSets      []vk.DescriptorSet
-
-	modelDescriptorSetLayout vk.DescriptorSetLayout
-	modelDescriptorPool      vk.DescriptorPool
-	modelDescriptorSets      []vk.DescriptorSet
 }
 
-func NewDescriptorProvisioner(device vk.Device) *DescriptorProvisioner {
+func NewDescriptorProvisioner(device vk.Device, framesInFlight int) *DescriptorProvisioner {
 	return &DescriptorProvisioner{
-		device: device,
+		device:         device,
+		framesInFlight: framesInFlight,
 	}
 }
 
 // allocDescriptorSets Allocates a list of descriptor sets of given layout from the stated pool
-func (dp *DescriptorProvisioner) allocDescriptorSets(pool vk.DescriptorPool, layouts []vk.DescriptorSetLayout) []vk.DescriptorSet {
+func (dp *DescriptorProvisioner) allocDescriptorSets(pool vk.DescriptorPool, layouts []vk.DescriptorSetLayout) ([]vk.DescriptorSet, error) {
 	cnt := uint32(len(layouts))
 	allocInfo := vk.DescriptorSetAllocateInfo{
 		SType:              vk.StructureTypeDescriptorSetAllocateInfo,
@@ -39,15 +38,16 @@ func (dp *DescriptorProvisioner) allocDescriptorSets(pool vk.DescriptorPool, lay
 	sets := make([]vk.DescriptorSet, cnt)
 	err := vk.Error(vk.AllocateDescriptorSets(dp.device, &allocInfo, &(sets[0])))
 	if err != nil {
-		log.Panicf("Failed to allocate descriptor sets")
+		return nil, fmt.Errorf("failed to allocate %d descriptor sets: %w", cnt, err)
 	}
-	return sets
+	return sets, nil
 }
 
-func (dp *DescriptorProvisioner) createDescriptorSetLayout() {
+func (dp *DescriptorProvisioner) createDescriptorSetLayout() error {
+	// The uniforms are streamed through the staging ring every frame, their offset in it is given when binding the set
 	uboLayoutBinding := vk.DescriptorSetLayoutBinding{
-		Binding:            0,                              // <- binding index in vert shader
-		DescriptorType:     vk.DescriptorTypeUniformBuffer, // <- type of binding in vert shader
+		Binding:            0,                                     // <- binding index in vert shader
+		DescriptorType:     vk.DescriptorTypeUniformBufferDynamic, // <- type of binding in vert shader
 		DescriptorCount:    1,
 		StageFlags:         vk.ShaderStageFlags(vk.ShaderStageVertexBit),
 		PImmutableSamplers: nil,
@@ -59,24 +59,10 @@ func (dp *DescriptorProvisioner) createDescriptorSetLayout() {
 		StageFlags:         vk.ShaderStageFlags(vk.ShaderStageFragmentBit),
 		PImmutableSamplers: nil,
 	}
-	layoutInfo := vk.DescriptorSetLayoutCreateInfo{
-		SType:        vk.StructureTypeDescriptorSetLayoutCreateInfo,
-		PNext:        nil,
-		Flags:        0,
-		BindingCount: 2,
-		PBindings:    []vk.DescriptorSetLayoutBinding{uboLayoutBinding, textureSamplerLayoutBinding},
-	}
-	dsl, err := com.VKCreateDescriptorSetLayout(dp.device, &layoutInfo, nil)
-	if err != nil {
-		log.Panicf("Failed to create descriptor set layout")
-	}
-	dp.descriptorSetLayout = dsl
-}
-
-func (dp *DescriptorProvisioner) createModelDescriptorSetLayout() {
-	ctxUboLayoutBinding := vk.DescriptorSetLayoutBinding{
-		Binding:            0,                              // <- binding index in vert shader
-		DescriptorType:     vk.DescriptorTypeUniformBuffer, // <- type of binding in vert shader
+	// The per-draw data of batched draws is streamed the same way as the uniforms, see: writeBatchedDraws
+	drawDataLayoutBinding := vk.DescriptorSetLayoutBinding{
+		Binding:            2,
+		DescriptorType:     vk.DescriptorTypeStorageBufferDynamic,
 		DescriptorCount:    1,
 		StageFlags:         vk.ShaderStageFlags(vk.ShaderStageVertexBit),
 		PImmutableSamplers: nil,
@@ -85,71 +71,66 @@ func (dp *DescriptorProvisioner) createModelDescriptorSetLayout() {
 		SType:        vk.StructureTypeDescriptorSetLayoutCreateInfo,
 		PNext:        nil,
 		Flags:        0,
-		BindingCount: 1,
-		PBindings:    []vk.DescriptorSetLayoutBinding{ctxUboLayoutBinding},
+		BindingCount: 3,
+		PBindings:    []vk.DescriptorSetLayoutBinding{uboLayoutBinding, textureSamplerLayoutBinding, drawDataLayoutBinding},
 	}
 	dsl, err := com.VKCreateDescriptorSetLayout(dp.device, &layoutInfo, nil)
 	if err != nil {
-		log.Panicf("Failed to create descriptor set layout")
+		return fmt.Errorf("failed to create descriptor set layout: %w", err)
 	}
-	dp.modelDescriptorSetLayout = dsl
+	dp.descriptorSetLayout = dsl
+	return nil
 }
 
-func (dp *DescriptorProvisioner) createDescriptorPool() {
+func (dp *DescriptorProvisioner) createDescriptorPool() error {
 	uboPoolSize := vk.DescriptorPoolSize{
-		Type:            vk.DescriptorTypeUniformBuffer,
-		DescriptorCount: MAX_FRAMES_IN_FLIGHT,
+		Type:            vk.DescriptorTypeUniformBufferDynamic,
+		DescriptorCount: uint32(dp.framesInFlight),
 	}
 	texSamplerPoolSize := vk.DescriptorPoolSize{
 		Type:            vk.DescriptorTypeCombinedImageSampler,
-		DescriptorCount: MAX_FRAMES_IN_FLIGHT,
+		DescriptorCount: uint32(dp.framesInFlight),
+	}
+	drawDataPoolSize := vk.DescriptorPoolSize{
+		Type:            vk.DescriptorTypeStorageBufferDynamic,
+		DescriptorCount: uint32(dp.framesInFlight),
 	}
 	poolInfo := vk.DescriptorPoolCreateInfo{
 		SType:         vk.StructureTypeDescriptorPoolCreateInfo,
 		PNext:         nil,
 		Flags:         0,
-		MaxSets:       MAX_FRAMES_IN_FLIGHT,
-		PoolSizeCount: 2,
-		PPoolSizes:    []vk.DescriptorPoolSize{uboPoolSize, texSamplerPoolSize},
+		MaxSets:       uint32(dp.framesInFlight),
+		PoolSizeCount: 3,
+		PPoolSizes:    []vk.DescriptorPoolSize{uboPoolSize, texSamplerPoolSize, drawDataPoolSize},
 	}
 	var descp vk.DescriptorPool
 	if vk.CreateDescriptorPool(dp.device, &poolInfo, nil, &descp) != vk.Success {
-		log.Panicf("Failed to create descriptor pool")
+		return errors.New("failed to create descriptor pool")
 	}
 	dp.descriptorPool = descp
+	return nil
 }
 
-func (dp *DescriptorProvisioner) createModelDescriptorPool() {
-	// this should be dynamic somehow
-	modelCount := uint32(4)
-	uboPoolSize := vk.DescriptorPoolSize{
-		Type:            vk.DescriptorTypeUniformBuffer,
-		DescriptorCount: 1,
-	}
-	poolInfo := vk.DescriptorPoolCreateInfo{
-		SType:         vk.StructureTypeDescriptorPoolCreateInfo,
-		PNext:         nil,
-		Flags:         0,
-		MaxSets:       modelCount,
-		PoolSizeCount: 1,
-		PPoolSizes:    []vk.DescriptorPoolSize{uboPoolSize},
+// createDescriptorSets creates one set per frame in flight. All of them point at the same uniform buffer, as each
+// frame's uniforms are selected by a dynamic offset into it. The per-draw data of batched draws is read from the same
+// buffer, drawDataSize bytes at another dynamic offset.
+func (dp *DescriptorProvisioner) createDescriptorSets(ubo *com.Buffer, drawDataSize vk.DeviceSize, textureSampler vk.Sampler, textureImageView vk.ImageView) error {
+
+	// One set per frame in flight, all of the same layout
+	layouts := make([]vk.DescriptorSetLayout, dp.framesInFlight)
+	for i := range layouts {
+		layouts[i] = dp.descriptorSetLayout
 	}
-	var descp vk.DescriptorPool
-	if vk.CreateDescriptorPool(dp.device, &poolInfo, nil, &descp) != vk.Success {
-		log.Panicf("Failed to create descriptor pool")
+	sets, err := dp.allocDescriptorSets(dp.descriptorPool, layouts)
+	if err != nil {
+		return err
 	}
-	dp.modelDescriptorPool = descp
-}
-
-func (dp *DescriptorProvisioner) createDescriptorSets(ubos []vk.Buffer, textureSampler vk.Sampler, textureImageView vk.ImageView) {
-
-	layouts := []vk.DescriptorSetLayout{dp.descriptorSetLayout, dp.descriptorSetLayout, dp.descriptorSetLayout}
-	dp.descriptorSets = dp.allocDescriptorSets(dp.descriptorPool, layouts)
+	dp.descriptorSets = sets
 
-	for i := 0; i < MAX_FRAMES_IN_FLIGHT; i++ {
+	for i := 0; i < dp.framesInFlight; i++ {
 		// ubo
 		bufferInfo := vk.DescriptorBufferInfo{
-			Buffer: ubos[i],
+			Buffer: ubo.Handle,
 			Offset: 0,
 			Range:  model.SizeOfUbo(),
 		}
@@ -160,77 +141,69 @@ func (dp *DescriptorProvisioner) createDescriptorSets(ubos []vk.Buffer, textureS
 			DstBinding:       0,
 			DstArrayElement:  0,
 			DescriptorCount:  1,
-			DescriptorType:   vk.DescriptorTypeUniformBuffer,
+			DescriptorType:   vk.DescriptorTypeUniformBufferDynamic,
 			PImageInfo:       nil,
 			PBufferInfo:      []vk.DescriptorBufferInfo{bufferInfo},
 			PTexelBufferView: nil,
 		}
-
-		// textureSampler
-		texSampler := vk.DescriptorImageInfo{
-			Sampler:     textureSampler,
-			ImageView:   textureImageView,
-			ImageLayout: vk.ImageLayoutShaderReadOnlyOptimal,
-		}
-		texSamplerDescriptorWrite := vk.WriteDescriptorSet{
-			SType:           vk.StructureTypeWriteDescriptorSet,
-			PNext:           nil,
-			DstSet:          dp.descriptorSets[i],
-			DstBinding:      1, // <-- shader binding location, corresponds to 'layout(binding = 1) uniform sampler2D texSampler;'
-			DstArrayElement: 0, // <-- when binding a single texture, this will just be 0 for now. Its the starting index in the binding.
-			// assuming I would push 4 texture samplers I could select where they are placed in the array of the binding
-			// e.g.: 'layout(binding = 1) uniform sampler2D texSampler[4];' -> pushing 2 samplers and setting it to 2
-			// would fill index 2 and 3
-			DescriptorCount:  1,
-			DescriptorType:   vk.DescriptorTypeCombinedImageSampler,
-			PImageInfo:       []vk.DescriptorImageInfo{texSampler},
-			PBufferInfo:      nil,
-			PTexelBufferView: nil,
-		}
-		writes := []vk.WriteDescriptorSet{uboDescriptorWrite, texSamplerDescriptorWrite}
-		vk.UpdateDescriptorSets(dp.device, uint32(len(writes)), writes, 0, nil)
-	}
-}
-
-func (dp *DescriptorProvisioner) createModelDescriptorSets(ctxUbos []vk.Buffer) {
-	// this holds descriptor sets for 3 models, this needs to be dynamic somehow
-	modelCount := uint32(4)
-	layouts := []vk.DescriptorSetLayout{dp.modelDescriptorSetLayout, dp.modelDescriptorSetLayout, dp.modelDescriptorSetLayout, dp.modelDescriptorSetLayout}
-	allocInfo := vk.DescriptorSetAllocateInfo{
-		SType:              vk.StructureTypeDescriptorSetAllocateInfo,
-		PNext:              nil,
-		DescriptorPool:     dp.modelDescriptorPool,
-		DescriptorSetCount: modelCount,
-		PSetLayouts:        layouts,
-	}
-	sets := make([]vk.DescriptorSet, modelCount)
-	err := vk.Error(vk.AllocateDescriptorSets(dp.device, &allocInfo, &(sets[0])))
-	if err != nil {
-		log.Panicf("Failed to allocate descriptor set: %v", err)
-	}
-	log.Printf("%v", sets)
-	dp.modelDescriptorSets = sets
-
-	for i := 0; i < int(modelCount); i++ {
-		// ctxubo
-		ctxBufferInfo := vk.DescriptorBufferInfo{
-			Buffer: ctxUbos[i],
+		drawDataInfo := vk.DescriptorBufferInfo{
+			Buffer: ubo.Handle,
 			Offset: 0,
-			Range:  model.SizeOfCtxUbo(),
+			Range:  drawDataSize,
 		}
-		ctxUboDescriptorWrite := vk.WriteDescriptorSet{
+		drawDataDescriptorWrite := vk.WriteDescriptorSet{
 			SType:            vk.StructureTypeWriteDescriptorSet,
 			PNext:            nil,
-			DstSet:           dp.modelDescriptorSets[i],
-			DstBinding:       0,
+			DstSet:           dp.descriptorSets[i],
+			DstBinding:       2,
 			DstArrayElement:  0,
 			DescriptorCount:  1,
-			DescriptorType:   vk.DescriptorTypeUniformBuffer,
+			DescriptorType:   vk.DescriptorTypeStorageBufferDynamic,
 			PImageInfo:       nil,
-			PBufferInfo:      []vk.DescriptorBufferInfo{ctxBufferInfo},
+			PBufferInfo:      []vk.DescriptorBufferInfo{drawDataInfo},
 			PTexelBufferView: nil,
 		}
-		writes := []vk.WriteDescriptorSet{ctxUboDescriptorWrite}
+		writes := []vk.WriteDescriptorSet{uboDescriptorWrite, drawDataDescriptorWrite}
 		vk.UpdateDescriptorSets(dp.device, uint32(len(writes)), writes, 0, nil)
+		dp.writeTextureDescriptor(i, textureSampler, textureImageView)
 	}
+	return nil
+}
+
+// writeTextureDescriptor points the descriptor set of a frame at another texture. The set must not be in use by a
+// frame in flight, i.e.: the frame's fence has to be signalled.
+func (dp *DescriptorProvisioner) writeTextureDescriptor(frameIdx int, textureSampler vk.Sampler, textureImageView vk.ImageView) {
+	texSampler := vk.DescriptorImageInfo{
+		Sampler:     textureSampler,
+		ImageView:   textureImageView,
+		ImageLayout: vk.ImageLayoutShaderReadOnlyOptimal,
+	}
+	texSamplerDescriptorWrite := vk.WriteDescriptorSet{
+		SType:           vk.StructureTypeWriteDescriptorSet,
+		PNext:           nil,
+		DstSet:          dp.descriptorSets[frameIdx],
+		DstBinding:      1, // <-- shader binding location, corresponds to 'layout(binding = 1) uniform sampler2D texSampler;'
+		DstArrayElement: 0, // <-- when binding a single texture, this will just be 0 for now. Its the starting index in the binding.
+		// assuming I would push 4 texture samplers I could select where they are placed in the array of the binding
+		// e.g.: 'layout(binding = 1) uniform sampler2D texSampler[4];' -> pushing 2 samplers and setting it to 2
+		// would fill index 2 and 3
+		DescriptorCount:  1,
+		DescriptorType:   vk.DescriptorTypeCombinedImageSampler,
+		PImageInfo:       []vk.DescriptorImageInfo{texSampler},
+		PBufferInfo:      nil,
+		PTexelBufferView: nil,
+	}
+	writes := []vk.WriteDescriptorSet{texSamplerDescriptorWrite}
+	vk.UpdateDescriptorSets(dp.device, uint32(len(writes)), writes, 0, nil)
+}
+
+// destroyDescriptorSetLayout destroys the set layout, a layout that was never created is a null handle and ignored
+func (dp *DescriptorProvisioner) destroyDescriptorSetLayout() {
+	vk.DestroyDescriptorSetLayout(dp.device, dp.descriptorSetLayout, nil)
+}
+
+// destroyDescriptorPool destroys the pool, which frees all descriptor sets allocated from it as well
+func (dp *DescriptorProvisioner) destroyDescriptorPool() {
+	vk.DestroyDescriptorPool(dp.device, dp.descriptorPool, nil)
+	dp.descriptorSets = nil
 }
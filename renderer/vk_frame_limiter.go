@@ -0,0 +1,62 @@
+package renderer
+
+import (
+	"runtime"
+	"time"
+)
+
+// FRAME_LIMIT_SPIN_MARGIN is the time before a frame is due at which the limiter stops sleeping and starts spinning.
+// Sleeping is only accurate to about a millisecond (considerably worse on Windows), spinning the rest keeps the frame
+// times even.
+const FRAME_LIMIT_SPIN_MARGIN = 2 * time.Millisecond
+
+// FrameLimiter caps the frame rate on the CPU side, independent of the present mode. This saves power when rendering
+// faster than needed, e.g.: on laptops or with present modes that don't wait for the display.
+type FrameLimiter struct {
+	interval time.Duration
+	next     time.Time
+}
+
+// NewFrameLimiter creates a limiter for the given number of frames per second, 0 disables limiting
+func NewFrameLimiter(maxFps float64) *FrameLimiter {
+	l := &FrameLimiter{}
+	l.SetMaxFPS(maxFps)
+	return l
+}
+
+// SetMaxFPS changes the frame rate limit, 0 disables limiting
+func (l *FrameLimiter) SetMaxFPS(maxFps float64) {
+	l.interval = 0
+	if maxFps > 0 {
+		l.interval = time.Duration(float64(time.Second) / maxFps)
+	}
+	l.next = time.Time{}
+}
+
+// MaxFPS returns the current limit, 0 if limiting is disabled
+func (l *FrameLimiter) MaxFPS() float64 {
+	if l.interval == 0 {
+		return 0
+	}
+	return float64(time.Second) / float64(l.interval)
+}
+
+// Wait blocks until the next frame is due. Frames are scheduled on a fixed grid, so time spent between calls is
+// accounted for. If a frame runs late by more than a whole interval, the schedule restarts instead of rushing through
+// the missed frames.
+func (l *FrameLimiter) Wait() {
+	if l.interval == 0 {
+		return
+	}
+	now := time.Now()
+	if l.next.IsZero() || now.Sub(l.next) > l.interval {
+		l.next = now
+	}
+	if remaining := l.next.Sub(now); remaining > FRAME_LIMIT_SPIN_MARGIN {
+		time.Sleep(remaining - FRAME_LIMIT_SPIN_MARGIN)
+	}
+	for time.Now().Before(l.next) {
+		runtime.Gosched()
+	}
+	l.next = l.next.Add(l.interval)
+}
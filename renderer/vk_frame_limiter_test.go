@@ -0,0 +1,42 @@
+package renderer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFrameLimiterPacesFrames(t *testing.T) {
+	l := NewFrameLimiter(200)
+	start := time.Now()
+	// The first frame is not delayed, each following one is due 5ms after the previous
+	for i := 0; i < 11; i++ {
+		l.Wait()
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Fatalf("expected 10 limited frames to take at least 50ms, took %v", elapsed)
+	}
+}
+
+func TestFrameLimiterDoesNotCatchUp(t *testing.T) {
+	l := NewFrameLimiter(200)
+	l.Wait()
+	// A long frame must not be followed by a burst of frames to make up for it
+	time.Sleep(30 * time.Millisecond)
+	l.Wait()
+	start := time.Now()
+	l.Wait()
+	if elapsed := time.Since(start); elapsed < 4*time.Millisecond {
+		t.Fatalf("expected the frame after a late one to be paced again, took %v", elapsed)
+	}
+}
+
+func TestFrameLimiterDisabled(t *testing.T) {
+	l := NewFrameLimiter(0)
+	start := time.Now()
+	for i := 0; i < 100; i++ {
+		l.Wait()
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Millisecond {
+		t.Fatalf("expected disabled limiter not to wait, took %v", elapsed)
+	}
+}
@@ -0,0 +1,93 @@
+package renderer
+
+import (
+	com "GPU_fluid_simulation/common"
+	"GPU_fluid_simulation/model"
+	"fmt"
+
+	vk "github.com/goki/vulkan"
+)
+
+// These functions are part of the rendering core but are split into their own file for logical separation. Their focus
+// is instanced rendering: a model created with model.NewInstancedModel draws its mesh once per instance with a single
+// draw call, reading each instance's transform and color from an instance buffer. Instances are added, updated and
+// removed through the core and streamed to the device before the next frame, the same way dynamic meshes are.
+
+// INSTANCE_BUFFER_MIN_INSTANCES is the number of instances the instance buffer of a new instanced model has room for,
+// it grows when more are added
+const INSTANCE_BUFFER_MIN_INSTANCES = 64
+
+// AddInstance adds an instance to an instanced model in the scene, it is drawn from the next frame on
+func (c *Core) AddInstance(m *model.Model, inst model.Instance) (model.InstanceHandle, error) {
+	if err := c.checkInstanced(m); err != nil {
+		return 0, err
+	}
+	return m.Instances.Add(inst), nil
+}
+
+// UpdateInstance replaces the transform and color of an instance, the change shows from the next frame on
+func (c *Core) UpdateInstance(m *model.Model, h model.InstanceHandle, inst model.Instance) error {
+	if err := c.checkInstanced(m); err != nil {
+		return err
+	}
+	return m.Instances.Set(h, inst)
+}
+
+// RemoveInstance drops an instance of an instanced model, it is no longer drawn from the next frame on. Handles of the
+// other instances stay valid.
+func (c *Core) RemoveInstance(m *model.Model, h model.InstanceHandle) error {
+	if err := c.checkInstanced(m); err != nil {
+		return err
+	}
+	return m.Instances.Remove(h)
+}
+
+func (c *Core) checkInstanced(m *model.Model) error {
+	if !m.IsInstanced() {
+		return fmt.Errorf("model '%s' is not instanced", m.Name)
+	}
+	if !c.isInScene(m) {
+		return fmt.Errorf("model '%s' is not in the scene", m.Name)
+	}
+	return nil
+}
+
+// createInstanceBuffer creates the instance buffer of an instanced model, with room for all its instances. The
+// instances are not uploaded, see: updateInstances.
+func (c *Core) createInstanceBuffer(m *model.Model) (*com.Buffer, error) {
+	label := m.Name + " instances"
+	buf, err := c.allocator.CreateBuffer(
+		label,
+		vk.DeviceSize(max(m.Instances.Len(), INSTANCE_BUFFER_MIN_INSTANCES)*model.INSTANCE_STRIDE),
+		vk.BufferUsageFlags(vk.BufferUsageTransferDstBit|vk.BufferUsageTransferSrcBit|vk.BufferUsageVertexBufferBit),
+		vk.MemoryPropertyFlags(vk.MemoryPropertyDeviceLocalBit),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create instance buffer of '%s': %w", m.Name, err)
+	}
+	nameObject(c, vk.ObjectTypeBuffer, buf.Handle, label)
+	return buf, nil
+}
+
+// updateInstances streams the instances changed since the last frame into the model's instance buffer, growing it if
+// needed. Like dynamic meshes, changes exceeding the frame's budget are streamed in parts, see: updateDynamicMeshes.
+// Only instances uploaded from the start without a gap are drawn meanwhile.
+func (c *Core) updateInstances(m *model.Model, budget *vk.DeviceSize) error {
+	changed := m.Instances.TakeDirty(c.streamableCount(*budget, model.INSTANCE_STRIDE))
+	if !changed.Empty() {
+		access := vk.AccessFlags(vk.AccessVertexAttributeReadBit)
+		buf, err := c.growBuffer(m.Name+" instances", m.InstanceBuffer, changed.End()*model.INSTANCE_STRIDE, vk.BufferUsageFlags(vk.BufferUsageVertexBufferBit), access)
+		if err != nil {
+			return fmt.Errorf("failed to grow instance buffer of '%s': %w", m.Name, err)
+		}
+		m.InstanceBuffer = buf
+		offset := vk.DeviceSize(changed.First * model.INSTANCE_STRIDE)
+		if err = c.streamToBuffer(buf, offset, m.Instances.GetRangeBytes(changed), vk.PipelineStageFlags(vk.PipelineStageVertexInputBit), access); err != nil {
+			return fmt.Errorf("failed to update instances %v of '%s': %w", changed, m.Name, err)
+		}
+		*budget -= min(*budget, vk.DeviceSize(changed.Count*model.INSTANCE_STRIDE))
+	}
+	// Removed instances are dropped from the end, so no range is streamed for them
+	m.InstanceCount = uint32(m.Instances.Uploaded(changed))
+	return nil
+}
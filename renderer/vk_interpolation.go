@@ -0,0 +1,96 @@
+package renderer
+
+import (
+	"GPU_fluid_simulation/model"
+	vm "local/vector_math"
+)
+
+// interpolationState is the camera and the model transforms as they were before the last update step. Frames are
+// drawn in between this state and the current one, see: drawCamera and drawModelMat. This hides the stutter of moving
+// things in fixed steps while drawing at another rate, at the cost of showing the world up to one step late.
+type interpolationState struct {
+	valid     bool
+	camPos    vm.Vec3
+	camDir    vm.Vec3
+	camUp     vm.Vec3
+	camTarget *vm.Vec3
+	modelMats map[*model.Model]vm.Mat
+}
+
+// snapshotState remembers the current camera and model transforms, it is called right before each update step
+func (c *Core) snapshotState() {
+	s := &c.prevState
+	s.valid = true
+	c.SnapCamera()
+	if s.modelMats == nil {
+		s.modelMats = map[*model.Model]vm.Mat{}
+	}
+	clear(s.modelMats)
+	for _, m := range c.models {
+		c.SnapModel(m)
+	}
+}
+
+// SnapModel makes the model matrix before the last update step the current one, the same way SnapCamera does for the
+// camera. Meant for matrices set outside of the update handler, e.g.: fitting a model to a mesh loaded in the background.
+func (c *Core) SnapModel(m *model.Model) {
+	if c.prevState.modelMats == nil {
+		c.prevState.modelMats = map[*model.Model]vm.Mat{}
+	}
+	mat := make(vm.Mat, len(m.Mesh.ModelMat))
+	for i, row := range m.Mesh.ModelMat {
+		mat[i] = append([]float32{}, row...)
+	}
+	c.prevState.modelMats[m] = mat
+}
+
+// SnapCamera makes the camera's state before the last update step its current one, so it is drawn where it is instead
+// of moving there from its old pose. Meant for teleports outside of the update handler, e.g.: resetting or framing the
+// camera from the draw handler.
+func (c *Core) SnapCamera() {
+	s := &c.prevState
+	s.camPos, s.camDir, s.camUp = c.Cam.Pos, c.Cam.LookDir, c.Cam.Up
+	s.camTarget = nil
+	if c.Cam.LookTarget != nil {
+		target := *c.Cam.LookTarget
+		s.camTarget = &target
+	}
+}
+
+// drawCamera returns a copy of the camera placed between its state before the last update step and now, by the
+// interpolation alpha of the frame
+func (c *Core) drawCamera() *model.Camera {
+	cam := *c.Cam
+	s := &c.prevState
+	if !s.valid {
+		return &cam
+	}
+	cam.Pos = s.camPos.Lerp(c.Cam.Pos, c.alpha)
+	// Directions pointing (almost) opposite to each other have no meaningful halfway point, those snap to now
+	if dir := s.camDir.Lerp(c.Cam.LookDir, c.alpha); dir.Len() > 1e-3 {
+		cam.LookDir = dir.Norm()
+	}
+	if up := s.camUp.Lerp(c.Cam.Up, c.alpha); up.Len() > 1e-3 {
+		cam.Up = up.Norm()
+	}
+	if s.camTarget != nil && c.Cam.LookTarget != nil {
+		target := s.camTarget.Lerp(*c.Cam.LookTarget, c.alpha)
+		cam.LookTarget = &target
+	}
+	return &cam
+}
+
+// drawModelMat returns the model matrix placed between its state before the last update step and now, by the
+// interpolation alpha of the frame. Models added since then are drawn as they are. Safe to call from the record
+// workers, the state is only written between frames.
+func (c *Core) drawModelMat(m *model.Model) vm.Mat {
+	prev, ok := c.prevState.modelMats[m]
+	if !ok {
+		return m.Mesh.ModelMat
+	}
+	mat, err := prev.Lerp(&m.Mesh.ModelMat, c.alpha)
+	if err != nil {
+		return m.Mesh.ModelMat
+	}
+	return mat
+}
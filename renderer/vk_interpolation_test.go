@@ -0,0 +1,45 @@
+package renderer
+
+import (
+	"GPU_fluid_simulation/model"
+	vm "local/vector_math"
+	"reflect"
+	"testing"
+)
+
+func TestSnapCameraSkipsInterpolation(t *testing.T) {
+	c := &Core{Cam: model.NewCamera(45, 0.1, 100)}
+	c.snapshotState()
+	c.Cam.Pos = vm.Vec3{X: 2}
+	c.alpha = 0.5
+	if got := c.drawCamera().Pos; got != (vm.Vec3{X: 1}) {
+		t.Fatalf("expected camera halfway between the update steps, got %v", got)
+	}
+	// A teleport from the draw handler must not be blended with the pose before it
+	c.Cam.Pos = vm.Vec3{X: 10}
+	c.Cam.SetTarget(vm.Vec3{Y: 1})
+	c.SnapCamera()
+	cam := c.drawCamera()
+	if cam.Pos != (vm.Vec3{X: 10}) || cam.LookTarget == nil || *cam.LookTarget != (vm.Vec3{Y: 1}) {
+		t.Fatalf("expected camera drawn at the teleport, got Pos:%v, LookTarget:%v", cam.Pos, cam.LookTarget)
+	}
+}
+
+func TestSnapModelSkipsInterpolation(t *testing.T) {
+	m := model.NewCubeModel("cube")
+	c := &Core{Cam: model.NewCamera(45, 0.1, 100), models: []*model.Model{m}}
+	c.snapshotState()
+	m.Translate(vm.Vec3{X: 4})
+	c.alpha = 0.25
+	want := vm.NewUnitMat(4)
+	want, _ = want.Translate(vm.Vec3{X: 1})
+	if got := c.drawModelMat(m); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected model a quarter of the way to its new position, got %v", got)
+	}
+	// A matrix set between update steps, e.g.: when a loaded mesh is fitted, must not be blended with the old one
+	m.Scale(vm.Vec3{X: 2, Y: 2, Z: 2})
+	c.SnapModel(m)
+	if got := c.drawModelMat(m); !reflect.DeepEqual(got, m.Mesh.ModelMat) {
+		t.Fatalf("expected snapped model drawn with its current matrix, got %v", got)
+	}
+}
@@ -0,0 +1,310 @@
+package renderer
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	vk "github.com/goki/vulkan"
+)
+
+const PROGRAM_NAME = "GPU fluid simulation"
+const WINDOW_WIDTH, WINDOW_HEIGHT int32 = 1280, 720
+
+// DEFAULT_FRAMES_IN_FLIGHT is the number of frames the CPU may record ahead of the GPU. MAX_FRAMES_IN_FLIGHT limits
+// what Options accept, more frames only add latency.
+const DEFAULT_FRAMES_IN_FLIGHT = 3
+const MAX_FRAMES_IN_FLIGHT = 8
+
+// DEFAULT_RECORD_WORKERS is the number of goroutines recording draw commands in parallel, MAX_RECORD_WORKERS limits
+// what Options accept
+const DEFAULT_RECORD_WORKERS = 4
+const MAX_RECORD_WORKERS = 32
+
+// Names of the present modes in Options, see: https://registry.khronos.org/vulkan/specs/1.3-extensions/man/html/VkPresentModeKHR.html
+// If the selected mode is not supported by the surface, FIFO is used, which is the only mode every surface supports.
+var presentModeNames = map[string]vk.PresentMode{
+	"immediate":    vk.PresentModeImmediate,
+	"mailbox":      vk.PresentModeMailbox,
+	"fifo":         vk.PresentModeFifo,
+	"fifo-relaxed": vk.PresentModeFifoRelaxed,
+}
+
+// Names of the surface formats in Options, all of them use the sRGB non-linear color space. If the selected format is
+// not supported by the surface, the first supported one is used.
+var surfaceFormatNames = map[string]vk.Format{
+	"bgra8-srgb":  vk.FormatB8g8r8a8Srgb,
+	"rgba8-srgb":  vk.FormatR8g8b8a8Srgb,
+	"bgra8-unorm": vk.FormatB8g8r8a8Unorm,
+	"rgba8-unorm": vk.FormatR8g8b8a8Unorm,
+}
+
+// Options configures the render core on creation. Use DefaultOptions as a starting point and adjust what is needed.
+// Options can be read from a json file with LoadOptions and overridden from the command line, see RegisterFlags.
+type Options struct {
+	// Title of the window, also shown in the task bar
+	Title string
+	// Initial size of the window in pixels, the window can be resized afterward
+	Width, Height int32
+	// Number of frames recorded ahead of the GPU, between 1 and MAX_FRAMES_IN_FLIGHT
+	FramesInFlight int
+	// Preferred present mode, one of the keys of presentModeNames. Can be changed at runtime with Core.SetPresentMode.
+	PresentMode string
+	// Frame rate limit enforced on the CPU, 0 for no limit. Can be changed at runtime through Core.Limiter.
+	MaxFPS float64
+	// Preferred swap chain format, one of the keys of surfaceFormatNames
+	SurfaceFormat string
+	// Enables the validation layers, which report incorrect use of the Vulkan API. Their messages are logged.
+	Validation       bool
+	ValidationLayers []string
+	// Turns validation errors into failures: initialization and Core.Loop return them as errors. Meant for tests and
+	// CI runs, requires Validation.
+	StrictValidation bool
+	// Color the frame is cleared to before drawing, RGBA in [0, 1]
+	ClearColor [4]float32
+	// Number of goroutines recording the draws of large scenes in parallel, between 1 and MAX_RECORD_WORKERS. With 1
+	// everything is recorded on the render thread.
+	RecordWorkers int
+}
+
+// DefaultOptions returns the options the render core has been developed with
+func DefaultOptions() Options {
+	return Options{
+		Title:          PROGRAM_NAME,
+		Width:          WINDOW_WIDTH,
+		Height:         WINDOW_HEIGHT,
+		FramesInFlight: DEFAULT_FRAMES_IN_FLIGHT,
+		PresentMode:    "mailbox",
+		SurfaceFormat:  "bgra8-srgb",
+		Validation:     true,
+		ValidationLayers: []string{
+			"VK_LAYER_KHRONOS_validation",
+		},
+		ClearColor:    [4]float32{0.01, 0.01, 0.01, 1},
+		RecordWorkers: DEFAULT_RECORD_WORKERS,
+	}
+}
+
+// Validate checks that all options are within their allowed range
+func (o *Options) Validate() error {
+	if o.Width <= 0 || o.Height <= 0 {
+		return fmt.Errorf("window size must be positive, got %dx%d", o.Width, o.Height)
+	}
+	if o.FramesInFlight < 1 || o.FramesInFlight > MAX_FRAMES_IN_FLIGHT {
+		return fmt.Errorf("frames in flight must be between 1 and %d, got %d", MAX_FRAMES_IN_FLIGHT, o.FramesInFlight)
+	}
+	if _, ok := presentModeNames[o.PresentMode]; !ok {
+		return fmt.Errorf("unknown present mode '%s', expected one of %v", o.PresentMode, names(presentModeNames))
+	}
+	if !(o.MaxFPS >= 0) || math.IsInf(o.MaxFPS, 0) {
+		return fmt.Errorf("frame rate limit must be 0 or positive, got %f", o.MaxFPS)
+	}
+	if _, ok := surfaceFormatNames[o.SurfaceFormat]; !ok {
+		return fmt.Errorf("unknown surface format '%s', expected one of %v", o.SurfaceFormat, names(surfaceFormatNames))
+	}
+	if o.Validation && len(o.ValidationLayers) == 0 {
+		return errors.New("validation is enabled but no validation layers are given")
+	}
+	if o.StrictValidation && !o.Validation {
+		return errors.New("strict validation requires validation to be enabled")
+	}
+	if o.RecordWorkers < 1 || o.RecordWorkers > MAX_RECORD_WORKERS {
+		return fmt.Errorf("record workers must be between 1 and %d, got %d", MAX_RECORD_WORKERS, o.RecordWorkers)
+	}
+	for i, c := range o.ClearColor {
+		if c < 0 || c > 1 {
+			return fmt.Errorf("clear color component %d must be in [0, 1], got %f", i, c)
+		}
+	}
+	return nil
+}
+
+// enabledLayers returns the validation layers if validation is enabled, no layers otherwise
+func (o *Options) enabledLayers() []string {
+	if !o.Validation {
+		return nil
+	}
+	return o.ValidationLayers
+}
+
+// surfaceFormat returns the swap chain format selected by SurfaceFormat. Options have to be valid.
+func (o *Options) surfaceFormat() vk.SurfaceFormat {
+	return vk.SurfaceFormat{Format: surfaceFormatNames[o.SurfaceFormat], ColorSpace: vk.ColorSpaceSrgbNonlinear}
+}
+
+// PresentModes returns the names of all present modes accepted by Options and Core.SetPresentMode
+func PresentModes() []string {
+	return names(presentModeNames)
+}
+
+// presentMode returns the present mode selected by PresentMode. Options have to be valid.
+func (o *Options) presentMode() vk.PresentMode {
+	return presentModeNames[o.PresentMode]
+}
+
+// LoadOptions reads options from a json file. The file only needs to contain the options it wants to change, all
+// others keep their default value, e.g.:
+//
+//	{ "Width": 1920, "Height": 1080, "PresentMode": "fifo", "Validation": false }
+func LoadOptions(path string) (Options, error) {
+	opts := DefaultOptions()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return opts, err
+	}
+	if err = json.Unmarshal(b, &opts); err != nil {
+		return opts, fmt.Errorf("failed to decode options '%s': %w", path, err)
+	}
+	if err = opts.Validate(); err != nil {
+		return opts, fmt.Errorf("invalid options in '%s': %w", path, err)
+	}
+	return opts, nil
+}
+
+// SaveOptions writes the options to a json file
+func SaveOptions(path string, opts Options) error {
+	b, err := json.MarshalIndent(opts, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode options: %w", err)
+	}
+	return os.WriteFile(path, b, 0644)
+}
+
+// Command line flags
+// ----------------------------------------------------------------------------------------------------------
+
+// optionFlag describes the command line flag of a single option
+type optionFlag struct {
+	name  string
+	usage string
+	set   func(o *Options, v string) error
+}
+
+// boolOptionFlags may be given without a value, e.g.: -validation is the same as -validation=true
+var boolOptionFlags = map[string]bool{
+	"validation":        true,
+	"strict-validation": true,
+}
+
+var optionFlags = []optionFlag{
+	{"title", "window title", func(o *Options, v string) error {
+		o.Title = v
+		return nil
+	}},
+	{"width", "initial window width in pixels", func(o *Options, v string) error {
+		w, err := strconv.ParseInt(v, 10, 32)
+		o.Width = int32(w)
+		return err
+	}},
+	{"height", "initial window height in pixels", func(o *Options, v string) error {
+		h, err := strconv.ParseInt(v, 10, 32)
+		o.Height = int32(h)
+		return err
+	}},
+	{"frames-in-flight", "number of frames recorded ahead of the GPU", func(o *Options, v string) error {
+		n, err := strconv.Atoi(v)
+		o.FramesInFlight = n
+		return err
+	}},
+	{"present-mode", "preferred present mode, one of " + strings.Join(names(presentModeNames), ", "), func(o *Options, v string) error {
+		o.PresentMode = v
+		return nil
+	}},
+	{"max-fps", "frame rate limit, 0 for no limit", func(o *Options, v string) error {
+		fps, err := strconv.ParseFloat(v, 64)
+		o.MaxFPS = fps
+		return err
+	}},
+	{"surface-format", "preferred surface format, one of " + strings.Join(names(surfaceFormatNames), ", "), func(o *Options, v string) error {
+		o.SurfaceFormat = v
+		return nil
+	}},
+	{"validation", "enable the validation layers (true/false)", func(o *Options, v string) error {
+		b, err := strconv.ParseBool(v)
+		o.Validation = b
+		return err
+	}},
+	{"validation-layers", "comma separated list of validation layers", func(o *Options, v string) error {
+		o.ValidationLayers = nil
+		for _, l := range strings.Split(v, ",") {
+			if l = strings.TrimSpace(l); l != "" {
+				o.ValidationLayers = append(o.ValidationLayers, l)
+			}
+		}
+		return nil
+	}},
+	{"strict-validation", "fail on validation errors (true/false)", func(o *Options, v string) error {
+		b, err := strconv.ParseBool(v)
+		o.StrictValidation = b
+		return err
+	}},
+	{"clear-color", "color the frame is cleared to as 'r,g,b,a' in [0, 1]", func(o *Options, v string) error {
+		parts := strings.Split(v, ",")
+		if len(parts) != len(o.ClearColor) {
+			return fmt.Errorf("expected %d components, got %d", len(o.ClearColor), len(parts))
+		}
+		for i, p := range parts {
+			c, err := strconv.ParseFloat(strings.TrimSpace(p), 32)
+			if err != nil {
+				return err
+			}
+			o.ClearColor[i] = float32(c)
+		}
+		return nil
+	}},
+	{"record-workers", "number of goroutines recording draws in parallel, 1 to record on the render thread only", func(o *Options, v string) error {
+		n, err := strconv.Atoi(v)
+		o.RecordWorkers = n
+		return err
+	}},
+}
+
+// RegisterFlags adds a flag for every option to the flag set. While parsing, the flags are only collected. The
+// returned function applies them to the given options, which allows loading a config file after parsing the command
+// line while still having the flags take precedence over the file.
+func RegisterFlags(fs *flag.FlagSet) func(*Options) error {
+	type setFlag struct {
+		flag  optionFlag
+		value string
+	}
+	var set []setFlag
+	for _, f := range optionFlags {
+		collect := func(v string) error {
+			// Check the value right away, so malformed values are reported by the flag set with the usage
+			if err := f.set(&Options{}, v); err != nil {
+				return err
+			}
+			set = append(set, setFlag{flag: f, value: v})
+			return nil
+		}
+		if boolOptionFlags[f.name] {
+			fs.BoolFunc(f.name, f.usage, collect)
+		} else {
+			fs.Func(f.name, f.usage, collect)
+		}
+	}
+	return func(o *Options) error {
+		for _, s := range set {
+			if err := s.flag.set(o, s.value); err != nil {
+				return fmt.Errorf("invalid value '%s' for flag -%s: %w", s.value, s.flag.name, err)
+			}
+		}
+		return o.Validate()
+	}
+}
+
+// names returns the sorted keys of a name map, used to list the allowed values in messages
+func names[T any](m map[string]T) []string {
+	ns := make([]string, 0, len(m))
+	for n := range m {
+		ns = append(ns, n)
+	}
+	sort.Strings(ns)
+	return ns
+}
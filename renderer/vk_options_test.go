@@ -0,0 +1,110 @@
+package renderer
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDefaultOptionsValid(t *testing.T) {
+	opts := DefaultOptions()
+	if err := opts.Validate(); err != nil {
+		t.Fatalf("expected default options to be valid: %v", err)
+	}
+}
+
+func TestOptionsValidate(t *testing.T) {
+	invalid := map[string]func(o *Options){
+		"zero width":           func(o *Options) { o.Width = 0 },
+		"no frames in flight":  func(o *Options) { o.FramesInFlight = 0 },
+		"too many frames":      func(o *Options) { o.FramesInFlight = MAX_FRAMES_IN_FLIGHT + 1 },
+		"unknown mode":         func(o *Options) { o.PresentMode = "vsync" },
+		"unknown format":       func(o *Options) { o.SurfaceFormat = "rgb565" },
+		"validation no layer":  func(o *Options) { o.ValidationLayers = nil },
+		"strict no validation": func(o *Options) { o.Validation, o.StrictValidation = false, true },
+		"clear color range":    func(o *Options) { o.ClearColor[2] = 1.5 },
+		"no record workers":    func(o *Options) { o.RecordWorkers = 0 },
+	}
+	for name, modify := range invalid {
+		opts := DefaultOptions()
+		modify(&opts)
+		if err := opts.Validate(); err == nil {
+			t.Errorf("%s: expected options to be invalid", name)
+		}
+	}
+	// Without validation the layers are not needed
+	opts := DefaultOptions()
+	opts.Validation = false
+	opts.ValidationLayers = nil
+	if err := opts.Validate(); err != nil {
+		t.Errorf("expected options without validation to be valid: %v", err)
+	}
+}
+
+func TestLoadOptionsKeepsDefaults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "renderer.json")
+	if err := os.WriteFile(path, []byte(`{ "Width": 800, "PresentMode": "fifo" }`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	opts, err := LoadOptions(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	def := DefaultOptions()
+	if opts.Width != 800 || opts.PresentMode != "fifo" {
+		t.Fatalf("expected options from file, got %dpx and '%s'", opts.Width, opts.PresentMode)
+	}
+	if opts.Height != def.Height || opts.FramesInFlight != def.FramesInFlight || opts.ClearColor != def.ClearColor {
+		t.Fatalf("expected options missing in the file to keep their default")
+	}
+
+	if err = os.WriteFile(path, []byte(`{ "FramesInFlight": 0 }`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = LoadOptions(path); err == nil {
+		t.Fatalf("expected invalid options in file to be reported")
+	}
+}
+
+func TestFlagsOverrideFile(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	apply := RegisterFlags(fs)
+	err := fs.Parse([]string{"-width", "640", "-clear-color", "1, 0, 0, 1", "-validation=false"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Options as loaded from a file, only the flags given above may change
+	opts := DefaultOptions()
+	opts.Width = 1920
+	opts.Title = "from file"
+	if err = apply(&opts); err != nil {
+		t.Fatal(err)
+	}
+	if opts.Width != 640 || opts.ClearColor != [4]float32{1, 0, 0, 1} || opts.Validation {
+		t.Fatalf("expected flags to take precedence, got %+v", opts)
+	}
+	if opts.Title != "from file" {
+		t.Fatalf("expected options without flag to be kept, got title '%s'", opts.Title)
+	}
+
+	if err = fs.Parse([]string{"-clear-color", "1,0"}); err == nil {
+		t.Fatalf("expected malformed flag value to be rejected while parsing")
+	}
+}
+
+func TestBoolFlagsWithoutValue(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	apply := RegisterFlags(fs)
+	if err := fs.Parse([]string{"-validation", "-strict-validation", "-width", "640"}); err != nil {
+		t.Fatal(err)
+	}
+	opts := DefaultOptions()
+	opts.Validation = false
+	if err := apply(&opts); err != nil {
+		t.Fatal(err)
+	}
+	if !opts.Validation || !opts.StrictValidation || opts.Width != 640 {
+		t.Fatalf("expected bare bool flags to enable their options, got %+v", opts)
+	}
+}
@@ -0,0 +1,224 @@
+package renderer
+
+import (
+	com "GPU_fluid_simulation/common"
+	"fmt"
+	"log"
+	"runtime"
+	"sync"
+
+	vk "github.com/goki/vulkan"
+)
+
+// RECORD_MIN_MODELS_PER_WORKER is the smallest slice of the model list worth handing to another goroutine. Smaller
+// scenes are recorded by fewer workers, or directly into the primary command buffer on the render thread.
+const RECORD_MIN_MODELS_PER_WORKER = 32
+
+// parallelRecorder records secondary command buffers on worker goroutines, which are executed by the frame's primary
+// command buffer. Command pools must not be used by two threads at once, so every worker owns a pool per frame in
+// flight, reset as a whole once the frame's fence has been waited for.
+//
+// SDL and the render loop are bound to the main thread, which is locked by the main package. The workers never call
+// into SDL and only record into their own command buffers, while the render thread blocks until all of them are done.
+// Each worker is locked to an OS thread of its own for its whole life, so its pools are always used from the same
+// thread, which drivers caching per thread state favor.
+type parallelRecorder struct {
+	dc      *com.Device
+	workers []*recordWorker
+	wg      sync.WaitGroup
+	// Records a job on its worker, recordSecondary outside of tests
+	execute func(w *recordWorker, job recordJob) error
+}
+
+type recordWorker struct {
+	// One pool and secondary command buffer per frame in flight
+	pools   []vk.CommandPool
+	buffers []vk.CommandBuffer
+	jobs    chan recordJob
+}
+
+type recordJob struct {
+	frameIdx    int
+	inheritance vk.CommandBufferInheritanceInfo
+	record      func(cmd vk.CommandBuffer)
+	done        chan<- error
+}
+
+// newParallelRecorder creates the pools and command buffers of all workers on the queue family and starts them
+func newParallelRecorder(dc *com.Device, family uint32, workers int, frames int) (*parallelRecorder, error) {
+	r := &parallelRecorder{dc: dc}
+	r.execute = r.recordSecondary
+	for i := 0; i < workers; i++ {
+		w := &recordWorker{jobs: make(chan recordJob)}
+		r.workers = append(r.workers, w)
+		for f := 0; f < frames; f++ {
+			pool, err := com.VKSCreateCommandPool(dc.D, vk.CommandPoolCreateFlags(vk.CommandPoolCreateTransientBit), family)
+			if err != nil {
+				r.destroy()
+				return nil, fmt.Errorf("failed to create command pool of record worker %d: %w", i, err)
+			}
+			w.pools = append(w.pools, pool)
+			buffers, err := com.VKAllocateCommandBuffersSecondary(dc.D, pool, 1)
+			if err != nil {
+				r.destroy()
+				return nil, fmt.Errorf("failed to allocate command buffer of record worker %d: %w", i, err)
+			}
+			w.buffers = append(w.buffers, buffers[0])
+		}
+	}
+	r.start()
+	return r, nil
+}
+
+// start runs a goroutine per worker, which records the jobs sent to it until destroy
+func (r *parallelRecorder) start() {
+	for _, w := range r.workers {
+		r.wg.Add(1)
+		go r.run(w)
+	}
+}
+
+func (r *parallelRecorder) run(w *recordWorker) {
+	defer r.wg.Done()
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	for job := range w.jobs {
+		job.done <- r.execute(w, job)
+	}
+}
+
+// recordSecondary records a job into the worker's command buffer of the job's frame, continuing the inherited render
+// pass
+func (r *parallelRecorder) recordSecondary(w *recordWorker, job recordJob) error {
+	if err := vk.Error(vk.ResetCommandPool(r.dc.D, w.pools[job.frameIdx], 0)); err != nil {
+		return fmt.Errorf("failed to reset command pool: %w", err)
+	}
+	cmd := w.buffers[job.frameIdx]
+	beginInfo := vk.CommandBufferBeginInfo{
+		SType:            vk.StructureTypeCommandBufferBeginInfo,
+		PNext:            nil,
+		Flags:            vk.CommandBufferUsageFlags(vk.CommandBufferUsageOneTimeSubmitBit | vk.CommandBufferUsageRenderPassContinueBit),
+		PInheritanceInfo: []vk.CommandBufferInheritanceInfo{job.inheritance},
+	}
+	if err := vk.Error(vk.BeginCommandBuffer(cmd, &beginInfo)); err != nil {
+		return fmt.Errorf("failed to begin recording secondary command buffer: %w", err)
+	}
+	job.record(cmd)
+	if err := vk.Error(vk.EndCommandBuffer(cmd)); err != nil {
+		return fmt.Errorf("failed to record secondary command buffer: %w", err)
+	}
+	return nil
+}
+
+// Workers returns the number of workers, the most parts record accepts
+func (r *parallelRecorder) Workers() int {
+	return len(r.workers)
+}
+
+// record runs each part on a worker of its own and waits for all of them. The returned secondary command buffers are in
+// the order of the parts, ready to be executed inside the render pass given by inheritance. The frame's fence has to be
+// signalled, as its command buffers are reset.
+func (r *parallelRecorder) record(frameIdx int, inheritance vk.CommandBufferInheritanceInfo, parts []func(cmd vk.CommandBuffer)) ([]vk.CommandBuffer, error) {
+	if len(parts) > len(r.workers) {
+		return nil, fmt.Errorf("%d parts exceed the %d record workers", len(parts), len(r.workers))
+	}
+	done := make(chan error, len(parts))
+	cmds := make([]vk.CommandBuffer, len(parts))
+	for i, part := range parts {
+		r.workers[i].jobs <- recordJob{frameIdx: frameIdx, inheritance: inheritance, record: part, done: done}
+		cmds[i] = r.workers[i].buffers[frameIdx]
+	}
+	var err error
+	for range parts {
+		if partErr := <-done; partErr != nil && err == nil {
+			err = partErr
+		}
+	}
+	return cmds, err
+}
+
+// destroy stops the workers and destroys their pools, which frees the command buffers. No frame in flight may use
+// them anymore.
+func (r *parallelRecorder) destroy() {
+	for _, w := range r.workers {
+		close(w.jobs)
+	}
+	r.wg.Wait()
+	for _, w := range r.workers {
+		for _, pool := range w.pools {
+			vk.DestroyCommandPool(r.dc.D, pool, nil)
+		}
+	}
+	r.workers = nil
+}
+
+func (c *Core) createParallelRecorder() error {
+	if c.opts.RecordWorkers <= 1 {
+		return nil
+	}
+	var err error
+	c.recorder, err = newParallelRecorder(c.device, *c.device.QFamilies.GraphicsFamily, c.opts.RecordWorkers, c.opts.FramesInFlight)
+	if err != nil {
+		return err
+	}
+	log.Printf("Successfully started %d record workers", c.recorder.Workers())
+	return nil
+}
+
+func (c *Core) destroyParallelRecorder() {
+	if c.recorder != nil {
+		c.recorder.destroy()
+	}
+}
+
+// recordParts returns how many secondary command buffers the draws of the given number of models are split into. At
+// most one means they are recorded inline into the primary command buffer.
+func (c *Core) recordParts(models int) int {
+	if c.recorder == nil {
+		return 1
+	}
+	parts := (models + RECORD_MIN_MODELS_PER_WORKER - 1) / RECORD_MIN_MODELS_PER_WORKER
+	return min(parts, c.recorder.Workers())
+}
+
+// recordSlices splits the visible models into the given number of parts of about the same size, keeping their order
+func recordSlices(visible []int, parts int) [][]int {
+	slices := make([][]int, parts)
+	for p := range slices {
+		slices[p] = visible[p*len(visible)/parts : (p+1)*len(visible)/parts]
+	}
+	return slices
+}
+
+// recordSecondaries splits the visible models into parts recorded in parallel and executes them from the primary
+// command buffer, whose render pass must have been begun with secondary command buffer contents. The first part records
+// the batched draws of the static models as well.
+func (c *Core) recordSecondaries(primary vk.CommandBuffer, imageIdx uint32, visible []int, parts int, batch batchedDraws, pipelineIdx int, uboOffset uint32) error {
+	inheritance := vk.CommandBufferInheritanceInfo{
+		SType:       vk.StructureTypeCommandBufferInheritanceInfo,
+		PNext:       nil,
+		RenderPass:  c.renderPass,
+		Subpass:     0,
+		Framebuffer: c.swapChain.FrameBuffers[imageIdx],
+	}
+	slices := recordSlices(visible, parts)
+	funcs := make([]func(cmd vk.CommandBuffer), parts)
+	for p := range funcs {
+		slice := slices[p]
+		first := p == 0
+		funcs[p] = func(cmd vk.CommandBuffer) {
+			c.recordPassState(cmd, pipelineIdx)
+			bound := pipelineIdx
+			if first && c.recordBatchedDraws(cmd, batch, pipelineIdx, uboOffset) {
+				bound = PIPELINE_BATCHED + pipelineIdx
+			}
+			c.recordModelDraws(cmd, slice, pipelineIdx, bound, uboOffset, batch.dataOffset)
+		}
+	}
+	cmds, err := c.recorder.record(int(c.currentFrameIdx), inheritance, funcs)
+	if err != nil {
+		return fmt.Errorf("failed to record draws in parallel: %w", err)
+	}
+	vk.CmdExecuteCommands(primary, uint32(len(cmds)), cmds)
+	return nil
+}
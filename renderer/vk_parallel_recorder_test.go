@@ -0,0 +1,158 @@
+package renderer
+
+import (
+	"GPU_fluid_simulation/model"
+	"errors"
+	vm "local/vector_math"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+	"unsafe"
+
+	vk "github.com/goki/vulkan"
+)
+
+// fakeRecorder returns a recorder whose workers record jobs by running the part on a stand-in command buffer, which is
+// never dereferenced. Workers are not started yet, so execute can still be replaced.
+func fakeRecorder(workers int, frames int) *parallelRecorder {
+	handles := make([]byte, workers*frames)
+	r := &parallelRecorder{}
+	for i := 0; i < workers; i++ {
+		w := &recordWorker{jobs: make(chan recordJob)}
+		for f := 0; f < frames; f++ {
+			w.buffers = append(w.buffers, vk.CommandBuffer(unsafe.Pointer(&handles[i*frames+f])))
+		}
+		r.workers = append(r.workers, w)
+	}
+	r.execute = func(w *recordWorker, job recordJob) error {
+		job.record(w.buffers[job.frameIdx])
+		return nil
+	}
+	return r
+}
+
+// TestRecordLargeSceneInParts splits a scene above the threshold into parts and records them through the workers, each
+// reading the draw state of its models
+func TestRecordLargeSceneInParts(t *testing.T) {
+	const modelCount = 4*RECORD_MIN_MODELS_PER_WORKER + 1
+	c := &Core{recorder: fakeRecorder(4, 1)}
+	c.recorder.start()
+	defer c.recorder.destroy()
+	visible := make([]int, modelCount)
+	for i := range visible {
+		m := model.NewModel(model.NewMesh(make([]model.Vertex, 3), []uint32{0, 1, 2}), "model")
+		m.Translate(vm.Vec3{X: float32(i)})
+		c.models = append(c.models, m)
+		visible[i] = i
+	}
+
+	parts := c.recordParts(len(visible))
+	if parts != 4 {
+		t.Fatalf("expected %d models to be recorded by all 4 workers, got %d parts", modelCount, parts)
+	}
+	slices := recordSlices(visible, parts)
+	recorded := make([][]model.ModelPushConstants, parts)
+	received := make([]vk.CommandBuffer, parts)
+	funcs := make([]func(cmd vk.CommandBuffer), parts)
+	for p := range funcs {
+		funcs[p] = func(cmd vk.CommandBuffer) {
+			received[p] = cmd
+			for _, i := range slices[p] {
+				recorded[p] = append(recorded[p], c.modelConstants(i))
+			}
+		}
+	}
+	cmds, err := c.recorder.record(0, vk.CommandBufferInheritanceInfo{}, funcs)
+	if err != nil {
+		t.Fatalf("expected recording to succeed: %v", err)
+	}
+
+	next := 0
+	for p := range recorded {
+		if received[p] != cmds[p] || cmds[p] != c.recorder.workers[p].buffers[0] {
+			t.Fatalf("expected part %d to be recorded into worker %d's buffer", p, p)
+		}
+		if len(recorded[p]) < RECORD_MIN_MODELS_PER_WORKER {
+			t.Fatalf("expected part %d to hold at least %d models, got %d", p, RECORD_MIN_MODELS_PER_WORKER, len(recorded[p]))
+		}
+		for _, pc := range recorded[p] {
+			if pc.ModelType != uint32(next) || !reflect.DeepEqual(pc.Model, c.models[next].Mesh.ModelMat) {
+				t.Fatalf("expected model %d to be recorded next, got type %d with matrix %v", next, pc.ModelType, pc.Model)
+			}
+			next++
+		}
+	}
+	if next != modelCount {
+		t.Fatalf("expected all %d models to be recorded once, got %d", modelCount, next)
+	}
+}
+
+// TestParallelRecorderRunsPartsOnWorkers drives record through the worker goroutines, see: fakeRecorder
+func TestParallelRecorderRunsPartsOnWorkers(t *testing.T) {
+	const workers, frames, frameIdx = 3, 2, 1
+	failing := errors.New("part failed")
+	r := fakeRecorder(workers, frames)
+	var failOn vk.CommandBuffer
+	r.execute = func(w *recordWorker, job recordJob) error {
+		cmd := w.buffers[job.frameIdx]
+		job.record(cmd)
+		if cmd == failOn {
+			return failing
+		}
+		return nil
+	}
+	r.start()
+
+	var mu sync.Mutex
+	runs := make([]int, workers)
+	received := make([]vk.CommandBuffer, workers)
+	// Every part waits for all others to start, which only returns if each of them runs on a goroutine of its own
+	var started sync.WaitGroup
+	started.Add(workers)
+	parts := make([]func(cmd vk.CommandBuffer), workers)
+	for p := range parts {
+		parts[p] = func(cmd vk.CommandBuffer) {
+			mu.Lock()
+			runs[p]++
+			received[p] = cmd
+			mu.Unlock()
+			started.Done()
+			started.Wait()
+		}
+	}
+	var cmds []vk.CommandBuffer
+	var err error
+	recorded := make(chan struct{})
+	go func() {
+		cmds, err = r.record(frameIdx, vk.CommandBufferInheritanceInfo{}, parts)
+		close(recorded)
+	}()
+	select {
+	case <-recorded:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected parts to run on workers in parallel, recording did not finish")
+	}
+	if err != nil {
+		t.Fatalf("expected recording to succeed: %v", err)
+	}
+	for p := range parts {
+		if runs[p] != 1 {
+			t.Fatalf("expected part %d to run once, ran %d times", p, runs[p])
+		}
+		want := r.workers[p].buffers[frameIdx]
+		if received[p] != want || cmds[p] != want {
+			t.Fatalf("expected part %d to be recorded into and returned as worker %d's buffer of frame %d", p, p, frameIdx)
+		}
+	}
+
+	failOn = r.workers[1].buffers[frameIdx]
+	noop := func(cmd vk.CommandBuffer) {}
+	if _, err = r.record(frameIdx, vk.CommandBufferInheritanceInfo{}, []func(cmd vk.CommandBuffer){noop, noop}); !errors.Is(err, failing) {
+		t.Fatalf("expected the error of the failing part, got %v", err)
+	}
+	if _, err = r.record(frameIdx, vk.CommandBufferInheritanceInfo{}, make([]func(cmd vk.CommandBuffer), workers+1)); err == nil {
+		t.Fatalf("expected more parts than workers to be rejected")
+	}
+	r.destroy()
+}
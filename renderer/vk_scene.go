@@ -3,10 +3,11 @@ package renderer
 import (
 	com "GPU_fluid_simulation/common"
 	"GPU_fluid_simulation/model"
+	"GPU_fluid_simulation/stl"
 	"fmt"
-	vk "github.com/goki/vulkan"
 	vm "local/vector_math"
 	"log"
+	"slices"
 )
 
 // These functions are part of the rendering core but are split into their own file for logical separation. Their
@@ -29,21 +30,197 @@ func (c *Core) FindInScene(name string) (*model.Model, error) {
 	return nil, fmt.Errorf("model '%s' not found", name)
 }
 
-func (c *Core) AddToScene(m *model.Model) {
+// SceneBounds returns the world space bounds enclosing every model currently in the scene
+func (c *Core) SceneBounds() (model.Bounds, error) {
+	if len(c.models) == 0 {
+		return model.Bounds{}, fmt.Errorf("scene is empty")
+	}
+	bs := make([]model.Bounds, len(c.models))
+	for i := range c.models {
+		bs[i] = c.models[i].WorldBounds()
+	}
+	return model.MergeBounds(bs...), nil
+}
+
+// AddToScene queues uploading the model's vertex and index data to the device and adds it to the scene right away. The
+// upload runs on the transfer queue without stalling rendering, the model is drawn once it has finished (see:
+// FrameStats.Pending). Instanced models get an instance buffer as well, see: AddInstance. If either upload can not be
+// queued, the model is left untouched and not added. The scene holds any number of models, none of them needs a
+// descriptor set of its own, see: model.ModelPushConstants.
+func (c *Core) AddToScene(m *model.Model) error {
+	var instBuf *com.Buffer
+	if m.IsInstanced() {
+		var err error
+		if instBuf, err = c.createInstanceBuffer(m); err != nil {
+			return err
+		}
+	}
+	vBuf, idxBuf, uploads, err := c.uploadMesh(m)
+	if err != nil {
+		if instBuf != nil {
+			com.DestroyBuffer(c.device, instBuf)
+		}
+		return err
+	}
 
 	// Careful, we set references for device memory on an object outside the Core.
 	// If the object is dereferenced we will not be able to recover this memory
-	m.VertexBuffer, m.VertexBufferMem = c.allocateVBuffer(m)
-	m.IndexBuffer, m.IndexBufferMem = c.allocateIdxBuffer(m)
+	m.VertexBuffer, m.IndexBuffer = vBuf, idxBuf
+	// Everything is part of the initial upload
+	m.TakeDirty()
+	m.IndicesUploaded(model.AllOf(len(m.Mesh.VIndices)))
+	if instBuf != nil {
+		// Instances are streamed once the mesh is uploaded, see: updateDynamicMeshes
+		m.InstanceBuffer, m.InstanceCount = instBuf, 0
+		m.Instances.MarkAllDirty()
+	}
+	c.pendingUploads[m] = uploads
 	c.models = append(c.models, m)
+	return nil
+}
+
+// uploadMesh creates the vertex and index buffer of the model and queues their uploads. On failure no buffer is left.
+func (c *Core) uploadMesh(m *model.Model) (*com.Buffer, *com.Buffer, []*com.Upload, error) {
+	vBuf, vUp, err := c.allocateVBuffer(m)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to upload vertices of '%s': %w", m.Name, err)
+	}
+	idxBuf, idxUp, err := c.allocateIdxBuffer(m)
+	if err != nil {
+		// Nothing has been submitted yet, the cancelled upload is dropped on the next flush
+		c.uploads.Cancel(vUp)
+		com.DestroyBuffer(c.device, vBuf)
+		return nil, nil, nil, fmt.Errorf("failed to upload indices of '%s': %w", m.Name, err)
+	}
+	return vBuf, idxBuf, []*com.Upload{vUp, idxUp}, nil
+}
+
+// meshSwap is a loaded mesh replacing the one of a model in the scene, once its buffers are uploaded
+type meshSwap struct {
+	model        *model.Model
+	mesh         *model.Mesh
+	vBuf, idxBuf *com.Buffer
+	uploads      []*com.Upload
+	removed      bool
+}
+
+// LoadMesh replaces the mesh of a model in the scene with the one read from the STL file at path. The file is parsed
+// in the background, until the new mesh is uploaded the model keeps drawing its current mesh, e.g.: a placeholder cube.
+// The model matrix carries over to the new mesh. onLoaded may be nil, otherwise it is called on the render thread
+// right after the swap, e.g.: to fit the model to the new mesh's bounds. The matrix it sets is drawn right away instead
+// of being interpolated from the old one, see: SnapModel.
+func (c *Core) LoadMesh(m *model.Model, path string, onLoaded func(*model.Model)) *Asset {
+	var mesh *model.Mesh
+	var swap *meshSwap
+	load := func(a *Asset) error {
+		var err error
+		mesh, err = stl.ReadStl(path, a.SetProgress)
+		return err
+	}
+	upload := func() error {
+		if !c.isInScene(m) {
+			return fmt.Errorf("model '%s' was removed from the scene", m.Name)
+		}
+		if m.Static {
+			return fmt.Errorf("mesh of static model '%s' can not be replaced", m.Name)
+		}
+		vBuf, idxBuf, uploads, err := c.uploadMesh(model.NewModel(mesh, m.Name))
+		if err != nil {
+			return err
+		}
+		swap = &meshSwap{model: m, mesh: mesh, vBuf: vBuf, idxBuf: idxBuf, uploads: uploads}
+		c.meshSwaps = append(c.meshSwaps, swap)
+		return nil
+	}
+	ready := func() (bool, error) {
+		if swap.removed {
+			return false, fmt.Errorf("model '%s' was removed from the scene", m.Name)
+		}
+		return c.canSwapMesh(swap), nil
+	}
+	apply := func() {
+		c.swapMesh(swap)
+		if onLoaded != nil {
+			onLoaded(m)
+			// The swap runs between update steps, the matrix set for the new mesh is drawn right away
+			c.SnapModel(m)
+		}
+	}
+	return c.loader.Load(fmt.Sprintf("%s (%s)", m.Name, path), load, upload, ready, apply)
+}
+
+// canSwapMesh reports whether the new mesh and buffers are uploaded and all swaps of the same model requested before
+// are done
+func (c *Core) canSwapMesh(s *meshSwap) bool {
+	for _, other := range c.meshSwaps {
+		if other == s {
+			break
+		}
+		if other.model == s.model {
+			return false
+		}
+	}
+	for _, up := range s.uploads {
+		if !up.Done() {
+			return false
+		}
+	}
+	return true
+}
+
+// swapMesh replaces the model's mesh and buffers, canSwapMesh has to report true. The replaced buffers are retired, as
+// frames in flight may still draw them.
+func (c *Core) swapMesh(s *meshSwap) {
+	idx := slices.Index(c.meshSwaps, s)
+	m := s.model
+	c.cancelUploads(m)
+	vBuf, idxBuf := m.VertexBuffer, m.IndexBuffer
+	c.retire(func() {
+		com.DestroyBuffer(c.device, vBuf)
+		com.DestroyBuffer(c.device, idxBuf)
+	})
+	s.mesh.ModelMat = m.Mesh.ModelMat
+	m.Mesh, m.VertexBuffer, m.IndexBuffer = s.mesh, s.vBuf, s.idxBuf
+	// Edits marked on the replaced mesh do not apply to the new one
+	m.TakeDirty()
+	m.IndicesUploaded(model.AllOf(len(s.mesh.VIndices)))
+	c.meshSwaps = append(c.meshSwaps[:idx], c.meshSwaps[idx+1:]...)
 }
 
-// ClearScene gracefully removes one object at a time expecting the RemoveFromScene function to never fail
-func (c *Core) ClearScene() {
+// dropMeshSwaps destroys the buffers of meshes loaded for a model that is removed, the device has to be idle
+func (c *Core) dropMeshSwaps(m *model.Model) {
+	remaining := c.meshSwaps[:0]
+	for _, s := range c.meshSwaps {
+		if s.model != m {
+			remaining = append(remaining, s)
+			continue
+		}
+		c.uploads.Cancel(s.uploads...)
+		com.DestroyBuffer(c.device, s.vBuf)
+		com.DestroyBuffer(c.device, s.idxBuf)
+		s.removed = true
+	}
+	c.meshSwaps = remaining
+}
+
+func (c *Core) isInScene(m *model.Model) bool {
+	for _, v := range c.models {
+		if v == m {
+			return true
+		}
+	}
+	return false
+}
+
+// ClearScene gracefully removes one object at a time, stopping at the first model that can not be removed
+func (c *Core) ClearScene() error {
 	log.Printf("Clear scene")
 	for i := len(c.models) - 1; i >= 0; i-- {
-		c.RemoveFromScene(c.models[i])
+		if err := c.RemoveFromScene(c.models[i]); err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
 // ClearSceneForced clears the scene from any objects still in the model list, freeing everything it can.
@@ -53,9 +230,12 @@ func (c *Core) ClearSceneForced() {
 	for i := len(c.models) - 1; i >= 0; i-- {
 		err := com.VKDeviceWaitIdle(c.device.D)
 		if err != nil {
-			log.Panicf("Failed to wait on device idle to forcefully clear scene: %v", err)
+			log.Printf("Failed to wait on device idle to forcefully clear scene, freeing anyway: %v", err)
 		}
+		c.cancelUploads(c.models[i])
+		c.dropMeshSwaps(c.models[i])
 		c.DestroyModelBuffers(c.models[i])
+		c.Animator.Remove(c.models[i])
 		c.models[i] = nil
 	}
 	c.models = c.models[:0]
@@ -63,7 +243,7 @@ func (c *Core) ClearSceneForced() {
 
 // RemoveFromScene drops the reference to a model found in the scene.
 // Comparison is done naively by name until more sophisticated methods are required.
-func (c *Core) RemoveFromScene(model *model.Model) {
+func (c *Core) RemoveFromScene(model *model.Model) error {
 	idx := -1
 	for i, v := range c.models {
 		if v.Name == model.Name {
@@ -74,22 +254,37 @@ func (c *Core) RemoveFromScene(model *model.Model) {
 	}
 	if idx == -1 {
 		log.Printf("Unable to find model to remove '%s'", model.Name)
-		return
+		return nil
 	}
 	err := com.VKDeviceWaitIdle(c.device.D)
 	if err != nil {
-		log.Panicf("Failed to wait on device idle remove model: %v", err)
+		return fmt.Errorf("failed to wait on device idle to remove model '%s': %w", model.Name, err)
 	}
+	c.cancelUploads(c.models[idx])
+	c.dropMeshSwaps(c.models[idx])
 	c.DestroyModelBuffers(model)
+	c.Animator.Remove(c.models[idx])
 	// Generic delete from slice: https://go.dev/wiki/SliceTricks
 	c.models[idx] = c.models[len(c.models)-1]
 	c.models[len(c.models)-1] = nil
 	c.models = c.models[:len(c.models)-1]
+	return nil
 }
 
+// DestroyModelBuffers releases the model's device buffers, returning their memory to the allocator. Static models return
+// their ranges to the mesh pools.
 func (c *Core) DestroyModelBuffers(model *model.Model) {
-	vk.DestroyBuffer(c.device.D, model.VertexBuffer, nil)
-	vk.FreeMemory(c.device.D, model.VertexBufferMem, nil)
-	vk.DestroyBuffer(c.device.D, model.IndexBuffer, nil)
-	vk.FreeMemory(c.device.D, model.IndexBufferMem, nil)
+	c.releasePooled(model)
+	if model.VertexBuffer != nil {
+		com.DestroyBuffer(c.device, model.VertexBuffer)
+		model.VertexBuffer = nil
+	}
+	if model.IndexBuffer != nil {
+		com.DestroyBuffer(c.device, model.IndexBuffer)
+		model.IndexBuffer = nil
+	}
+	if model.InstanceBuffer != nil {
+		com.DestroyBuffer(c.device, model.InstanceBuffer)
+		model.InstanceBuffer = nil
+	}
 }
@@ -2,6 +2,7 @@ package renderer
 
 import (
 	"GPU_fluid_simulation/common"
+	"fmt"
 	vk "github.com/goki/vulkan"
 	"log"
 	"os"
@@ -10,8 +11,11 @@ import (
 // LoadVert reads a '.spv' file with the expectation of it containing a vertex shader for later use in a
 // render pipeline. For this, a shader module (containing the shader code) and its vk.PipelineShaderStageCreateInfo
 // is returned. Which is required to bind the shader to the pipeline.
-func LoadVert(d vk.Device, path string) (vk.ShaderModule, vk.PipelineShaderStageCreateInfo) {
-	vertMod := readShaderCode(d, path)
+func LoadVert(d vk.Device, path string) (vk.ShaderModule, vk.PipelineShaderStageCreateInfo, error) {
+	vertMod, err := readShaderCode(d, path)
+	if err != nil {
+		return nil, vk.PipelineShaderStageCreateInfo{}, err
+	}
 	log.Printf("Created vertex shader module: %v", vertMod)
 
 	vertexShaderStageInfo := vk.PipelineShaderStageCreateInfo{
@@ -23,14 +27,17 @@ func LoadVert(d vk.Device, path string) (vk.ShaderModule, vk.PipelineShaderStage
 		PName:               "main\x00", // entrypoint -> function name in the shader
 		PSpecializationInfo: nil,
 	}
-	return vertMod, vertexShaderStageInfo
+	return vertMod, vertexShaderStageInfo, nil
 }
 
 // LoadFrag reads a '.spv' file with the expectation of it containing a fragment shader for later use in a
 // render pipeline. For this, a shader module (containing the shader code) and its vk.PipelineShaderStageCreateInfo
 // is returned. Which is required to bind the shader to the pipeline.
-func LoadFrag(d vk.Device, path string) (vk.ShaderModule, vk.PipelineShaderStageCreateInfo) {
-	fragMod := readShaderCode(d, path)
+func LoadFrag(d vk.Device, path string) (vk.ShaderModule, vk.PipelineShaderStageCreateInfo, error) {
+	fragMod, err := readShaderCode(d, path)
+	if err != nil {
+		return nil, vk.PipelineShaderStageCreateInfo{}, err
+	}
 	log.Printf("Created fragment shader module: %v", fragMod)
 
 	fragmentShaderStageInfo := vk.PipelineShaderStageCreateInfo{
@@ -42,7 +49,7 @@ func LoadFrag(d vk.Device, path string) (vk.ShaderModule, vk.PipelineShaderStage
 		PName:               "main\x00", // entrypoint -> function name in the shader
 		PSpecializationInfo: nil,
 	}
-	return fragMod, fragmentShaderStageInfo
+	return fragMod, fragmentShaderStageInfo, nil
 }
 
 // DeleteShaderMod discards a shader module. As vk.ShaderModule is only meant as a container to move the shader code
@@ -51,11 +58,11 @@ func DeleteShaderMod(d vk.Device, mod vk.ShaderModule) {
 	vk.DestroyShaderModule(d, mod, nil)
 }
 
-func readShaderCode(d vk.Device, shaderFile string) vk.ShaderModule {
+func readShaderCode(d vk.Device, shaderFile string) (vk.ShaderModule, error) {
 	shaderCodeB, err := os.ReadFile(shaderFile)
 	shaderCodeLen := uint64(len(shaderCodeB))
 	if err != nil {
-		log.Panicf("Failed to read shader file: '%s' due to: %v", shaderFile, err)
+		return nil, fmt.Errorf("failed to read shader file '%s': %w", shaderFile, err)
 	}
 	log.Printf("Read shader file (%s) of size: %dByte", shaderFile, shaderCodeLen)
 
@@ -68,7 +75,7 @@ func readShaderCode(d vk.Device, shaderFile string) vk.ShaderModule {
 	}
 	module, err := common.VKCreateShaderModule(d, createInfo, nil)
 	if err != nil {
-		log.Panicf("Failed to create shader module: '%s'", shaderFile)
+		return nil, fmt.Errorf("failed to create shader module '%s': %w", shaderFile, err)
 	}
-	return module
+	return module, nil
 }
@@ -0,0 +1,258 @@
+package renderer
+
+import (
+	com "GPU_fluid_simulation/common"
+	"GPU_fluid_simulation/model"
+	"fmt"
+	"log"
+
+	vk "github.com/goki/vulkan"
+)
+
+// These functions stream data to the device through the staging ring. The data is copied into the ring right away and
+// the copy to its destination is recorded into the next frame's command buffer, before its render pass. Nothing is
+// allocated per call, so this is meant for data changing every frame. Streaming is possible from the update and draw
+// handlers of Loop, or before the loop starts. Data has to fit into the ring's region of the frame, see:
+// STAGING_RING_FRAME_SIZE. Dynamic meshes are split into parts that do, see: updateDynamicMeshes.
+
+// streamToBuffer copies data into dst at dstOffset. dst needs vk.BufferUsageTransferDstBit and is used in dstStage with
+// dstAccess, e.g.: vertex input and vertex attribute read for vertex buffers. Frames recorded before are done using
+// the old contents by the time the copy runs.
+func (c *Core) streamToBuffer(dst *com.Buffer, dstOffset vk.DeviceSize, data []byte, dstStage vk.PipelineStageFlags, dstAccess vk.AccessFlags) error {
+	if dstOffset+vk.DeviceSize(len(data)) > dst.Size {
+		return fmt.Errorf("%d bytes at offset %d exceed buffer of %d bytes", len(data), dstOffset, dst.Size)
+	}
+	srcOffset, err := c.ring.Write(data, c.device.PdProps.Limits.OptimalBufferCopyOffsetAlignment)
+	if err != nil {
+		return err
+	}
+	size := vk.DeviceSize(len(data))
+	c.streamCopies = append(c.streamCopies, func(cmd vk.CommandBuffer) {
+		// Earlier frames reading the range have to finish before it is overwritten, the copy has to finish before this
+		// frame reads it
+		before := bufferBarrier(dst, dstOffset, size, dstAccess, vk.AccessFlags(vk.AccessTransferWriteBit))
+		vk.CmdPipelineBarrier(cmd, dstStage, vk.PipelineStageFlags(vk.PipelineStageTransferBit), 0, 0, nil, 1, []vk.BufferMemoryBarrier{before}, 0, nil)
+		region := vk.BufferCopy{SrcOffset: srcOffset, DstOffset: dstOffset, Size: size}
+		vk.CmdCopyBuffer(cmd, c.ring.Buffer.Handle, dst.Handle, 1, []vk.BufferCopy{region})
+		after := bufferBarrier(dst, dstOffset, size, vk.AccessFlags(vk.AccessTransferWriteBit), dstAccess)
+		vk.CmdPipelineBarrier(cmd, vk.PipelineStageFlags(vk.PipelineStageTransferBit), dstStage, 0, 0, nil, 1, []vk.BufferMemoryBarrier{after}, 0, nil)
+	})
+	return nil
+}
+
+func bufferBarrier(buf *com.Buffer, offset vk.DeviceSize, size vk.DeviceSize, srcAccess vk.AccessFlags, dstAccess vk.AccessFlags) vk.BufferMemoryBarrier {
+	return vk.BufferMemoryBarrier{
+		SType:               vk.StructureTypeBufferMemoryBarrier,
+		PNext:               nil,
+		SrcAccessMask:       srcAccess,
+		DstAccessMask:       dstAccess,
+		SrcQueueFamilyIndex: vk.QueueFamilyIgnored,
+		DstQueueFamilyIndex: vk.QueueFamilyIgnored,
+		Buffer:              buf.Handle,
+		Offset:              offset,
+		Size:                size,
+	}
+}
+
+// UpdateTexture overwrites a w x h rectangle of the current texture at (x, y) with tightly packed RGBA pixels. The
+// update shows from the next frame on. A texture loaded with LoadTexture replaces the updated one once it is ready,
+// updates still pending by then go to the loaded texture, or are dropped if they do not fit into it.
+func (c *Core) UpdateTexture(x uint32, y uint32, w uint32, h uint32, pixels []byte) error {
+	if x+w > c.textureExtent.Width || y+h > c.textureExtent.Height {
+		return fmt.Errorf(
+			"rectangle %dx%d at (%d, %d) exceeds texture of %dx%d", w, h, x, y, c.textureExtent.Width, c.textureExtent.Height,
+		)
+	}
+	if len(pixels) != int(w*h*4) {
+		return fmt.Errorf("expected %d bytes for %dx%d RGBA pixels, got %d", w*h*4, w, h, len(pixels))
+	}
+	// Buffer offsets of image copies have to be a multiple of the texel size as well
+	alignment := max(c.device.PdProps.Limits.OptimalBufferCopyOffsetAlignment, 4)
+	srcOffset, err := c.ring.Write(pixels, alignment)
+	if err != nil {
+		return err
+	}
+	// The texture is resolved once the copy is recorded, it may have been switched and its image retired until then
+	c.streamCopies = append(c.streamCopies, func(cmd vk.CommandBuffer) {
+		if x+w > c.textureExtent.Width || y+h > c.textureExtent.Height {
+			log.Printf("Dropped update of %dx%d at (%d, %d) not fitting into texture %s", w, h, x, y, c.textureName)
+			return
+		}
+		img := c.textureImage
+		toTransferDst := textureBarrier(img, vk.ImageLayoutShaderReadOnlyOptimal, vk.ImageLayoutTransferDstOptimal)
+		toTransferDst.SrcAccessMask = vk.AccessFlags(vk.AccessShaderReadBit)
+		toTransferDst.DstAccessMask = vk.AccessFlags(vk.AccessTransferWriteBit)
+		vk.CmdPipelineBarrier(
+			cmd,
+			vk.PipelineStageFlags(vk.PipelineStageFragmentShaderBit), vk.PipelineStageFlags(vk.PipelineStageTransferBit),
+			0,
+			0, nil,
+			0, nil,
+			1, []vk.ImageMemoryBarrier{toTransferDst},
+		)
+		region := vk.BufferImageCopy{
+			BufferOffset:      srcOffset,
+			BufferRowLength:   0,
+			BufferImageHeight: 0,
+			ImageSubresource: vk.ImageSubresourceLayers{
+				AspectMask:     vk.ImageAspectFlags(vk.ImageAspectColorBit),
+				MipLevel:       0,
+				BaseArrayLayer: 0,
+				LayerCount:     1,
+			},
+			ImageOffset: vk.Offset3D{X: int32(x), Y: int32(y), Z: 0},
+			ImageExtent: vk.Extent3D{Width: w, Height: h, Depth: 1},
+		}
+		vk.CmdCopyBufferToImage(cmd, c.ring.Buffer.Handle, img, vk.ImageLayoutTransferDstOptimal, 1, []vk.BufferImageCopy{region})
+		toShaderRead := textureBarrier(img, vk.ImageLayoutTransferDstOptimal, vk.ImageLayoutShaderReadOnlyOptimal)
+		toShaderRead.SrcAccessMask = vk.AccessFlags(vk.AccessTransferWriteBit)
+		toShaderRead.DstAccessMask = vk.AccessFlags(vk.AccessShaderReadBit)
+		vk.CmdPipelineBarrier(
+			cmd,
+			vk.PipelineStageFlags(vk.PipelineStageTransferBit), vk.PipelineStageFlags(vk.PipelineStageFragmentShaderBit),
+			0,
+			0, nil,
+			0, nil,
+			1, []vk.ImageMemoryBarrier{toShaderRead},
+		)
+	})
+	return nil
+}
+
+func textureBarrier(img vk.Image, old vk.ImageLayout, new vk.ImageLayout) vk.ImageMemoryBarrier {
+	return vk.ImageMemoryBarrier{
+		SType:               vk.StructureTypeImageMemoryBarrier,
+		PNext:               nil,
+		OldLayout:           old,
+		NewLayout:           new,
+		SrcQueueFamilyIndex: vk.QueueFamilyIgnored,
+		DstQueueFamilyIndex: vk.QueueFamilyIgnored,
+		Image:               img,
+		SubresourceRange: vk.ImageSubresourceRange{
+			AspectMask:     vk.ImageAspectFlags(vk.ImageAspectColorBit),
+			BaseMipLevel:   0,
+			LevelCount:     1,
+			BaseArrayLayer: 0,
+			LayerCount:     1,
+		},
+	}
+}
+
+// recordStreamCopies records all copies streamed since the last frame, it must be called outside a render pass
+func (c *Core) recordStreamCopies(cmd vk.CommandBuffer) {
+	for _, record := range c.streamCopies {
+		record(cmd)
+	}
+	c.streamCopies = c.streamCopies[:0]
+}
+
+// updateDynamicMeshes streams the vertex and index ranges marked dirty on models in the scene (see: Model.MarkDirty)
+// and the changed instances of instanced models into their buffers. Models still waiting for their initial upload keep
+// their ranges until it is done, static models until they are packed into the mesh pools. Frames in flight keep
+// drawing the old contents, as the copies are ordered after them by streamToBuffer's barriers. A buffer too small for
+// the mesh is replaced by a larger one, see: growBuffer. Ranges exceeding what is left of MESH_STREAM_FRAME_SIZE are
+// streamed in parts, their rest stays dirty for the next frames. Indices of a model wait until its vertices are done,
+// so they do not point at vertices missing from the buffer.
+func (c *Core) updateDynamicMeshes() error {
+	vertexStage := vk.PipelineStageFlags(vk.PipelineStageVertexInputBit)
+	budget := vk.DeviceSize(MESH_STREAM_FRAME_SIZE)
+	for _, m := range c.models {
+		// Instanced models are always visited, removing the last instance changes the count without marking anything
+		if !(m.IsDirty() || m.IsInstanced()) || !c.isUploaded(m) {
+			continue
+		}
+		if m.Static {
+			if c.isPacked(m) {
+				if err := c.updateStaticMesh(m, &budget); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		n := c.streamableCount(budget, model.VERTEX_STRIDE)
+		vertices := m.TakeDirtyVertices(n)
+		if vertices.Count == n {
+			// The vertices may have been cut off, nothing else is streamed this frame
+			budget = 0
+		}
+		if !vertices.Empty() {
+			access := vk.AccessFlags(vk.AccessVertexAttributeReadBit)
+			buf, err := c.growBuffer(m.Name+" vertices", m.VertexBuffer, vertices.End()*model.VERTEX_STRIDE, vk.BufferUsageFlags(vk.BufferUsageVertexBufferBit), access)
+			if err != nil {
+				return fmt.Errorf("failed to grow vertex buffer of '%s': %w", m.Name, err)
+			}
+			m.VertexBuffer = buf
+			offset := vk.DeviceSize(vertices.First * model.VERTEX_STRIDE)
+			if err = c.streamToBuffer(buf, offset, m.GetVRangeBytes(vertices), vertexStage, access); err != nil {
+				return fmt.Errorf("failed to update vertices %v of '%s': %w", vertices, m.Name, err)
+			}
+			budget -= min(budget, vk.DeviceSize(vertices.Count*model.VERTEX_STRIDE))
+		}
+		indices := m.TakeDirtyIndices(c.streamableCount(budget, model.INDEX_STRIDE))
+		if !indices.Empty() {
+			access := vk.AccessFlags(vk.AccessIndexReadBit)
+			buf, err := c.growBuffer(m.Name+" indices", m.IndexBuffer, indices.End()*model.INDEX_STRIDE, vk.BufferUsageFlags(vk.BufferUsageIndexBufferBit), access)
+			if err != nil {
+				return fmt.Errorf("failed to grow index buffer of '%s': %w", m.Name, err)
+			}
+			m.IndexBuffer = buf
+			offset := vk.DeviceSize(indices.First * model.INDEX_STRIDE)
+			if err = c.streamToBuffer(buf, offset, m.GetIdxRangeBytes(indices), vertexStage, access); err != nil {
+				return fmt.Errorf("failed to update indices %v of '%s': %w", indices, m.Name, err)
+			}
+			budget -= min(budget, vk.DeviceSize(indices.Count*model.INDEX_STRIDE))
+		}
+		// Indices removed from the end of the mesh make the model dirty as well, so they stop being drawn here
+		m.IndicesUploaded(indices)
+		if m.IsInstanced() {
+			if err := c.updateInstances(m, &budget); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// streamableCount returns how many elements of stride bytes can be streamed within the budget left for meshes this
+// frame, they have to fit into the free part of the staging ring's region as well
+func (c *Core) streamableCount(budget vk.DeviceSize, stride int) int {
+	free := c.ring.Available(c.device.PdProps.Limits.OptimalBufferCopyOffsetAlignment)
+	return int(min(budget, free)) / stride
+}
+
+// growBuffer returns buf if it holds at least size bytes. Otherwise it creates a device local buffer of at least twice
+// the size, so meshes growing a bit every frame do not replace it every frame, and copies the old contents over on the
+// device. The old buffer is retired with the current frame, which is the last one reading it.
+func (c *Core) growBuffer(label string, buf *com.Buffer, size int, usage vk.BufferUsageFlags, access vk.AccessFlags) (*com.Buffer, error) {
+	if vk.DeviceSize(size) <= buf.Size {
+		return buf, nil
+	}
+	grown, err := c.allocator.CreateBuffer(
+		label,
+		max(vk.DeviceSize(size), 2*buf.Size),
+		vk.BufferUsageFlags(vk.BufferUsageTransferDstBit|vk.BufferUsageTransferSrcBit)|usage,
+		vk.MemoryPropertyFlags(vk.MemoryPropertyDeviceLocalBit),
+	)
+	if err != nil {
+		return nil, err
+	}
+	nameObject(c, vk.ObjectTypeBuffer, grown.Handle, label)
+	log.Printf("Growing buffer \"%s\" from %d to %d Byte", label, buf.Size, grown.Size)
+	old := buf
+	vertexStage := vk.PipelineStageFlags(vk.PipelineStageVertexInputBit)
+	transferStage := vk.PipelineStageFlags(vk.PipelineStageTransferBit)
+	c.streamCopies = append(c.streamCopies, func(cmd vk.CommandBuffer) {
+		// The old contents were streamed by an earlier frame or acquired from the transfer queue for the vertex input stage
+		before := bufferBarrier(old, 0, old.Size, vk.AccessFlags(vk.AccessTransferWriteBit), vk.AccessFlags(vk.AccessTransferReadBit))
+		vk.CmdPipelineBarrier(cmd, transferStage|vertexStage, transferStage, 0, 0, nil, 1, []vk.BufferMemoryBarrier{before}, 0, nil)
+		region := vk.BufferCopy{SrcOffset: 0, DstOffset: 0, Size: old.Size}
+		vk.CmdCopyBuffer(cmd, old.Handle, grown.Handle, 1, []vk.BufferCopy{region})
+		// Ranges streamed into the new buffer this frame overwrite parts of the copy, the draws read all of it
+		after := bufferBarrier(grown, 0, grown.Size, vk.AccessFlags(vk.AccessTransferWriteBit), vk.AccessFlags(vk.AccessTransferWriteBit)|access)
+		vk.CmdPipelineBarrier(cmd, transferStage, transferStage|vertexStage, 0, 0, nil, 1, []vk.BufferMemoryBarrier{after}, 0, nil)
+	})
+	c.retireWithFrame(func() {
+		com.DestroyBuffer(c.device, old)
+	})
+	return grown, nil
+}
@@ -0,0 +1,36 @@
+#version 450
+
+//ubos
+layout(set = 0, binding = 0) uniform UniformBufferObject {
+    mat4 view;
+    mat4 proj;
+} ubo;
+
+//per draw data of batched draws, the draw ID is passed as first instance
+struct DrawData {
+    mat4 model;
+    int modelType;
+};
+
+layout(std430, set = 0, binding = 2) readonly buffer DrawDataBuffer {
+    DrawData draws[];
+} batch;
+
+layout(location = 0) in vec3 inPosition;
+layout(location = 1) in vec3 inColor;
+layout(location = 2) in vec2 inTexColor;
+
+layout(location = 0) out vec3 fragColor;
+layout(location = 1) out vec2 fragTexColor;
+
+void main() {
+    DrawData draw = batch.draws[gl_InstanceIndex];
+    gl_Position = ubo.proj * ubo.view * draw.model * vec4(inPosition, 1.0);
+    fragColor = inColor;
+    vec2 tex = inTexColor;
+    if (draw.modelType == 0) {
+        tex = vec2(0.0, 0.0);
+    }
+
+    fragTexColor = tex;
+}
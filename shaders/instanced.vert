@@ -0,0 +1,35 @@
+#version 450
+
+//ubos
+layout(set = 0, binding = 0) uniform UniformBufferObject {
+    mat4 view;
+    mat4 proj;
+} ubo;
+
+//push constants
+layout( push_constant ) uniform constants {
+    mat4 model;
+    int modelType;
+} pc;
+
+layout(location = 0) in vec3 inPosition;
+layout(location = 1) in vec3 inColor;
+layout(location = 2) in vec2 inTexColor;
+
+//per instance, a mat4 takes up the locations 3 to 6
+layout(location = 3) in mat4 instTransform;
+layout(location = 7) in vec3 instColor;
+
+layout(location = 0) out vec3 fragColor;
+layout(location = 1) out vec2 fragTexColor;
+
+void main() {
+    gl_Position = ubo.proj * ubo.view * pc.model * instTransform * vec4(inPosition, 1.0);
+    fragColor = inColor * instColor;
+    vec2 tex = inTexColor;
+    if (pc.modelType == 0) {
+        tex = vec2(0.0, 0.0);
+    }
+
+    fragTexColor = tex;
+}
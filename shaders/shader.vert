@@ -6,14 +6,10 @@ layout(set = 0, binding = 0) uniform UniformBufferObject {
     mat4 proj;
 } ubo;
 
-layout(set = 1, binding = 0) uniform ModelUniformBufferObject {
-    int modelType;
-} ctx;
-
-
 //push constants
 layout( push_constant ) uniform constants {
     mat4 model;
+    int modelType;
 } pc;
 
 layout(location = 0) in vec3 inPosition;
@@ -27,7 +23,7 @@ void main() {
     gl_Position = ubo.proj * ubo.view * pc.model * vec4(inPosition, 1.0);
     fragColor = inColor;
     vec2 tex = inTexColor;
-    if (ctx.modelType == 0) {
+    if (pc.modelType == 0) {
         //gl_Position = vec4(inPosition, 1.0);
         tex = vec2(0.0, 0.0);
     }
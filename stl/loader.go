@@ -3,35 +3,61 @@ package stl
 import (
 	"GPU_fluid_simulation/model"
 	"encoding/binary"
+	"fmt"
 	"local/vector_math"
 	"log"
 	"math"
 	"os"
 )
 
+// STL_HEADER_SIZE is the size of the binary STL header: 80 bytes of free text followed by the triangle count
+const STL_HEADER_SIZE = 84
+
+// STL_TRIANGLE_SIZE is the size of a single triangle record: normal, three vertices and a 2 byte attribute
+const STL_TRIANGLE_SIZE = 50
+
+// ReadStlFile reads a binary STL file, stopping the program if it can not be read. See: ReadStl.
 func ReadStlFile(path string) *model.Mesh {
+	mesh, err := ReadStl(path, nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return mesh
+}
+
+// ReadStl reads a binary STL file into a mesh. If progress is set, it is called with the fraction of triangles
+// converted so far while doing so, this is meant for loading on a background goroutine.
+func ReadStl(path string, progress func(float64)) (*model.Mesh, error) {
 	log.Printf("Reading stl file %s", path)
 	b, err := os.ReadFile(path)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
+	}
+	if len(b) < STL_HEADER_SIZE {
+		return nil, fmt.Errorf("stl file %s is too short for the header: %d Byte", path, len(b))
 	}
 	header := b[:80]
-	tCntBits := binary.LittleEndian.Uint32(b[80:84])
-	byteCnt := len(b[84:]) / 1024
+	tCntBits := binary.LittleEndian.Uint32(b[80:STL_HEADER_SIZE])
+	if want := int(tCntBits) * STL_TRIANGLE_SIZE; len(b[STL_HEADER_SIZE:]) < want {
+		return nil, fmt.Errorf("stl file %s is truncated: %d triangles need %d Byte, got %d", path, tCntBits, want, len(b[STL_HEADER_SIZE:]))
+	}
+	byteCnt := len(b[STL_HEADER_SIZE:]) / 1024
 	log.Printf("Successfully read stl file, Header: '%s', Triangle Count: %d, Triangle memory size: %d KiB", header, tCntBits, byteCnt)
-	// log.Printf("Mesh: %v", toMesh(b[84:], tCntBits))
-	return toMesh(b[84:], tCntBits)
+	return toMesh(b[STL_HEADER_SIZE:], tCntBits, progress), nil
 }
 
-func toMesh(bytes []byte, triangleCnt uint32) *model.Mesh {
-	stride := 50
+// STL_PROGRESS_STEP is the number of triangles converted between two progress reports
+const STL_PROGRESS_STEP = 4096
+
+func toMesh(bytes []byte, triangleCnt uint32, progress func(float64)) *model.Mesh {
+	stride := STL_TRIANGLE_SIZE
 	v := make([]model.Vertex, triangleCnt*3)
 	vi := 0
 
 	id := make([]uint32, triangleCnt*3)
 	idxi := uint32(0)
 
-	for i := 0; i < len(bytes); i += stride {
+	for i := 0; i < int(triangleCnt)*stride; i += stride {
 		normal := toVec3(bytes[i : i+12])
 		v1 := toVec3(bytes[i+12 : i+24])
 		v[vi] = model.Vertex{
@@ -62,6 +88,9 @@ func toMesh(bytes []byte, triangleCnt uint32) *model.Mesh {
 
 		// attr := bytes[i+48 : i+50]
 		// log.Printf("normal: %v, v1: %v, v2: %v, v3: %v, attr: %v", normal, v1, v2, v3, attr)
+		if t := i / stride; progress != nil && t%STL_PROGRESS_STEP == 0 {
+			progress(float64(t) / float64(triangleCnt))
+		}
 	}
 
 	return model.NewMesh(v, id)
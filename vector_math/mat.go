@@ -60,6 +60,27 @@ func (m *Mat) Sub(b *Mat) (Mat, error) {
 	return C, nil
 }
 
+// Lerp interpolates each element linearly between m (t = 0) and b (t = 1). For transformation matrices this is only
+// a good approximation if both are close to each other, e.g.: consecutive steps of a movement.
+func (m *Mat) Lerp(b *Mat, t float32) (Mat, error) {
+	rowsA, colsA := (*m).Size()
+	rowsB, colsB := (*b).Size()
+	if rowsA != rowsB || colsA != colsB {
+		msg := fmt.Sprintf(
+			"can't interpolate %dx%d matrix with %dx%d matrix, matracies not of equal size",
+			rowsA, colsA, rowsB, colsB,
+		)
+		return nil, errors.New(msg)
+	}
+	C, _ := NewMat(uint(rowsA), uint(colsA))
+	for i := 0; i < rowsA; i++ {
+		for j := 0; j < colsA; j++ {
+			C[i][j] = (*m)[i][j] + ((*b)[i][j]-(*m)[i][j])*t
+		}
+	}
+	return C, nil
+}
+
 func (m *Mat) Mult(b *Mat) (Mat, error) {
 	rowsA, colsA := (*m).Size()
 	rowsB, colsB := (*b).Size()
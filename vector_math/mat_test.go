@@ -143,3 +143,23 @@ func TestTranspose(t *testing.T) {
 	t.Logf("%s", m.Describe())
 	t.Logf("%s", mT.Describe())
 }
+
+func TestLerp(t *testing.T) {
+	a := NewUnitMat(4)
+	b := NewTranslation(Vec3{X: 2, Y: -4})
+	half, err := a.Lerp(&b, 0.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := NewTranslation(Vec3{X: 1, Y: -2})
+	if !half.Equals(&expected) {
+		t.Fatalf("expected halfway translation:\n%s\ngot:\n%s", expected.Describe(), half.Describe())
+	}
+	if end, _ := a.Lerp(&b, 1); !end.Equals(&b) {
+		t.Fatalf("expected t = 1 to return the second matrix")
+	}
+	c, _ := NewMat(3, 3)
+	if _, err = a.Lerp(&c, 0.5); err == nil {
+		t.Fatalf("expected matrices of different size to be rejected")
+	}
+}
@@ -56,3 +56,26 @@ func (v Vec3) Norm() Vec3 {
 		Z: v.Z / l,
 	}
 }
+
+// Min returns the component-wise minimum of v and w
+func (v Vec3) Min(w Vec3) Vec3 {
+	return Vec3{
+		X: float32(math.Min(float64(v.X), float64(w.X))),
+		Y: float32(math.Min(float64(v.Y), float64(w.Y))),
+		Z: float32(math.Min(float64(v.Z), float64(w.Z))),
+	}
+}
+
+// Max returns the component-wise maximum of v and w
+func (v Vec3) Max(w Vec3) Vec3 {
+	return Vec3{
+		X: float32(math.Max(float64(v.X), float64(w.X))),
+		Y: float32(math.Max(float64(v.Y), float64(w.Y))),
+		Z: float32(math.Max(float64(v.Z), float64(w.Z))),
+	}
+}
+
+// Lerp linearly interpolates between v (t = 0) and w (t = 1)
+func (v Vec3) Lerp(w Vec3, t float32) Vec3 {
+	return v.Add(w.Sub(v).ScalarMul(t))
+}